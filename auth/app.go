@@ -2,15 +2,22 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/gbrlsnchs/jwt/v3"
 	"golang.org/x/xerrors"
 
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
 
 	"github.com/ipfs-force-community/sophon-auth/config"
 	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/log"
 )
 
 // DefaultAdminToken is the default admin token which is for local client user
@@ -18,14 +25,27 @@ const DefaultAdminTokenName = "defaultLocalToken"
 
 type OAuthApp interface {
 	verify(token string) (*JWTPayload, error)
-	GetDefaultAdminToken() (string, error)
+	GetDefaultAdminToken(saved string) (string, error)
+	StartTokenGC(ctx context.Context, cnf *config.TokenGCConfig)
+	StartRateLimitFlush(ctx context.Context, cnf *config.RateLimitConfig)
 
 	Verify(c *gin.Context)
 	GenerateToken(c *gin.Context)
+	RefreshToken(c *gin.Context)
 	RemoveToken(c *gin.Context)
 	RecoverToken(c *gin.Context)
 	Tokens(c *gin.Context)
 	GetToken(c *gin.Context)
+	GCTokens(c *gin.Context)
+	JWKS(c *gin.Context)
+	ListSigningKeys(c *gin.Context)
+	RotateSigningKey(c *gin.Context)
+	RetireSigningKey(c *gin.Context)
+	SubscribeChanges(c *gin.Context)
+	ListAuditLogs(c *gin.Context)
+	GetAuditChainHead(c *gin.Context)
+	VerifyAuditChain(c *gin.Context)
+	Backup(c *gin.Context)
 
 	CreateUser(c *gin.Context)
 	GetUser(c *gin.Context)
@@ -36,10 +56,24 @@ type OAuthApp interface {
 	DeleteUser(c *gin.Context)
 	RecoverUser(c *gin.Context)
 
+	CreateRole(c *gin.Context)
+	UpdateRole(c *gin.Context)
+	GetRole(c *gin.Context)
+	ListRoles(c *gin.Context)
+	DeleteRole(c *gin.Context)
+
 	AddUserRateLimit(c *gin.Context)
 	UpsertUserRateLimit(c *gin.Context)
 	GetUserRateLimit(c *gin.Context)
+	GetEffectiveRateLimit(c *gin.Context)
 	DelUserRateLimit(c *gin.Context)
+	ConsumeRateLimit(c *gin.Context)
+	GetQuotaUsage(c *gin.Context)
+
+	UpsertRateLimitTier(c *gin.Context)
+	GetRateLimitTier(c *gin.Context)
+	ListRateLimitTiers(c *gin.Context)
+	DelRateLimitTier(c *gin.Context)
 
 	UpsertMiner(c *gin.Context)
 	HasMiner(c *gin.Context)
@@ -61,8 +95,8 @@ type oauthApp struct {
 	srv OAuthService
 }
 
-func NewOAuthApp(dbPath string, cnf *config.DBConfig) (OAuthApp, error) {
-	srv, err := NewOAuthService(dbPath, cnf)
+func NewOAuthApp(dbPath string, cnf *config.DBConfig, opts ...ServiceOption) (OAuthApp, error) {
+	srv, err := NewOAuthService(dbPath, cnf, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -93,22 +127,36 @@ func (o *oauthApp) verify(token string) (*JWTPayload, error) {
 	return o.srv.Verify(core.CtxWithPerm(context.Background(), core.PermRead), token)
 }
 
-func (o *oauthApp) GetDefaultAdminToken() (string, error) {
+// GetDefaultAdminToken returns the admin token of `DefaultAdminTokenName`, `saved` is the one returned
+// last time, which is returned again if it's still valid, as tokens stored by hash can't be read back.
+func (o *oauthApp) GetDefaultAdminToken(saved string) (string, error) {
 	adminCtx := core.CtxWithPerm(context.Background(), core.PermAdmin)
+	if len(saved) != 0 {
+		pl, err := o.srv.Verify(adminCtx, saved)
+		if err == nil && pl.Name == DefaultAdminTokenName && pl.Perm == core.PermAdmin {
+			return saved, nil
+		}
+	}
 	// if not found, create one
 	token, err := o.srv.GetTokenByName(adminCtx, DefaultAdminTokenName)
 	if err != nil {
 		return "", err
 	}
 	for _, t := range token {
-		if t.Perm == core.PermAdmin {
+		if t.Perm == core.PermAdmin && len(t.Token) != 0 {
 			return t.Token, nil
 		}
 	}
 	// create one
-	_, err = o.srv.CreateUser(adminCtx, &CreateUserRequest{Name: DefaultAdminTokenName})
+	has, err := o.srv.HasUser(adminCtx, &HasUserRequest{Name: DefaultAdminTokenName})
 	if err != nil {
-		return "", fmt.Errorf("create default user for admin token: %w", err)
+		return "", err
+	}
+	if !has {
+		_, err = o.srv.CreateUser(adminCtx, &CreateUserRequest{Name: DefaultAdminTokenName})
+		if err != nil {
+			return "", fmt.Errorf("create default user for admin token: %w", err)
+		}
 	}
 	ret, err := o.srv.GenerateToken(adminCtx, &JWTPayload{
 		Name: DefaultAdminTokenName,
@@ -129,9 +177,9 @@ func (o *oauthApp) Verify(c *gin.Context) {
 	}
 	res, err := o.srv.Verify(c, req.Token)
 	if err != nil {
-		if err == ErrorNonRegisteredToken || err == ErrorVerificationFailed {
+		if reason := VerifyFailedReasonOf(err); len(reason) != 0 {
 			c.Error(err) // nolint
-			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			c.JSON(http.StatusUnauthorized, VerifyFailedResponse{Error: err.Error(), Reason: reason})
 			return
 		}
 		BadResponse(c, err)
@@ -141,17 +189,82 @@ func (o *oauthApp) Verify(c *gin.Context) {
 	SuccessResponse(c, res)
 }
 
+var verifyFailedReasons = []struct {
+	err    error
+	reason VerifyFailedReason
+}{
+	{ErrorNonRegisteredToken, ReasonTokenNotRegistered},
+	{ErrorVerificationFailed, ReasonVerificationFailed},
+	{ErrorTokenExpired, ReasonTokenExpired},
+	{ErrorTokenNotValidYet, ReasonTokenNotValidYet},
+	{ErrorUserDisabled, ReasonUserDisabled},
+	{ErrorUserDeleted, ReasonUserDeleted},
+	{ErrorRoleNotFound, ReasonRoleNotFound},
+	{ErrorInvalidRefreshToken, ReasonRefreshTokenInvalid},
+	{ErrorRefreshTokenReused, ReasonRefreshTokenReused},
+}
+
+// VerifyFailedReasonOf returns the reason of an unauthorized error, empty if err isn't one
+func VerifyFailedReasonOf(err error) VerifyFailedReason {
+	for _, r := range verifyFailedReasons {
+		if errors.Is(err, r.err) {
+			return r.reason
+		}
+	}
+	return ""
+}
+
+// Err returns the error of reason, nil if reason is unknown
+func (r VerifyFailedReason) Err() error {
+	for _, fr := range verifyFailedReasons {
+		if fr.reason == r {
+			return fr.err
+		}
+	}
+	return nil
+}
+
 func (o *oauthApp) GenerateToken(c *gin.Context) {
 	req := new(GenTokenRequest)
 	if err := c.ShouldBind(req); err != nil {
 		BadResponse(c, err)
 		return
 	}
-	res, err := o.srv.GenerateToken(c, &JWTPayload{
-		Name:  req.Name,
-		Perm:  req.Perm,
-		Extra: req.Extra,
-	})
+	if req.TTL < 0 || req.NotBefore < 0 || req.RefreshTTL < 0 {
+		BadResponse(c, xerrors.Errorf("`ttl`, `nbf` and `refreshTTL` must not be negative"))
+		return
+	}
+	if req.Refresh && req.TTL == 0 {
+		BadResponse(c, xerrors.Errorf("`ttl` is required to generate a refresh token"))
+		return
+	}
+	pl := &JWTPayload{
+		Name:   req.Name,
+		Perm:   req.Perm,
+		Extra:  req.Extra,
+		Scopes: req.Scopes,
+		Role:   req.Role,
+	}
+	if req.TTL > 0 || req.NotBefore > 0 {
+		now := time.Now()
+		pl.IssuedAt = jwt.NumericDate(now)
+		if req.TTL > 0 {
+			pl.ExpirationTime = jwt.NumericDate(now.Add(req.TTL))
+		}
+		if req.NotBefore > 0 {
+			pl.NotBefore = jwt.NumericDate(time.Unix(req.NotBefore, 0))
+		}
+	}
+	if req.Refresh {
+		res, err := o.srv.GenerateTokenPair(c, pl, req.RefreshTTL)
+		if err != nil {
+			BadResponse(c, err)
+			return
+		}
+		SuccessResponse(c, res)
+		return
+	}
+	res, err := o.srv.GenerateToken(c, pl)
 	if err != nil {
 		BadResponse(c, err)
 		return
@@ -162,6 +275,25 @@ func (o *oauthApp) GenerateToken(c *gin.Context) {
 	SuccessResponse(c, output)
 }
 
+func (o *oauthApp) RefreshToken(c *gin.Context) {
+	req := new(RefreshTokenRequest)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, err)
+		return
+	}
+	res, err := o.srv.RefreshToken(c, req.RefreshToken)
+	if err != nil {
+		if reason := VerifyFailedReasonOf(err); len(reason) != 0 {
+			c.Error(err) // nolint
+			c.JSON(http.StatusUnauthorized, VerifyFailedResponse{Error: err.Error(), Reason: reason})
+			return
+		}
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
 func (o *oauthApp) RemoveToken(c *gin.Context) {
 	req := new(RemoveTokenRequest)
 	if err := c.ShouldBind(req); err != nil {
@@ -226,6 +358,209 @@ func (o *oauthApp) Tokens(c *gin.Context) {
 	SuccessResponse(c, res)
 }
 
+func (o *oauthApp) GCTokens(c *gin.Context) {
+	req := new(GCTokensRequest)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, err)
+		return
+	}
+	res, err := o.srv.GCTokens(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) JWKS(c *gin.Context) {
+	res, err := o.srv.JWKS(c)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) ListSigningKeys(c *gin.Context) {
+	res, err := o.srv.ListSigningKeys(c)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) RotateSigningKey(c *gin.Context) {
+	req := new(RotateSigningKeyRequest)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, err)
+		return
+	}
+	res, err := o.srv.RotateSigningKey(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) RetireSigningKey(c *gin.Context) {
+	req := new(RetireSigningKeyRequest)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, err)
+		return
+	}
+	err := o.srv.RetireSigningKey(c, req)
+	Response(c, err)
+}
+
+// changeHeartbeatInterval keeps idle change streams alive through proxies
+const changeHeartbeatInterval = 15 * time.Second
+
+func (o *oauthApp) SubscribeChanges(c *gin.Context) {
+	ch, err := o.srv.SubscribeChanges(c, c.GetHeader(LastEventIDHeader))
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(changeHeartbeatInterval)
+	defer heartbeat.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return false
+			}
+			c.Render(-1, sse.Event{Id: ev.ID(), Event: string(ev.Type), Data: ev})
+			return true
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ":ping\n\n")
+			return err == nil
+		}
+	})
+}
+
+func (o *oauthApp) ListAuditLogs(c *gin.Context) {
+	req := new(ListAuditLogsRequest)
+	if err := c.ShouldBindQuery(req); err != nil {
+		BadResponse(c, err)
+		return
+	}
+	res, err := o.srv.ListAuditLogs(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) GetAuditChainHead(c *gin.Context) {
+	res, err := o.srv.GetAuditChainHead(c)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) VerifyAuditChain(c *gin.Context) {
+	res, err := o.srv.VerifyAuditChain(c)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) Backup(c *gin.Context) {
+	req := new(BackupRequest)
+	if err := c.ShouldBindQuery(req); err != nil {
+		BadResponse(c, err)
+		return
+	}
+	w := &backupWriter{c: c}
+	since, err := o.srv.Backup(c, w, req.Since)
+	if err != nil {
+		if !w.written {
+			BadResponse(c, err)
+			return
+		}
+		// the client finds the backup incomplete without the trailer
+		log.Errorf("write backup: %s", err)
+		_ = c.Error(err)
+		return
+	}
+	if !w.written {
+		w.writeHeader(false)
+	}
+	c.Header(BackupSinceTrailer, strconv.FormatUint(since, 10))
+	c.Writer.WriteHeaderNow()
+}
+
+func (o *oauthApp) CreateRole(c *gin.Context) {
+	req := new(CreateRoleRequest)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, err)
+		return
+	}
+	res, err := o.srv.CreateRole(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) UpdateRole(c *gin.Context) {
+	req := new(UpdateRoleRequest)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, err)
+		return
+	}
+	err := o.srv.UpdateRole(c, req)
+	Response(c, err)
+}
+
+func (o *oauthApp) GetRole(c *gin.Context) {
+	req := new(GetRoleRequest)
+	if err := c.ShouldBindQuery(req); err != nil {
+		BadResponse(c, err)
+		return
+	}
+	res, err := o.srv.GetRole(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) ListRoles(c *gin.Context) {
+	res, err := o.srv.ListRoles(c)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) DeleteRole(c *gin.Context) {
+	req := new(DeleteRoleRequest)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, err)
+		return
+	}
+	err := o.srv.DeleteRole(c, req)
+	Response(c, err)
+}
+
 func (o *oauthApp) CreateUser(c *gin.Context) {
 	req := new(CreateUserRequest)
 	if err := c.ShouldBind(req); err != nil {
@@ -384,6 +719,98 @@ func (o *oauthApp) GetUserRateLimit(c *gin.Context) {
 	SuccessResponse(c, res)
 }
 
+func (o *oauthApp) GetEffectiveRateLimit(c *gin.Context) {
+	req := new(GetEffectiveRateLimitReq)
+	if err := c.ShouldBindQuery(req); err != nil {
+		BadResponse(c, err)
+		return
+	}
+
+	res, err := o.srv.GetEffectiveRateLimit(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) ConsumeRateLimit(c *gin.Context) {
+	req := new(ConsumeRateLimitReq)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, err)
+		return
+	}
+
+	res, err := o.srv.ConsumeRateLimit(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) GetQuotaUsage(c *gin.Context) {
+	req := new(GetQuotaUsageReq)
+	if err := c.ShouldBindQuery(req); err != nil {
+		BadResponse(c, err)
+		return
+	}
+
+	res, err := o.srv.GetQuotaUsage(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) UpsertRateLimitTier(c *gin.Context) {
+	req := new(UpsertRateLimitTierReq)
+	if err := c.ShouldBindJSON(req); err != nil {
+		BadResponse(c, err)
+		return
+	}
+	res, err := o.srv.UpsertRateLimitTier(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) GetRateLimitTier(c *gin.Context) {
+	req := new(GetRateLimitTierReq)
+	if err := c.ShouldBindQuery(req); err != nil {
+		BadResponse(c, err)
+		return
+	}
+	res, err := o.srv.GetRateLimitTier(c, req)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) ListRateLimitTiers(c *gin.Context) {
+	res, err := o.srv.ListRateLimitTiers(c)
+	if err != nil {
+		BadResponse(c, err)
+		return
+	}
+	SuccessResponse(c, res)
+}
+
+func (o *oauthApp) DelRateLimitTier(c *gin.Context) {
+	req := new(DelRateLimitTierReq)
+	if err := c.ShouldBind(req); err != nil {
+		BadResponse(c, err)
+		return
+	}
+	err := o.srv.DelRateLimitTier(c, req)
+	Response(c, err)
+}
+
 func (o *oauthApp) DelUserRateLimit(c *gin.Context) {
 	req := new(DelUserRateLimitReq)
 	if err := c.ShouldBind(req); err != nil {
@@ -0,0 +1,378 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/log"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+// actions of audit logs
+const (
+	AuditTokenGenerate       = "token.generate"
+	AuditTokenRefresh        = "token.refresh"
+	AuditTokenRemove         = "token.remove"
+	AuditTokenRecover        = "token.recover"
+	AuditTokenGC             = "token.gc"
+	AuditKeyRotate           = "key.rotate"
+	AuditKeyRetire           = "key.retire"
+	AuditUserCreate          = "user.create"
+	AuditUserUpdate          = "user.update"
+	AuditUserDelete          = "user.delete"
+	AuditUserRecover         = "user.recover"
+	AuditRateLimitUpsert     = "ratelimit.upsert"
+	AuditRateLimitDelete     = "ratelimit.delete"
+	AuditMinerUpsert         = "miner.upsert"
+	AuditMinerDelete         = "miner.delete"
+	AuditSignerRegister      = "signer.register"
+	AuditSignerUnregister    = "signer.unregister"
+	AuditSignerDelete        = "signer.delete"
+	AuditRoleCreate          = "role.create"
+	AuditRoleUpdate          = "role.update"
+	AuditRoleDelete          = "role.delete"
+	AuditRateLimitTierUpsert = "ratelimit.tier.upsert"
+	AuditRateLimitTierDelete = "ratelimit.tier.delete"
+)
+
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// auditVerifyBatch is the number of audit logs loaded at a time when verifying the chain
+const auditVerifyBatch = 1000
+
+// auditService records every mutating call of the wrapped service to store, other calls are passed through.
+// Audit logs are chained up by hash, so they are appended one by one, instances sharing a store fork the chain.
+type auditService struct {
+	OAuthService
+	store storage.Store
+
+	lk sync.Mutex
+}
+
+var _ OAuthService = (*auditService)(nil)
+
+func newAuditService(srv OAuthService, store storage.Store) *auditService {
+	return &auditService{OAuthService: srv, store: store}
+}
+
+// record never fails the audited call, errors are logged only
+func (a *auditService) record(ctx context.Context, action, target string, err error) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+
+	actor, _ := core.CtxGetName(ctx)
+	entry := &storage.AuditLog{
+		Id:     uuid.NewString(),
+		Time:   time.Now().Truncate(time.Microsecond),
+		Actor:  actor,
+		Action: action,
+		Target: target,
+		IP:     requestIP(ctx),
+		Result: AuditSuccess,
+	}
+	if err != nil {
+		entry.Result = AuditFailure
+		entry.Error = err.Error()
+	}
+	prev, err := a.store.LastAuditLog()
+	if err != nil && !errors.Is(err, storage.ErrAuditLogNotFound) {
+		log.Errorf("record audit log %s of %s failed: get last audit log: %v", action, target, err)
+		return
+	}
+	if prev != nil {
+		entry.PrevHash = prev.Hash
+		// keep audit logs in the order of the chain even if the clock goes backwards
+		if !entry.Time.After(prev.Time) {
+			entry.Time = prev.Time.Add(time.Microsecond)
+		}
+	}
+	entry.Truncate()
+	entry.Hash = entry.ComputeHash()
+	if err := a.store.PutAuditLog(entry); err != nil {
+		log.Errorf("record audit log %s of %s failed: %v", action, target, err)
+	}
+}
+
+func requestIP(ctx context.Context) string {
+	if c, ok := ctx.(*gin.Context); ok {
+		return c.ClientIP()
+	}
+	return ""
+}
+
+// tokenTarget identifies a token in audit logs without leaking it
+func tokenTarget(token string) string {
+	return "token:" + storage.TokenFingerprint(token)
+}
+
+func addrsTarget(user string, addrs []address.Address) string {
+	strs := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		strs = append(strs, addr.String())
+	}
+	return fmt.Sprintf("%s:%s", user, strings.Join(strs, ","))
+}
+
+// userTarget is user with the rate limit tier it's moved to, an empty tier means leaving its tier
+func userTarget(user string, tier *string) string {
+	if tier == nil {
+		return user
+	}
+	return fmt.Sprintf("%s:tier=%s", user, *tier)
+}
+
+func (a *auditService) GenerateToken(ctx context.Context, pl *JWTPayload) (string, error) {
+	token, err := a.OAuthService.GenerateToken(ctx, pl)
+	a.record(ctx, AuditTokenGenerate, pl.Name, err)
+	return token, err
+}
+
+func (a *auditService) GenerateTokenPair(ctx context.Context, pl *JWTPayload, refreshTTL time.Duration) (*GenTokenResponse, error) {
+	res, err := a.OAuthService.GenerateTokenPair(ctx, pl, refreshTTL)
+	a.record(ctx, AuditTokenGenerate, pl.Name, err)
+	return res, err
+}
+
+func (a *auditService) RefreshToken(ctx context.Context, refreshToken string) (*GenTokenResponse, error) {
+	res, err := a.OAuthService.RefreshToken(ctx, refreshToken)
+	a.record(ctx, AuditTokenRefresh, tokenTarget(refreshToken), err)
+	return res, err
+}
+
+func (a *auditService) RemoveToken(ctx context.Context, token string) error {
+	err := a.OAuthService.RemoveToken(ctx, token)
+	a.record(ctx, AuditTokenRemove, tokenTarget(token), err)
+	return err
+}
+
+func (a *auditService) RecoverToken(ctx context.Context, token string) error {
+	err := a.OAuthService.RecoverToken(ctx, token)
+	a.record(ctx, AuditTokenRecover, tokenTarget(token), err)
+	return err
+}
+
+func (a *auditService) GCTokens(ctx context.Context, req *GCTokensRequest) (*GCTokensResponse, error) {
+	res, err := a.OAuthService.GCTokens(ctx, req)
+	// gc runs periodically, skip the rounds purging nothing
+	if err != nil {
+		a.record(ctx, AuditTokenGC, "", err)
+	} else if !req.DryRun && res.Count > 0 {
+		a.record(ctx, AuditTokenGC, fmt.Sprintf("%d tokens", res.Count), nil)
+	}
+	return res, err
+}
+
+func (a *auditService) RotateSigningKey(ctx context.Context, req *RotateSigningKeyRequest) (*SigningKeyInfo, error) {
+	res, err := a.OAuthService.RotateSigningKey(ctx, req)
+	target := ""
+	if res != nil {
+		target = res.Kid
+	}
+	a.record(ctx, AuditKeyRotate, target, err)
+	return res, err
+}
+
+func (a *auditService) RetireSigningKey(ctx context.Context, req *RetireSigningKeyRequest) error {
+	err := a.OAuthService.RetireSigningKey(ctx, req)
+	a.record(ctx, AuditKeyRetire, req.Kid, err)
+	return err
+}
+
+func (a *auditService) CreateUser(ctx context.Context, req *CreateUserRequest) (*CreateUserResponse, error) {
+	res, err := a.OAuthService.CreateUser(ctx, req)
+	a.record(ctx, AuditUserCreate, userTarget(req.Name, req.RateLimitTier), err)
+	return res, err
+}
+
+func (a *auditService) UpdateUser(ctx context.Context, req *UpdateUserRequest) error {
+	err := a.OAuthService.UpdateUser(ctx, req)
+	a.record(ctx, AuditUserUpdate, userTarget(req.Name, req.RateLimitTier), err)
+	return err
+}
+
+func (a *auditService) DeleteUser(ctx context.Context, req *DeleteUserRequest) error {
+	err := a.OAuthService.DeleteUser(ctx, req)
+	a.record(ctx, AuditUserDelete, req.Name, err)
+	return err
+}
+
+func (a *auditService) RecoverUser(ctx context.Context, req *RecoverUserRequest) error {
+	err := a.OAuthService.RecoverUser(ctx, req)
+	a.record(ctx, AuditUserRecover, req.Name, err)
+	return err
+}
+
+func (a *auditService) UpsertUserRateLimit(ctx context.Context, req *UpsertUserRateLimitReq) (string, error) {
+	id, err := a.OAuthService.UpsertUserRateLimit(ctx, req)
+	a.record(ctx, AuditRateLimitUpsert, req.Name, err)
+	return id, err
+}
+
+func (a *auditService) DelUserRateLimit(ctx context.Context, req *DelUserRateLimitReq) error {
+	err := a.OAuthService.DelUserRateLimit(ctx, req)
+	a.record(ctx, AuditRateLimitDelete, fmt.Sprintf("%s:%s", req.Name, req.Id), err)
+	return err
+}
+
+func (a *auditService) UpsertRateLimitTier(ctx context.Context, req *UpsertRateLimitTierReq) (*RateLimitTierInfo, error) {
+	res, err := a.OAuthService.UpsertRateLimitTier(ctx, req)
+	a.record(ctx, AuditRateLimitTierUpsert, req.Name, err)
+	return res, err
+}
+
+func (a *auditService) DelRateLimitTier(ctx context.Context, req *DelRateLimitTierReq) error {
+	err := a.OAuthService.DelRateLimitTier(ctx, req)
+	a.record(ctx, AuditRateLimitTierDelete, req.Name, err)
+	return err
+}
+
+func (a *auditService) UpsertMiner(ctx context.Context, req *UpsertMinerReq) (bool, error) {
+	created, err := a.OAuthService.UpsertMiner(ctx, req)
+	a.record(ctx, AuditMinerUpsert, addrsTarget(req.User, []address.Address{req.Miner}), err)
+	return created, err
+}
+
+func (a *auditService) DelMiner(ctx context.Context, req *DelMinerReq) (bool, error) {
+	deleted, err := a.OAuthService.DelMiner(ctx, req)
+	a.record(ctx, AuditMinerDelete, req.Miner.String(), err)
+	return deleted, err
+}
+
+func (a *auditService) RegisterSigners(ctx context.Context, req *RegisterSignersReq) error {
+	err := a.OAuthService.RegisterSigners(ctx, req)
+	a.record(ctx, AuditSignerRegister, addrsTarget(req.User, req.Signers), err)
+	return err
+}
+
+func (a *auditService) UnregisterSigners(ctx context.Context, req *UnregisterSignersReq) error {
+	err := a.OAuthService.UnregisterSigners(ctx, req)
+	a.record(ctx, AuditSignerUnregister, addrsTarget(req.User, req.Signers), err)
+	return err
+}
+
+func (a *auditService) DelSigner(ctx context.Context, req *DelSignerReq) (bool, error) {
+	deleted, err := a.OAuthService.DelSigner(ctx, req)
+	a.record(ctx, AuditSignerDelete, req.Signer.String(), err)
+	return deleted, err
+}
+
+func (a *auditService) CreateRole(ctx context.Context, req *CreateRoleRequest) (*RoleInfo, error) {
+	res, err := a.OAuthService.CreateRole(ctx, req)
+	a.record(ctx, AuditRoleCreate, req.Name, err)
+	return res, err
+}
+
+func (a *auditService) UpdateRole(ctx context.Context, req *UpdateRoleRequest) error {
+	err := a.OAuthService.UpdateRole(ctx, req)
+	a.record(ctx, AuditRoleUpdate, req.Name, err)
+	return err
+}
+
+func (a *auditService) DeleteRole(ctx context.Context, req *DeleteRoleRequest) error {
+	err := a.OAuthService.DeleteRole(ctx, req)
+	a.record(ctx, AuditRoleDelete, req.Name, err)
+	return err
+}
+
+func (o *jwtOAuth) ListAuditLogs(ctx context.Context, req *ListAuditLogsRequest) (ListAuditLogsResponse, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	filter := &storage.AuditLogFilter{
+		Actor:  req.Actor,
+		Action: req.Action,
+		Skip:   req.GetSkip(),
+		Limit:  req.GetLimit(),
+	}
+	if req.Start > 0 {
+		filter.Start = time.Unix(req.Start, 0)
+	}
+	if req.End > 0 {
+		filter.End = time.Unix(req.End, 0)
+	}
+	return o.store.ListAuditLogs(filter)
+}
+
+func (o *jwtOAuth) GetAuditChainHead(ctx context.Context) (*AuditChainHead, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	head, err := o.store.LastAuditLog()
+	if err != nil {
+		if errors.Is(err, storage.ErrAuditLogNotFound) {
+			return &AuditChainHead{}, nil
+		}
+		return nil, err
+	}
+	return &AuditChainHead{Id: head.Id, Time: head.Time, Hash: head.Hash}, nil
+}
+
+// VerifyAuditChain walks through all audit logs and reports the first one breaking the chain,
+// leading audit logs recorded before the chain was introduced are skipped.
+func (o *jwtOAuth) VerifyAuditChain(ctx context.Context) (*VerifyAuditChainResponse, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	res := &VerifyAuditChainResponse{}
+	started := false
+	var prev *storage.AuditLog
+	for {
+		logs, err := o.store.ListAuditLogs(&storage.AuditLogFilter{Skip: res.Checked, Limit: auditVerifyBatch})
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range logs {
+			res.Checked++
+			unchained := len(l.Hash) == 0 && len(l.PrevHash) == 0
+			// audit logs recorded before chaining lead the chain, an unchained one after is a break
+			if !started && unchained {
+				res.Unchained++
+				continue
+			}
+			started = true
+
+			prevHash := ""
+			if prev != nil {
+				prevHash = prev.Hash
+			}
+			if unchained {
+				res.Broken, res.Reason = l, "audit log is not chained, its hashes are removed"
+			} else if l.PrevHash != prevHash {
+				res.Broken, res.Reason = l, "previous hash mismatch, audit logs before it are deleted or inserted"
+			} else if l.Hash != l.ComputeHash() {
+				res.Broken, res.Reason = l, "hash mismatch, the audit log is modified"
+			}
+			if res.Broken != nil {
+				res.Checked--
+				return res, nil
+			}
+			prev = l
+			res.Head = &AuditChainHead{Id: l.Id, Time: l.Time, Hash: l.Hash}
+		}
+		if len(logs) < auditVerifyBatch {
+			if !started && res.Checked > 0 {
+				res.NoChain = true
+				res.Reason = "no chained audit logs, the hashes of all audit logs may have been removed"
+			}
+			return res, nil
+		}
+	}
+}
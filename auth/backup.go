@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+// BackupPath streams a backup of the badger store, which could be loaded by `sophon-auth restore`
+const BackupPath = "/admin/backup"
+
+// BackupSinceTrailer is the `since` of the next incremental backup, it's known after the backup
+// is written, so it's sent as a trailer, or a header if the backup is empty.
+const BackupSinceTrailer = "X-Backup-Since"
+
+// Backup writes the records changed since version `since` of store to w, 0 means a full backup,
+// it returns the `since` of the next incremental backup.
+func (o *jwtOAuth) Backup(ctx context.Context, w io.Writer, since uint64) (uint64, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return 0, fmt.Errorf("need admin prem: %w", err)
+	}
+	backuper, ok := o.store.(storage.Backuper)
+	if !ok {
+		return 0, storage.ErrBackupNotSupported
+	}
+	return backuper.Backup(w, since)
+}
+
+// backupWriter writes the headers of backup stream on the first write, so that
+// errors before it are responded as usual
+type backupWriter struct {
+	c       *gin.Context
+	written bool
+}
+
+func (w *backupWriter) writeHeader(trailer bool) {
+	w.written = true
+	w.c.Header("Content-Type", "application/octet-stream")
+	if trailer {
+		w.c.Header("Trailer", BackupSinceTrailer)
+	}
+	w.c.Status(http.StatusOK)
+}
+
+func (w *backupWriter) Write(p []byte) (int, error) {
+	if !w.written {
+		w.writeHeader(true)
+	}
+	return w.c.Writer.Write(p)
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChangesPath is the server-sent events stream of `ChangeEvent`
+const ChangesPath = "/changes"
+
+// LastEventIDHeader is the standard SSE header used to resume a stream
+const LastEventIDHeader = "Last-Event-ID"
+
+type ChangeType string
+
+const (
+	// ChangeReset means the subscriber missed some events, everything it cached should be dropped
+	ChangeReset          ChangeType = "reset"
+	ChangeTokenRemoved   ChangeType = "tokenRemoved"
+	ChangeTokenRecovered ChangeType = "tokenRecovered"
+	// ChangeUser is emitted when a user is updated, deleted or recovered
+	ChangeUser   ChangeType = "user"
+	ChangeMiner  ChangeType = "miner"
+	ChangeSigner ChangeType = "signer"
+	// ChangeSigningKey is emitted when signing keys are rotated or retired
+	ChangeSigningKey ChangeType = "signingKey"
+	// ChangeRole is emitted when a role is updated or deleted
+	ChangeRole ChangeType = "role"
+	// ChangeRateLimit is emitted when a rate limit of `User` is put or deleted, or a rate limit tier is changed
+	ChangeRateLimit ChangeType = "rateLimit"
+)
+
+// ChangeEvent describes a mutation which may invalidate results cached by clients.
+// `Epoch` changes every time sophon-auth restarts, `Seq` increases in an epoch.
+type ChangeEvent struct {
+	Epoch int64      `json:"epoch"`
+	Seq   uint64     `json:"seq"`
+	Type  ChangeType `json:"type"`
+	Token string     `json:"token,omitempty"`
+	// Fingerprint is set along with `Token`, or alone if the token is removed or recovered by its fingerprint
+	Fingerprint string `json:"fingerprint,omitempty"`
+	User        string `json:"user,omitempty"`
+	Address     string `json:"address,omitempty"`
+	Role        string `json:"role,omitempty"`
+	Tier        string `json:"tier,omitempty"`
+}
+
+// ID returns the SSE event id, which is used to resume the stream
+func (ev *ChangeEvent) ID() string {
+	return fmt.Sprintf("%d-%d", ev.Epoch, ev.Seq)
+}
+
+// ParseChangeEventID parses id returned by `ChangeEvent.ID`
+func ParseChangeEventID(id string) (int64, uint64, error) {
+	epochStr, seqStr, ok := strings.Cut(id, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid event id %s", id)
+	}
+	epoch, err := strconv.ParseInt(epochStr, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid event id %s: %w", id, err)
+	}
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid event id %s: %w", id, err)
+	}
+	return epoch, seq, nil
+}
+
+const (
+	// changeHistorySize is how many recent events are kept for subscribers to resume from
+	changeHistorySize = 1024
+	// changeSubBuffer is the buffer size of a subscriber, slow subscribers are dropped
+	// when it is full and have to resume from their last event
+	changeSubBuffer = 128
+)
+
+type changeHub struct {
+	lk      sync.Mutex
+	epoch   int64
+	seq     uint64
+	history []*ChangeEvent
+	subs    map[chan *ChangeEvent]struct{}
+}
+
+func newChangeHub() *changeHub {
+	return &changeHub{
+		epoch: time.Now().UnixNano(),
+		subs:  make(map[chan *ChangeEvent]struct{}),
+	}
+}
+
+func (h *changeHub) publish(ev *ChangeEvent) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	h.seq++
+	ev.Epoch, ev.Seq = h.epoch, h.seq
+	h.history = append(h.history, ev)
+	if len(h.history) > changeHistorySize {
+		h.history = h.history[len(h.history)-changeHistorySize:]
+	}
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe returns a channel of events after `lastEventID`, the channel is closed when ctx is done
+// or the subscriber is too slow. A reset event is sent first if the events after `lastEventID` are
+// not available, eg: sophon-auth restarted, or `lastEventID` is empty.
+func (h *changeHub) subscribe(ctx context.Context, lastEventID string) <-chan *ChangeEvent {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	backlog := h.backlog(lastEventID)
+	ch := make(chan *ChangeEvent, len(backlog)+changeSubBuffer)
+	for _, ev := range backlog {
+		ch <- ev
+	}
+	h.subs[ch] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+		h.lk.Lock()
+		defer h.lk.Unlock()
+		if _, ok := h.subs[ch]; ok {
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}()
+	return ch
+}
+
+func (h *changeHub) backlog(lastEventID string) []*ChangeEvent {
+	reset := []*ChangeEvent{{Epoch: h.epoch, Seq: h.seq, Type: ChangeReset}}
+	if len(lastEventID) == 0 {
+		return reset
+	}
+	epoch, seq, err := ParseChangeEventID(lastEventID)
+	if err != nil || epoch != h.epoch || seq > h.seq {
+		return reset
+	}
+	if seq == h.seq {
+		return nil
+	}
+	// events between seq and the first one in history have been dropped
+	if len(h.history) == 0 || h.history[0].Seq > seq+1 {
+		return reset
+	}
+	return h.history[len(h.history)-int(h.seq-seq):]
+}
@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/google/uuid"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+// JWKSPath is where sophon-auth publishes the public keys used to sign tokens
+const JWKSPath = "/.well-known/jwks.json"
+
+// JWK is a public key in the format of RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Key returns the key with `kid`, nil if not found
+func (s *JWKSet) Key(kid string) *JWK {
+	for idx := range s.Keys {
+		if s.Keys[idx].Kid == kid {
+			return &s.Keys[idx]
+		}
+	}
+	return nil
+}
+
+// Verifier returns a jwt algorithm which is able to verify tokens signed by the private key of `k`
+func (k *JWK) Verifier() (jwt.Algorithm, error) {
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("decode x of key %s: %w", k.Kid, err)
+	}
+	switch {
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid ed25519 public key size %d", len(x))
+		}
+		return jwt.NewEd25519(jwt.Ed25519PublicKey(x)), nil
+	case k.Kty == "EC" && k.Crv == "P-256":
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("decode y of key %s: %w", k.Kid, err)
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("public key %s is not on curve P-256", k.Kid)
+		}
+		return jwt.NewES256(jwt.ECDSAPublicKey(pub)), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s with curve %s", k.Kty, k.Crv)
+	}
+}
+
+// signingKey is the parsed `storage.SigningKey`
+type signingKey struct {
+	kid        string
+	alg        config.SigningAlg
+	state      core.SigningKeyState
+	createTime time.Time
+	retireTime *time.Time
+	signer     jwt.Algorithm
+	jwk        JWK
+}
+
+// canVerify returns true if key is active, or verify-only and not reaching its retire time
+func (k *signingKey) canVerify(now time.Time) bool {
+	switch k.state {
+	case core.SigningKeyActive:
+		return true
+	case core.SigningKeyVerifyOnly:
+		return k.retireTime == nil || now.Before(*k.retireTime)
+	default:
+		return false
+	}
+}
+
+// newSigningKey generates a key of alg, the private key is sealed by box if it isn't nil
+func newSigningKey(alg config.SigningAlg, box *storage.SecretBox) (*storage.SigningKey, error) {
+	var priv []byte
+	switch alg {
+	case config.SigningAlgEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		priv = key.Seed()
+	case config.SigningAlgES256:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if priv, err = x509.MarshalECPrivateKey(key); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %s", alg)
+	}
+	privateKey := hex.EncodeToString(priv)
+	if box != nil {
+		var err error
+		if privateKey, err = box.Seal(privateKey); err != nil {
+			return nil, fmt.Errorf("encrypt private key: %w", err)
+		}
+	}
+	return &storage.SigningKey{
+		Kid:        uuid.NewString(),
+		Alg:        alg,
+		PrivateKey: privateKey,
+		CreateTime: time.Now(),
+	}, nil
+}
+
+// parseSigningKey parses sk, whose private key is opened by box if it is sealed
+func parseSigningKey(sk *storage.SigningKey, box *storage.SecretBox) (*signingKey, error) {
+	privateKey, err := box.Open(sk.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt private key %s: %w", sk.Kid, err)
+	}
+	priv, err := hex.DecodeString(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("decode private key %s: %w", sk.Kid, err)
+	}
+	key := &signingKey{
+		kid:        sk.Kid,
+		alg:        sk.Alg,
+		state:      sk.State,
+		createTime: sk.CreateTime,
+		retireTime: sk.RetireTime,
+		jwk:        JWK{Alg: sk.Alg, Use: "sig", Kid: sk.Kid},
+	}
+	switch sk.Alg {
+	case config.SigningAlgEd25519:
+		if len(priv) != ed25519.SeedSize {
+			return nil, fmt.Errorf("invalid ed25519 seed size %d", len(priv))
+		}
+		pk := ed25519.NewKeyFromSeed(priv)
+		key.signer = jwt.NewEd25519(jwt.Ed25519PrivateKey(pk))
+		key.jwk.Kty, key.jwk.Crv = "OKP", "Ed25519"
+		key.jwk.Alg = "EdDSA"
+		key.jwk.X = base64.RawURLEncoding.EncodeToString(pk.Public().(ed25519.PublicKey))
+	case config.SigningAlgES256:
+		pk, err := x509.ParseECPrivateKey(priv)
+		if err != nil {
+			return nil, fmt.Errorf("parse ecdsa private key %s: %w", sk.Kid, err)
+		}
+		key.signer = jwt.NewES256(jwt.ECDSAPrivateKey(pk))
+		key.jwk.Kty, key.jwk.Crv = "EC", "P-256"
+		key.jwk.X = base64.RawURLEncoding.EncodeToString(pk.X.FillBytes(make([]byte, 32)))
+		key.jwk.Y = base64.RawURLEncoding.EncodeToString(pk.Y.FillBytes(make([]byte, 32)))
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %s of key %s", sk.Alg, sk.Kid)
+	}
+	return key, nil
+}
+
+// sortSigningKeys sorts keys from the newest to the oldest
+func sortSigningKeys(keys []*signingKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].createTime.After(keys[j].createTime)
+	})
+}
+
+// keyRing holds the parsed signing keys in memory
+type keyRing struct {
+	// loadLk serializes loading keys from store
+	loadLk sync.Mutex
+
+	lk sync.RWMutex
+	// signKey signs new tokens, nil means signing tokens with a random secret of HS256
+	signKey *signingKey
+	// keys are all the asymmetric keys, from the newest to the oldest
+	keys []*signingKey
+}
+
+func newKeyRing() *keyRing {
+	return &keyRing{}
+}
+
+func (r *keyRing) set(signKey *signingKey, keys []*signingKey) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.signKey = signKey
+	r.keys = keys
+}
+
+func (r *keyRing) signer() *signingKey {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	return r.signKey
+}
+
+func (r *keyRing) get(kid string) (*signingKey, bool) {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	for _, key := range r.keys {
+		if key.kid == kid {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// jwks returns public keys which are able to verify tokens
+func (r *keyRing) jwks() *JWKSet {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	now := time.Now()
+	set := &JWKSet{Keys: make([]JWK, 0, len(r.keys))}
+	for _, key := range r.keys {
+		if key.canVerify(now) {
+			set.Keys = append(set.Keys, key.jwk)
+		}
+	}
+	return set
+}
+
+func toSigningKeyInfo(sk *storage.SigningKey, now time.Time) *SigningKeyInfo {
+	info := &SigningKeyInfo{
+		Kid:        sk.Kid,
+		Alg:        sk.Alg,
+		State:      sk.State,
+		CreateTime: sk.CreateTime,
+		RetireTime: sk.RetireTime,
+	}
+	if info.State == core.SigningKeyVerifyOnly && info.RetireTime != nil && !now.Before(*info.RetireTime) {
+		info.State = core.SigningKeyRetired
+	}
+	return info
+}
@@ -7,6 +7,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"sort"
 	"strings"
 	"time"
 
@@ -18,16 +20,24 @@ import (
 
 	"github.com/ipfs-force-community/sophon-auth/config"
 	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/log"
 	"github.com/ipfs-force-community/sophon-auth/storage"
 	"github.com/ipfs-force-community/sophon-auth/util"
 )
 
 var (
-	ErrorNonRegisteredToken = xerrors.New("A non-registered token")
-	ErrorVerificationFailed = xerrors.New("Verification Failed")
-	ErrorPermissionDeny     = xerrors.New("Permission Deny")
-	ErrorPermissionNotFound = errors.New("permission not found")
-	ErrorUsernameNotFound   = errors.New("username not found")
+	ErrorNonRegisteredToken  = xerrors.New("A non-registered token")
+	ErrorVerificationFailed  = xerrors.New("Verification Failed")
+	ErrorPermissionDeny      = xerrors.New("Permission Deny")
+	ErrorPermissionNotFound  = errors.New("permission not found")
+	ErrorUsernameNotFound    = errors.New("username not found")
+	ErrorTokenExpired        = xerrors.New("token is expired")
+	ErrorTokenNotValidYet    = xerrors.New("token is not valid yet")
+	ErrorUserDisabled        = xerrors.New("user is disabled")
+	ErrorUserDeleted         = xerrors.New("user is deleted")
+	ErrorRoleNotFound        = xerrors.New("role not found")
+	ErrorInvalidRefreshToken = xerrors.New("invalid refresh token")
+	ErrorRefreshTokenReused  = xerrors.New("refresh token is reused")
 )
 
 var jwtOAuthInstance *jwtOAuth
@@ -44,6 +54,18 @@ type OAuthService interface {
 	Tokens(ctx context.Context, skip, limit int64) ([]*TokenInfo, error)
 	GetToken(c context.Context, token string) (*TokenInfo, error)
 	GetTokenByName(c context.Context, name string) ([]*TokenInfo, error)
+	GCTokens(ctx context.Context, req *GCTokensRequest) (*GCTokensResponse, error)
+	JWKS(ctx context.Context) (*JWKSet, error)
+	ListSigningKeys(ctx context.Context) ([]*SigningKeyInfo, error)
+	RotateSigningKey(ctx context.Context, req *RotateSigningKeyRequest) (*SigningKeyInfo, error)
+	RetireSigningKey(ctx context.Context, req *RetireSigningKeyRequest) error
+	SubscribeChanges(ctx context.Context, lastEventID string) (<-chan *ChangeEvent, error)
+	GenerateTokenPair(ctx context.Context, pl *JWTPayload, refreshTTL time.Duration) (*GenTokenResponse, error)
+	RefreshToken(ctx context.Context, refreshToken string) (*GenTokenResponse, error)
+	ListAuditLogs(ctx context.Context, req *ListAuditLogsRequest) (ListAuditLogsResponse, error)
+	GetAuditChainHead(ctx context.Context) (*AuditChainHead, error)
+	VerifyAuditChain(ctx context.Context) (*VerifyAuditChainResponse, error)
+	Backup(ctx context.Context, w io.Writer, since uint64) (uint64, error)
 
 	CreateUser(ctx context.Context, req *CreateUserRequest) (*CreateUserResponse, error)
 	GetUser(ctx context.Context, req *GetUserRequest) (*OutputUser, error)
@@ -54,9 +76,24 @@ type OAuthService interface {
 	DeleteUser(ctx context.Context, req *DeleteUserRequest) error
 	RecoverUser(ctx context.Context, req *RecoverUserRequest) error
 
+	CreateRole(ctx context.Context, req *CreateRoleRequest) (*RoleInfo, error)
+	UpdateRole(ctx context.Context, req *UpdateRoleRequest) error
+	GetRole(ctx context.Context, req *GetRoleRequest) (*RoleInfo, error)
+	ListRoles(ctx context.Context) (ListRolesResponse, error)
+	DeleteRole(ctx context.Context, req *DeleteRoleRequest) error
+
 	GetUserRateLimits(ctx context.Context, req *GetUserRateLimitsReq) (GetUserRateLimitResponse, error)
+	GetEffectiveRateLimit(ctx context.Context, req *GetEffectiveRateLimitReq) (*EffectiveRateLimitResponse, error)
 	UpsertUserRateLimit(ctx context.Context, req *UpsertUserRateLimitReq) (string, error)
 	DelUserRateLimit(ctx context.Context, req *DelUserRateLimitReq) error
+	ConsumeRateLimit(ctx context.Context, req *ConsumeRateLimitReq) (ConsumeRateLimitResponse, error)
+	FlushRateLimitBuckets(ctx context.Context) (int64, error)
+	GetQuotaUsage(ctx context.Context, req *GetQuotaUsageReq) (GetQuotaUsageResponse, error)
+
+	UpsertRateLimitTier(ctx context.Context, req *UpsertRateLimitTierReq) (*RateLimitTierInfo, error)
+	GetRateLimitTier(ctx context.Context, req *GetRateLimitTierReq) (*RateLimitTierInfo, error)
+	ListRateLimitTiers(ctx context.Context) (ListRateLimitTiersResponse, error)
+	DelRateLimitTier(ctx context.Context, req *DelRateLimitTierReq) error
 
 	UpsertMiner(ctx context.Context, req *UpsertMinerReq) (bool, error)
 	HasMiner(ctx context.Context, req *HasMinerRequest) (bool, error)
@@ -75,27 +112,219 @@ type OAuthService interface {
 }
 
 type jwtOAuth struct {
-	store storage.Store
-	mp    Mapper
+	store   storage.Store
+	mp      Mapper
+	signing *config.SigningConfig
+	keys    *keyRing
+	changes *changeHub
+	// verifyCache is nil if disabled
+	verifyCache *verifyCache
+	// secrets encrypts token secrets at rest, secrets are stored in plain if it's nil
+	secrets *storage.SecretBox
+	// rateLimit configures whether budgets of `rateLimits` are persisted, it is nil if not configured
+	rateLimit  *config.RateLimitConfig
+	rateLimits *rateLimitCounter
+}
+
+type ServiceOption func(*jwtOAuth)
+
+// WithSigningConfig sets how new tokens are signed, default to HS256 with one secret for each token
+func WithSigningConfig(cnf *config.SigningConfig) ServiceOption {
+	return func(o *jwtOAuth) {
+		o.signing = cnf
+	}
+}
+
+// WithVerifyCacheConfig caches verified tokens in memory, which is disabled by default
+func WithVerifyCacheConfig(cnf *config.VerifyCacheConfig) ServiceOption {
+	return func(o *jwtOAuth) {
+		o.verifyCache = newVerifyCache(cnf)
+	}
+}
+
+// WithSecretBox encrypts token secrets with the master key of box, plain secrets in store are
+// encrypted once the service starts
+func WithSecretBox(box *storage.SecretBox) ServiceOption {
+	return func(o *jwtOAuth) {
+		o.secrets = box
+	}
+}
+
+// WithRateLimitConfig configures the counter of rate limit budgets, budgets are only kept in memory by default
+func WithRateLimitConfig(cnf *config.RateLimitConfig) ServiceOption {
+	return func(o *jwtOAuth) {
+		o.rateLimit = cnf
+	}
 }
 
 type JWTPayload struct {
 	Name  string          `json:"name"`
 	Perm  core.Permission `json:"perm"`
 	Extra string          `json:"ext"`
+	// Scopes restrict the token to some groups of API, tokens without scopes are granted by `Perm`
+	Scopes []core.Scope `json:"scopes,omitempty"`
+	// Role is resolved at verify time, `Perm` and `Scopes` of the verified payload are replaced by the role's
+	Role string `json:"role,omitempty"`
+
+	// optional time claims, tokens without `exp` never expire
+	ExpirationTime *jwt.Time `json:"exp,omitempty"`
+	NotBefore      *jwt.Time `json:"nbf,omitempty"`
+	IssuedAt       *jwt.Time `json:"iat,omitempty"`
+}
+
+// Valid checks the time claims of payload against `now`
+func (p *JWTPayload) Valid(now time.Time) error {
+	if p.ExpirationTime != nil && !now.Before(p.ExpirationTime.Time) {
+		return ErrorTokenExpired
+	}
+	if p.NotBefore != nil && now.Before(p.NotBefore.Time) {
+		return ErrorTokenNotValidYet
+	}
+	return nil
 }
 
-func NewOAuthService(dbPath string, cnf *config.DBConfig) (OAuthService, error) {
+func NewOAuthService(dbPath string, cnf *config.DBConfig, opts ...ServiceOption) (OAuthService, error) {
 	store, err := storage.NewStore(cnf, dbPath)
 	if err != nil {
 		return nil, err
 	}
 
 	jwtOAuthInstance = &jwtOAuth{
-		store: store,
-		mp:    newMapper(),
+		store:      store,
+		mp:         newMapper(),
+		keys:       newKeyRing(),
+		changes:    newChangeHub(),
+		rateLimits: newRateLimitCounter(),
+	}
+	for _, opt := range opts {
+		opt(jwtOAuthInstance)
+	}
+	if err := jwtOAuthInstance.loadSigningKeys(); err != nil {
+		return nil, fmt.Errorf("load signing keys: %w", err)
+	}
+	if jwtOAuthInstance.secrets != nil {
+		count, err := storage.EncryptSecrets(store, jwtOAuthInstance.secrets)
+		if err != nil {
+			return nil, fmt.Errorf("encrypt secrets: %w", err)
+		}
+		if count > 0 {
+			log.Infof("encrypt secrets of %d tokens and signing keys with master key %s", count, jwtOAuthInstance.secrets.ID())
+		}
+	}
+	if cnf := jwtOAuthInstance.rateLimit; cnf != nil && cnf.Persist {
+		buckets, err := store.ListRateLimitBuckets()
+		if err != nil {
+			return nil, fmt.Errorf("load rate limit buckets: %w", err)
+		}
+		jwtOAuthInstance.rateLimits.load(buckets, time.Now())
+	}
+	return newAuditService(jwtOAuthInstance, store), nil
+}
+
+// loadSigningKeys loads all signing keys from store, the newest active key of the configured
+// algorithm is used to sign tokens, which is generated if there is none.
+func (o *jwtOAuth) loadSigningKeys() error {
+	o.keys.loadLk.Lock()
+	defer o.keys.loadLk.Unlock()
+
+	sks, err := o.store.ListSigningKeys()
+	if err != nil {
+		return err
+	}
+	keys := make([]*signingKey, 0, len(sks))
+	for _, sk := range sks {
+		key, err := parseSigningKey(sk, o.secrets)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
 	}
-	return jwtOAuthInstance, nil
+	sortSigningKeys(keys)
+
+	var signKey *signingKey
+	if o.signing != nil && len(o.signing.Alg) != 0 && o.signing.Alg != config.SigningAlgHS256 {
+		for _, key := range keys {
+			if key.alg == o.signing.Alg && key.state == core.SigningKeyActive {
+				signKey = key
+				break
+			}
+		}
+		if signKey == nil {
+			sk, err := newSigningKey(o.signing.Alg, o.secrets)
+			if err != nil {
+				return err
+			}
+			if err := o.store.PutSigningKey(sk); err != nil {
+				return fmt.Errorf("store signing key: %w", err)
+			}
+			if signKey, err = parseSigningKey(sk, o.secrets); err != nil {
+				return err
+			}
+			keys = append([]*signingKey{signKey}, keys...)
+		}
+	}
+
+	o.keys.set(signKey, keys)
+	return nil
+}
+
+// sign signs payload with the server-held key if configured, otherwise with a random HS256 secret
+// which is returned hex encoded
+func (o *jwtOAuth) sign(pl *JWTPayload) ([]byte, string, error) {
+	if signKey := o.keys.signer(); signKey != nil {
+		tk, err := jwt.Sign(pl, signKey.signer, jwt.KeyID(signKey.kid))
+		return tk, "", err
+	}
+
+	// one token, one secret
+	secret, err := config.RandSecret()
+	if err != nil {
+		return nil, "", xerrors.Errorf("rand secret %v", err)
+	}
+	tk, err := jwt.Sign(pl, jwt.NewHS256(secret))
+	return tk, hex.EncodeToString(secret), err
+}
+
+// verifier returns the algorithm to verify token and the id of its signing key,
+// tokens without secret are signed by a server-held key
+func (o *jwtOAuth) verifier(token string, kp *storage.KeyPair) (jwt.Algorithm, string, error) {
+	if len(kp.Secret) != 0 {
+		plain, err := o.secrets.Open(kp.Secret)
+		if err != nil {
+			return nil, "", fmt.Errorf("decrypt secret: %w", err)
+		}
+		secret, err := hex.DecodeString(plain)
+		if err != nil {
+			return nil, "", xerrors.Errorf("decode secret %v", err)
+		}
+		return jwt.NewHS256(secret), "", nil
+	}
+
+	header, err := JwtHeaderFromToken(token)
+	if err != nil {
+		return nil, "", err
+	}
+	key, ok := o.keys.get(header.KeyID)
+	if !ok {
+		// the key may be rotated by another instance sharing the same store
+		if err := o.loadSigningKeys(); err != nil {
+			return nil, "", fmt.Errorf("reload signing keys: %w", err)
+		}
+		if key, ok = o.keys.get(header.KeyID); !ok {
+			return nil, "", fmt.Errorf("signing key %s not found: %w", header.KeyID, ErrorVerificationFailed)
+		}
+	}
+	if err := o.checkSigningKey(key, time.Now()); err != nil {
+		return nil, "", err
+	}
+	return key.signer, key.kid, nil
+}
+
+func (o *jwtOAuth) checkSigningKey(key *signingKey, now time.Time) error {
+	if !key.canVerify(now) {
+		return fmt.Errorf("signing key %s is retired: %w", key.kid, ErrorVerificationFailed)
+	}
+	return nil
 }
 
 func (o *jwtOAuth) GenerateToken(ctx context.Context, pl *JWTPayload) (string, error) {
@@ -103,6 +332,25 @@ func (o *jwtOAuth) GenerateToken(ctx context.Context, pl *JWTPayload) (string, e
 	if err != nil {
 		return "", fmt.Errorf("need admin prem: %w", err)
 	}
+	return o.generateToken(pl)
+}
+
+func (o *jwtOAuth) generateToken(pl *JWTPayload) (string, error) {
+	if len(pl.Role) != 0 {
+		role, err := o.getRole(pl.Role)
+		if err != nil {
+			return "", err
+		}
+		pl.Perm = role.Perm
+	}
+	for _, scope := range pl.Scopes {
+		if err := core.ValidateScope(scope); err != nil {
+			return "", err
+		}
+		if !core.ScopeWithinPerm(scope, pl.Perm) {
+			return "", fmt.Errorf("scope %s exceeds permission %s", scope, pl.Perm)
+		}
+	}
 
 	exist, err := o.store.HasUser(pl.Name)
 	if err != nil {
@@ -112,15 +360,15 @@ func (o *jwtOAuth) GenerateToken(ctx context.Context, pl *JWTPayload) (string, e
 		return "", fmt.Errorf("token must be based on an existing user %s to generate", pl.Name)
 	}
 
-	// one token, one secret
-	secret, err := config.RandSecret()
-	if err != nil {
-		return "", xerrors.Errorf("rand secret %v", err)
-	}
-	tk, err := jwt.Sign(pl, jwt.NewHS256(secret))
+	tk, secret, err := o.sign(pl)
 	if err != nil {
 		return core.EmptyString, xerrors.Errorf("gen token failed :%s", err)
 	}
+	if len(secret) != 0 && o.secrets != nil {
+		if secret, err = o.secrets.Seal(secret); err != nil {
+			return core.EmptyString, fmt.Errorf("encrypt secret: %w", err)
+		}
+	}
 	token := storage.Token(tk)
 	has, err := o.store.Has(token)
 	if err != nil {
@@ -130,10 +378,15 @@ func (o *jwtOAuth) GenerateToken(ctx context.Context, pl *JWTPayload) (string, e
 		return token.String(), nil
 	}
 
-	err = o.store.Put(&storage.KeyPair{
-		Token: token, Secret: hex.EncodeToString(secret), CreateTime: time.Now(),
+	kp := &storage.KeyPair{
+		Token: token, Secret: secret, CreateTime: time.Now(),
 		Name: pl.Name, Perm: pl.Perm, Extra: pl.Extra, IsDeleted: core.NotDelete,
-	})
+	}
+	if pl.ExpirationTime != nil {
+		expireTime := pl.ExpirationTime.Time
+		kp.ExpireTime = &expireTime
+	}
+	err = o.store.Put(kp)
 	if err != nil {
 		return core.EmptyString, xerrors.Errorf("store token failed :%s", err)
 	}
@@ -146,6 +399,25 @@ func (o *jwtOAuth) Verify(ctx context.Context, token string) (*JWTPayload, error
 		return nil, fmt.Errorf("need read prem: %w", err)
 	}
 
+	now := time.Now()
+	if vt, ok := o.verifyCache.get(token); ok {
+		if len(vt.kid) != 0 {
+			// the signing key may be retired after the token was cached
+			key, ok := o.keys.get(vt.kid)
+			if !ok {
+				return nil, fmt.Errorf("signing key %s not found: %w", vt.kid, ErrorVerificationFailed)
+			}
+			if err := o.checkSigningKey(key, now); err != nil {
+				return nil, err
+			}
+		}
+		if err := vt.payload.Valid(now); err != nil {
+			return nil, err
+		}
+		p := vt.payload
+		return &p, nil
+	}
+
 	p := new(JWTPayload)
 	tk := []byte(token)
 
@@ -153,35 +425,219 @@ func (o *jwtOAuth) Verify(ctx context.Context, token string) (*JWTPayload, error
 	if err != nil {
 		return nil, xerrors.Errorf("get token: %v", err)
 	}
-	secret, err := hex.DecodeString(kp.Secret)
+	alg, kid, err := o.verifier(token, kp)
 	if err != nil {
-		return nil, xerrors.Errorf("decode secret %v", err)
+		return nil, err
 	}
-	if _, err := jwt.Verify(tk, jwt.NewHS256(secret), p); err != nil {
+	if _, err := jwt.Verify(tk, alg, p, jwt.ValidateHeader); err != nil {
 		return nil, ErrorVerificationFailed
 	}
+	if err := p.Valid(now); err != nil {
+		return nil, err
+	}
+	// the cached tokens of a user are dropped once the user is changed, so check it before caching
+	if err := o.checkTokenOwner(p.Name); err != nil {
+		return nil, err
+	}
+	if len(p.Role) != 0 {
+		role, err := o.getRole(p.Role)
+		if err != nil {
+			return nil, err
+		}
+		if err := applyRole(p, role); err != nil {
+			return nil, err
+		}
+	}
+	o.verifyCache.add(token, &verifiedToken{payload: *p, kid: kid})
 	return p, nil
 }
 
+// checkTokenOwner rejects tokens whose owner is disabled or deleted
+func (o *jwtOAuth) checkTokenOwner(name string) error {
+	user, err := o.store.GetUser(name)
+	if err != nil {
+		if storage.IsNotFound(err) {
+			return fmt.Errorf("user %s: %w", name, ErrorUserDeleted)
+		}
+		return fmt.Errorf("get user %s: %w", name, err)
+	}
+	if user.State == core.UserStateDisabled {
+		return fmt.Errorf("user %s: %w", name, ErrorUserDisabled)
+	}
+	return nil
+}
+
+// JWKS returns public keys of all signing keys, which is public to everyone
+func (o *jwtOAuth) JWKS(ctx context.Context) (*JWKSet, error) {
+	return o.keys.jwks(), nil
+}
+
+func (o *jwtOAuth) ListSigningKeys(ctx context.Context) ([]*SigningKeyInfo, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	sks, err := o.store.ListSigningKeys()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(sks, func(i, j int) bool {
+		return sks[i].CreateTime.After(sks[j].CreateTime)
+	})
+	now := time.Now()
+	infos := make([]*SigningKeyInfo, 0, len(sks))
+	for _, sk := range sks {
+		infos = append(infos, toSigningKeyInfo(sk, now))
+	}
+	return infos, nil
+}
+
+// defaultKeyOverlap is how long the previous active keys keep verifying tokens after rotation when not specified
+const defaultKeyOverlap = 7 * 24 * time.Hour
+
+// RotateSigningKey generates a new active key of the configured algorithm, previous active keys
+// become verify-only, and are retired after `req.Overlap`.
+func (o *jwtOAuth) RotateSigningKey(ctx context.Context, req *RotateSigningKeyRequest) (*SigningKeyInfo, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+	if o.signing == nil || len(o.signing.Alg) == 0 || o.signing.Alg == config.SigningAlgHS256 {
+		return nil, fmt.Errorf("rotating key requires an asymmetric signing algorithm, current: HS256")
+	}
+	if req.Overlap < 0 {
+		return nil, fmt.Errorf("overlap must not be negative")
+	}
+	overlap := req.Overlap
+	if overlap == 0 {
+		overlap = defaultKeyOverlap
+	}
+
+	sks, err := o.store.ListSigningKeys()
+	if err != nil {
+		return nil, err
+	}
+	// store the new key first, so that there is always an active key
+	newKey, err := newSigningKey(o.signing.Alg, o.secrets)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.store.PutSigningKey(newKey); err != nil {
+		return nil, fmt.Errorf("store signing key: %w", err)
+	}
+	retireTime := newKey.CreateTime.Add(overlap)
+	for _, sk := range sks {
+		if sk.State != core.SigningKeyActive {
+			continue
+		}
+		sk.State = core.SigningKeyVerifyOnly
+		sk.RetireTime = &retireTime
+		if err := o.store.PutSigningKey(sk); err != nil {
+			return nil, fmt.Errorf("update signing key %s: %w", sk.Kid, err)
+		}
+	}
+	if err := o.loadSigningKeys(); err != nil {
+		return nil, fmt.Errorf("reload signing keys: %w", err)
+	}
+	return toSigningKeyInfo(newKey, time.Now()), nil
+}
+
+// RetireSigningKey retires a verify-only key immediately, tokens signed by it are no longer valid
+func (o *jwtOAuth) RetireSigningKey(ctx context.Context, req *RetireSigningKeyRequest) error {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return fmt.Errorf("need admin prem: %w", err)
+	}
+
+	sk, err := o.store.GetSigningKey(req.Kid)
+	if err != nil {
+		return fmt.Errorf("get signing key %s: %w", req.Kid, err)
+	}
+	if sk.State == core.SigningKeyActive {
+		return fmt.Errorf("signing key %s is active, rotate it first", req.Kid)
+	}
+	if sk.State == core.SigningKeyRetired {
+		return nil
+	}
+	now := time.Now()
+	sk.State = core.SigningKeyRetired
+	if sk.RetireTime == nil || sk.RetireTime.After(now) {
+		sk.RetireTime = &now
+	}
+	if err := o.store.PutSigningKey(sk); err != nil {
+		return fmt.Errorf("update signing key %s: %w", sk.Kid, err)
+	}
+	if err := o.loadSigningKeys(); err != nil {
+		return err
+	}
+	o.publishChange(&ChangeEvent{Type: ChangeSigningKey})
+	return nil
+}
+
+// publishChange drops the tokens and rate limits affected by `ev` from caches, and notifies subscribers
+func (o *jwtOAuth) publishChange(ev *ChangeEvent) {
+	o.verifyCache.invalidate(ev)
+	o.rateLimits.invalidate(ev)
+	o.changes.publish(ev)
+}
+
+// SubscribeChanges streams the mutations after `lastEventID`, which clients use to invalidate their caches
+func (o *jwtOAuth) SubscribeChanges(ctx context.Context, lastEventID string) (<-chan *ChangeEvent, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+	return o.changes.subscribe(ctx, lastEventID), nil
+}
+
 type TokenInfo struct {
-	Token      string    `json:"token"`
-	Name       string    `json:"name"`
-	Perm       string    `json:"perm"`
-	Custom     string    `json:"custom"`
-	CreateTime time.Time `json:"createTime"`
+	// Token is empty if tokens are stored by hash
+	Token string `json:"token"`
+	// Fingerprint identifies the token without revealing it, see `storage.TokenFingerprint`
+	Fingerprint string     `json:"fingerprint"`
+	Name        string     `json:"name"`
+	Perm        string     `json:"perm"`
+	Custom      string     `json:"custom"`
+	Scopes      []string   `json:"scopes,omitempty"`
+	Role        string     `json:"role,omitempty"`
+	CreateTime  time.Time  `json:"createTime"`
+	ExpireTime  *time.Time `json:"expireTime,omitempty"`
 }
 
 func toTokenInfo(kp *storage.KeyPair) (*TokenInfo, error) {
-	jwtPayload, err := util.JWTPayloadMap(string(kp.Token))
+	token := kp.Token.String()
+	if storage.IsHashedToken(kp.Token) {
+		token = kp.UnsignedToken
+	}
+	jwtPayload, err := util.JWTPayloadMap(token)
 	if err != nil {
 		return nil, err
 	}
-	return &TokenInfo{
-		Token:      kp.Token.String(),
-		CreateTime: kp.CreateTime,
-		Name:       jwtPayload["name"].(string),
-		Perm:       jwtPayload["perm"].(string),
-	}, nil
+	info := &TokenInfo{
+		Fingerprint: storage.TokenFingerprint(kp.Token.String()),
+		CreateTime:  kp.CreateTime,
+		Name:        jwtPayload["name"].(string),
+		Perm:        jwtPayload["perm"].(string),
+	}
+	if !storage.IsHashedToken(kp.Token) {
+		info.Token = kp.Token.String()
+	}
+	if scopes, ok := jwtPayload["scopes"].([]interface{}); ok {
+		for _, scope := range scopes {
+			if s, ok := scope.(string); ok {
+				info.Scopes = append(info.Scopes, s)
+			}
+		}
+	}
+	if role, ok := jwtPayload["role"].(string); ok {
+		info.Role = role
+	}
+	if exp, ok := jwtPayload["exp"].(float64); ok {
+		expireTime := time.Unix(int64(exp), 0)
+		info.ExpireTime = &expireTime
+	}
+	return info, nil
 }
 
 func (o *jwtOAuth) GetToken(ctx context.Context, token string) (*TokenInfo, error) {
@@ -190,7 +646,11 @@ func (o *jwtOAuth) GetToken(ctx context.Context, token string) (*TokenInfo, erro
 		return nil, fmt.Errorf("need admin prem: %w", err)
 	}
 
-	pair, err := o.store.Get(storage.Token(token))
+	key, _, err := o.resolveToken(token)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := o.store.Get(key)
 	if err != nil {
 		return nil, err
 	}
@@ -240,31 +700,124 @@ func (o *jwtOAuth) Tokens(ctx context.Context, skip, limit int64) ([]*TokenInfo,
 }
 
 func (o *jwtOAuth) RemoveToken(ctx context.Context, token string) error {
-	err := tokenPermCheck(ctx, token)
+	key, owner, err := o.resolveToken(token)
 	if err != nil {
+		return err
+	}
+	if err := userPermCheck(ctx, owner); err != nil {
 		return fmt.Errorf("need admin prem or token %s check failed: %w", token, err)
 	}
 
-	err = o.store.Delete(storage.Token(token))
+	err = o.store.Delete(key)
 	if err != nil {
 		return fmt.Errorf("remove token %s: %w", token, err)
 	}
+	o.publishChange(tokenChangeEvent(ChangeTokenRemoved, token))
 	return nil
 }
 
 func (o *jwtOAuth) RecoverToken(ctx context.Context, token string) error {
-	err := tokenPermCheck(ctx, token)
+	key, owner, err := o.resolveToken(token)
 	if err != nil {
+		return err
+	}
+	if err := userPermCheck(ctx, owner); err != nil {
 		return fmt.Errorf("need admin prem or token %s check failed: %w", token, err)
 	}
 
-	err = o.store.Recover(storage.Token(token))
+	err = o.store.Recover(key)
 	if err != nil {
 		return fmt.Errorf("recover token %s: %w", token, err)
 	}
+	o.publishChange(tokenChangeEvent(ChangeTokenRecovered, token))
 	return nil
 }
 
+// resolveToken returns the key of token in store and the owner of token, token is either a token
+// or its fingerprint, fingerprints are only found if tokens are stored by hash
+func (o *jwtOAuth) resolveToken(token string) (storage.Token, string, error) {
+	if !storage.IsTokenFingerprint(token) {
+		owner, err := JwtUserFromToken(token)
+		if err != nil {
+			return "", "", fmt.Errorf("get user of token %s failed: %w", token, err)
+		}
+		return storage.Token(token), owner, nil
+	}
+
+	kps, err := o.store.TokensByPrefix(storage.Token(storage.HashedTokenPrefix+token), 2)
+	if err != nil {
+		return "", "", err
+	}
+	switch len(kps) {
+	case 0:
+		return "", "", fmt.Errorf("token of fingerprint %s: %w", token, ErrorNonRegisteredToken)
+	case 1:
+		return kps[0].Token, kps[0].Name, nil
+	default:
+		return "", "", fmt.Errorf("fingerprint %s matches more than one token, use the token instead", token)
+	}
+}
+
+// tokenChangeEvent identifies the token by fingerprint, and by token too if token is not a fingerprint
+func tokenChangeEvent(typ ChangeType, token string) *ChangeEvent {
+	ev := &ChangeEvent{Type: typ, Fingerprint: storage.TokenFingerprint(token)}
+	if !storage.IsTokenFingerprint(token) {
+		ev.Token = token
+	}
+	return ev
+}
+
+// defaultGCBatchSize is the count of tokens purged in one batch when not specified
+const defaultGCBatchSize = 100
+
+func (o *jwtOAuth) GCTokens(ctx context.Context, req *GCTokensRequest) (*GCTokensResponse, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+	if req.Retention < 0 {
+		return nil, fmt.Errorf("retention must not be negative")
+	}
+
+	before := time.Now().Add(-req.Retention)
+	if req.DryRun {
+		pairs, err := o.store.ListStaleTokens(before, 0)
+		if err != nil {
+			return nil, err
+		}
+		res := &GCTokensResponse{Count: int64(len(pairs)), Tokens: make([]*TokenInfo, 0, len(pairs))}
+		for _, pair := range pairs {
+			tokenInfo, err := toTokenInfo(pair)
+			if err != nil {
+				return nil, err
+			}
+			res.Tokens = append(res.Tokens, tokenInfo)
+		}
+		return res, nil
+	}
+
+	count, err := o.purgeStaleTokens(before, req.BatchSize)
+	return &GCTokensResponse{Count: count}, err
+}
+
+// purgeStaleTokens hard-deletes stale tokens batch by batch until there is none left
+func (o *jwtOAuth) purgeStaleTokens(before time.Time, batchSize int64) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = defaultGCBatchSize
+	}
+	var total int64
+	for {
+		count, err := o.store.PurgeStaleTokens(before, batchSize)
+		if err != nil {
+			return total, fmt.Errorf("purge stale tokens: %w", err)
+		}
+		total += count
+		if count < batchSize {
+			return total, nil
+		}
+	}
+}
+
 func (o *jwtOAuth) CreateUser(ctx context.Context, req *CreateUserRequest) (*CreateUserResponse, error) {
 	err := permCheck(ctx, core.PermAdmin)
 	if err != nil {
@@ -293,10 +846,19 @@ func (o *jwtOAuth) CreateUser(ctx context.Context, req *CreateUserRequest) (*Cre
 	if req.Comment != nil {
 		userNew.Comment = *req.Comment
 	}
+	if req.RateLimitTier != nil {
+		if err := o.checkRateLimitTier(*req.RateLimitTier); err != nil {
+			return nil, err
+		}
+		userNew.RateLimitTier = *req.RateLimitTier
+	}
 	err = o.store.PutUser(userNew)
 	if err != nil {
 		return nil, err
 	}
+	if len(userNew.RateLimitTier) != 0 {
+		o.publishChange(&ChangeEvent{Type: ChangeRateLimit, User: userNew.Name})
+	}
 	return o.mp.ToOutPutUser(userNew), nil
 }
 
@@ -317,7 +879,17 @@ func (o *jwtOAuth) UpdateUser(ctx context.Context, req *UpdateUserRequest) error
 	if req.State != core.UserStateUndefined {
 		user.State = req.State
 	}
-	return o.store.UpdateUser(user)
+	if req.RateLimitTier != nil {
+		if err := o.checkRateLimitTier(*req.RateLimitTier); err != nil {
+			return err
+		}
+		user.RateLimitTier = *req.RateLimitTier
+	}
+	if err := o.store.UpdateUser(user); err != nil {
+		return err
+	}
+	o.publishChange(&ChangeEvent{Type: ChangeUser, User: req.Name})
+	return nil
 }
 
 func (o *jwtOAuth) VerifyUsers(ctx context.Context, req *VerifyUsersReq) error {
@@ -357,7 +929,11 @@ func (o *jwtOAuth) DeleteUser(ctx context.Context, req *DeleteUserRequest) error
 		return fmt.Errorf("need admin prem: %w", err)
 	}
 
-	return o.store.DeleteUser(req.Name)
+	if err := o.store.DeleteUser(req.Name); err != nil {
+		return err
+	}
+	o.publishChange(&ChangeEvent{Type: ChangeUser, User: req.Name})
+	return nil
 }
 
 func (o *jwtOAuth) RecoverUser(ctx context.Context, req *RecoverUserRequest) error {
@@ -365,7 +941,14 @@ func (o *jwtOAuth) RecoverUser(ctx context.Context, req *RecoverUserRequest) err
 	if err != nil {
 		return fmt.Errorf("need admin prem: %w", err)
 	}
-	return o.store.RecoverUser(req.Name)
+	if err := o.store.RecoverUser(req.Name); err != nil {
+		return err
+	}
+	if err := o.leaveMissingRateLimitTier(req.Name); err != nil {
+		return err
+	}
+	o.publishChange(&ChangeEvent{Type: ChangeUser, User: req.Name})
+	return nil
 }
 
 func (o *jwtOAuth) GetUserByMiner(ctx context.Context, req *GetUserByMinerRequest) (*OutputUser, error) {
@@ -419,7 +1002,20 @@ func (o jwtOAuth) GetUserRateLimits(ctx context.Context, req *GetUserRateLimitsR
 		return nil, fmt.Errorf("need admin prem: %w", err)
 	}
 
-	return o.store.GetRateLimits(req.Name, req.Id)
+	limits, err := o.rateLimitsOf(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Id) == 0 {
+		return limits, nil
+	}
+	res := make(GetUserRateLimitResponse, 0, 1)
+	for _, l := range limits {
+		if l.Id == req.Id {
+			res = append(res, l)
+		}
+	}
+	return res, nil
 }
 
 func (o *jwtOAuth) UpsertUserRateLimit(ctx context.Context, req *UpsertUserRateLimitReq) (string, error) {
@@ -427,8 +1023,31 @@ func (o *jwtOAuth) UpsertUserRateLimit(ctx context.Context, req *UpsertUserRateL
 	if err != nil {
 		return "nil", fmt.Errorf("need admin prem: %w", err)
 	}
+	if len(req.Token) != 0 {
+		if !storage.IsTokenFingerprint(req.Token) {
+			name, err := JwtUserFromToken(req.Token)
+			if err != nil {
+				return "", fmt.Errorf("invalid token: %w", err)
+			}
+			if name != req.Name {
+				return "", fmt.Errorf("token of %s can't be limited as the token of %s", name, req.Name)
+			}
+		}
+		// never keep the token itself
+		req.Token = storage.TokenFingerprint(req.Token)
+	}
+	// a limit put to user is the user's own, even if it's copied from the tier
+	req.Tier = ""
+	if err := validateRateLimit((*storage.UserRateLimit)(req)); err != nil {
+		return "", err
+	}
 
-	return o.store.PutRateLimit((*storage.UserRateLimit)(req))
+	id, err := o.store.PutRateLimit((*storage.UserRateLimit)(req))
+	if err != nil {
+		return "", err
+	}
+	o.publishChange(&ChangeEvent{Type: ChangeRateLimit, User: req.Name})
+	return id, nil
 }
 
 func (o jwtOAuth) DelUserRateLimit(ctx context.Context, req *DelUserRateLimitReq) error {
@@ -437,7 +1056,11 @@ func (o jwtOAuth) DelUserRateLimit(ctx context.Context, req *DelUserRateLimitReq
 		return fmt.Errorf("need admin prem: %w", err)
 	}
 
-	return o.store.DelRateLimit(req.Name, req.Id)
+	if err := o.store.DelRateLimit(req.Name, req.Id); err != nil {
+		return err
+	}
+	o.publishChange(&ChangeEvent{Type: ChangeRateLimit, User: req.Name})
+	return nil
 }
 
 func (o *jwtOAuth) UpsertMiner(ctx context.Context, req *UpsertMinerReq) (bool, error) {
@@ -451,7 +1074,12 @@ func (o *jwtOAuth) UpsertMiner(ctx context.Context, req *UpsertMinerReq) (bool,
 		return false, fmt.Errorf("invalid protocol type: %v", mAddr.Protocol())
 	}
 
-	return o.store.UpsertMiner(mAddr, req.User, req.OpenMining)
+	isCreate, err := o.store.UpsertMiner(mAddr, req.User, req.OpenMining)
+	if err != nil {
+		return false, err
+	}
+	o.publishChange(&ChangeEvent{Type: ChangeMiner, User: req.User, Address: mAddr.String()})
+	return isCreate, nil
 }
 
 func (o *jwtOAuth) HasMiner(ctx context.Context, req *HasMinerRequest) (bool, error) {
@@ -511,7 +1139,14 @@ func (o jwtOAuth) DelMiner(ctx context.Context, req *DelMinerReq) (bool, error)
 		}
 	}
 
-	return o.store.DelMiner(req.Miner)
+	deleted, err := o.store.DelMiner(req.Miner)
+	if err != nil {
+		return false, err
+	}
+	if deleted {
+		o.publishChange(&ChangeEvent{Type: ChangeMiner, Address: req.Miner.String()})
+	}
+	return deleted, nil
 }
 
 func (o *jwtOAuth) RegisterSigners(ctx context.Context, req *RegisterSignersReq) error {
@@ -529,6 +1164,7 @@ func (o *jwtOAuth) RegisterSigners(ctx context.Context, req *RegisterSignersReq)
 		if err != nil {
 			return fmt.Errorf("unregister signer:%s, error: %w", signer, err)
 		}
+		o.publishChange(&ChangeEvent{Type: ChangeSigner, User: req.User, Address: signer.String()})
 	}
 
 	return nil
@@ -588,6 +1224,7 @@ func (o *jwtOAuth) UnregisterSigners(ctx context.Context, req *UnregisterSigners
 		if err != nil {
 			return fmt.Errorf("unregister signer:%s, error: %w", signer, err)
 		}
+		o.publishChange(&ChangeEvent{Type: ChangeSigner, User: req.User, Address: signer.String()})
 	}
 
 	return nil
@@ -616,7 +1253,14 @@ func (o jwtOAuth) DelSigner(ctx context.Context, req *DelSignerReq) (bool, error
 		}
 	}
 
-	return o.store.DelSigner(addr)
+	deleted, err := o.store.DelSigner(addr)
+	if err != nil {
+		return false, err
+	}
+	if deleted {
+		o.publishChange(&ChangeEvent{Type: ChangeSigner, Address: addr.String()})
+	}
+	return deleted, nil
 }
 
 func DecodeToBytes(enc []byte) ([]byte, error) {
@@ -629,18 +1273,45 @@ func DecodeToBytes(enc []byte) ([]byte, error) {
 }
 
 func JwtUserFromToken(token string) (string, error) {
+	payload, err := JwtPayloadFromToken(token)
+	if err != nil {
+		return "", err
+	}
+	return payload.Name, nil
+}
+
+// JwtHeaderFromToken decodes the header of token without verifying its signature
+func JwtHeaderFromToken(token string) (*jwt.Header, error) {
 	sks := strings.Split(token, ".")
-	if len(sks) < 1 {
-		return "", fmt.Errorf("can't parse user from input token")
+	if len(sks) < 2 {
+		return nil, fmt.Errorf("can't parse header from input token")
+	}
+	dec, err := DecodeToBytes([]byte(sks[0]))
+	if err != nil {
+		return nil, err
+	}
+	header := &jwt.Header{}
+	if err = json.Unmarshal(dec, header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// JwtPayloadFromToken decodes the payload of token without verifying its signature
+func JwtPayloadFromToken(token string) (*JWTPayload, error) {
+	sks := strings.Split(token, ".")
+	if len(sks) < 2 {
+		return nil, fmt.Errorf("can't parse payload from input token")
 	}
 	dec, err := DecodeToBytes([]byte(sks[1]))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	payload := &JWTPayload{}
-	err = json.Unmarshal(dec, payload)
-
-	return payload.Name, err
+	if err = json.Unmarshal(dec, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
 }
 
 func IsSignerAddress(addr address.Address) bool {
@@ -680,28 +1351,6 @@ func userPermCheck(ctx context.Context, username string) error {
 	return ErrorPermissionDeny
 }
 
-func tokenPermCheck(ctx context.Context, token string) error {
-	err := permCheck(ctx, core.PermAdmin)
-	if err == nil {
-		return nil
-	}
-
-	username, err := JwtUserFromToken(token)
-	if err != nil {
-		return fmt.Errorf("get user of token %s failed: %w", token, err)
-	}
-
-	ctxUsername, ok := core.CtxGetName(ctx)
-	if !ok {
-		return ErrorUsernameNotFound
-	}
-	if ctxUsername == username {
-		return nil
-	}
-
-	return ErrorPermissionDeny
-}
-
 type minerOwnershipChecker interface {
 	MinerExistInUser(maddr address.Address, userName string) (bool, error)
 }
@@ -3,6 +3,7 @@ package auth
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,9 +11,13 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -52,6 +57,15 @@ func TestJwt(t *testing.T) {
 	t.Run("generate token", testGenerateToken)
 	// stm: @VENUSAUTH_JWT_VERIFY_TOKEN_001, @VENUSAUTH_JWT_VERIFY_TOKEN_002
 	t.Run("verify token", testVerifyToken)
+	t.Run("verify token with time claims", testVerifyTokenWithTimeClaims)
+	t.Run("verify token of disabled or deleted user", testVerifyTokenOwner)
+	t.Run("generate token with scopes", testGenerateTokenWithScopes)
+	t.Run("roles", testRoles)
+	t.Run("refresh token", testRefreshToken)
+	t.Run("audit log", testAuditLog)
+	t.Run("audit log of oversized fields", testAuditLogOversized)
+	t.Run("audit log unchained", testAuditLogUnchained)
+	t.Run("audit log of rate limit tiers", testAuditLogRateLimitTier)
 	// stm: @VENUSAUTH_JWT_GET_TOKEN_001, @VENUSAUTH_JWT_GET_TOKEN_002
 	t.Run("get token", testGetToken)
 	// stm: @VENUSAUTH_JWT_GET_TOKEN_BY_NAME_001, @VENUSAUTH_JWT_GET_TOKEN_BY_NAME_002
@@ -60,6 +74,14 @@ func TestJwt(t *testing.T) {
 	t.Run("list all tokens", testTokenList)
 	// stm: @VENUSAUTH_JWT_REMOVE_TOKEN_001, @VENUSAUTH_JWT_RECOVER_TOKEN_001, @VENUSAUTH_JWT_RECOVER_TOKEN_003
 	t.Run("remove and recover tokens", testRemoveAndRecoverToken)
+	t.Run("gc tokens", testGCTokens)
+	t.Run("asymmetric signing", testAsymmetricSigning)
+	t.Run("rotate signing key", testRotateSigningKey)
+	t.Run("subscribe changes", testSubscribeChanges)
+	t.Run("verify cache", testVerifyCache)
+	t.Run("encrypt secrets", testEncryptSecrets)
+	t.Run("encrypt signing keys", testEncryptSigningKeys)
+	t.Run("hash tokens", testHashTokens)
 	// Features about users
 	// stm: @VENUSAUTH_JWT_CREATE_USER_001, @VENUSAUTH_JWT_CREATE_USER_003
 	t.Run("test create user", func(t *testing.T) { testCreateUser(t, userMiners) })
@@ -106,6 +128,11 @@ func TestJwt(t *testing.T) {
 	t.Run("test get rate limit", func(t *testing.T) { testGetUserRateLimits(t, userMiners, originLimits) })
 	// stm: @VENUSAUTH_JWT_DELETE_USER_RATE_LIMITS_001
 	t.Run("test delete rate limit", func(t *testing.T) { testDeleteUserRateLimits(t, userMiners, originLimits) })
+	t.Run("test effective rate limit", testEffectiveRateLimit)
+	t.Run("test consume rate limit", testConsumeRateLimit)
+	t.Run("test quotas", testQuotas)
+	t.Run("test token rate limit", testTokenRateLimit)
+	t.Run("test rate limit tiers", testRateLimitTiers)
 }
 
 func testGenerateToken(t *testing.T) {
@@ -175,6 +202,624 @@ func testVerifyToken(t *testing.T) {
 	assert.Equal(t, ErrorPermissionNotFound, errors.Unwrap(err))
 }
 
+func testVerifyTokenWithTimeClaims(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	createUserReq := &CreateUserRequest{
+		Name:  "test-token-01",
+		State: 0,
+	}
+	_, err := jwtOAuthInstance.CreateUser(adminCtx, createUserReq)
+	assert.Nil(t, err)
+
+	now := time.Now()
+	genToken := func(exp, nbf *jwt.Time) string {
+		token, err := jwtOAuthInstance.GenerateToken(adminCtx, &JWTPayload{
+			Name:           "test-token-01",
+			Perm:           "admin",
+			IssuedAt:       jwt.NumericDate(now),
+			ExpirationTime: exp,
+			NotBefore:      nbf,
+		})
+		assert.Nil(t, err)
+		return token
+	}
+
+	// not expired yet
+	validToken := genToken(jwt.NumericDate(now.Add(time.Hour)), nil)
+	payload, err := jwtOAuthInstance.Verify(readCtx, validToken)
+	assert.Nil(t, err)
+	assert.Equal(t, now.Add(time.Hour).Unix(), payload.ExpirationTime.Unix())
+	tokenInfo, err := jwtOAuthInstance.GetToken(adminCtx, validToken)
+	assert.Nil(t, err)
+	assert.NotNil(t, tokenInfo.ExpireTime)
+	assert.Equal(t, now.Add(time.Hour).Unix(), tokenInfo.ExpireTime.Unix())
+
+	// expired
+	expiredToken := genToken(jwt.NumericDate(now.Add(-time.Hour)), nil)
+	_, err = jwtOAuthInstance.Verify(readCtx, expiredToken)
+	assert.True(t, errors.Is(err, ErrorTokenExpired))
+
+	// not valid yet
+	futureToken := genToken(nil, jwt.NumericDate(now.Add(time.Hour)))
+	_, err = jwtOAuthInstance.Verify(readCtx, futureToken)
+	assert.True(t, errors.Is(err, ErrorTokenNotValidYet))
+	tokenInfo, err = jwtOAuthInstance.GetToken(adminCtx, futureToken)
+	assert.Nil(t, err)
+	assert.Nil(t, tokenInfo.ExpireTime)
+}
+
+func testGCTokens(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	createUserReq := &CreateUserRequest{
+		Name:  "test-token-01",
+		State: 0,
+	}
+	_, err := jwtOAuthInstance.CreateUser(adminCtx, createUserReq)
+	assert.Nil(t, err)
+
+	now := time.Now()
+	genToken := func(exp *jwt.Time) string {
+		token, err := jwtOAuthInstance.GenerateToken(adminCtx, &JWTPayload{
+			Name:           "test-token-01",
+			Perm:           "read",
+			IssuedAt:       jwt.NumericDate(now),
+			ExpirationTime: exp,
+		})
+		assert.Nil(t, err)
+		return token
+	}
+	expiredToken := genToken(jwt.NumericDate(now.Add(-2 * time.Hour)))
+	validToken := genToken(jwt.NumericDate(now.Add(time.Hour)))
+	removedToken := genToken(nil)
+	assert.Nil(t, jwtOAuthInstance.RemoveToken(adminCtx, removedToken))
+
+	// only admin is allowed
+	_, err = jwtOAuthInstance.GCTokens(readCtx, &GCTokensRequest{})
+	assert.NotNil(t, err)
+	_, err = jwtOAuthInstance.GCTokens(adminCtx, &GCTokensRequest{Retention: -time.Hour})
+	assert.NotNil(t, err)
+
+	// removed token is still within retention
+	res, err := jwtOAuthInstance.GCTokens(adminCtx, &GCTokensRequest{Retention: time.Hour, DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res.Count)
+	assert.Len(t, res.Tokens, 1)
+	assert.Equal(t, expiredToken, res.Tokens[0].Token)
+
+	res, err = jwtOAuthInstance.GCTokens(adminCtx, &GCTokensRequest{BatchSize: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), res.Count)
+	assert.Len(t, res.Tokens, 0)
+
+	_, err = jwtOAuthInstance.GetToken(adminCtx, expiredToken)
+	assert.NotNil(t, err)
+	assert.NotNil(t, jwtOAuthInstance.RecoverToken(adminCtx, removedToken))
+	_, err = jwtOAuthInstance.GetToken(adminCtx, validToken)
+	assert.Nil(t, err)
+}
+
+func testAsymmetricSigning(t *testing.T) {
+	for _, alg := range []config.SigningAlg{config.SigningAlgEd25519, config.SigningAlgES256} {
+		t.Run(alg, func(t *testing.T) {
+			cfg := config.DBConfig{Type: "badger"}
+			setup(&cfg, t)
+			defer shutdown(&cfg, t)
+
+			// tokens signed with HS256 before switching algorithm are still valid
+			_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: "test-token-01"})
+			require.NoError(t, err)
+			hsToken, err := jwtOAuthInstance.GenerateToken(adminCtx, &JWTPayload{Name: "test-token-01", Perm: core.PermRead})
+			require.NoError(t, err)
+
+			jwtOAuthInstance.signing = &config.SigningConfig{Alg: alg}
+			require.NoError(t, jwtOAuthInstance.loadSigningKeys())
+			jwks, err := jwtOAuthInstance.JWKS(context.Background())
+			require.NoError(t, err)
+			require.Len(t, jwks.Keys, 1)
+
+			// reloading doesn't generate a new key
+			require.NoError(t, jwtOAuthInstance.loadSigningKeys())
+			jwks2, err := jwtOAuthInstance.JWKS(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, jwks, jwks2)
+
+			token, err := jwtOAuthInstance.GenerateToken(adminCtx, &JWTPayload{Name: "test-token-01", Perm: core.PermSign})
+			require.NoError(t, err)
+			header, err := JwtHeaderFromToken(token)
+			require.NoError(t, err)
+			require.Equal(t, jwks.Keys[0].Kid, header.KeyID)
+
+			payload, err := jwtOAuthInstance.Verify(readCtx, token)
+			require.NoError(t, err)
+			require.Equal(t, core.PermSign, payload.Perm)
+			_, err = jwtOAuthInstance.Verify(readCtx, hsToken)
+			require.NoError(t, err)
+
+			// verify offline with the published public key
+			verifier, err := jwks.Key(header.KeyID).Verifier()
+			require.NoError(t, err)
+			var offlinePayload JWTPayload
+			_, err = jwt.Verify([]byte(token), verifier, &offlinePayload, jwt.ValidateHeader)
+			require.NoError(t, err)
+			require.Equal(t, payload, &offlinePayload)
+
+			// tampered token
+			sks := strings.Split(token, ".")
+			fakePayload, err := json.Marshal(&JWTPayload{Name: "test-token-01", Perm: core.PermAdmin})
+			require.NoError(t, err)
+			_, err = jwt.Verify([]byte(sks[0]+"."+base64.RawURLEncoding.EncodeToString(fakePayload)+"."+sks[2]),
+				verifier, &offlinePayload)
+			require.Error(t, err)
+		})
+	}
+}
+
+func testRotateSigningKey(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	// rotating is not supported with HS256
+	_, err := jwtOAuthInstance.RotateSigningKey(adminCtx, &RotateSigningKeyRequest{})
+	require.Error(t, err)
+
+	jwtOAuthInstance.signing = &config.SigningConfig{Alg: config.SigningAlgEd25519}
+	require.NoError(t, jwtOAuthInstance.loadSigningKeys())
+	_, err = jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: "test-token-01"})
+	require.NoError(t, err)
+	genToken := func() string {
+		token, err := jwtOAuthInstance.GenerateToken(adminCtx, &JWTPayload{
+			Name:     "test-token-01",
+			Perm:     core.PermRead,
+			IssuedAt: jwt.NumericDate(time.Now()),
+			Extra:    uuid.NewString(),
+		})
+		require.NoError(t, err)
+		return token
+	}
+	oldToken := genToken()
+	keys, err := jwtOAuthInstance.ListSigningKeys(adminCtx)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	oldKid := keys[0].Kid
+
+	_, err = jwtOAuthInstance.RotateSigningKey(readCtx, &RotateSigningKeyRequest{})
+	require.Error(t, err)
+	_, err = jwtOAuthInstance.RotateSigningKey(adminCtx, &RotateSigningKeyRequest{Overlap: -time.Hour})
+	require.Error(t, err)
+	newKey, err := jwtOAuthInstance.RotateSigningKey(adminCtx, &RotateSigningKeyRequest{Overlap: time.Hour})
+	require.NoError(t, err)
+	require.Equal(t, core.SigningKeyActive, newKey.State)
+
+	keys, err = jwtOAuthInstance.ListSigningKeys(adminCtx)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	require.Equal(t, newKey.Kid, keys[0].Kid)
+	require.Equal(t, oldKid, keys[1].Kid)
+	require.Equal(t, core.SigningKeyVerifyOnly, keys[1].State)
+	require.NotNil(t, keys[1].RetireTime)
+
+	// new tokens are signed by the new key, old tokens are still valid within overlap
+	newToken := genToken()
+	header, err := JwtHeaderFromToken(newToken)
+	require.NoError(t, err)
+	require.Equal(t, newKey.Kid, header.KeyID)
+	_, err = jwtOAuthInstance.Verify(readCtx, newToken)
+	require.NoError(t, err)
+	_, err = jwtOAuthInstance.Verify(readCtx, oldToken)
+	require.NoError(t, err)
+	jwks, err := jwtOAuthInstance.JWKS(context.Background())
+	require.NoError(t, err)
+	require.Len(t, jwks.Keys, 2)
+
+	// active key can't be retired
+	require.Error(t, jwtOAuthInstance.RetireSigningKey(adminCtx, &RetireSigningKeyRequest{Kid: newKey.Kid}))
+	require.NoError(t, jwtOAuthInstance.RetireSigningKey(adminCtx, &RetireSigningKeyRequest{Kid: oldKid}))
+	_, err = jwtOAuthInstance.Verify(readCtx, oldToken)
+	require.ErrorIs(t, err, ErrorVerificationFailed)
+	_, err = jwtOAuthInstance.Verify(readCtx, newToken)
+	require.NoError(t, err)
+	jwks, err = jwtOAuthInstance.JWKS(context.Background())
+	require.NoError(t, err)
+	require.Len(t, jwks.Keys, 1)
+	require.Equal(t, newKey.Kid, jwks.Keys[0].Kid)
+
+	// verify-only key stops verifying after its retire time
+	_, err = jwtOAuthInstance.RotateSigningKey(adminCtx, &RotateSigningKeyRequest{Overlap: time.Nanosecond})
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond)
+	_, err = jwtOAuthInstance.Verify(readCtx, newToken)
+	require.ErrorIs(t, err, ErrorVerificationFailed)
+	keys, err = jwtOAuthInstance.ListSigningKeys(adminCtx)
+	require.NoError(t, err)
+	require.Equal(t, core.SigningKeyRetired, keys[1].State)
+}
+
+func testVerifyTokenOwner(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	name := "test-token-owner"
+	_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: name, State: core.UserStateEnabled})
+	assert.Nil(t, err)
+	token, err := jwtOAuthInstance.GenerateToken(adminCtx, &JWTPayload{Name: name, Perm: core.PermRead})
+	assert.Nil(t, err)
+	_, err = jwtOAuthInstance.Verify(readCtx, token)
+	assert.Nil(t, err)
+
+	assert.Nil(t, jwtOAuthInstance.UpdateUser(adminCtx, &UpdateUserRequest{Name: name, State: core.UserStateDisabled}))
+	_, err = jwtOAuthInstance.Verify(readCtx, token)
+	assert.ErrorIs(t, err, ErrorUserDisabled)
+	assert.Equal(t, ReasonUserDisabled, VerifyFailedReasonOf(err))
+
+	assert.Nil(t, jwtOAuthInstance.UpdateUser(adminCtx, &UpdateUserRequest{Name: name, State: core.UserStateEnabled}))
+	_, err = jwtOAuthInstance.Verify(readCtx, token)
+	assert.Nil(t, err)
+
+	assert.Nil(t, jwtOAuthInstance.DeleteUser(adminCtx, &DeleteUserRequest{Name: name}))
+	_, err = jwtOAuthInstance.Verify(readCtx, token)
+	assert.ErrorIs(t, err, ErrorUserDeleted)
+	assert.Equal(t, ReasonUserDeleted, VerifyFailedReasonOf(err))
+}
+
+func testGenerateTokenWithScopes(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	name := "test-token-scopes"
+	_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: name})
+	assert.Nil(t, err)
+
+	pl := &JWTPayload{Name: name, Perm: core.PermSign, Scopes: []core.Scope{"market:read", "wallet:sign"}}
+	token, err := jwtOAuthInstance.GenerateToken(adminCtx, pl)
+	assert.Nil(t, err)
+	payload, err := jwtOAuthInstance.Verify(readCtx, token)
+	assert.Nil(t, err)
+	assert.Equal(t, pl.Scopes, payload.Scopes)
+
+	tokenInfo, err := jwtOAuthInstance.GetToken(adminCtx, token)
+	assert.Nil(t, err)
+	assert.Equal(t, pl.Scopes, tokenInfo.Scopes)
+
+	// invalid scope
+	_, err = jwtOAuthInstance.GenerateToken(adminCtx, &JWTPayload{Name: name, Perm: core.PermRead, Scopes: []core.Scope{"market"}})
+	assert.Error(t, err)
+	// scope exceeds permission
+	_, err = jwtOAuthInstance.GenerateToken(adminCtx, &JWTPayload{Name: name, Perm: core.PermRead, Scopes: []core.Scope{"wallet:sign"}})
+	assert.Error(t, err)
+}
+
+func testRoles(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	// cached tokens are dropped once their role is changed
+	jwtOAuthInstance.verifyCache = newVerifyCache(&config.VerifyCacheConfig{Size: 10, TTL: time.Minute})
+
+	name := "test-token-role"
+	_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: name})
+	assert.Nil(t, err)
+
+	roleName := "market-operator"
+	_, err = jwtOAuthInstance.CreateRole(readCtx, &CreateRoleRequest{Name: roleName, Perm: core.PermWrite})
+	assert.Error(t, err)
+	// invalid roles
+	_, err = jwtOAuthInstance.CreateRole(adminCtx, &CreateRoleRequest{Name: core.PermSign, Perm: core.PermWrite})
+	assert.Error(t, err)
+	_, err = jwtOAuthInstance.CreateRole(adminCtx, &CreateRoleRequest{Name: roleName, Perm: core.PermWrite, Scopes: []core.Scope{"wallet:sign"}})
+	assert.Error(t, err)
+
+	role, err := jwtOAuthInstance.CreateRole(adminCtx, &CreateRoleRequest{Name: roleName, Perm: core.PermWrite, Scopes: []core.Scope{"market:write"}})
+	assert.Nil(t, err)
+	assert.Equal(t, roleName, role.Name)
+	_, err = jwtOAuthInstance.CreateRole(adminCtx, &CreateRoleRequest{Name: roleName, Perm: core.PermWrite})
+	assert.Error(t, err)
+
+	// roles are resolved by the service only, `core` knows nothing about them
+	assert.Empty(t, core.AdaptOldStrategy(roleName))
+
+	_, err = jwtOAuthInstance.GenerateToken(adminCtx, &JWTPayload{Name: name, Role: "not-exist"})
+	assert.ErrorIs(t, err, ErrorRoleNotFound)
+	token, err := jwtOAuthInstance.GenerateToken(adminCtx, &JWTPayload{Name: name, Role: roleName})
+	assert.Nil(t, err)
+	payload, err := jwtOAuthInstance.Verify(readCtx, token)
+	assert.Nil(t, err)
+	assert.Equal(t, core.PermWrite, payload.Perm)
+	assert.Equal(t, []core.Scope{"market:write"}, payload.Scopes)
+	roleCtx := core.CtxWithScopes(core.CtxWithPerm(context.Background(), payload.Perm), core.ScopesOf(payload.Perm, payload.Scopes))
+	assert.True(t, core.HasPerm(roleCtx, nil, core.PermWrite))
+	assert.False(t, core.HasPerm(roleCtx, nil, core.PermSign))
+	assert.True(t, core.HasScope(roleCtx, "market:read"))
+	assert.False(t, core.HasScope(roleCtx, "wallet:read"))
+	tokenInfo, err := jwtOAuthInstance.GetToken(adminCtx, token)
+	assert.Nil(t, err)
+	assert.Equal(t, roleName, tokenInfo.Role)
+
+	// tokens are granted the updated role at verify time
+	err = jwtOAuthInstance.UpdateRole(adminCtx, &UpdateRoleRequest{Name: roleName, Perm: core.PermSign, Scopes: []core.Scope{"wallet:sign"}})
+	assert.Nil(t, err)
+	payload, err = jwtOAuthInstance.Verify(readCtx, token)
+	assert.Nil(t, err)
+	assert.Equal(t, core.PermSign, payload.Perm)
+	assert.Equal(t, []core.Scope{"wallet:sign"}, payload.Scopes)
+
+	// tokens whose scopes all exceed the role are rejected rather than granted the whole permission
+	scopedToken, err := jwtOAuthInstance.GenerateToken(adminCtx, &JWTPayload{Name: name, Role: roleName, Scopes: []core.Scope{"market:write"}})
+	assert.Nil(t, err)
+	err = jwtOAuthInstance.UpdateRole(adminCtx, &UpdateRoleRequest{Name: roleName, Perm: core.PermRead, Scopes: []core.Scope{"market:read"}})
+	assert.Nil(t, err)
+	_, err = jwtOAuthInstance.Verify(readCtx, scopedToken)
+	assert.ErrorIs(t, err, ErrorVerificationFailed)
+	err = jwtOAuthInstance.UpdateRole(adminCtx, &UpdateRoleRequest{Name: roleName, Perm: core.PermSign, Scopes: []core.Scope{"wallet:sign"}})
+	assert.Nil(t, err)
+
+	roles, err := jwtOAuthInstance.ListRoles(adminCtx)
+	assert.Nil(t, err)
+	assert.Len(t, roles, 1)
+	role, err = jwtOAuthInstance.GetRole(adminCtx, &GetRoleRequest{Name: roleName})
+	assert.Nil(t, err)
+	assert.Equal(t, core.PermSign, role.Perm)
+
+	// tokens of a deleted role fail to verify
+	assert.Nil(t, jwtOAuthInstance.DeleteRole(adminCtx, &DeleteRoleRequest{Name: roleName}))
+	_, err = jwtOAuthInstance.Verify(readCtx, token)
+	assert.ErrorIs(t, err, ErrorRoleNotFound)
+	assert.Equal(t, ReasonRoleNotFound, VerifyFailedReasonOf(err))
+	assert.Error(t, jwtOAuthInstance.DeleteRole(adminCtx, &DeleteRoleRequest{Name: roleName}))
+}
+
+func testRefreshToken(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	name := "test-refresh-token"
+	_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: name})
+	assert.Nil(t, err)
+
+	now := time.Now()
+	pl := &JWTPayload{Name: name, Perm: core.PermSign, IssuedAt: jwt.NumericDate(now), ExpirationTime: jwt.NumericDate(now.Add(time.Hour))}
+	_, err = jwtOAuthInstance.GenerateTokenPair(readCtx, pl, 0)
+	assert.Error(t, err)
+	// access token with refresh token must expire
+	_, err = jwtOAuthInstance.GenerateTokenPair(adminCtx, &JWTPayload{Name: name, Perm: core.PermSign}, 0)
+	assert.Error(t, err)
+
+	pair, err := jwtOAuthInstance.GenerateTokenPair(adminCtx, pl, 24*time.Hour)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, pair.RefreshToken)
+
+	// refresh tokens are rotated on use
+	next, err := jwtOAuthInstance.RefreshToken(context.Background(), pair.RefreshToken)
+	assert.Nil(t, err)
+	assert.NotEqual(t, pair.RefreshToken, next.RefreshToken)
+	payload, err := jwtOAuthInstance.Verify(readCtx, next.Token)
+	assert.Nil(t, err)
+	assert.Equal(t, core.PermSign, payload.Perm)
+	assert.Equal(t, time.Hour, payload.ExpirationTime.Sub(payload.IssuedAt.Time))
+	rt, err := jwtOAuthInstance.store.GetRefreshToken(next.RefreshToken)
+	assert.Nil(t, err)
+	first, err := jwtOAuthInstance.store.GetRefreshToken(pair.RefreshToken)
+	assert.Nil(t, err)
+	assert.Equal(t, first.Family, rt.Family)
+	assert.Equal(t, first.ExpireTime.Unix(), rt.ExpireTime.Unix())
+
+	// reusing a refresh token revokes all of its family
+	_, err = jwtOAuthInstance.RefreshToken(context.Background(), pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrorRefreshTokenReused)
+	assert.Equal(t, ReasonRefreshTokenReused, VerifyFailedReasonOf(err))
+	_, err = jwtOAuthInstance.RefreshToken(context.Background(), next.RefreshToken)
+	assert.ErrorIs(t, err, ErrorInvalidRefreshToken)
+	_, err = jwtOAuthInstance.RefreshToken(context.Background(), "not-exist")
+	assert.ErrorIs(t, err, ErrorInvalidRefreshToken)
+
+	// refresh tokens of disabled users are rejected
+	pair, err = jwtOAuthInstance.GenerateTokenPair(adminCtx, pl, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, jwtOAuthInstance.UpdateUser(adminCtx, &UpdateUserRequest{Name: name, State: core.UserStateDisabled}))
+	_, err = jwtOAuthInstance.RefreshToken(context.Background(), pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrorUserDisabled)
+}
+
+func testAuditLog(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	srv := newAuditService(jwtOAuthInstance, jwtOAuthInstance.store)
+	ctx := core.CtxWithName(adminCtx, "admin")
+
+	name := "test-audit-log"
+	_, err := srv.CreateUser(ctx, &CreateUserRequest{Name: name})
+	assert.Nil(t, err)
+	token, err := srv.GenerateToken(ctx, &JWTPayload{Name: name, Perm: core.PermSign})
+	assert.Nil(t, err)
+	// failed mutations are recorded too
+	_, err = srv.CreateUser(core.CtxWithName(readCtx, "reader"), &CreateUserRequest{Name: "test-audit-log-read"})
+	assert.Error(t, err)
+	// reads are not recorded
+	_, err = srv.GetUser(ctx, &GetUserRequest{Name: name})
+	assert.Nil(t, err)
+
+	_, err = srv.ListAuditLogs(readCtx, &ListAuditLogsRequest{})
+	assert.Error(t, err)
+
+	logs, err := srv.ListAuditLogs(adminCtx, &ListAuditLogsRequest{})
+	assert.Nil(t, err)
+	assert.Len(t, logs, 3)
+	assert.Equal(t, AuditUserCreate, logs[0].Action)
+	assert.Equal(t, name, logs[0].Target)
+	assert.Equal(t, AuditSuccess, logs[0].Result)
+	assert.Equal(t, AuditTokenGenerate, logs[1].Action)
+	assert.NotContains(t, logs[1].Target, token)
+	assert.Equal(t, "reader", logs[2].Actor)
+	assert.Equal(t, AuditFailure, logs[2].Result)
+	assert.NotEmpty(t, logs[2].Error)
+
+	logs, err = srv.ListAuditLogs(adminCtx, &ListAuditLogsRequest{Actor: "admin"})
+	assert.Nil(t, err)
+	assert.Len(t, logs, 2)
+	logs, err = srv.ListAuditLogs(adminCtx, &ListAuditLogsRequest{Action: AuditUserCreate})
+	assert.Nil(t, err)
+	assert.Len(t, logs, 2)
+	logs, err = srv.ListAuditLogs(adminCtx, &ListAuditLogsRequest{Start: time.Now().Add(time.Hour).Unix()})
+	assert.Nil(t, err)
+	assert.Len(t, logs, 0)
+
+	// audit logs are chained up by hash
+	_, err = srv.VerifyAuditChain(readCtx)
+	assert.Error(t, err)
+	res, err := srv.VerifyAuditChain(adminCtx)
+	assert.Nil(t, err)
+	assert.Nil(t, res.Broken)
+	assert.Equal(t, int64(3), res.Checked)
+	head, err := srv.GetAuditChainHead(adminCtx)
+	assert.Nil(t, err)
+	assert.Equal(t, res.Head.Hash, head.Hash)
+
+	logs, err = srv.ListAuditLogs(adminCtx, &ListAuditLogsRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, logs[0].Hash, logs[1].PrevHash)
+	assert.Equal(t, head.Hash, logs[2].Hash)
+
+	// editing an audit log breaks the chain
+	edited := *logs[1]
+	edited.Target = "someone-else"
+	assert.Nil(t, jwtOAuthInstance.store.PutAuditLog(&edited))
+	res, err = srv.VerifyAuditChain(adminCtx)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res.Checked)
+	assert.Equal(t, logs[1].Id, res.Broken.Id)
+	assert.Contains(t, res.Reason, "hash mismatch")
+
+	// so does re-hashing it, the next one still links to the original hash
+	edited.Hash = edited.ComputeHash()
+	assert.Nil(t, jwtOAuthInstance.store.PutAuditLog(&edited))
+	res, err = srv.VerifyAuditChain(adminCtx)
+	assert.Nil(t, err)
+	assert.Equal(t, logs[2].Id, res.Broken.Id)
+	assert.Contains(t, res.Reason, "previous hash mismatch")
+}
+
+func testAuditLogRateLimitTier(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	srv := newAuditService(jwtOAuthInstance, jwtOAuthInstance.store)
+	ctx := core.CtxWithName(adminCtx, "admin")
+	tier, name, noTier := "test-audit-tier", "test-audit-tier-user", ""
+	_, err := srv.UpsertRateLimitTier(ctx, &UpsertRateLimitTierReq{Name: tier})
+	assert.Nil(t, err)
+	_, err = srv.CreateUser(ctx, &CreateUserRequest{Name: name, RateLimitTier: &tier})
+	assert.Nil(t, err)
+	assert.Error(t, srv.DelRateLimitTier(ctx, &DelRateLimitTierReq{Name: tier}))
+	assert.Nil(t, srv.UpdateUser(ctx, &UpdateUserRequest{Name: name, RateLimitTier: &noTier}))
+	assert.Nil(t, srv.DelRateLimitTier(ctx, &DelRateLimitTierReq{Name: tier}))
+
+	logs, err := srv.ListAuditLogs(adminCtx, &ListAuditLogsRequest{})
+	assert.Nil(t, err)
+	require.Len(t, logs, 5)
+	expected := []struct{ action, target, result string }{
+		{AuditRateLimitTierUpsert, tier, AuditSuccess},
+		{AuditUserCreate, name + ":tier=" + tier, AuditSuccess},
+		{AuditRateLimitTierDelete, tier, AuditFailure},
+		{AuditUserUpdate, name + ":tier=", AuditSuccess},
+		{AuditRateLimitTierDelete, tier, AuditSuccess},
+	}
+	for idx, e := range expected {
+		assert.Equal(t, e.action, logs[idx].Action)
+		assert.Equal(t, e.target, logs[idx].Target)
+		assert.Equal(t, e.result, logs[idx].Result)
+	}
+}
+
+func testAuditLogOversized(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	srv := newAuditService(jwtOAuthInstance, jwtOAuthInstance.store)
+	addrs := make([]address.Address, 0, 100)
+	for i := 0; i < 100; i++ {
+		addr, err := address.NewIDAddress(uint64(10000 + i))
+		assert.Nil(t, err)
+		addrs = append(addrs, addr)
+	}
+	target := addrsTarget("test-audit-oversized", addrs)
+	assert.Greater(t, len(target), 255)
+	srv.record(core.CtxWithName(adminCtx, "admin"), AuditSignerRegister, target, errors.New(strings.Repeat("e", 2000)))
+
+	logs, err := srv.ListAuditLogs(adminCtx, &ListAuditLogsRequest{})
+	assert.Nil(t, err)
+	assert.Len(t, logs, 1)
+	assert.Len(t, logs[0].Target, 255)
+	assert.True(t, strings.HasPrefix(target, strings.TrimSuffix(logs[0].Target, "...")))
+	assert.Len(t, logs[0].Error, 1024)
+
+	res, err := srv.VerifyAuditChain(adminCtx)
+	assert.Nil(t, err)
+	assert.Nil(t, res.Broken)
+	assert.Equal(t, int64(1), res.Checked)
+}
+
+func testAuditLogUnchained(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	srv := newAuditService(jwtOAuthInstance, jwtOAuthInstance.store)
+	ctx := core.CtxWithName(adminCtx, "admin")
+	// audit logs recorded before chaining lead the chain
+	legacy := &storage.AuditLog{Id: "legacy", Time: time.Now().Add(-time.Hour).Truncate(time.Microsecond),
+		Actor: "admin", Action: AuditUserCreate, Target: "legacy", Result: AuditSuccess}
+	assert.Nil(t, jwtOAuthInstance.store.PutAuditLog(legacy))
+	for i := 0; i < 3; i++ {
+		srv.record(ctx, AuditUserCreate, fmt.Sprintf("test-audit-unchained-%d", i), nil)
+	}
+	res, err := srv.VerifyAuditChain(adminCtx)
+	assert.Nil(t, err)
+	assert.True(t, res.Intact())
+	assert.Equal(t, int64(4), res.Checked)
+	assert.Equal(t, int64(1), res.Unchained)
+
+	// removing the hashes of a chained audit log breaks the chain
+	logs, err := srv.ListAuditLogs(adminCtx, &ListAuditLogsRequest{})
+	assert.Nil(t, err)
+	require.Len(t, logs, 4)
+	blank := func(l *storage.AuditLog) {
+		blanked := *l
+		blanked.Hash, blanked.PrevHash = "", ""
+		assert.Nil(t, jwtOAuthInstance.store.PutAuditLog(&blanked))
+	}
+	blank(logs[3])
+	res, err = srv.VerifyAuditChain(adminCtx)
+	assert.Nil(t, err)
+	assert.False(t, res.Intact())
+	assert.Equal(t, logs[3].Id, res.Broken.Id)
+	assert.Contains(t, res.Reason, "not chained")
+
+	// so does removing the hashes of all audit logs
+	for _, l := range logs {
+		blank(l)
+	}
+	res, err = srv.VerifyAuditChain(adminCtx)
+	assert.Nil(t, err)
+	assert.False(t, res.Intact())
+	assert.True(t, res.NoChain)
+	assert.Nil(t, res.Broken)
+	assert.Equal(t, int64(4), res.Checked)
+}
+
 func testGetToken(t *testing.T) {
 	cfg := config.DBConfig{Type: "badger"}
 	setup(&cfg, t)
@@ -1198,6 +1843,465 @@ func testDeleteUserRateLimits(t *testing.T, userMiners map[string][]string, orig
 	assert.True(t, errors.Is(err, ErrorPermissionDeny))
 }
 
+func testEffectiveRateLimit(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	user := "test-effective-limit"
+	limits := []*UpsertUserRateLimitReq{
+		{Id: "root", Name: user},
+		{Id: "market", Name: user, Service: "market"},
+		{Id: "market-deal", Name: user, Service: "market", API: "Deal*"},
+		{Id: "market-deal-list", Name: user, Service: "market", API: "DealList"},
+		{Id: "any-wallet", Name: user, API: "Wallet*"},
+		{Id: "any-wallet-sign", Name: user, Service: "*", API: "WalletSign*"},
+	}
+	for _, l := range limits {
+		l.ReqLimit = storage.ReqLimit{Cap: 10, ResetDur: time.Minute}
+		_, err := jwtOAuthInstance.UpsertUserRateLimit(adminCtx, l)
+		require.NoError(t, err)
+	}
+
+	cases := []struct {
+		service, api, expect string
+	}{
+		{"", "", "root"},
+		{"messager", "PushMessage", "root"},
+		{"market", "", "market"},
+		{"market", "PieceList", "market"},
+		{"market", "DealGet", "market-deal"},
+		{"market", "DealList", "market-deal-list"},
+		{"gateway", "WalletList", "any-wallet"},
+		{"gateway", "WalletSignMessage", "any-wallet-sign"},
+		{"market", "WalletSign", "market"},
+	}
+	for _, c := range cases {
+		res, err := jwtOAuthInstance.GetEffectiveRateLimit(adminCtx, &GetEffectiveRateLimitReq{Name: user, Service: c.service, API: c.api})
+		require.NoError(t, err)
+		require.NotNil(t, res.Limit, c)
+		assert.Equal(t, c.expect, res.Limit.Id, c)
+	}
+
+	res, err := jwtOAuthInstance.GetEffectiveRateLimit(adminCtx, &GetEffectiveRateLimitReq{Name: "no-limit-user"})
+	assert.Nil(t, err)
+	assert.Nil(t, res.Limit)
+	_, err = jwtOAuthInstance.GetEffectiveRateLimit(readCtx, &GetEffectiveRateLimitReq{Name: user})
+	assert.Error(t, err)
+
+	for _, l := range []*UpsertUserRateLimitReq{
+		{Id: "bad-service", Name: user, Service: "mar*"},
+		{Id: "bad-api", Name: user, API: "*Sign"},
+	} {
+		_, err := jwtOAuthInstance.UpsertUserRateLimit(adminCtx, l)
+		assert.Error(t, err, l.Id)
+	}
+}
+
+func testConsumeRateLimit(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	user := "test-consume-limit"
+	for _, l := range []*UpsertUserRateLimitReq{
+		{Id: "root", Name: user, ReqLimit: storage.ReqLimit{Cap: 3, ResetDur: time.Minute}},
+		{Id: "market-deal", Name: user, Service: "market", API: "Deal*", ReqLimit: storage.ReqLimit{Cap: 2, ResetDur: time.Minute}},
+	} {
+		_, err := jwtOAuthInstance.UpsertUserRateLimit(adminCtx, l)
+		require.NoError(t, err)
+	}
+
+	consume := func(consumptions ...*RateLimitConsumption) ConsumeRateLimitResponse {
+		res, err := jwtOAuthInstance.ConsumeRateLimit(adminCtx, &ConsumeRateLimitReq{Consumptions: consumptions})
+		require.NoError(t, err)
+		require.Len(t, res, len(consumptions))
+		return res
+	}
+
+	// users without limits are never limited
+	res := consume(&RateLimitConsumption{Name: "no-limit-user", Count: 100})
+	assert.True(t, res[0].Allowed)
+	assert.Empty(t, res[0].LimitID)
+
+	deal := &RateLimitConsumption{Name: user, Service: "market", API: "DealList"}
+	res = consume(deal, deal, deal)
+	assert.Equal(t, []bool{true, true, false}, []bool{res[0].Allowed, res[1].Allowed, res[2].Allowed})
+	assert.Equal(t, "market-deal", res[2].LimitID)
+	assert.Equal(t, int64(0), res[2].Remaining)
+	assert.True(t, res[2].ResetIn > 0 && res[2].ResetIn <= time.Minute)
+
+	// the budget of root limit is not taken by the requests above
+	res = consume(&RateLimitConsumption{Name: user, Service: "market", API: "PieceList", Count: 2},
+		&RateLimitConsumption{Name: user, Count: 2}, &RateLimitConsumption{Name: user})
+	assert.Equal(t, []bool{true, false, true}, []bool{res[0].Allowed, res[1].Allowed, res[2].Allowed})
+	assert.Equal(t, "root", res[2].LimitID)
+	assert.Equal(t, int64(0), res[2].Remaining)
+
+	_, err := jwtOAuthInstance.ConsumeRateLimit(readCtx, &ConsumeRateLimitReq{Consumptions: []*RateLimitConsumption{deal}})
+	assert.Error(t, err)
+
+	// budgets are not saved unless persisted
+	count, err := jwtOAuthInstance.FlushRateLimitBuckets(adminCtx)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	jwtOAuthInstance.rateLimit = &config.RateLimitConfig{Persist: true}
+	count, err = jwtOAuthInstance.FlushRateLimitBuckets(adminCtx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	count, err = jwtOAuthInstance.FlushRateLimitBuckets(adminCtx)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	// budgets survive restarts
+	buckets, err := jwtOAuthInstance.store.ListRateLimitBuckets()
+	require.NoError(t, err)
+	require.Len(t, buckets, 2)
+	jwtOAuthInstance.rateLimits = newRateLimitCounter()
+	jwtOAuthInstance.rateLimits.load(buckets, time.Now())
+	res = consume(deal)
+	assert.False(t, res[0].Allowed)
+
+	// budgets are refilled once reset
+	later := time.Now().Add(2 * time.Minute)
+	jwtOAuthInstance.rateLimits.load(buckets, later)
+	limit := &storage.UserRateLimit{Id: "market-deal", Name: user, ReqLimit: storage.ReqLimit{Cap: 2, ResetDur: time.Minute}}
+	assert.True(t, jwtOAuthInstance.rateLimits.consume(user, limit, 1, later).Allowed)
+	purged, err := jwtOAuthInstance.store.PurgeRateLimitBuckets(later)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+
+	// limits are cached, changes through the service apply at once
+	piece := &RateLimitConsumption{Name: user, Service: "market", API: "PieceList"}
+	_, err = jwtOAuthInstance.store.PutRateLimit(&storage.UserRateLimit{Id: "market-piece", Name: user, Service: "market",
+		API: "Piece*", ReqLimit: storage.ReqLimit{Cap: 5, ResetDur: time.Minute}})
+	require.NoError(t, err)
+	assert.Equal(t, "root", consume(piece)[0].LimitID)
+	_, err = jwtOAuthInstance.UpsertUserRateLimit(adminCtx, &UpsertUserRateLimitReq{Id: "market-piece", Name: user,
+		Service: "market", API: "Piece*", ReqLimit: storage.ReqLimit{Cap: 5, ResetDur: time.Minute}})
+	require.NoError(t, err)
+	assert.Equal(t, "market-piece", consume(piece)[0].LimitID)
+}
+
+func testQuotas(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	user := "test-quota"
+	_, err := jwtOAuthInstance.UpsertUserRateLimit(adminCtx, &UpsertUserRateLimitReq{
+		Id: "negative", Name: user, Quota: storage.Quota{Daily: -1},
+	})
+	assert.Error(t, err)
+	for _, l := range []*UpsertUserRateLimitReq{
+		{Id: "root", Name: user, ReqLimit: storage.ReqLimit{Cap: 100, ResetDur: time.Minute}, Quota: storage.Quota{Daily: 3, Monthly: 10}},
+		{Id: "market", Name: user, Service: "market", Quota: storage.Quota{Monthly: 1}},
+	} {
+		_, err := jwtOAuthInstance.UpsertUserRateLimit(adminCtx, l)
+		require.NoError(t, err)
+	}
+
+	consume := func(consumptions ...*RateLimitConsumption) ConsumeRateLimitResponse {
+		res, err := jwtOAuthInstance.ConsumeRateLimit(adminCtx, &ConsumeRateLimitReq{Consumptions: consumptions})
+		require.NoError(t, err)
+		require.Len(t, res, len(consumptions))
+		return res
+	}
+
+	req := &RateLimitConsumption{Name: user}
+	res := consume(req, req, req, req)
+	assert.Equal(t, []bool{true, true, true, false}, []bool{res[0].Allowed, res[1].Allowed, res[2].Allowed, res[3].Allowed})
+	assert.Equal(t, storage.QuotaDaily, res[3].QuotaExceeded)
+	assert.True(t, res[3].ResetIn > 0 && res[3].ResetIn <= 24*time.Hour)
+	// the budget of the window is not taken by denied requests
+	assert.Equal(t, int64(97), res[3].Remaining)
+
+	// a limit could have quotas only
+	market := &RateLimitConsumption{Name: user, Service: "market"}
+	res = consume(market, market)
+	assert.True(t, res[0].Allowed)
+	assert.False(t, res[1].Allowed)
+	assert.Equal(t, storage.QuotaMonthly, res[1].QuotaExceeded)
+
+	now := time.Now()
+	day, month := storage.QuotaWindow(storage.QuotaDaily, now), storage.QuotaWindow(storage.QuotaMonthly, now)
+	expect := GetQuotaUsageResponse{
+		{LimitID: "root", Period: storage.QuotaDaily, Window: day, Quota: 3, Used: 3},
+		{LimitID: "market", Service: "market", Period: storage.QuotaMonthly, Window: month, Quota: 1, Used: 1},
+		{LimitID: "root", Period: storage.QuotaMonthly, Window: month, Quota: 10, Used: 3},
+	}
+	usages, err := jwtOAuthInstance.GetQuotaUsage(adminCtx, &GetQuotaUsageReq{Name: user})
+	require.NoError(t, err)
+	assert.Equal(t, expect, usages)
+	_, err = jwtOAuthInstance.GetQuotaUsage(readCtx, &GetQuotaUsageReq{Name: user})
+	assert.Error(t, err)
+	_, err = jwtOAuthInstance.GetQuotaUsage(adminCtx, &GetQuotaUsageReq{Name: user, Window: "2023-13"})
+	assert.Error(t, err)
+
+	// usages are saved as they are taken and survive restarts
+	jwtOAuthInstance.rateLimits = newRateLimitCounter()
+	usages, err = jwtOAuthInstance.GetQuotaUsage(adminCtx, &GetQuotaUsageReq{Name: user})
+	require.NoError(t, err)
+	assert.Equal(t, expect, usages)
+	res = consume(req, market)
+	assert.False(t, res[0].Allowed)
+	assert.False(t, res[1].Allowed)
+
+	// usages of another instance sharing the store are seen at once, the daily usage is
+	// lowered to check the monthly quota
+	require.NoError(t, jwtOAuthInstance.store.AddQuotaUsages([]*storage.QuotaUsage{
+		{Name: user, LimitID: "root", Period: storage.QuotaMonthly, Window: month, Used: 7},
+		{Name: user, LimitID: "root", Period: storage.QuotaDaily, Window: day, Used: -3},
+	}))
+	res = consume(&RateLimitConsumption{Name: user, Service: "wallet"})
+	assert.False(t, res[0].Allowed)
+	assert.Equal(t, storage.QuotaMonthly, res[0].QuotaExceeded)
+	// nothing is taken from the daily quota as the monthly one is not enough
+	dayUsages, err := jwtOAuthInstance.store.ListQuotaUsages(user, storage.QuotaDaily, day)
+	require.NoError(t, err)
+	require.Len(t, dayUsages, 1)
+	assert.Zero(t, dayUsages[0].Used)
+
+	// usages of limits without the quota anymore are reported with no quota
+	_, err = jwtOAuthInstance.UpsertUserRateLimit(adminCtx, &UpsertUserRateLimitReq{Id: "market", Name: user, Service: "market"})
+	require.NoError(t, err)
+	usages, err = jwtOAuthInstance.GetQuotaUsage(adminCtx, &GetQuotaUsageReq{Name: user, Window: month})
+	require.NoError(t, err)
+	assert.Equal(t, GetQuotaUsageResponse{
+		{LimitID: "root", Period: storage.QuotaMonthly, Window: month, Quota: 10, Used: 10},
+		{LimitID: "market", Service: "market", Period: storage.QuotaMonthly, Window: month, Used: 1},
+	}, usages)
+
+	// past windows are kept
+	usages, err = jwtOAuthInstance.GetQuotaUsage(adminCtx, &GetQuotaUsageReq{Name: user, Window: "2000-01-01"})
+	require.NoError(t, err)
+	assert.Equal(t, GetQuotaUsageResponse{
+		{LimitID: "root", Period: storage.QuotaDaily, Window: "2000-01-01", Quota: 3},
+	}, usages)
+
+	// instances sharing the store never allow more than the quota together
+	shared := "test-quota-shared"
+	_, err = jwtOAuthInstance.UpsertUserRateLimit(adminCtx, &UpsertUserRateLimitReq{Id: "shared", Name: shared, Quota: storage.Quota{Daily: 10}})
+	require.NoError(t, err)
+	other := &jwtOAuth{store: jwtOAuthInstance.store, changes: newChangeHub(), rateLimits: newRateLimitCounter()}
+	var allowed int64
+	var wg sync.WaitGroup
+	for _, instance := range []*jwtOAuth{jwtOAuthInstance, other, jwtOAuthInstance, other} {
+		wg.Add(1)
+		go func(instance *jwtOAuth) {
+			defer wg.Done()
+			for i := 0; i < 5; i++ {
+				res, err := instance.ConsumeRateLimit(adminCtx, &ConsumeRateLimitReq{
+					Consumptions: []*RateLimitConsumption{{Name: shared}},
+				})
+				assert.NoError(t, err)
+				if err == nil && res[0].Allowed {
+					atomic.AddInt64(&allowed, 1)
+				}
+			}
+		}(instance)
+	}
+	wg.Wait()
+	assert.Equal(t, int64(10), allowed)
+}
+
+func testTokenRateLimit(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	user, other := "test-token-limit", "test-token-limit-other"
+	tokens := make(map[string]string)
+	for _, name := range []string{user, other} {
+		_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: name})
+		require.NoError(t, err)
+		tokens[name], err = jwtOAuthInstance.GenerateToken(adminCtx, &JWTPayload{Name: name, Perm: core.PermRead})
+		require.NoError(t, err)
+	}
+	leaked := tokens[user]
+	fingerprint := storage.TokenFingerprint(leaked)
+
+	_, err := jwtOAuthInstance.UpsertUserRateLimit(adminCtx, &UpsertUserRateLimitReq{Id: "other", Name: user, Token: tokens[other]})
+	assert.Error(t, err)
+	_, err = jwtOAuthInstance.UpsertUserRateLimit(adminCtx, &UpsertUserRateLimitReq{Id: "invalid", Name: user, Token: "invalid"})
+	assert.Error(t, err)
+	for _, l := range []*UpsertUserRateLimitReq{
+		{Id: "user-market", Name: user, Service: "market", ReqLimit: storage.ReqLimit{Cap: 100, ResetDur: time.Minute}},
+		{Id: "token", Name: user, Token: leaked, ReqLimit: storage.ReqLimit{Cap: 1, ResetDur: time.Minute}},
+		{Id: "token-wallet", Name: user, Token: fingerprint, API: "Wallet*", ReqLimit: storage.ReqLimit{Cap: 2, ResetDur: time.Minute}},
+	} {
+		_, err := jwtOAuthInstance.UpsertUserRateLimit(adminCtx, l)
+		require.NoError(t, err)
+	}
+
+	// tokens are kept as fingerprints
+	limits, err := jwtOAuthInstance.GetUserRateLimits(adminCtx, &GetUserRateLimitsReq{Name: user, Id: "token"})
+	require.NoError(t, err)
+	require.Len(t, limits, 1)
+	assert.Equal(t, fingerprint, limits[0].Token)
+
+	cases := []struct {
+		token, service, api, expect string
+	}{
+		{"", "market", "DealList", "user-market"},
+		{"", "", "WalletSign", ""},
+		{leaked, "market", "DealList", "token"},
+		{fingerprint, "market", "DealList", "token"},
+		{leaked, "", "WalletSign", "token-wallet"},
+		{tokens[other], "market", "DealList", "user-market"},
+	}
+	for _, c := range cases {
+		res, err := jwtOAuthInstance.GetEffectiveRateLimit(adminCtx, &GetEffectiveRateLimitReq{
+			Name: user, Token: c.token, Service: c.service, API: c.api,
+		})
+		require.NoError(t, err)
+		if len(c.expect) == 0 {
+			assert.Nil(t, res.Limit, c)
+			continue
+		}
+		require.NotNil(t, res.Limit, c)
+		assert.Equal(t, c.expect, res.Limit.Id, c)
+	}
+
+	// the leaked token doesn't exhaust the budget of the user
+	res, err := jwtOAuthInstance.ConsumeRateLimit(adminCtx, &ConsumeRateLimitReq{Consumptions: []*RateLimitConsumption{
+		{Name: user, Token: fingerprint, Service: "market", Count: 1},
+		{Name: user, Token: fingerprint, Service: "market", Count: 1},
+		{Name: user, Service: "market", Count: 10},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, false, true}, []bool{res[0].Allowed, res[1].Allowed, res[2].Allowed})
+	assert.Equal(t, "token", res[1].LimitID)
+	assert.Equal(t, int64(90), res[2].Remaining)
+}
+
+func testRateLimitTiers(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	tierName, member, other := "gold", "test-tier-member", "test-tier-other"
+	_, err := jwtOAuthInstance.UpsertRateLimitTier(readCtx, &UpsertRateLimitTierReq{Name: tierName})
+	assert.Error(t, err)
+	for _, rules := range []storage.RateLimitRules{
+		{{Id: "dup", Service: "market"}, {Id: "dup", Service: "wallet"}},
+		{{Service: "market"}, {Service: "market", API: "*"}},
+		{{Service: "mark*"}},
+		{{Quota: storage.Quota{Daily: -1}}},
+	} {
+		_, err := jwtOAuthInstance.UpsertRateLimitTier(adminCtx, &UpsertRateLimitTierReq{Name: tierName, Rules: rules})
+		assert.Error(t, err)
+	}
+	comment := "paying users"
+	tier, err := jwtOAuthInstance.UpsertRateLimitTier(adminCtx, &UpsertRateLimitTierReq{
+		Name: tierName,
+		Rules: storage.RateLimitRules{
+			{Id: "tier-any", ReqLimit: storage.ReqLimit{Cap: 10, ResetDur: time.Minute}},
+			{Service: "market", ReqLimit: storage.ReqLimit{Cap: 5, ResetDur: time.Minute}, Quota: storage.Quota{Daily: 100}},
+		},
+		Comment: &comment,
+	})
+	require.NoError(t, err)
+	require.Len(t, tier.Rules, 2)
+	marketRule := tier.Rules[1].Id
+	assert.NotEmpty(t, marketRule)
+
+	// a tier must exist to be joined
+	missing := "missing"
+	_, err = jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: member, RateLimitTier: &missing})
+	assert.ErrorIs(t, err, storage.ErrRateLimitTierNotFound)
+	user, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: member, RateLimitTier: &tierName})
+	require.NoError(t, err)
+	assert.Equal(t, tierName, user.RateLimitTier)
+	_, err = jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: other})
+	require.NoError(t, err)
+
+	tier, err = jwtOAuthInstance.GetRateLimitTier(adminCtx, &GetRateLimitTierReq{Name: tierName})
+	require.NoError(t, err)
+	assert.Equal(t, []string{member}, tier.Members)
+	assert.Equal(t, comment, tier.Comment)
+
+	// rules are inherited by members, and overridden by the limits of member to the same service and api
+	_, err = jwtOAuthInstance.UpsertUserRateLimit(adminCtx, &UpsertUserRateLimitReq{
+		Id: "own-any", Name: member, Service: "*", ReqLimit: storage.ReqLimit{Cap: 20, ResetDur: time.Minute},
+	})
+	require.NoError(t, err)
+	limits, err := jwtOAuthInstance.GetUserRateLimits(adminCtx, &GetUserRateLimitsReq{Name: member})
+	require.NoError(t, err)
+	require.Len(t, limits, 2)
+	assert.Equal(t, "own-any", limits[0].Id)
+	assert.Empty(t, limits[0].Tier)
+	assert.Equal(t, marketRule, limits[1].Id)
+	assert.Equal(t, tierName, limits[1].Tier)
+	assert.Equal(t, member, limits[1].Name)
+
+	limits, err = jwtOAuthInstance.GetUserRateLimits(adminCtx, &GetUserRateLimitsReq{Name: other})
+	require.NoError(t, err)
+	assert.Empty(t, limits)
+
+	res, err := jwtOAuthInstance.GetEffectiveRateLimit(adminCtx, &GetEffectiveRateLimitReq{Name: member, Service: "market", API: "DealList"})
+	require.NoError(t, err)
+	require.NotNil(t, res.Limit)
+	assert.Equal(t, marketRule, res.Limit.Id)
+
+	budgets, err := jwtOAuthInstance.ConsumeRateLimit(adminCtx, &ConsumeRateLimitReq{Consumptions: []*RateLimitConsumption{
+		{Name: member, Service: "market", Count: 5},
+		{Name: member, Service: "market", Count: 1},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, false}, []bool{budgets[0].Allowed, budgets[1].Allowed})
+
+	usages, err := jwtOAuthInstance.GetQuotaUsage(adminCtx, &GetQuotaUsageReq{Name: member})
+	require.NoError(t, err)
+	require.Len(t, usages, 1)
+	assert.Equal(t, marketRule, usages[0].LimitID)
+	assert.Equal(t, int64(5), usages[0].Used)
+
+	// rules changed apply to members immediately, nil rules are kept
+	_, err = jwtOAuthInstance.UpsertRateLimitTier(adminCtx, &UpsertRateLimitTierReq{
+		Name:  tierName,
+		Rules: storage.RateLimitRules{{Id: marketRule, Service: "market", ReqLimit: storage.ReqLimit{Cap: 50, ResetDur: time.Minute}}},
+	})
+	require.NoError(t, err)
+	tier, err = jwtOAuthInstance.UpsertRateLimitTier(adminCtx, &UpsertRateLimitTierReq{Name: tierName})
+	require.NoError(t, err)
+	require.Len(t, tier.Rules, 1)
+	budgets, err = jwtOAuthInstance.ConsumeRateLimit(adminCtx, &ConsumeRateLimitReq{Consumptions: []*RateLimitConsumption{
+		{Name: member, Service: "market", Count: 1},
+	}})
+	require.NoError(t, err)
+	assert.True(t, budgets[0].Allowed)
+	assert.Equal(t, int64(50), budgets[0].Cap)
+
+	// a tier is deleted only if it has no member
+	assert.Error(t, jwtOAuthInstance.DelRateLimitTier(adminCtx, &DelRateLimitTierReq{Name: tierName}))
+	empty := ""
+	require.NoError(t, jwtOAuthInstance.UpdateUser(adminCtx, &UpdateUserRequest{Name: member, RateLimitTier: &empty}))
+	limits, err = jwtOAuthInstance.GetUserRateLimits(adminCtx, &GetUserRateLimitsReq{Name: member})
+	require.NoError(t, err)
+	require.Len(t, limits, 1)
+	assert.Equal(t, "own-any", limits[0].Id)
+
+	// deleted users are not members, they leave the tier deleted meanwhile once recovered
+	require.NoError(t, jwtOAuthInstance.UpdateUser(adminCtx, &UpdateUserRequest{Name: other, RateLimitTier: &tierName}))
+	require.NoError(t, jwtOAuthInstance.DeleteUser(adminCtx, &DeleteUserRequest{Name: other}))
+	tier, err = jwtOAuthInstance.GetRateLimitTier(adminCtx, &GetRateLimitTierReq{Name: tierName})
+	require.NoError(t, err)
+	assert.Empty(t, tier.Members)
+	require.NoError(t, jwtOAuthInstance.DelRateLimitTier(adminCtx, &DelRateLimitTierReq{Name: tierName}))
+	require.NoError(t, jwtOAuthInstance.RecoverUser(adminCtx, &RecoverUserRequest{Name: other}))
+	user, err = jwtOAuthInstance.GetUser(adminCtx, &GetUserRequest{Name: other})
+	require.NoError(t, err)
+	assert.Empty(t, user.RateLimitTier)
+
+	tiers, err := jwtOAuthInstance.ListRateLimitTiers(adminCtx)
+	require.NoError(t, err)
+	assert.Empty(t, tiers)
+	_, err = jwtOAuthInstance.GetRateLimitTier(adminCtx, &GetRateLimitTierReq{Name: tierName})
+	assert.ErrorIs(t, err, storage.ErrRateLimitTierNotFound)
+}
+
 func TestTokenDecode(t *testing.T) {
 	payload := []byte("eyJzdWIiOiIxMjM0NTY3ODkwIiwibmFtZSI6IkpvaG4gRG9lIiwiaWF0IjoxNTE2MjM5MDIyfQ")
 	pb, err := DecodeToBytes(payload)
@@ -1212,6 +2316,260 @@ func TestTokenDecode(t *testing.T) {
 	assert.Equal(t, a["name"], "John Doe")
 }
 
+func testSubscribeChanges(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	_, err := jwtOAuthInstance.SubscribeChanges(context.Background(), "")
+	assert.Error(t, err)
+
+	ctx, cancel := context.WithCancel(adminCtx)
+	ch, err := jwtOAuthInstance.SubscribeChanges(ctx, "")
+	assert.Nil(t, err)
+	ev := <-ch
+	assert.Equal(t, ChangeReset, ev.Type)
+
+	_, err = jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: "test-changes"})
+	assert.Nil(t, err)
+	token, err := jwtOAuthInstance.GenerateToken(adminCtx, &JWTPayload{Name: "test-changes", Perm: core.PermRead})
+	assert.Nil(t, err)
+	assert.Nil(t, jwtOAuthInstance.RemoveToken(adminCtx, token))
+	ev = <-ch
+	assert.Equal(t, ChangeTokenRemoved, ev.Type)
+	assert.Equal(t, token, ev.Token)
+	lastEventID := ev.ID()
+
+	cancel()
+	_, ok := <-ch
+	assert.False(t, ok)
+
+	// resume from the last received event
+	assert.Nil(t, jwtOAuthInstance.RecoverToken(adminCtx, token))
+	assert.Nil(t, jwtOAuthInstance.DeleteUser(adminCtx, &DeleteUserRequest{Name: "test-changes"}))
+	ctx, cancel = context.WithCancel(adminCtx)
+	defer cancel()
+	ch, err = jwtOAuthInstance.SubscribeChanges(ctx, lastEventID)
+	assert.Nil(t, err)
+	ev = <-ch
+	assert.Equal(t, ChangeTokenRecovered, ev.Type)
+	ev = <-ch
+	assert.Equal(t, ChangeUser, ev.Type)
+	assert.Equal(t, "test-changes", ev.User)
+
+	// events of another epoch can't be replayed
+	ch, err = jwtOAuthInstance.SubscribeChanges(ctx, fmt.Sprintf("%d-%d", ev.Epoch+1, ev.Seq))
+	assert.Nil(t, err)
+	ev = <-ch
+	assert.Equal(t, ChangeReset, ev.Type)
+}
+
+func testVerifyCache(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+	jwtOAuthInstance.verifyCache = newVerifyCache(&config.VerifyCacheConfig{Size: 10, TTL: time.Minute})
+	cache := jwtOAuthInstance.verifyCache
+
+	_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: "test-cache"})
+	assert.Nil(t, err)
+	pl := &JWTPayload{Name: "test-cache", Perm: core.PermRead}
+	token, err := jwtOAuthInstance.GenerateToken(adminCtx, pl)
+	assert.Nil(t, err)
+
+	for i := 0; i < 2; i++ {
+		payload, err := jwtOAuthInstance.Verify(adminCtx, token)
+		assert.Nil(t, err)
+		assert.Equal(t, pl, payload)
+		assert.Equal(t, 1, cache.lru.Len())
+	}
+
+	// removed token is dropped from cache
+	assert.Nil(t, jwtOAuthInstance.RemoveToken(adminCtx, token))
+	assert.Equal(t, 0, cache.lru.Len())
+	_, err = jwtOAuthInstance.Verify(adminCtx, token)
+	assert.Error(t, err)
+
+	assert.Nil(t, jwtOAuthInstance.RecoverToken(adminCtx, token))
+	_, err = jwtOAuthInstance.Verify(adminCtx, token)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, cache.lru.Len())
+
+	// tokens of the updated user are dropped from cache
+	comment := "updated"
+	assert.Nil(t, jwtOAuthInstance.UpdateUser(adminCtx, &UpdateUserRequest{Name: "test-cache", Comment: &comment}))
+	assert.Equal(t, 0, cache.lru.Len())
+
+	// expired token is rejected even if it is cached
+	exp := &JWTPayload{Name: "test-cache", Perm: core.PermRead, ExpirationTime: jwt.NumericDate(time.Now().Add(time.Second))}
+	token, err = jwtOAuthInstance.GenerateToken(adminCtx, exp)
+	assert.Nil(t, err)
+	_, err = jwtOAuthInstance.Verify(adminCtx, token)
+	assert.Nil(t, err)
+	jwtOAuthInstance.verifyCache.lru.Add(token, &verifiedToken{payload: *exp}, time.Minute)
+	time.Sleep(time.Second)
+	_, err = jwtOAuthInstance.Verify(adminCtx, token)
+	assert.ErrorIs(t, err, ErrorTokenExpired)
+}
+
+func testEncryptSecrets(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: "test-secrets"})
+	assert.Nil(t, err)
+	pl := &JWTPayload{Name: "test-secrets", Perm: core.PermRead}
+	plainToken, err := jwtOAuthInstance.GenerateToken(adminCtx, pl)
+	assert.Nil(t, err)
+
+	masterKey, err := config.RandSecret()
+	require.NoError(t, err)
+	box, err := storage.NewSecretBox(masterKey)
+	require.NoError(t, err)
+	jwtOAuthInstance.secrets = box
+
+	// existing secrets are encrypted once
+	count, err := storage.EncryptSecrets(jwtOAuthInstance.store, box)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+	count, err = storage.EncryptSecrets(jwtOAuthInstance.store, box)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+
+	pl2 := &JWTPayload{Name: "test-secrets", Perm: core.PermSign}
+	token, err := jwtOAuthInstance.GenerateToken(adminCtx, pl2)
+	assert.Nil(t, err)
+	for _, tk := range []string{plainToken, token} {
+		kp, err := jwtOAuthInstance.store.Get(storage.Token(tk))
+		assert.Nil(t, err)
+		assert.True(t, storage.IsSealedSecret(kp.Secret))
+		_, err = jwtOAuthInstance.Verify(readCtx, tk)
+		assert.Nil(t, err)
+	}
+
+	// secrets can't be decrypted without the master key
+	jwtOAuthInstance.secrets = nil
+	_, err = jwtOAuthInstance.Verify(readCtx, token)
+	assert.ErrorIs(t, err, storage.ErrMasterKeyRequired)
+}
+
+func testEncryptSigningKeys(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger"}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+
+	// the key generated before the master key is configured is plain
+	jwtOAuthInstance.signing = &config.SigningConfig{Alg: config.SigningAlgEd25519}
+	require.NoError(t, jwtOAuthInstance.loadSigningKeys())
+	_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: "test-signing-keys"})
+	require.NoError(t, err)
+	pl := &JWTPayload{Name: "test-signing-keys", Perm: core.PermRead}
+	oldToken, err := jwtOAuthInstance.GenerateToken(adminCtx, pl)
+	require.NoError(t, err)
+
+	masterKey, err := config.RandSecret()
+	require.NoError(t, err)
+	box, err := storage.NewSecretBox(masterKey)
+	require.NoError(t, err)
+	jwtOAuthInstance.secrets = box
+	count, err := storage.EncryptSecrets(jwtOAuthInstance.store, box)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+
+	// keys generated with the master key are sealed as well
+	_, err = jwtOAuthInstance.RotateSigningKey(adminCtx, &RotateSigningKeyRequest{Overlap: time.Hour})
+	require.NoError(t, err)
+	sks, err := jwtOAuthInstance.store.ListSigningKeys()
+	require.NoError(t, err)
+	require.Len(t, sks, 2)
+	for _, sk := range sks {
+		require.True(t, storage.IsSealedSecret(sk.PrivateKey))
+	}
+
+	pl2 := &JWTPayload{Name: "test-signing-keys", Perm: core.PermSign}
+	token, err := jwtOAuthInstance.GenerateToken(adminCtx, pl2)
+	require.NoError(t, err)
+	require.NoError(t, jwtOAuthInstance.loadSigningKeys())
+	for _, tk := range []string{oldToken, token} {
+		_, err = jwtOAuthInstance.Verify(readCtx, tk)
+		require.NoError(t, err)
+	}
+
+	// keys can't be loaded without the master key
+	jwtOAuthInstance.secrets = nil
+	require.ErrorIs(t, jwtOAuthInstance.loadSigningKeys(), storage.ErrMasterKeyRequired)
+}
+
+func testHashTokens(t *testing.T) {
+	cfg := config.DBConfig{Type: "badger", HashToken: true}
+	setup(&cfg, t)
+	defer shutdown(&cfg, t)
+	jwtOAuthInstance.verifyCache = newVerifyCache(&config.VerifyCacheConfig{Size: 10, TTL: time.Minute})
+
+	_, err := jwtOAuthInstance.CreateUser(adminCtx, &CreateUserRequest{Name: "test-hash"})
+	assert.Nil(t, err)
+	pl := &JWTPayload{Name: "test-hash", Perm: core.PermSign, Scopes: []core.Scope{"wallet:sign"}}
+	token, err := jwtOAuthInstance.GenerateToken(adminCtx, pl)
+	assert.Nil(t, err)
+	_, err = jwtOAuthInstance.Verify(readCtx, token)
+	assert.Nil(t, err)
+
+	// listings show the fingerprint only
+	infos, err := jwtOAuthInstance.GetTokenByName(adminCtx, "test-hash")
+	assert.Nil(t, err)
+	require.Len(t, infos, 1)
+	fingerprint := storage.TokenFingerprint(token)
+	assert.Empty(t, infos[0].Token)
+	assert.Equal(t, fingerprint, infos[0].Fingerprint)
+	assert.Equal(t, core.PermSign, infos[0].Perm)
+	assert.Equal(t, []string{"wallet:sign"}, infos[0].Scopes)
+
+	for _, tk := range []string{token, fingerprint} {
+		info, err := jwtOAuthInstance.GetToken(adminCtx, tk)
+		assert.Nil(t, err)
+		assert.Equal(t, fingerprint, info.Fingerprint)
+	}
+
+	// removing by fingerprint drops the cached token too
+	userCtx := core.CtxWithName(readCtx, "test-hash")
+	assert.Nil(t, jwtOAuthInstance.RemoveToken(userCtx, fingerprint))
+	assert.Equal(t, 0, jwtOAuthInstance.verifyCache.lru.Len())
+	_, err = jwtOAuthInstance.Verify(readCtx, token)
+	assert.Error(t, err)
+	assert.Nil(t, jwtOAuthInstance.RecoverToken(adminCtx, fingerprint))
+	_, err = jwtOAuthInstance.Verify(readCtx, token)
+	assert.Nil(t, err)
+
+	assert.Error(t, jwtOAuthInstance.RemoveToken(core.CtxWithName(readCtx, "other"), fingerprint))
+	_, err = jwtOAuthInstance.GetToken(adminCtx, "0123456789abcdef")
+	assert.ErrorIs(t, err, ErrorNonRegisteredToken)
+
+	// refresh tokens are stored by hash too
+	now := time.Now()
+	pair, err := jwtOAuthInstance.GenerateTokenPair(adminCtx, &JWTPayload{Name: "test-hash", Perm: core.PermRead,
+		IssuedAt: jwt.NumericDate(now), ExpirationTime: jwt.NumericDate(now.Add(time.Hour))}, 0)
+	assert.Nil(t, err)
+	hashed := storage.HashToken(storage.Token(pair.RefreshToken)).String()
+	var stored []string
+	assert.Nil(t, jwtOAuthInstance.store.WalkRecords(storage.RecordRefreshToken, func(record interface{}) error {
+		stored = append(stored, record.(*storage.RefreshToken).Token)
+		return nil
+	}))
+	assert.Equal(t, []string{hashed}, stored)
+	next, err := jwtOAuthInstance.RefreshToken(context.Background(), pair.RefreshToken)
+	assert.Nil(t, err)
+	assert.NotEqual(t, pair.RefreshToken, next.RefreshToken)
+	assert.False(t, storage.IsHashedToken(storage.Token(next.RefreshToken)))
+	// the hash in store is not a refresh token
+	_, err = jwtOAuthInstance.RefreshToken(context.Background(), storage.HashToken(storage.Token(next.RefreshToken)).String())
+	assert.ErrorIs(t, err, ErrorInvalidRefreshToken)
+	_, err = jwtOAuthInstance.RefreshToken(context.Background(), hashed)
+	assert.ErrorIs(t, err, ErrorInvalidRefreshToken)
+	_, err = jwtOAuthInstance.RefreshToken(context.Background(), next.RefreshToken)
+	assert.Nil(t, err)
+}
+
 func setup(cfg *config.DBConfig, t *testing.T) {
 	var err error
 	var dataPath string
@@ -1224,8 +2582,11 @@ func setup(cfg *config.DBConfig, t *testing.T) {
 	}
 
 	jwtOAuthInstance = &jwtOAuth{
-		store: theStore,
-		mp:    newMapper(),
+		store:      theStore,
+		mp:         newMapper(),
+		keys:       newKeyRing(),
+		changes:    newChangeHub(),
+		rateLimits: newRateLimitCounter(),
 	}
 }
 
@@ -20,12 +20,13 @@ func (o *mapper) ToOutPutUser(m *storage.User) *OutputUser {
 		return nil
 	}
 	return &OutputUser{
-		Id:         m.Id,
-		Name:       m.Name,
-		Comment:    m.Comment,
-		State:      m.State,
-		CreateTime: m.CreateTime.Unix(),
-		UpdateTime: m.UpdateTime.Unix(),
+		Id:            m.Id,
+		Name:          m.Name,
+		Comment:       m.Comment,
+		State:         m.State,
+		CreateTime:    m.CreateTime.Unix(),
+		UpdateTime:    m.UpdateTime.Unix(),
+		RateLimitTier: m.RateLimitTier,
 	}
 }
 
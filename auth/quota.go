@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+// Quota usages are counted in store, every consumption adds to them atomically if the quotas are enough,
+// so instances sharing a store never allow more than the quotas together.
+
+// quotaWindowEnd returns when the window of period containing now ends
+func quotaWindowEnd(period storage.QuotaPeriod, now time.Time) time.Time {
+	_, _, end, _ := storage.ParseQuotaWindow(storage.QuotaWindow(period, now))
+	return end
+}
+
+// takeQuotas takes `count` requests from the quotas of limit in the current windows, nothing is taken if
+// any quota is not enough, the period of which is returned then
+func (o *jwtOAuth) takeQuotas(name string, limit *storage.UserRateLimit, count int64, now time.Time) (storage.QuotaPeriod, error) {
+	var usages []*storage.QuotaUsage
+	var quotas []int64
+	for _, period := range storage.QuotaPeriods {
+		quota := limit.Quota.Cap(period)
+		if quota <= 0 {
+			continue
+		}
+		usages = append(usages, &storage.QuotaUsage{
+			Name:    name,
+			LimitID: limit.Id,
+			Period:  period,
+			Window:  storage.QuotaWindow(period, now),
+			Used:    count,
+		})
+		quotas = append(quotas, quota)
+	}
+	if len(usages) == 0 {
+		return "", nil
+	}
+	exceeded, err := o.store.TakeQuotaUsages(usages, quotas)
+	if err != nil {
+		return "", fmt.Errorf("take quotas: %w", err)
+	}
+	if exceeded != nil {
+		return exceeded.Period, nil
+	}
+	return "", nil
+}
+
+// GetQuotaUsage reports the usages of the quotas of a user in a window, which are the current day and month by default.
+// Usages taken from the quotas of removed limits are reported too.
+func (o *jwtOAuth) GetQuotaUsage(ctx context.Context, req *GetQuotaUsageReq) (GetQuotaUsageResponse, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	windows := make(map[storage.QuotaPeriod]string)
+	if len(req.Window) != 0 {
+		period, _, _, err := storage.ParseQuotaWindow(req.Window)
+		if err != nil {
+			return nil, err
+		}
+		windows[period] = req.Window
+	} else {
+		now := time.Now()
+		for _, period := range storage.QuotaPeriods {
+			windows[period] = storage.QuotaWindow(period, now)
+		}
+	}
+
+	limits, err := o.rateLimitsOf(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(limits, func(i, j int) bool {
+		return limits[i].Id < limits[j].Id
+	})
+	byID := make(map[string]*storage.UserRateLimit, len(limits))
+	for _, l := range limits {
+		byID[l.Id] = l
+	}
+
+	res := GetQuotaUsageResponse{}
+	for _, period := range storage.QuotaPeriods {
+		window, ok := windows[period]
+		if !ok {
+			continue
+		}
+		usages, err := o.store.ListQuotaUsages(req.Name, period, window)
+		if err != nil {
+			return nil, err
+		}
+		used := make(map[string]int64, len(usages))
+		for _, u := range usages {
+			used[u.LimitID] = u.Used
+		}
+
+		report := func(limitID, service, api string, quota int64) {
+			res = append(res, &QuotaUsageInfo{
+				LimitID: limitID,
+				Service: service,
+				API:     api,
+				Period:  period,
+				Window:  window,
+				Quota:   quota,
+				Used:    used[limitID],
+			})
+			delete(used, limitID)
+		}
+		for _, l := range limits {
+			if quota := l.Quota.Cap(period); quota > 0 {
+				report(l.Id, l.Service, l.API, quota)
+			}
+		}
+		// the limit is removed or has no quota of the period now
+		for _, u := range usages {
+			if _, ok := used[u.LimitID]; !ok {
+				continue
+			}
+			if l, ok := byID[u.LimitID]; ok {
+				report(l.Id, l.Service, l.API, 0)
+			} else {
+				report(u.LimitID, "", "", 0)
+			}
+		}
+	}
+	return res, nil
+}
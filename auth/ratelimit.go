@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+// RateLimitWildcard matches any service or API, an API ending with it matches the APIs of the prefix,
+// eg: "Wallet*" matches "WalletSign" and "WalletList". Empty service or API is the same as the wildcard.
+const RateLimitWildcard = "*"
+
+// Rate limits are matched by specificity, a limit of the service beats limits of any service,
+// then a limit of the exact API beats a limit of an API prefix, longer prefixes beat shorter ones,
+// and any of them beats a limit of any API. Limits of the token of request beat all limits of the user,
+// limits of other tokens never match. Limits of the same specificity are ordered by id.
+const (
+	apiScoreExact = 1 << 10
+	serviceScore  = 1 << 11
+	tokenScore    = 1 << 12
+)
+
+// rateLimitScore returns the specificity of l for the request made with the token of fingerprint,
+// -1 if l doesn't match it
+func rateLimitScore(l *storage.UserRateLimit, fingerprint, service, api string) int {
+	score := 0
+	if len(l.Token) != 0 {
+		if l.Token != fingerprint {
+			return -1
+		}
+		score = tokenScore
+	}
+	if len(l.Service) != 0 && l.Service != RateLimitWildcard {
+		if l.Service != service {
+			return -1
+		}
+		score += serviceScore
+	}
+
+	switch {
+	case len(l.API) == 0 || l.API == RateLimitWildcard:
+	case strings.HasSuffix(l.API, RateLimitWildcard):
+		prefix := strings.TrimSuffix(l.API, RateLimitWildcard)
+		if !strings.HasPrefix(api, prefix) {
+			return -1
+		}
+		score += len(prefix)
+	case l.API == api:
+		score += apiScoreExact
+	default:
+		return -1
+	}
+	return score
+}
+
+// MatchRateLimit returns the most specific limit of limits for the request, nil if none matches.
+// token is the token of request or its fingerprint, empty if it's unknown.
+func MatchRateLimit(limits []*storage.UserRateLimit, token, service, api string) *storage.UserRateLimit {
+	var fingerprint string
+	if len(token) != 0 {
+		fingerprint = storage.TokenFingerprint(token)
+	}
+	var matched *storage.UserRateLimit
+	best := -1
+	for _, l := range limits {
+		score := rateLimitScore(l, fingerprint, service, api)
+		if score < 0 {
+			continue
+		}
+		if score > best || (score == best && l.Id < matched.Id) {
+			matched, best = l, score
+		}
+	}
+	return matched
+}
+
+// validateRateLimit rejects wildcards other than the whole service, the whole API or the suffix of an API
+func validateRateLimit(l *storage.UserRateLimit) error {
+	if l.Service != RateLimitWildcard && strings.Contains(l.Service, RateLimitWildcard) {
+		return fmt.Errorf("invalid service %q, wildcard must be the whole service", l.Service)
+	}
+	if strings.Contains(strings.TrimSuffix(l.API, RateLimitWildcard), RateLimitWildcard) {
+		return fmt.Errorf("invalid api %q, wildcard must be the suffix of api", l.API)
+	}
+	if l.Quota.Daily < 0 || l.Quota.Monthly < 0 {
+		return fmt.Errorf("invalid quota %+v, quota must not be negative", l.Quota)
+	}
+	return nil
+}
+
+// GetEffectiveRateLimit returns the rate limit applying to the request of a user to an API of a service
+func (o *jwtOAuth) GetEffectiveRateLimit(ctx context.Context, req *GetEffectiveRateLimitReq) (*EffectiveRateLimitResponse, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	limits, err := o.rateLimitsOf(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &EffectiveRateLimitResponse{
+		Name:    req.Name,
+		Service: req.Service,
+		API:     req.API,
+		Limit:   MatchRateLimit(limits, req.Token, req.Service, req.API),
+	}, nil
+}
@@ -0,0 +1,275 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/log"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+	"github.com/ipfs-force-community/sophon-auth/util"
+)
+
+const (
+	rateLimitCacheSize = 4096
+	// rateLimitCacheTTL bounds how long the rate limits changed by other instances sharing the store are not seen
+	rateLimitCacheTTL = time.Minute
+)
+
+// rateLimitCounter counts the requests of users against their rate limits, so that all instances of
+// a service consuming budgets through `/ratelimit/consume` share them. The budget of a limit is `Cap`
+// requests in a `ResetDur` window, which is refilled once the window ends. The quotas of the limit in
+// the current day and month are counted in store, see `takeQuotas`.
+type rateLimitCounter struct {
+	lk      sync.Mutex
+	buckets map[string]*storage.RateLimitBucket
+	// dirty is the keys of buckets changed since they were taken by `takeDirty`
+	dirty map[string]struct{}
+	// rules caches the rate limits of users, so that consuming doesn't hit the store for every request,
+	// users are dropped by `invalidate`
+	rules *util.LRU[string, []*storage.UserRateLimit]
+}
+
+func newRateLimitCounter() *rateLimitCounter {
+	return &rateLimitCounter{
+		buckets: make(map[string]*storage.RateLimitBucket),
+		dirty:   make(map[string]struct{}),
+		rules:   util.NewLRU[string, []*storage.UserRateLimit](rateLimitCacheSize),
+	}
+}
+
+// invalidate drops the rate limits affected by `ev`
+func (c *rateLimitCounter) invalidate(ev *ChangeEvent) {
+	switch ev.Type {
+	case ChangeUser:
+		c.rules.Remove(ev.User)
+	case ChangeRateLimit:
+		if len(ev.User) != 0 {
+			c.rules.Remove(ev.User)
+			return
+		}
+		// the members of a tier are not known here
+		c.rules.Purge()
+	case ChangeReset:
+		c.rules.Purge()
+	}
+}
+
+// load restores the buckets saved in store, buckets reset already are skipped
+func (c *rateLimitCounter) load(buckets []*storage.RateLimitBucket, now time.Time) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	for _, b := range buckets {
+		if b.ResetAt.After(now) {
+			c.buckets[b.Key] = b
+		}
+	}
+}
+
+// consume takes `count` requests from the budget of `limit` of user `name`, nothing is taken if the budget
+// is not enough. A nil limit or a limit without cap and quota doesn't limit anything, quotas of limit are
+// taken from store by `takeQuotas` after the budget.
+func (c *rateLimitCounter) consume(name string, limit *storage.UserRateLimit, count int64, now time.Time) *RateLimitBudget {
+	windowed := limit != nil && limit.ReqLimit.Cap > 0 && limit.ReqLimit.ResetDur > 0
+	if !windowed {
+		if limit == nil || limit.Quota.IsEmpty() {
+			return &RateLimitBudget{Allowed: true}
+		}
+		return &RateLimitBudget{Allowed: true, LimitID: limit.Id}
+	}
+
+	key := storage.RateLimitBucketKey(name, limit.Id)
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	b, ok := c.buckets[key]
+	if !ok || !now.Before(b.ResetAt) {
+		b = &storage.RateLimitBucket{Key: key, ResetAt: now.Add(limit.ReqLimit.ResetDur)}
+		c.buckets[key] = b
+	}
+	allowed := b.Used+count <= limit.ReqLimit.Cap
+	if allowed {
+		b.Used += count
+		c.dirty[key] = struct{}{}
+	}
+	return &RateLimitBudget{
+		Allowed:   allowed,
+		LimitID:   limit.Id,
+		Cap:       limit.ReqLimit.Cap,
+		Remaining: remaining(limit, b),
+		ResetIn:   b.ResetAt.Sub(now),
+	}
+}
+
+// refund gives back `count` requests taken by `consume` from the budget of `limit`, eg. the quotas of
+// limit are not enough, `Remaining` of budget is updated then
+func (c *rateLimitCounter) refund(name string, limit *storage.UserRateLimit, count int64, budget *RateLimitBudget) {
+	if limit.ReqLimit.Cap <= 0 || limit.ReqLimit.ResetDur <= 0 {
+		return
+	}
+	key := storage.RateLimitBucketKey(name, limit.Id)
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	b, ok := c.buckets[key]
+	if !ok {
+		return
+	}
+	b.Used -= count
+	if b.Used < 0 {
+		// the bucket was reset after taken
+		b.Used = 0
+	}
+	c.dirty[key] = struct{}{}
+	budget.Remaining = remaining(limit, b)
+}
+
+func remaining(limit *storage.UserRateLimit, b *storage.RateLimitBucket) int64 {
+	remaining := limit.ReqLimit.Cap - b.Used
+	if remaining < 0 {
+		// the cap of limit was lowered in the window
+		remaining = 0
+	}
+	return remaining
+}
+
+// takeDirty returns copies of the buckets changed since the last call, buckets reset already are dropped
+func (c *rateLimitCounter) takeDirty(now time.Time) []*storage.RateLimitBucket {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	for key, b := range c.buckets {
+		if !now.Before(b.ResetAt) {
+			delete(c.buckets, key)
+			delete(c.dirty, key)
+		}
+	}
+	buckets := make([]*storage.RateLimitBucket, 0, len(c.dirty))
+	for key := range c.dirty {
+		b := *c.buckets[key]
+		buckets = append(buckets, &b)
+	}
+	c.dirty = make(map[string]struct{})
+	return buckets
+}
+
+// markDirty marks buckets dirty again, eg. they failed to be saved
+func (c *rateLimitCounter) markDirty(buckets []*storage.RateLimitBucket) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	for _, b := range buckets {
+		if _, ok := c.buckets[b.Key]; ok {
+			c.dirty[b.Key] = struct{}{}
+		}
+	}
+}
+
+// ConsumeRateLimit takes requests from the budgets of the limits applying to the consumptions in order
+func (o *jwtOAuth) ConsumeRateLimit(ctx context.Context, req *ConsumeRateLimitReq) (ConsumeRateLimitResponse, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	now := time.Now()
+	limits := make(map[string][]*storage.UserRateLimit)
+	res := make(ConsumeRateLimitResponse, 0, len(req.Consumptions))
+	for _, cons := range req.Consumptions {
+		ls, ok := limits[cons.Name]
+		if !ok {
+			if ls, err = o.cachedRateLimitsOf(cons.Name); err != nil {
+				return nil, err
+			}
+			limits[cons.Name] = ls
+		}
+		count := cons.Count
+		if count <= 0 {
+			count = 1
+		}
+		limit := MatchRateLimit(ls, cons.Token, cons.Service, cons.API)
+		budget := o.rateLimits.consume(cons.Name, limit, count, now)
+		if budget.Allowed && limit != nil && !limit.Quota.IsEmpty() {
+			period, err := o.takeQuotas(cons.Name, limit, count, now)
+			if err != nil {
+				o.rateLimits.refund(cons.Name, limit, count, budget)
+				return nil, err
+			}
+			if len(period) != 0 {
+				o.rateLimits.refund(cons.Name, limit, count, budget)
+				budget.Allowed = false
+				budget.QuotaExceeded = period
+				budget.ResetIn = quotaWindowEnd(period, now).Sub(now)
+			}
+		}
+		res = append(res, budget)
+	}
+	return res, nil
+}
+
+// cachedRateLimitsOf is `rateLimitsOf` through the cache of counter
+func (o *jwtOAuth) cachedRateLimitsOf(name string) ([]*storage.UserRateLimit, error) {
+	if limits, ok := o.rateLimits.rules.Get(name); ok {
+		return limits, nil
+	}
+	limits, err := o.rateLimitsOf(name)
+	if err != nil {
+		return nil, err
+	}
+	o.rateLimits.rules.Add(name, limits, rateLimitCacheTTL)
+	return limits, nil
+}
+
+// FlushRateLimitBuckets saves the budgets changed since the last flush to store and purges the ones
+// reset already, it returns the count of saved buckets. Nothing is saved unless `Persist` is configured.
+func (o *jwtOAuth) FlushRateLimitBuckets(ctx context.Context) (int64, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return 0, fmt.Errorf("need admin prem: %w", err)
+	}
+	if o.rateLimit == nil || !o.rateLimit.Persist {
+		return 0, nil
+	}
+
+	now := time.Now()
+	buckets := o.rateLimits.takeDirty(now)
+	if err := o.store.PutRateLimitBuckets(buckets); err != nil {
+		o.rateLimits.markDirty(buckets)
+		return 0, err
+	}
+	if _, err := o.store.PurgeRateLimitBuckets(now); err != nil {
+		return 0, err
+	}
+	return int64(len(buckets)), nil
+}
+
+// StartRateLimitFlush saves rate limit budgets every `cnf.FlushInterval` if `cnf.Persist` is set,
+// budgets are saved once more when ctx is done
+func (o *oauthApp) StartRateLimitFlush(ctx context.Context, cnf *config.RateLimitConfig) {
+	if cnf == nil || !cnf.Persist {
+		return
+	}
+	interval := cnf.FlushInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	log.Infof("start flushing rate limit budgets, interval: %v", interval)
+
+	flush := func(ctx context.Context) {
+		if _, err := o.srv.FlushRateLimitBuckets(ctx); err != nil {
+			log.Errorf("flush rate limit budgets failed: %v", err)
+		}
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				flush(core.CtxWithPerm(context.Background(), core.PermAdmin))
+				return
+			case <-ticker.C:
+				flush(core.CtxWithPerm(ctx, core.PermAdmin))
+			}
+		}
+	}()
+}
@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/log"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+// sameRateLimitTarget tells whether limits a and b apply to the same service and API, empty ones are the wildcard
+func sameRateLimitTarget(a, b string) bool {
+	if len(a) == 0 {
+		a = RateLimitWildcard
+	}
+	if len(b) == 0 {
+		b = RateLimitWildcard
+	}
+	return a == b
+}
+
+// inheritRateLimits appends the rules of tier to the limits of user `name`, a rule is overridden by
+// the limit of the user to the same service and API. Limits of tokens override nothing.
+func inheritRateLimits(name string, limits []*storage.UserRateLimit, tier *storage.RateLimitTier) []*storage.UserRateLimit {
+	res := limits
+	for _, rule := range tier.Rules {
+		overridden := false
+		for _, l := range limits {
+			if len(l.Token) == 0 && sameRateLimitTarget(l.Service, rule.Service) && sameRateLimitTarget(l.API, rule.API) {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			res = append(res, rule.Limit(name, tier.Name))
+		}
+	}
+	return res
+}
+
+// rateLimitsOf returns the limits of user `name` along with the ones inherited from the tier of user
+func (o *jwtOAuth) rateLimitsOf(name string) ([]*storage.UserRateLimit, error) {
+	limits, err := o.store.GetRateLimits(name, "")
+	if err != nil {
+		return nil, err
+	}
+	has, err := o.store.HasUser(name)
+	if err != nil || !has {
+		return limits, err
+	}
+	user, err := o.store.GetUser(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(user.RateLimitTier) == 0 {
+		return limits, nil
+	}
+	tier, err := o.store.GetRateLimitTier(user.RateLimitTier)
+	if err != nil {
+		if errors.Is(err, storage.ErrRateLimitTierNotFound) {
+			log.Warnf("rate limit tier %s of user %s not found", user.RateLimitTier, name)
+			return limits, nil
+		}
+		return nil, err
+	}
+	return inheritRateLimits(name, limits, tier), nil
+}
+
+// checkRateLimitTier returns an error if tier doesn't exist, empty tier means no tier
+func (o *jwtOAuth) checkRateLimitTier(tier string) error {
+	if len(tier) == 0 {
+		return nil
+	}
+	_, err := o.store.GetRateLimitTier(tier)
+	return err
+}
+
+// validateRateLimitRules generates ids for rules without one, and rejects rules of the same id or target
+func validateRateLimitRules(rules storage.RateLimitRules) error {
+	for idx, rule := range rules {
+		if rule == nil {
+			return fmt.Errorf("rule %d is empty", idx)
+		}
+		if len(rule.Id) == 0 {
+			rule.Id = uuid.NewString()
+		}
+		if err := validateRateLimit(rule.Limit("", "")); err != nil {
+			return err
+		}
+		for _, prev := range rules[:idx] {
+			if prev.Id == rule.Id {
+				return fmt.Errorf("duplicate rule id %s", rule.Id)
+			}
+			if sameRateLimitTarget(prev.Service, rule.Service) && sameRateLimitTarget(prev.API, rule.API) {
+				return fmt.Errorf("rules %s and %s apply to the same service and api", prev.Id, rule.Id)
+			}
+		}
+	}
+	return nil
+}
+
+// rateLimitTierMembers returns the users of each tier, deleted users are not members of their tiers,
+// see `leaveMissingRateLimitTier`
+func (o *jwtOAuth) rateLimitTierMembers() (map[string][]string, error) {
+	users, err := o.store.ListUsers(0, 0, core.UserStateUndefined)
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[string][]string)
+	for _, user := range users {
+		if user.IsDeleted == core.Deleted {
+			continue
+		}
+		if len(user.RateLimitTier) != 0 {
+			members[user.RateLimitTier] = append(members[user.RateLimitTier], user.Name)
+		}
+	}
+	return members, nil
+}
+
+// leaveMissingRateLimitTier removes user `name` from its tier if the tier doesn't exist, which happens
+// when the tier is deleted while the user is deleted
+func (o *jwtOAuth) leaveMissingRateLimitTier(name string) error {
+	user, err := o.store.GetUser(name)
+	if err != nil {
+		return err
+	}
+	if len(user.RateLimitTier) == 0 {
+		return nil
+	}
+	if _, err := o.store.GetRateLimitTier(user.RateLimitTier); !errors.Is(err, storage.ErrRateLimitTierNotFound) {
+		return err
+	}
+	log.Warnf("rate limit tier %s of user %s not found, remove user from it", user.RateLimitTier, name)
+	user.RateLimitTier = ""
+	user.UpdateTime = time.Now().Local()
+	return o.store.UpdateUser(user)
+}
+
+func toRateLimitTierInfo(t *storage.RateLimitTier, members []string) *RateLimitTierInfo {
+	return &RateLimitTierInfo{
+		Name:       t.Name,
+		Rules:      t.Rules,
+		Comment:    t.Comment,
+		Members:    members,
+		CreateTime: t.CreateTime,
+		UpdateTime: t.UpdateTime,
+	}
+}
+
+// UpsertRateLimitTier creates a tier or updates it, members of the tier apply the new rules immediately
+func (o *jwtOAuth) UpsertRateLimitTier(ctx context.Context, req *UpsertRateLimitTierReq) (*RateLimitTierInfo, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	now := time.Now().Local()
+	tier, err := o.store.GetRateLimitTier(req.Name)
+	if err != nil {
+		if !errors.Is(err, storage.ErrRateLimitTierNotFound) {
+			return nil, err
+		}
+		tier = &storage.RateLimitTier{Name: req.Name, Rules: storage.RateLimitRules{}, CreateTime: now}
+	}
+	if req.Rules != nil {
+		if err := validateRateLimitRules(req.Rules); err != nil {
+			return nil, err
+		}
+		tier.Rules = req.Rules
+	}
+	if req.Comment != nil {
+		tier.Comment = *req.Comment
+	}
+	tier.UpdateTime = now
+	if err := o.store.PutRateLimitTier(tier); err != nil {
+		return nil, err
+	}
+	o.publishChange(&ChangeEvent{Type: ChangeRateLimit, Tier: tier.Name})
+
+	members, err := o.rateLimitTierMembers()
+	if err != nil {
+		return nil, err
+	}
+	return toRateLimitTierInfo(tier, members[tier.Name]), nil
+}
+
+func (o *jwtOAuth) GetRateLimitTier(ctx context.Context, req *GetRateLimitTierReq) (*RateLimitTierInfo, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	tier, err := o.store.GetRateLimitTier(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	members, err := o.rateLimitTierMembers()
+	if err != nil {
+		return nil, err
+	}
+	return toRateLimitTierInfo(tier, members[tier.Name]), nil
+}
+
+func (o *jwtOAuth) ListRateLimitTiers(ctx context.Context) (ListRateLimitTiersResponse, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	tiers, err := o.store.ListRateLimitTiers()
+	if err != nil {
+		return nil, err
+	}
+	members, err := o.rateLimitTierMembers()
+	if err != nil {
+		return nil, err
+	}
+	infos := make(ListRateLimitTiersResponse, 0, len(tiers))
+	for _, tier := range tiers {
+		infos = append(infos, toRateLimitTierInfo(tier, members[tier.Name]))
+	}
+	return infos, nil
+}
+
+// DelRateLimitTier deletes a tier which has no member
+func (o *jwtOAuth) DelRateLimitTier(ctx context.Context, req *DelRateLimitTierReq) error {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return fmt.Errorf("need admin prem: %w", err)
+	}
+
+	members, err := o.rateLimitTierMembers()
+	if err != nil {
+		return err
+	}
+	if len(members[req.Name]) != 0 {
+		return fmt.Errorf("rate limit tier %s is used by %d users", req.Name, len(members[req.Name]))
+	}
+	if err := o.store.DelRateLimitTier(req.Name); err != nil {
+		return err
+	}
+	o.publishChange(&ChangeEvent{Type: ChangeRateLimit, Tier: req.Name})
+	return nil
+}
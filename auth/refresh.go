@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/google/uuid"
+
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/log"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+// RefreshTokenPath exchanges a refresh token for a new access token, it's authorized by the refresh token itself
+const RefreshTokenPath = "/token/refresh"
+
+func newRefreshTokenString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// GenerateTokenPair generates an access token expiring at `pl.ExpirationTime` and a refresh token to renew it,
+// the refresh token and all its successors expire after `refreshTTL`, never if it's zero.
+func (o *jwtOAuth) GenerateTokenPair(ctx context.Context, pl *JWTPayload, refreshTTL time.Duration) (*GenTokenResponse, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+	if pl.ExpirationTime == nil || pl.IssuedAt == nil {
+		return nil, fmt.Errorf("access token with refresh token must expire")
+	}
+	if refreshTTL < 0 {
+		return nil, fmt.Errorf("refresh ttl must not be negative")
+	}
+
+	token, err := o.generateToken(pl)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	rt := &storage.RefreshToken{
+		Family:     uuid.NewString(),
+		Name:       pl.Name,
+		Perm:       pl.Perm,
+		Role:       pl.Role,
+		Scopes:     pl.Scopes,
+		Extra:      pl.Extra,
+		AccessTTL:  pl.ExpirationTime.Sub(pl.IssuedAt.Time),
+		CreateTime: now,
+	}
+	if refreshTTL > 0 {
+		expireTime := now.Add(refreshTTL)
+		rt.ExpireTime = &expireTime
+	}
+	if err := o.putRefreshToken(rt); err != nil {
+		return nil, err
+	}
+	return &GenTokenResponse{Token: token, RefreshToken: rt.Token, ExpireTime: &pl.ExpirationTime.Time}, nil
+}
+
+// putRefreshToken stores rt with a new random token
+func (o *jwtOAuth) putRefreshToken(rt *storage.RefreshToken) error {
+	token, err := newRefreshTokenString()
+	if err != nil {
+		return fmt.Errorf("rand refresh token: %w", err)
+	}
+	rt.Token = token
+	if err := o.store.PutRefreshToken(rt); err != nil {
+		return fmt.Errorf("store refresh token: %w", err)
+	}
+	return nil
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new refresh token. Each refresh token
+// can be used once, using it again means it's leaked, then all refresh tokens rotated from the same one are revoked.
+func (o *jwtOAuth) RefreshToken(ctx context.Context, refreshToken string) (*GenTokenResponse, error) {
+	rt, err := o.store.GetRefreshToken(refreshToken)
+	if err != nil {
+		if errors.Is(err, storage.ErrRefreshTokenNotFound) {
+			return nil, ErrorInvalidRefreshToken
+		}
+		return nil, fmt.Errorf("get refresh token: %w", err)
+	}
+	now := time.Now()
+	if rt.Revoked {
+		return nil, fmt.Errorf("refresh token is revoked: %w", ErrorInvalidRefreshToken)
+	}
+	if rt.UsedTime != nil {
+		return nil, o.revokeRefreshTokens(rt)
+	}
+	if rt.ExpireTime != nil && !now.Before(*rt.ExpireTime) {
+		return nil, fmt.Errorf("refresh token is expired: %w", ErrorInvalidRefreshToken)
+	}
+	if err := o.checkTokenOwner(rt.Name); err != nil {
+		return nil, err
+	}
+
+	if err := o.store.UseRefreshToken(rt.Token, now); err != nil {
+		if errors.Is(err, storage.ErrRefreshTokenUsed) {
+			return nil, o.revokeRefreshTokens(rt)
+		}
+		return nil, fmt.Errorf("use refresh token: %w", err)
+	}
+
+	pl := &JWTPayload{
+		Name:           rt.Name,
+		Perm:           rt.Perm,
+		Extra:          rt.Extra,
+		Scopes:         rt.Scopes,
+		Role:           rt.Role,
+		IssuedAt:       jwt.NumericDate(now),
+		ExpirationTime: jwt.NumericDate(now.Add(rt.AccessTTL)),
+	}
+	token, err := o.generateToken(pl)
+	if err != nil {
+		return nil, err
+	}
+	next := *rt
+	next.CreateTime = now
+	next.UsedTime = nil
+	if err := o.putRefreshToken(&next); err != nil {
+		return nil, err
+	}
+	return &GenTokenResponse{Token: token, RefreshToken: next.Token, ExpireTime: &pl.ExpirationTime.Time}, nil
+}
+
+// revokeRefreshTokens revokes the family of a reused refresh token
+func (o *jwtOAuth) revokeRefreshTokens(rt *storage.RefreshToken) error {
+	log.Warnf("refresh token of user %s is reused, revoke its family %s", rt.Name, rt.Family)
+	if err := o.store.RevokeRefreshTokens(rt.Family); err != nil {
+		return fmt.Errorf("revoke refresh tokens: %w", err)
+	}
+	return ErrorRefreshTokenReused
+}
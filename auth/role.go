@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+func toCoreRole(r *storage.Role) *core.Role {
+	return &core.Role{Name: r.Name, Perm: r.Perm, Scopes: r.Scopes}
+}
+
+func toRoleInfo(r *storage.Role) *RoleInfo {
+	return &RoleInfo{
+		Name:       r.Name,
+		Perm:       r.Perm,
+		Scopes:     r.Scopes,
+		Comment:    r.Comment,
+		CreateTime: r.CreateTime,
+		UpdateTime: r.UpdateTime,
+	}
+}
+
+// getRole reads role from store, so that roles changed by other instances sharing the store apply at once
+func (o *jwtOAuth) getRole(name string) (*core.Role, error) {
+	role, err := o.store.GetRole(name)
+	if err != nil {
+		if errors.Is(err, storage.ErrRoleNotFound) {
+			return nil, fmt.Errorf("role %s: %w", name, ErrorRoleNotFound)
+		}
+		return nil, fmt.Errorf("get role %s: %w", name, err)
+	}
+	return toCoreRole(role), nil
+}
+
+// applyRole grants payload what its role grants, scopes of the token exceeding the role are dropped.
+// It fails if all scopes are dropped, since a token without scopes is granted everything of the permission.
+func applyRole(p *JWTPayload, role *core.Role) error {
+	p.Perm = role.Perm
+	if len(p.Scopes) == 0 {
+		p.Scopes = role.Scopes
+		return nil
+	}
+	scopes := make([]core.Scope, 0, len(p.Scopes))
+	for _, scope := range p.Scopes {
+		if core.ScopeWithinPerm(scope, role.Perm) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return fmt.Errorf("scopes %v exceed role %s: %w", p.Scopes, role.Name, ErrorVerificationFailed)
+	}
+	p.Scopes = scopes
+	return nil
+}
+
+func (o *jwtOAuth) CreateRole(ctx context.Context, req *CreateRoleRequest) (*RoleInfo, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	role := &core.Role{Name: req.Name, Perm: req.Perm, Scopes: req.Scopes}
+	if err := core.ValidateRole(role); err != nil {
+		return nil, err
+	}
+	_, err = o.store.GetRole(req.Name)
+	if err == nil {
+		return nil, errors.New("role already exists")
+	}
+	if !errors.Is(err, storage.ErrRoleNotFound) {
+		return nil, err
+	}
+
+	now := time.Now().Local()
+	newRole := &storage.Role{
+		Name:       req.Name,
+		Perm:       req.Perm,
+		Scopes:     req.Scopes,
+		Comment:    req.Comment,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	if err := o.store.PutRole(newRole); err != nil {
+		return nil, err
+	}
+	return toRoleInfo(newRole), nil
+}
+
+func (o *jwtOAuth) UpdateRole(ctx context.Context, req *UpdateRoleRequest) error {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return fmt.Errorf("need admin prem: %w", err)
+	}
+
+	role, err := o.store.GetRole(req.Name)
+	if err != nil {
+		return err
+	}
+	if len(req.Perm) != 0 {
+		role.Perm = req.Perm
+	}
+	if req.Scopes != nil {
+		role.Scopes = req.Scopes
+	}
+	if req.Comment != nil {
+		role.Comment = *req.Comment
+	}
+	if err := core.ValidateRole(toCoreRole(role)); err != nil {
+		return err
+	}
+	role.UpdateTime = time.Now().Local()
+	if err := o.store.PutRole(role); err != nil {
+		return err
+	}
+	o.publishChange(&ChangeEvent{Type: ChangeRole, Role: req.Name})
+	return nil
+}
+
+func (o *jwtOAuth) GetRole(ctx context.Context, req *GetRoleRequest) (*RoleInfo, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	role, err := o.store.GetRole(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return toRoleInfo(role), nil
+}
+
+func (o *jwtOAuth) ListRoles(ctx context.Context) (ListRolesResponse, error) {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("need admin prem: %w", err)
+	}
+
+	roles, err := o.store.ListRoles()
+	if err != nil {
+		return nil, err
+	}
+	infos := make(ListRolesResponse, 0, len(roles))
+	for _, role := range roles {
+		infos = append(infos, toRoleInfo(role))
+	}
+	return infos, nil
+}
+
+// DeleteRole deletes a role, tokens generated with it fail to verify afterwards
+func (o *jwtOAuth) DeleteRole(ctx context.Context, req *DeleteRoleRequest) error {
+	err := permCheck(ctx, core.PermAdmin)
+	if err != nil {
+		return fmt.Errorf("need admin prem: %w", err)
+	}
+
+	if err := o.store.DelRole(req.Name); err != nil {
+		return err
+	}
+	o.publishChange(&ChangeEvent{Type: ChangeRole, Role: req.Name})
+	return nil
+}
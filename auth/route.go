@@ -23,6 +23,10 @@ func InitRouter(app OAuthApp) http.Handler {
 	router.ContextWithFallback = true
 	router.Use(CorsMiddleWare())
 	router.Use(RewriteAddressInUrl())
+	// public keys are open to everyone, so register it before `permMiddleWare`
+	router.GET(JWKSPath, app.JWKS)
+	// authorized by the refresh token in body
+	router.POST(RefreshTokenPath, app.RefreshToken)
 	router.Use(permMiddleWare(app))
 
 	headlerFunc := healthcheck.HandlerFunc()
@@ -43,6 +47,17 @@ func InitRouter(app OAuthApp) http.Handler {
 	router.GET("/tokens", app.Tokens)
 	router.DELETE("/token", app.RemoveToken)
 	router.POST("/recoverToken", app.RecoverToken)
+	router.POST("/token/gc", app.GCTokens)
+	router.GET(ChangesPath, app.SubscribeChanges)
+	router.GET("/audit", app.ListAuditLogs)
+	router.GET("/audit/head", app.GetAuditChainHead)
+	router.GET("/audit/verify", app.VerifyAuditChain)
+	router.GET(BackupPath, app.Backup)
+
+	keyGroup := router.Group("/key")
+	keyGroup.GET("/list", app.ListSigningKeys)
+	keyGroup.POST("/rotate", app.RotateSigningKey)
+	keyGroup.POST("/retire", app.RetireSigningKey)
 
 	userGroup := router.Group("/user")
 	userGroup.PUT("/new", app.CreateUser)
@@ -54,10 +69,28 @@ func InitRouter(app OAuthApp) http.Handler {
 	userGroup.POST("/del", app.DeleteUser)
 	userGroup.POST("/recover", app.RecoverUser)
 
+	roleGroup := router.Group("/role")
+	roleGroup.PUT("/new", app.CreateRole)
+	roleGroup.POST("/update", app.UpdateRole)
+	roleGroup.GET("/list", app.ListRoles)
+	roleGroup.GET("", app.GetRole)
+	roleGroup.POST("/del", app.DeleteRole)
+
 	rateLimitGroup := userGroup.Group("/ratelimit")
 	rateLimitGroup.POST("/upsert", app.UpsertUserRateLimit)
 	rateLimitGroup.POST("/del", app.DelUserRateLimit)
 	rateLimitGroup.GET("", app.GetUserRateLimit)
+	rateLimitGroup.GET("/effective", app.GetEffectiveRateLimit)
+	router.POST("/ratelimit/consume", app.ConsumeRateLimit)
+
+	quotaGroup := userGroup.Group("/quota")
+	quotaGroup.GET("/usage", app.GetQuotaUsage)
+
+	tierGroup := router.Group("/ratelimit/tier")
+	tierGroup.POST("/upsert", app.UpsertRateLimitTier)
+	tierGroup.GET("", app.GetRateLimitTier)
+	tierGroup.GET("/list", app.ListRateLimitTiers)
+	tierGroup.POST("/del", app.DelRateLimitTier)
 
 	// Compatible with older versions(<=v1.6.0)
 	minerGroup := router.Group("/miner")
@@ -200,6 +233,7 @@ func permMiddleWare(app OAuthApp) gin.HandlerFunc {
 		if len(jwtPayload.Name) != 0 {
 			reqCtx = core.CtxWithName(reqCtx, jwtPayload.Name)
 		}
+		reqCtx = core.CtxWithScopes(reqCtx, core.ScopesOf(jwtPayload.Perm, jwtPayload.Scopes))
 		c.Request = c.Request.WithContext(reqCtx)
 
 		c.Next()
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/log"
+)
+
+// StartTokenGC purges stale tokens every `cnf.Interval` until ctx is done
+func (o *oauthApp) StartTokenGC(ctx context.Context, cnf *config.TokenGCConfig) {
+	if cnf == nil || !cnf.Enable {
+		return
+	}
+	interval := cnf.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	log.Infof("start token gc, interval: %v, retention: %v", interval, cnf.Retention)
+
+	adminCtx := core.CtxWithPerm(ctx, core.PermAdmin)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				res, err := o.srv.GCTokens(adminCtx, &GCTokensRequest{
+					Retention: cnf.Retention,
+					BatchSize: cnf.BatchSize,
+				})
+				if err != nil {
+					log.Errorf("token gc failed: %v", err)
+					continue
+				}
+				if res.Count > 0 {
+					log.Infof("token gc purged %d tokens", res.Count)
+				}
+			}
+		}
+	}()
+}
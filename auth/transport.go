@@ -13,14 +13,55 @@ type VerifyRequest struct {
 }
 type VerifyResponse = JWTPayload
 
+// VerifyFailedReason tells why a token is rejected by `/verify`
+type VerifyFailedReason string
+
+const (
+	ReasonTokenNotRegistered VerifyFailedReason = "tokenNotRegistered"
+	ReasonVerificationFailed VerifyFailedReason = "verificationFailed"
+	ReasonTokenExpired       VerifyFailedReason = "tokenExpired"
+	ReasonTokenNotValidYet   VerifyFailedReason = "tokenNotValidYet"
+	ReasonUserDisabled       VerifyFailedReason = "userDisabled"
+	ReasonUserDeleted        VerifyFailedReason = "userDeleted"
+	ReasonRoleNotFound       VerifyFailedReason = "roleNotFound"
+	// reasons of `/token/refresh`
+	ReasonRefreshTokenInvalid VerifyFailedReason = "refreshTokenInvalid"
+	ReasonRefreshTokenReused  VerifyFailedReason = "refreshTokenReused"
+)
+
+// VerifyFailedResponse is the body of `/verify` when it responds 401
+type VerifyFailedResponse struct {
+	Error  string             `json:"error"`
+	Reason VerifyFailedReason `json:"reason"`
+}
+
 type GenTokenRequest struct {
 	Name  string `form:"name" json:"name" binding:"required"`
 	Perm  string `form:"perm" json:"perm"`
 	Extra string `form:"extra" json:"extra"`
+	// Scopes restrict the token to some groups of API, eg: "market:read"
+	Scopes []string `form:"scopes" json:"scopes"`
+	// Role grants the token what the role grants, `Perm` is ignored if set
+	Role string `form:"role" json:"role"`
+	// TTL is the lifetime of token, zero means never expire
+	TTL time.Duration `form:"ttl" json:"ttl"`
+	// NotBefore is an unix timestamp before which the token is not valid, zero means valid immediately
+	NotBefore int64 `form:"nbf" json:"nbf"`
+	// Refresh generates a refresh token to renew the token, which requires `TTL`
+	Refresh bool `form:"refresh" json:"refresh"`
+	// RefreshTTL is the lifetime of the refresh token and its successors, zero means never expire
+	RefreshTTL time.Duration `form:"refreshTTL" json:"refreshTTL"`
 }
 
 type GenTokenResponse struct {
 	Token string `json:"token"`
+	// RefreshToken is returned if `GenTokenRequest.Refresh` is set or by `/token/refresh`
+	RefreshToken string     `json:"refreshToken,omitempty"`
+	ExpireTime   *time.Time `json:"expireTime,omitempty"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `form:"refreshToken" json:"refreshToken" binding:"required"`
 }
 
 type GetTokenRequest struct {
@@ -36,6 +77,112 @@ type RecoverTokenRequest struct {
 	Token string `form:"token" json:"token" binding:"required"`
 }
 
+type BackupRequest struct {
+	// Since is the version returned by the previous backup, 0 means a full backup
+	Since uint64 `form:"since" json:"since"`
+}
+
+type GCTokensRequest struct {
+	// tokens soft-deleted or expired longer than `Retention` are purged
+	Retention time.Duration `form:"retention" json:"retention"`
+	BatchSize int64         `form:"batchSize" json:"batchSize"`
+	// only list the tokens to be purged if `DryRun` is true
+	DryRun bool `form:"dryRun" json:"dryRun"`
+}
+
+type GCTokensResponse struct {
+	Count  int64        `json:"count"`
+	Tokens []*TokenInfo `json:"tokens"`
+}
+
+type SigningKeyInfo struct {
+	Kid        string               `json:"kid"`
+	Alg        string               `json:"alg"`
+	State      core.SigningKeyState `json:"state"`
+	CreateTime time.Time            `json:"createTime"`
+	RetireTime *time.Time           `json:"retireTime,omitempty"`
+}
+
+type RotateSigningKeyRequest struct {
+	// previous active keys keep verifying tokens for `Overlap` before retired
+	Overlap time.Duration `form:"overlap" json:"overlap"`
+}
+
+type RetireSigningKeyRequest struct {
+	Kid string `form:"kid" json:"kid" binding:"required"`
+}
+
+type CreateRoleRequest struct {
+	Name    string          `form:"name" json:"name" binding:"required"`
+	Perm    core.Permission `form:"perm" json:"perm" binding:"required"`
+	Scopes  []core.Scope    `form:"scopes" json:"scopes"`
+	Comment string          `form:"comment" json:"comment"`
+}
+
+type UpdateRoleRequest struct {
+	Name    string          `form:"name" json:"name" binding:"required"`
+	Perm    core.Permission `form:"perm" json:"perm"`
+	Scopes  []core.Scope    `form:"scopes" json:"scopes"`
+	Comment *string         `form:"comment" json:"comment"`
+}
+
+type GetRoleRequest struct {
+	Name string `form:"name" binding:"required"`
+}
+
+type DeleteRoleRequest struct {
+	Name string `form:"name" json:"name" binding:"required"`
+}
+
+type RoleInfo struct {
+	Name       string          `json:"name"`
+	Perm       core.Permission `json:"perm"`
+	Scopes     []core.Scope    `json:"scopes,omitempty"`
+	Comment    string          `json:"comment"`
+	CreateTime time.Time       `json:"createTime"`
+	UpdateTime time.Time       `json:"updateTime"`
+}
+
+type ListRolesResponse = []*RoleInfo
+
+type ListAuditLogsRequest struct {
+	core.Page
+	// Start and End are unix timestamps bounding audit logs in [Start, End), zero means unbounded
+	Start  int64  `form:"start" json:"start"`
+	End    int64  `form:"end" json:"end"`
+	Actor  string `form:"actor" json:"actor"`
+	Action string `form:"action" json:"action"`
+}
+
+type ListAuditLogsResponse = []*storage.AuditLog
+
+// AuditChainHead is the latest audit log of the hash chain, publishing its hash elsewhere anchors all audit logs before it
+type AuditChainHead struct {
+	Id   string    `json:"id"`
+	Time time.Time `json:"time"`
+	Hash string    `json:"hash"`
+}
+
+type VerifyAuditChainResponse struct {
+	// Checked is the number of audit logs walked through before the broken one
+	Checked int64 `json:"checked"`
+	// Unchained is the number of the leading audit logs recorded before audit logs were chained,
+	// they are included in `Checked` but can't be verified
+	Unchained int64           `json:"unchained"`
+	Head      *AuditChainHead `json:"head,omitempty"`
+	// Broken is the first audit log breaking the chain, nil if the chain is intact
+	Broken *storage.AuditLog `json:"broken,omitempty"`
+	Reason string            `json:"reason,omitempty"`
+	// NoChain is set if there are audit logs but none of them is chained, so nothing is verified,
+	// the hashes of all audit logs may have been removed
+	NoChain bool `json:"noChain,omitempty"`
+}
+
+// Intact tells whether the audit logs are verified, no audit log at all is intact
+func (r *VerifyAuditChainResponse) Intact() bool {
+	return r.Broken == nil && !r.NoChain
+}
+
 type GetTokensRequest struct {
 	*core.Page
 }
@@ -78,6 +225,8 @@ type CreateUserRequest struct {
 	Name    string         `form:"name" binding:"required"`
 	Comment *string        `form:"comment"`
 	State   core.UserState `form:"state"` // 0: disable, 1: enable
+	// RateLimitTier is the tier whose rules the user inherits, empty means no tier
+	RateLimitTier *string `form:"rateLimitTier"`
 }
 type CreateUserResponse = OutputUser
 
@@ -85,6 +234,8 @@ type UpdateUserRequest struct {
 	Name    string         `form:"name"`
 	Comment *string        `form:"comment"`
 	State   core.UserState `form:"state"`
+	// RateLimitTier is kept if it's nil, an empty one removes the user from the tier
+	RateLimitTier *string `form:"rateLimitTier"`
 }
 
 type OutputUser struct {
@@ -94,6 +245,8 @@ type OutputUser struct {
 	State      core.UserState `json:"state"`
 	CreateTime int64          `json:"createTime"`
 	UpdateTime int64          `json:"updateTime"`
+	// RateLimitTier is the tier whose rules the user inherits
+	RateLimitTier string `json:"rateLimitTier"`
 	// the field `Miners` is used for compound api `ListUserWithMiners`
 	// which calls 'listuser' and for each 'user' calls 'listminers'
 	Miners []*OutputMiner `json:"-"`
@@ -123,17 +276,80 @@ type GetUserByMinerRequest struct {
 	Miner address.Address `form:"miner" binding:"required"`
 }
 
-func (ls GetUserRateLimitResponse) MatchedLimit(service, api string) *storage.UserRateLimit {
-	// just returns root matched limit currently
-	// todo: returns most matched limit
-	for _, l := range ls {
-		if l.Service == "" && l.API == "" {
-			return l
-		}
-	}
-	return nil
+// MatchedLimit returns the most specific limit for the request, see `MatchRateLimit`
+func (ls GetUserRateLimitResponse) MatchedLimit(token, service, api string) *storage.UserRateLimit {
+	return MatchRateLimit(ls, token, service, api)
+}
+
+type GetEffectiveRateLimitReq struct {
+	Name string `form:"name" binding:"required"`
+	// Token is the token of request or its fingerprint, limits of tokens are skipped if it's empty
+	Token   string `form:"token"`
+	Service string `form:"service"`
+	API     string `form:"api"`
+}
+
+type EffectiveRateLimitResponse struct {
+	Name    string `json:"name"`
+	Service string `json:"service"`
+	API     string `json:"api"`
+	// Limit is the matched limit, nil if the request is not limited
+	Limit *storage.UserRateLimit `json:"limit"`
+}
+
+// RateLimitConsumption takes `Count` requests of a user to an API of a service from the budget of
+// the limit applying to them, see `MatchRateLimit`
+type RateLimitConsumption struct {
+	Name string `json:"name" binding:"required"`
+	// Token is the token of request or its fingerprint, limits of tokens are skipped if it's empty
+	Token   string `json:"token"`
+	Service string `json:"service"`
+	API     string `json:"api"`
+	// Count is 1 if it's not positive
+	Count int64 `json:"count"`
+}
+
+type ConsumeRateLimitReq struct {
+	Consumptions []*RateLimitConsumption `json:"consumptions" binding:"required,dive"`
+}
+
+// RateLimitBudget is the result of a consumption
+type RateLimitBudget struct {
+	// Allowed is false if the budget is not enough, nothing is consumed then
+	Allowed bool `json:"allowed"`
+	// LimitID is the limit applying to the consumption, empty if it's not limited
+	LimitID   string `json:"limitId"`
+	Cap       int64  `json:"cap"`
+	Remaining int64  `json:"remaining"`
+	// ResetIn is how long until the budget is refilled, or the window of the exceeded quota ends
+	ResetIn time.Duration `json:"resetIn"`
+	// QuotaExceeded is the period of the quota which is not enough, empty if no quota is exceeded
+	QuotaExceeded storage.QuotaPeriod `json:"quotaExceeded,omitempty"`
+}
+
+// ConsumeRateLimitResponse has the budgets of the consumptions of the request in order
+type ConsumeRateLimitResponse []*RateLimitBudget
+
+type GetQuotaUsageReq struct {
+	Name string `form:"name" binding:"required"`
+	// Window is a day(yyyy-mm-dd) or a month(yyyy-mm) in UTC, the current day and month if it's empty
+	Window string `form:"window"`
+}
+
+// QuotaUsageInfo is the usage of a quota of a limit in a window
+type QuotaUsageInfo struct {
+	LimitID string              `json:"limitId"`
+	Service string              `json:"service"`
+	API     string              `json:"api"`
+	Period  storage.QuotaPeriod `json:"period"`
+	Window  string              `json:"window"`
+	// Quota is the quota of the limit now, 0 if the limit has no quota of the period anymore
+	Quota int64 `json:"quota"`
+	Used  int64 `json:"used"`
 }
 
+type GetQuotaUsageResponse []*QuotaUsageInfo
+
 type UpsertMinerReq struct {
 	User       string          `binding:"required"`
 	Miner      address.Address `binding:"required"`
@@ -203,3 +419,30 @@ type OutputSigner struct {
 	CreatedAt, UpdatedAt time.Time
 }
 type ListSignerResp []*OutputSigner
+
+type UpsertRateLimitTierReq struct {
+	Name string `json:"name" binding:"required"`
+	// Rules replace the rules of the tier, they are kept if it's nil. Rules without id are given one.
+	Rules   storage.RateLimitRules `json:"rules"`
+	Comment *string                `json:"comment"`
+}
+
+type GetRateLimitTierReq struct {
+	Name string `form:"name" binding:"required"`
+}
+
+type DelRateLimitTierReq struct {
+	Name string `form:"name" json:"name" binding:"required"`
+}
+
+// RateLimitTierInfo is a tier of rate limits, `Members` are the users inheriting its rules
+type RateLimitTierInfo struct {
+	Name       string                 `json:"name"`
+	Rules      storage.RateLimitRules `json:"rules"`
+	Comment    string                 `json:"comment"`
+	Members    []string               `json:"members"`
+	CreateTime time.Time              `json:"createTime"`
+	UpdateTime time.Time              `json:"updateTime"`
+}
+
+type ListRateLimitTiersResponse = []*RateLimitTierInfo
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+	"github.com/ipfs-force-community/sophon-auth/util"
+)
+
+// verifiedToken is the result of a successful verification
+type verifiedToken struct {
+	payload JWTPayload
+	// kid is the signing key of the token, empty for HS256 tokens
+	kid string
+}
+
+// verifyCache caches verified tokens, so that `Verify` doesn't hit the store for every request.
+// A nil cache is disabled.
+type verifyCache struct {
+	ttl time.Duration
+	lru *util.LRU[string, *verifiedToken]
+}
+
+func newVerifyCache(cnf *config.VerifyCacheConfig) *verifyCache {
+	if cnf == nil || cnf.Size <= 0 || cnf.TTL <= 0 {
+		return nil
+	}
+	return &verifyCache{ttl: cnf.TTL, lru: util.NewLRU[string, *verifiedToken](cnf.Size)}
+}
+
+func (c *verifyCache) get(token string) (*verifiedToken, bool) {
+	if c == nil {
+		return nil, false
+	}
+	return c.lru.Get(token)
+}
+
+func (c *verifyCache) add(token string, vt *verifiedToken) {
+	if c == nil {
+		return
+	}
+	ttl := c.ttl
+	// never cache a token longer than its lifetime
+	if vt.payload.ExpirationTime != nil {
+		if left := time.Until(vt.payload.ExpirationTime.Time); left < ttl {
+			ttl = left
+		}
+	}
+	c.lru.Add(token, vt, ttl)
+}
+
+// invalidate drops the tokens affected by `ev`
+func (c *verifyCache) invalidate(ev *ChangeEvent) {
+	if c == nil {
+		return
+	}
+	switch ev.Type {
+	case ChangeTokenRemoved, ChangeTokenRecovered:
+		if len(ev.Token) != 0 {
+			c.lru.Remove(ev.Token)
+			return
+		}
+		c.lru.RemoveIf(func(token string, _ *verifiedToken) bool {
+			return storage.TokenFingerprint(token) == ev.Fingerprint
+		})
+	case ChangeUser:
+		c.lru.RemoveIf(func(_ string, vt *verifiedToken) bool {
+			return vt.payload.Name == ev.User
+		})
+	case ChangeRole:
+		c.lru.RemoveIf(func(_ string, vt *verifiedToken) bool {
+			return vt.payload.Role == ev.Role
+		})
+	case ChangeSigningKey, ChangeReset:
+		c.lru.Purge()
+	}
+}
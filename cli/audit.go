@@ -0,0 +1,153 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/core"
+)
+
+var auditSubCommand = &cli.Command{
+	Name:  "audit",
+	Usage: "Sub commands for audit logs of administrative mutations",
+	Subcommands: []*cli.Command{
+		listAuditLogsCmd,
+		verifyAuditLogsCmd,
+		auditChainHeadCmd,
+	},
+}
+
+var listAuditLogsCmd = &cli.Command{
+	Name:  "list",
+	Usage: "list audit logs in chronological order",
+	Flags: []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "since",
+			Usage: "list audit logs in the last duration, eg. 24h, ignored if `start` is set",
+		},
+		&cli.StringFlag{
+			Name:  "start",
+			Usage: "list audit logs at or after the time, in RFC3339 format, eg. 2006-01-02T15:04:05Z",
+		},
+		&cli.StringFlag{
+			Name:  "end",
+			Usage: "list audit logs before the time, in RFC3339 format",
+		},
+		&cli.StringFlag{
+			Name:  "actor",
+			Usage: "name of the user who made the mutations",
+		},
+		&cli.StringFlag{
+			Name:  "action",
+			Usage: "eg. user.create, token.generate, miner.upsert, signer.unregister",
+		},
+		&cli.Int64Flag{
+			Name:  "skip",
+			Value: 0,
+		},
+		&cli.Int64Flag{
+			Name:  "limit",
+			Value: 100,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		req := &auth.ListAuditLogsRequest{
+			Page:   core.Page{Skip: ctx.Int64("skip"), Limit: ctx.Int64("limit")},
+			Actor:  ctx.String("actor"),
+			Action: ctx.String("action"),
+		}
+		if ctx.IsSet("start") {
+			start, err := time.Parse(time.RFC3339, ctx.String("start"))
+			if err != nil {
+				return fmt.Errorf("parse `start`: %w", err)
+			}
+			req.Start = start.Unix()
+		} else if ctx.IsSet("since") {
+			req.Start = time.Now().Add(-ctx.Duration("since")).Unix()
+		}
+		if ctx.IsSet("end") {
+			end, err := time.Parse(time.RFC3339, ctx.String("end"))
+			if err != nil {
+				return fmt.Errorf("parse `end`: %w", err)
+			}
+			req.End = end.Unix()
+		}
+
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		logs, err := client.ListAuditLogs(ctx.Context, req)
+		if err != nil {
+			return err
+		}
+
+		const padding = 2
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, padding, ' ', tabwriter.TabIndent)
+		fmt.Fprintln(w, "time\tactor\taction\ttarget\tip\tresult\t")
+		for _, l := range logs {
+			result := l.Result
+			if len(l.Error) != 0 {
+				result = fmt.Sprintf("%s: %s", l.Result, l.Error)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t\n", l.Time.Format(time.RFC3339), l.Actor, l.Action, l.Target, l.IP, result)
+		}
+		return w.Flush()
+	},
+}
+
+var verifyAuditLogsCmd = &cli.Command{
+	Name:  "verify",
+	Usage: "verify the hash chain of audit logs, report the first broken link",
+	Action: func(ctx *cli.Context) error {
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		res, err := client.VerifyAuditChain(ctx.Context)
+		if err != nil {
+			return err
+		}
+		if res.Broken != nil {
+			l := res.Broken
+			return fmt.Errorf("audit chain is broken after %d audit logs at %s (time: %s, actor: %s, action: %s, target: %s): %s",
+				res.Checked, l.Id, l.Time.Format(time.RFC3339), l.Actor, l.Action, l.Target, res.Reason)
+		}
+		if res.NoChain {
+			return fmt.Errorf("none of %d audit logs is chained: %s", res.Checked, res.Reason)
+		}
+		if res.Head == nil {
+			fmt.Println("no audit logs")
+			return nil
+		}
+		fmt.Printf("audit chain is intact, checked %d audit logs (%d recorded before the chain), head: %s %s\n",
+			res.Checked, res.Unchained, res.Head.Id, res.Head.Hash)
+		return nil
+	},
+}
+
+var auditChainHeadCmd = &cli.Command{
+	Name:  "head",
+	Usage: "show the latest audit log of the hash chain, publish its hash elsewhere to anchor the chain",
+	Action: func(ctx *cli.Context) error {
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		head, err := client.GetAuditChainHead(ctx.Context)
+		if err != nil {
+			return err
+		}
+		if len(head.Id) == 0 {
+			fmt.Println("no audit logs")
+			return nil
+		}
+		fmt.Printf("id: %s\ntime: %s\nhash: %s\n", head.Id, head.Time.Format(time.RFC3339Nano), head.Hash)
+		return nil
+	},
+}
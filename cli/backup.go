@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+var backupCommand = &cli.Command{
+	Name:  "backup",
+	Usage: "back up the badger store of the running sophon-auth",
+	Description: `A full backup is taken without --since. Each backup prints the --since of the next incremental backup,
+which contains the changes after the previous backup only.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "out",
+			Usage:    "path of the backup file",
+			Required: true,
+		},
+		&cli.Uint64Flag{
+			Name:  "since",
+			Usage: "take an incremental backup after the backup which printed it",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		out := ctx.String("out")
+		f, err := os.OpenFile(out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err != nil {
+			return fmt.Errorf("create backup file: %w", err)
+		}
+		next, err := client.Backup(ctx.Context, f, ctx.Uint64("since"))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = os.Remove(out)
+			return fmt.Errorf("backup: %w", err)
+		}
+		fmt.Printf("backup is written to %s, take the next incremental backup with --since %d\n", out, next)
+		return nil
+	},
+}
+
+var restoreCommand = &cli.Command{
+	Name:  "restore",
+	Usage: "restore the badger store of the repo from backups, sophon-auth must be stopped first",
+	Description: `Backups are loaded on top of the data of the repo in the given order, so restore into a repo with
+an empty data directory, with the full backup first and the incremental backups after it in the order they were taken.`,
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:     "in",
+			Usage:    "path of the backup file, could be repeated",
+			Required: true,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		repoPath, err := GetRepoPath(ctx)
+		if err != nil {
+			return err
+		}
+		cnfPath := ctx.String("config")
+		if len(cnfPath) == 0 {
+			cnfPath = filepath.Join(repoPath, DefaultConfigFile)
+		}
+		cnf, err := config.DecodeConfig(cnfPath)
+		if err != nil {
+			return fmt.Errorf("decode config: %w", err)
+		}
+		if !strings.EqualFold(cnf.DB.Type, config.Badger) {
+			return fmt.Errorf("restore is only supported by badger store, the repo uses %s", cnf.DB.Type)
+		}
+
+		var backups []io.Reader
+		for _, in := range ctx.StringSlice("in") {
+			f, err := os.Open(in)
+			if err != nil {
+				return fmt.Errorf("open backup file: %w", err)
+			}
+			defer f.Close() // nolint
+			backups = append(backups, f)
+		}
+		dataPath := filepath.Join(repoPath, DefaultDataDir)
+		if err := storage.RestoreBadger(dataPath, backups...); err != nil {
+			return fmt.Errorf("restore: %w", err)
+		}
+		fmt.Printf("restored %d backups to %s\n", len(backups), dataPath)
+		return nil
+	},
+}
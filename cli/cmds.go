@@ -10,4 +10,14 @@ var Commands = []*cli.Command{
 	userSubCommand,
 	minerSubCommand,
 	signerSubCommand,
+	keySubCommand,
+	roleSubCommand,
+	rateLimitTierSubCommand,
+	auditSubCommand,
+	storeSubCommand,
+	secretsSubCommand,
+	exportCommand,
+	importCommand,
+	backupCommand,
+	restoreCommand,
 }
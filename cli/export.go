@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+var passphraseFlag = &cli.StringFlag{
+	Name:    "passphrase",
+	Usage:   "passphrase to encrypt or decrypt secrets in the export file, eg. token secrets, signing keys",
+	EnvVars: []string{"SOPHON_AUTH_PASSPHRASE"},
+}
+
+var exportCommand = &cli.Command{
+	Name:  "export",
+	Usage: "export all records of the store to a file, the daemon must be stopped first",
+	Description: `The export file is NDJSON, the first line is a header with the format version and the store version,
+each of the following lines is a record. Secrets are encrypted if passphrase is set.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "output",
+			Aliases:  []string{"o"},
+			Usage:    "path of the export file",
+			Required: true,
+		},
+		passphraseFlag,
+	},
+	Action: func(ctx *cli.Context) error {
+		store, err := openRepoStore(ctx)
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(ctx.String("output"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err != nil {
+			return fmt.Errorf("create export file: %w", err)
+		}
+		counts, err := storage.Export(store, f, ctx.String("passphrase"))
+		if err != nil {
+			_ = f.Close()
+			return fmt.Errorf("export: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "KIND\tEXPORTED")
+		for _, kind := range storage.RecordKinds {
+			_, _ = fmt.Fprintf(tw, "%s\t%d\n", kind, counts[kind])
+		}
+		return tw.Flush()
+	},
+}
+
+var importCommand = &cli.Command{
+	Name:  "import",
+	Usage: "import records from a file written by `export`, the daemon must be stopped first",
+	Description: `A record conflicts with an existing one if they have the same key, eg. users of the same name,
+miners of the same address. In 'merge' mode, existing records are kept, in 'replace' mode, they are
+replaced by the imported ones. Use --dry-run to see the conflicts without writing the store.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "input",
+			Aliases:  []string{"i"},
+			Usage:    "path of the export file",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "mode",
+			Usage: "merge or replace",
+			Value: string(storage.ImportMerge),
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "report what would be imported and the conflicts only",
+		},
+		passphraseFlag,
+	},
+	Action: func(ctx *cli.Context) error {
+		store, err := openRepoStore(ctx)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(ctx.String("input"))
+		if err != nil {
+			return fmt.Errorf("open export file: %w", err)
+		}
+		defer f.Close() // nolint
+
+		report, err := storage.Import(store, f, storage.ImportOptions{
+			Mode:       storage.ImportMode(ctx.String("mode")),
+			DryRun:     ctx.Bool("dry-run"),
+			Passphrase: ctx.String("passphrase"),
+		})
+		if err != nil {
+			return fmt.Errorf("import: %w", err)
+		}
+
+		if ctx.Bool("dry-run") {
+			fmt.Println("dry run, nothing is written")
+		}
+		fmt.Printf("exported at %s from store version %d\n", report.Header.CreateTime.Format(time.RFC3339), report.Header.StoreVersion)
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "KIND\tTOTAL\tCREATED\tREPLACED\tSKIPPED")
+		for _, kind := range storage.RecordKinds {
+			count := report.Counts[kind]
+			_, _ = fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\n", kind, count.Total, count.Created, count.Replaced, count.Skipped)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		if len(report.Conflicts) != 0 {
+			fmt.Printf("\n%d conflicts:\n", len(report.Conflicts))
+			for _, conflict := range report.Conflicts {
+				fmt.Printf("%s\t%s\n", conflict.Kind, conflict.Key)
+			}
+		}
+		return nil
+	},
+}
+
+// openRepoStore opens the store of the repo as `run` does
+func openRepoStore(ctx *cli.Context) (storage.Store, error) {
+	cnf, repoPath, err := loadRepoConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return storage.NewStore(cnf.DB, filepath.Join(repoPath, DefaultDataDir))
+}
+
+// loadRepoConfig decodes the config of the repo, it returns the repo path too
+func loadRepoConfig(ctx *cli.Context) (*config.Config, string, error) {
+	repoPath, err := GetRepoPath(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	cnfPath := ctx.String("config")
+	if len(cnfPath) == 0 {
+		cnfPath = filepath.Join(repoPath, DefaultConfigFile)
+	}
+	cnf, err := config.DecodeConfig(cnfPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("decode config: %w", err)
+	}
+	return cnf, repoPath, nil
+}
@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+var keySubCommand = &cli.Command{
+	Name:  "key",
+	Usage: "Sub commands for managing keys signing tokens",
+	Subcommands: []*cli.Command{
+		listKeysCmd,
+		rotateKeyCmd,
+		retireKeyCmd,
+	},
+}
+
+var listKeysCmd = &cli.Command{
+	Name:  "list",
+	Usage: "list signing keys",
+	Action: func(ctx *cli.Context) error {
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		keys, err := client.ListSigningKeys(ctx.Context)
+		if err != nil {
+			return err
+		}
+
+		const padding = 2
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, padding, ' ', tabwriter.TabIndent)
+		fmt.Fprintln(w, "kid\talg\tstate\tcreate-time\tretire-time\t")
+		for _, key := range keys {
+			retireTime := "-"
+			if key.RetireTime != nil {
+				retireTime = key.RetireTime.Format(time.RFC1123)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n", key.Kid, key.Alg, key.State,
+				key.CreateTime.Format(time.RFC1123), retireTime)
+		}
+		return w.Flush()
+	},
+}
+
+var rotateKeyCmd = &cli.Command{
+	Name:  "rotate",
+	Usage: "generate a new active signing key, previous active keys only verify tokens until retired",
+	Flags: []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "overlap",
+			Usage: "how long previous active keys keep verifying tokens",
+			Value: 7 * 24 * time.Hour,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.Duration("overlap") <= 0 {
+			return fmt.Errorf("overlap must be positive")
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		key, err := client.RotateSigningKey(ctx.Context, ctx.Duration("overlap"))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("rotate signing key success, new key: %s(%s)\n", key.Kid, key.Alg)
+		return nil
+	},
+}
+
+var retireKeyCmd = &cli.Command{
+	Name:      "retire",
+	Usage:     "retire a verify-only signing key immediately, tokens signed by it become invalid",
+	ArgsUsage: "<kid>",
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		kid := ctx.Args().First()
+		if err := client.RetireSigningKey(ctx.Context, kid); err != nil {
+			return err
+		}
+		fmt.Printf("retire signing key %s success\n", kid)
+		return nil
+	},
+}
@@ -0,0 +1,243 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+var rateLimitTierSubCommand = &cli.Command{
+	Name:  "rate-limit-tier",
+	Usage: "Sub commands for managing rate limit tiers, a tier is a named set of rate limit rules inherited by its member users",
+	Subcommands: []*cli.Command{
+		rateLimitTierSetCmd,
+		rateLimitTierSetRuleCmd,
+		rateLimitTierDelRuleCmd,
+		rateLimitTierGetCmd,
+		rateLimitTierListCmd,
+		rateLimitTierRemoveCmd,
+	},
+}
+
+var rateLimitTierSetCmd = &cli.Command{
+	Name:      "set",
+	Usage:     "Add tier or update its comment",
+	ArgsUsage: "<name>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "comment",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		req := &auth.UpsertRateLimitTierReq{Name: ctx.Args().First()}
+		if ctx.IsSet("comment") {
+			comment := ctx.String("comment")
+			req.Comment = &comment
+		}
+		tier, err := client.UpsertRateLimitTier(ctx.Context, req)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("set rate limit tier %s success\n", tier.Name)
+		return nil
+	},
+}
+
+var rateLimitTierSetRuleCmd = &cli.Command{
+	Name:      "set-rule",
+	Usage:     "Set the rule of tier applying to an api of a service, the tier is added if not exists. Members apply it immediately",
+	ArgsUsage: "<name>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "service", Usage: "service the rule applies to, eg. market, '*' or empty for any service"},
+		&cli.StringFlag{Name: "api", Usage: "api the rule applies to, ending with '*' for apis of the prefix, eg. Wallet*, '*' or empty for any api"},
+		&cli.Int64Flag{Name: "cap", Usage: "requests allowed in a duration, 0 for no limit"},
+		&cli.DurationFlag{Name: "duration", Usage: "duration the cap of requests is refilled, eg. 1m, 2h"},
+		&cli.Int64Flag{Name: "daily", Usage: "requests allowed in a day, 0 for no daily quota"},
+		&cli.Int64Flag{Name: "monthly", Usage: "requests allowed in a month, 0 for no monthly quota"},
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		name := ctx.Args().First()
+		tiers, err := client.ListRateLimitTiers(ctx.Context)
+		if err != nil {
+			return err
+		}
+		rules := storage.RateLimitRules{}
+		for _, tier := range tiers {
+			if tier.Name == name {
+				rules = tier.Rules
+			}
+		}
+
+		service, api := ctx.String("service"), ctx.String("api")
+		var rule *storage.RateLimitRule
+		for _, r := range rules {
+			if r.Service == service && r.API == api {
+				rule = r
+				break
+			}
+		}
+		if rule == nil {
+			rule = &storage.RateLimitRule{Service: service, API: api}
+			rules = append(rules, rule)
+		}
+		if ctx.IsSet("cap") {
+			rule.ReqLimit.Cap = ctx.Int64("cap")
+		}
+		if ctx.IsSet("duration") {
+			rule.ReqLimit.ResetDur = ctx.Duration("duration")
+		}
+		if ctx.IsSet("daily") {
+			rule.Quota.Daily = ctx.Int64("daily")
+		}
+		if ctx.IsSet("monthly") {
+			rule.Quota.Monthly = ctx.Int64("monthly")
+		}
+
+		tier, err := client.UpsertRateLimitTier(ctx.Context, &auth.UpsertRateLimitTierReq{Name: name, Rules: rules})
+		if err != nil {
+			return err
+		}
+		for _, r := range tier.Rules {
+			if r.Service == service && r.API == api {
+				fmt.Printf("set rule of rate limit tier %s success: %s\n", tier.Name, r.Id)
+			}
+		}
+		return nil
+	},
+}
+
+var rateLimitTierDelRuleCmd = &cli.Command{
+	Name:      "del-rule",
+	Usage:     "Remove a rule of tier",
+	ArgsUsage: "<name> <rule-id>",
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 2 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		name, id := ctx.Args().Get(0), ctx.Args().Get(1)
+		tier, err := client.GetRateLimitTier(ctx.Context, name)
+		if err != nil {
+			return err
+		}
+		rules := make(storage.RateLimitRules, 0, len(tier.Rules))
+		for _, r := range tier.Rules {
+			if r.Id != id {
+				rules = append(rules, r)
+			}
+		}
+		if len(rules) == len(tier.Rules) {
+			return fmt.Errorf("rule %s of rate limit tier %s not exists", id, name)
+		}
+		if _, err := client.UpsertRateLimitTier(ctx.Context, &auth.UpsertRateLimitTierReq{Name: name, Rules: rules}); err != nil {
+			return err
+		}
+		fmt.Printf("remove rule %s of rate limit tier %s success\n", id, name)
+		return nil
+	},
+}
+
+var rateLimitTierGetCmd = &cli.Command{
+	Name:      "get",
+	Usage:     "Get tier by name",
+	ArgsUsage: "<name>",
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		tier, err := client.GetRateLimitTier(ctx.Context, ctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("name:       ", tier.Name)
+		fmt.Println("comment:    ", tier.Comment)
+		fmt.Println("members:    ", strings.Join(tier.Members, ","))
+		fmt.Println("createTime: ", tier.CreateTime.Format(time.RFC1123))
+		fmt.Println("updateTime: ", tier.UpdateTime.Format(time.RFC1123))
+		fmt.Println("rules:")
+		for _, r := range tier.Rules {
+			fmt.Printf("  rule id:%s, service:%s, api:%s, request limit amount:%d, duration:%.2f(h), daily quota:%d, monthly quota:%d\n",
+				r.Id, rateLimitTarget(r.Service), rateLimitTarget(r.API), r.ReqLimit.Cap, r.ReqLimit.ResetDur.Hours(),
+				r.Quota.Daily, r.Quota.Monthly)
+		}
+		return nil
+	},
+}
+
+var rateLimitTierListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "List tiers",
+	Action: func(ctx *cli.Context) error {
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		tiers, err := client.ListRateLimitTiers(ctx.Context)
+		if err != nil {
+			return err
+		}
+
+		const padding = 2
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, padding, ' ', tabwriter.TabIndent)
+		fmt.Fprintln(w, "name\trules\tmembers\tcomment\t")
+		for _, tier := range tiers {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\t\n", tier.Name, len(tier.Rules), len(tier.Members), tier.Comment)
+		}
+		return w.Flush()
+	},
+}
+
+var rateLimitTierRemoveCmd = &cli.Command{
+	Name:      "rm",
+	Usage:     "Remove tier, which must have no member",
+	ArgsUsage: "<name>",
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		name := ctx.Args().First()
+		if err := client.DelRateLimitTier(ctx.Context, name); err != nil {
+			return err
+		}
+		fmt.Printf("remove rate limit tier %s success\n", name)
+		return nil
+	},
+}
@@ -0,0 +1,186 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/core"
+)
+
+var roleSubCommand = &cli.Command{
+	Name:  "role",
+	Usage: "Sub commands for managing roles, a role is a named set of permission and scopes",
+	Subcommands: []*cli.Command{
+		roleAddCmd,
+		roleGetCmd,
+		roleUpdateCmd,
+		roleListCmd,
+		roleRemoveCmd,
+	},
+}
+
+var roleAddCmd = &cli.Command{
+	Name:      "add",
+	Usage:     "Add role",
+	ArgsUsage: "<name>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "perm",
+			Usage:    "permission granted by the role (read, write, sign, admin)",
+			Required: true,
+		},
+		&cli.StringSliceFlag{
+			Name:  "scope",
+			Usage: "API groups granted by the role, eg. market:read, wallet:sign, granted by perm if not set",
+		},
+		&cli.StringFlag{
+			Name: "comment",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		role, err := client.CreateRole(ctx.Context, &auth.CreateRoleRequest{
+			Name:    ctx.Args().First(),
+			Perm:    ctx.String("perm"),
+			Scopes:  ctx.StringSlice("scope"),
+			Comment: ctx.String("comment"),
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("add role %s success\n", role.Name)
+		return nil
+	},
+}
+
+var roleGetCmd = &cli.Command{
+	Name:      "get",
+	Usage:     "Get role by name",
+	ArgsUsage: "<name>",
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		role, err := client.GetRole(ctx.Context, ctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("name:       ", role.Name)
+		fmt.Println("perm:       ", role.Perm)
+		fmt.Println("scopes:     ", strings.Join(core.ScopesOf(role.Perm, role.Scopes), ","))
+		fmt.Println("comment:    ", role.Comment)
+		fmt.Println("createTime: ", role.CreateTime.Format(time.RFC1123))
+		fmt.Println("updateTime: ", role.UpdateTime.Format(time.RFC1123))
+		return nil
+	},
+}
+
+var roleUpdateCmd = &cli.Command{
+	Name:      "update",
+	Usage:     "Update role, tokens generated with it are granted the new permission and scopes",
+	ArgsUsage: "<name>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "perm",
+			Usage: "permission granted by the role (read, write, sign, admin)",
+		},
+		&cli.StringSliceFlag{
+			Name:  "scope",
+			Usage: "API groups granted by the role, replaces the previous scopes",
+		},
+		&cli.StringFlag{
+			Name: "comment",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		req := &auth.UpdateRoleRequest{
+			Name: ctx.Args().First(),
+			Perm: ctx.String("perm"),
+		}
+		if ctx.IsSet("scope") {
+			req.Scopes = ctx.StringSlice("scope")
+		}
+		if ctx.IsSet("comment") {
+			comment := ctx.String("comment")
+			req.Comment = &comment
+		}
+		if err := client.UpdateRole(ctx.Context, req); err != nil {
+			return err
+		}
+		fmt.Printf("update role %s success\n", req.Name)
+		return nil
+	},
+}
+
+var roleListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "List roles",
+	Action: func(ctx *cli.Context) error {
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		roles, err := client.ListRoles(ctx.Context)
+		if err != nil {
+			return err
+		}
+
+		const padding = 2
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, padding, ' ', tabwriter.TabIndent)
+		fmt.Fprintln(w, "name\tperm\tscopes\tcomment\t")
+		for _, role := range roles {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", role.Name, role.Perm,
+				strings.Join(core.ScopesOf(role.Perm, role.Scopes), ","), role.Comment)
+		}
+		return w.Flush()
+	},
+}
+
+var roleRemoveCmd = &cli.Command{
+	Name:      "rm",
+	Usage:     "Remove role, tokens generated with it become invalid",
+	ArgsUsage: "<name>",
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		name := ctx.Args().First()
+		if err := client.DeleteRole(ctx.Context, name); err != nil {
+			return err
+		}
+		fmt.Printf("remove role %s success\n", name)
+		return nil
+	},
+}
@@ -26,7 +26,7 @@ var runCommand = &cli.Command{
 		},
 		&cli.StringFlag{
 			Name:  "db-type",
-			Usage: "which db to use. sqlite/mysql",
+			Usage: "which db to use. badger/sqlite/mysql/postgres",
 		},
 	},
 	Action: run,
@@ -100,12 +100,22 @@ func run(cliCtx *cli.Context) error {
 	log.InitLog(cnf.Log)
 
 	dataPath := repo.GetDataDir()
-	app, err := auth.NewOAuthApp(dataPath, cnf.DB)
+	secrets, err := loadSecretBox(cnf.Secrets)
+	if err != nil {
+		return err
+	}
+	if secrets == nil {
+		log.Warnf("master key is not configured, token secrets are stored in plain")
+	}
+	app, err := auth.NewOAuthApp(dataPath, cnf.DB, auth.WithSigningConfig(cnf.Signing),
+		auth.WithVerifyCacheConfig(cnf.VerifyCache), auth.WithSecretBox(secrets), auth.WithRateLimitConfig(cnf.RateLimit))
 	if err != nil {
 		return fmt.Errorf("init oauth app: %s", err)
 	}
 
-	token, err := app.GetDefaultAdminToken()
+	// the saved token doesn't exist in a new repo
+	saved, _ := repo.GetToken()
+	token, err := app.GetDefaultAdminToken(saved)
 	if err != nil {
 		return fmt.Errorf("get default admin token: %s", err)
 	}
@@ -115,6 +125,9 @@ func run(cliCtx *cli.Context) error {
 		return fmt.Errorf("save token: %s", err)
 	}
 
+	app.StartTokenGC(cliCtx.Context, cnf.TokenGC)
+	app.StartRateLimitFlush(cliCtx.Context, cnf.RateLimit)
+
 	router := auth.InitRouter(app)
 
 	if cnf.Trace != nil && cnf.Trace.JaegerTracingEnabled {
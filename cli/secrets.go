@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+var secretsSubCommand = &cli.Command{
+	Name:  "secrets",
+	Usage: "Sub commands for the master key which encrypts token secrets",
+	Subcommands: []*cli.Command{
+		genMasterKeyCmd,
+		rekeySecretsCmd,
+	},
+}
+
+var genMasterKeyCmd = &cli.Command{
+	Name:  "gen-key",
+	Usage: "generate a master key to a file",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "out",
+			Usage:    "path of the master key file",
+			Required: true,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		key, err := config.RandSecret()
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(ctx.String("out"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err != nil {
+			return fmt.Errorf("create master key file: %w", err)
+		}
+		if _, err := f.WriteString(hex.EncodeToString(key)); err != nil {
+			_ = f.Close()
+			return err
+		}
+		return f.Close()
+	},
+}
+
+var rekeySecretsCmd = &cli.Command{
+	Name:  "rekey",
+	Usage: "re-encrypt token secrets and signing keys with a new master key, the daemon must be stopped first",
+	Description: `Secrets encrypted by the master key of the config are re-encrypted by the new one, plain secrets are
+encrypted too. Configure the new master key in the config once it succeeds, running it again after a failure
+continues the work.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "new-key-file",
+			Usage:    "path of the new master key file, see `secrets gen-key`",
+			Required: true,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		cnf, _, err := loadRepoConfig(ctx)
+		if err != nil {
+			return err
+		}
+		from, err := loadSecretBox(cnf.Secrets)
+		if err != nil {
+			return err
+		}
+		to, err := loadSecretBox(&config.SecretsConfig{MasterKeyFile: ctx.String("new-key-file")})
+		if err != nil {
+			return err
+		}
+		if to == nil {
+			return fmt.Errorf("new master key file %s is empty", ctx.String("new-key-file"))
+		}
+
+		store, err := openRepoStore(ctx)
+		if err != nil {
+			return err
+		}
+		count, err := storage.RekeySecrets(store, from, to)
+		if err != nil {
+			return fmt.Errorf("rekey secrets after %d tokens and signing keys updated: %w", count, err)
+		}
+		fmt.Printf("secrets of %d tokens and signing keys are encrypted by master key %s, configure it in the config now\n", count, to.ID())
+		return nil
+	},
+}
+
+// loadSecretBox returns nil if no master key is configured
+func loadSecretBox(cnf *config.SecretsConfig) (*storage.SecretBox, error) {
+	key, err := cnf.LoadMasterKey()
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, nil
+	}
+	return storage.NewSecretBox(key)
+}
@@ -0,0 +1,175 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+)
+
+var storeSubCommand = &cli.Command{
+	Name:  "store",
+	Usage: "Sub commands for the store of sophon-auth, the daemon must be stopped before running them",
+	Subcommands: []*cli.Command{
+		migrateStoreCmd,
+	},
+}
+
+var migrateStoreCmd = &cli.Command{
+	Name:  "migrate",
+	Usage: "copy all records from one store to another, eg. from badger to mysql",
+	Description: `The stores are opened with the db config of the config files, the data directory of badger or sqlite
+is the 'data' directory next to the config file. Records are copied as they are, soft-deleted ones included.
+An interrupted migration is resumed by running the same command again, the progress is saved in a file
+next to the config file of '--to' and removed once the migration succeeds.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "from",
+			Usage:    "config file of the store to migrate from",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "to",
+			Usage:    "config file of the store to migrate to",
+			Required: true,
+		},
+		&cli.BoolFlag{
+			Name:  "restart",
+			Usage: "ignore the progress of the previous migration and copy all records again",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		fromPath, err := filepath.Abs(ctx.String("from"))
+		if err != nil {
+			return err
+		}
+		toPath, err := filepath.Abs(ctx.String("to"))
+		if err != nil {
+			return err
+		}
+		if fromPath == toPath {
+			return errors.New("can't migrate a store to itself")
+		}
+
+		from, err := openStore(fromPath)
+		if err != nil {
+			return fmt.Errorf("open store of %s: %w", fromPath, err)
+		}
+		to, err := openStore(toPath)
+		if err != nil {
+			return fmt.Errorf("open store of %s: %w", toPath, err)
+		}
+
+		progressPath := filepath.Join(filepath.Dir(toPath), migrateProgressFile)
+		progress := &migrateProgress{From: fromPath, To: toPath, Copied: storage.CopyProgress{}}
+		if !ctx.Bool("restart") {
+			if progress, err = loadMigrateProgress(progressPath, fromPath, toPath); err != nil {
+				return err
+			}
+		}
+		for _, kind := range storage.RecordKinds {
+			if copied := progress.Copied[kind]; copied > 0 {
+				fmt.Printf("resume %s records after %d copied ones\n", kind, copied)
+			}
+		}
+
+		if err := storage.CopyRecords(from, to, progress.Copied, func(copied storage.CopyProgress) error {
+			progress.Copied = copied
+			return progress.save(progressPath)
+		}); err != nil {
+			return fmt.Errorf("migrate store: %w", err)
+		}
+
+		fromCounts, err := storage.CountRecords(from)
+		if err != nil {
+			return err
+		}
+		toCounts, err := storage.CountRecords(to)
+		if err != nil {
+			return err
+		}
+		var mismatched []storage.RecordKind
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "KIND\tFROM\tTO\tRESULT")
+		for _, kind := range storage.RecordKinds {
+			result := "ok"
+			if fromCounts[kind] != toCounts[kind] {
+				result = "mismatch"
+				mismatched = append(mismatched, kind)
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", kind, fromCounts[kind], toCounts[kind], result)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		if len(mismatched) != 0 {
+			return fmt.Errorf("count of %v records mismatch, records may be in the target store before migration", mismatched)
+		}
+
+		if err := os.Remove(progressPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove migration progress: %w", err)
+		}
+		return nil
+	},
+}
+
+// openStore opens the store configured in the config file, with the data directory of the repo
+func openStore(cnfPath string) (storage.Store, error) {
+	cnf, err := config.DecodeConfig(cnfPath)
+	if err != nil {
+		return nil, fmt.Errorf("decode config: %w", err)
+	}
+	return storage.NewStore(cnf.DB, filepath.Join(filepath.Dir(cnfPath), DefaultDataDir))
+}
+
+const migrateProgressFile = "migrate-progress.json"
+
+type migrateProgress struct {
+	From   string
+	To     string
+	Copied storage.CopyProgress
+}
+
+// loadMigrateProgress loads the progress of the previous migration between the same stores
+func loadMigrateProgress(path, from, to string) (*migrateProgress, error) {
+	progress := &migrateProgress{From: from, To: to, Copied: storage.CopyProgress{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return progress, nil
+		}
+		return nil, fmt.Errorf("read migration progress: %w", err)
+	}
+	var previous migrateProgress
+	if err := json.Unmarshal(data, &previous); err != nil {
+		return nil, fmt.Errorf("decode migration progress %s: %w", path, err)
+	}
+	if previous.From != from || previous.To != to {
+		return nil, fmt.Errorf("%s is the progress of migrating from %s to %s, use --restart to ignore it",
+			path, previous.From, previous.To)
+	}
+	if previous.Copied != nil {
+		progress.Copied = previous.Copied
+	}
+	return progress, nil
+}
+
+// save writes the progress to a temporary file first, so that it's never half written
+func (p *migrateProgress) save(path string) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("save migration progress: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
@@ -2,10 +2,14 @@ package cli
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/urfave/cli/v2"
 
+	"github.com/ipfs-force-community/sophon-auth/auth"
 	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/jwtclient"
 )
 
 var tokenSubCommand = &cli.Command{
@@ -13,10 +17,12 @@ var tokenSubCommand = &cli.Command{
 	Usage: "token command",
 	Subcommands: []*cli.Command{
 		genTokenCmd,
+		refreshTokenCmd,
 		getTokenCmd,
 		listTokensCmd,
 		removeTokenCmd,
 		recoverTokenCmd,
+		gcTokensCmd,
 	},
 }
 
@@ -24,7 +30,7 @@ var genTokenCmd = &cli.Command{
 	Name:      "gen",
 	Usage:     "generate token",
 	ArgsUsage: "[name]",
-	UsageText: "./sophon-auth token gen --perm=<auth> [name]",
+	UsageText: "./sophon-auth token gen --perm=<auth>|--role=<role> [--ttl=<duration>] [--refresh [--refresh-ttl=<duration>]] [--scope=<resource:action>...] [name]",
 	Flags: []cli.Flag{
 		&cli.StringFlag{
 			Name:  "perm",
@@ -35,6 +41,26 @@ var genTokenCmd = &cli.Command{
 			Usage: "custom string in JWT payload",
 			Value: "",
 		},
+		&cli.DurationFlag{
+			Name:  "ttl",
+			Usage: "lifetime of the token, eg. 720h, never expire if not set",
+		},
+		&cli.StringSliceFlag{
+			Name:  "scope",
+			Usage: "restrict the token to API groups, eg. market:read, wallet:sign, granted by perm if not set",
+		},
+		&cli.StringFlag{
+			Name:  "role",
+			Usage: "grant the token what the role grants, `perm` is ignored if set",
+		},
+		&cli.BoolFlag{
+			Name:  "refresh",
+			Usage: "also generate a refresh token to renew the token, requires `ttl`",
+		},
+		&cli.DurationFlag{
+			Name:  "refresh-ttl",
+			Usage: "lifetime of the refresh token and its successors, never expire if not set",
+		},
 	},
 	Action: func(ctx *cli.Context) error {
 		client, err := GetCli(ctx)
@@ -46,17 +72,49 @@ var genTokenCmd = &cli.Command{
 		}
 		name := ctx.Args().Get(0)
 
-		if !ctx.IsSet("perm") {
-			return fmt.Errorf("`perm` flag not set")
+		var opts []jwtclient.GenTokenOption
+		perm := ctx.String("perm")
+		if ctx.IsSet("role") {
+			opts = append(opts, jwtclient.WithRole(ctx.String("role")))
+		} else {
+			if !ctx.IsSet("perm") {
+				return fmt.Errorf("`perm` flag not set")
+			}
+			if !core.IsValid(perm) {
+				return fmt.Errorf("`perm` flag invalid")
+			}
 		}
 
-		perm := ctx.String("perm")
-		if !core.IsValid(perm) {
-			return fmt.Errorf("`perm` flag invalid")
+		if ctx.IsSet("ttl") {
+			ttl := ctx.Duration("ttl")
+			if ttl <= 0 {
+				return fmt.Errorf("`ttl` must be positive")
+			}
+			opts = append(opts, jwtclient.WithTTL(ttl))
+		}
+		if scopes := ctx.StringSlice("scope"); len(scopes) > 0 {
+			for _, scope := range scopes {
+				if err := core.ValidateScope(scope); err != nil {
+					return err
+				}
+			}
+			opts = append(opts, jwtclient.WithScopes(scopes...))
 		}
 
 		extra := ctx.String("extra")
-		tk, err := client.GenerateToken(ctx.Context, name, perm, extra)
+		if ctx.Bool("refresh") {
+			if !ctx.IsSet("ttl") {
+				return fmt.Errorf("`ttl` is required to generate a refresh token")
+			}
+			res, err := client.GenerateTokenPair(ctx.Context, name, perm, extra, ctx.Duration("ttl"), ctx.Duration("refresh-ttl"), opts...)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("generate token success: %s\n", res.Token)
+			fmt.Printf("refresh token: %s\n", res.RefreshToken)
+			return nil
+		}
+		tk, err := client.GenerateToken(ctx.Context, name, perm, extra, opts...)
 		if err != nil {
 			return err
 		}
@@ -66,6 +124,30 @@ var genTokenCmd = &cli.Command{
 	},
 }
 
+var refreshTokenCmd = &cli.Command{
+	Name:      "refresh",
+	Usage:     "exchange a refresh token for a new token and a new refresh token, the used one becomes invalid",
+	ArgsUsage: "<refresh token>",
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			cli.ShowSubcommandHelpAndExit(ctx, 1)
+			return nil
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		res, err := client.RefreshToken(ctx.Context, ctx.Args().First())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("refresh token success: %s\n", res.Token)
+		fmt.Printf("expire time: %s\n", formatExpireTime(res.ExpireTime))
+		fmt.Printf("refresh token: %s\n", res.RefreshToken)
+		return nil
+	},
+}
+
 var getTokenCmd = &cli.Command{
 	Name:  "get",
 	Usage: "get token",
@@ -74,7 +156,8 @@ var getTokenCmd = &cli.Command{
 			Name: "name",
 		},
 		&cli.StringFlag{
-			Name: "token",
+			Name:  "token",
+			Usage: "token or its fingerprint",
 		},
 	},
 	Action: func(ctx *cli.Context) error {
@@ -91,8 +174,18 @@ var getTokenCmd = &cli.Command{
 		for _, token := range tokens {
 			fmt.Println("name:       ", token.Name)
 			fmt.Println("perm:       ", token.Perm)
+			if len(token.Scopes) > 0 {
+				fmt.Println("scopes:     ", strings.Join(token.Scopes, ","))
+			}
+			if len(token.Role) > 0 {
+				fmt.Println("role:       ", token.Role)
+			}
 			fmt.Println("create time:", token.CreateTime)
-			fmt.Println("token:      ", token.Token)
+			fmt.Println("expire time:", formatExpireTime(token.ExpireTime))
+			fmt.Println("fingerprint:", token.Fingerprint)
+			if len(token.Token) != 0 {
+				fmt.Println("token:      ", token.Token)
+			}
 			fmt.Println()
 		}
 
@@ -128,22 +221,42 @@ var listTokensCmd = &cli.Command{
 		//	Token     string    `json:"token"`
 		//	Name      string    `json:"name"`
 		//	CreatTime time.Time `json:"createTime"`
-		fmt.Println("num\tname\t\tperm\t\tcreateTime\t\ttoken")
+		fmt.Println("num\tname\t\tperm\t\tcreateTime\t\texpireTime\t\ttoken")
 		for k, v := range tks {
 			name := v.Name
 			if len(name) < 8 {
 				name = name + "\t"
 			}
-			fmt.Printf("%d\t%s\t%s\t%s\t%s\n", k+1, name, v.Perm, v.CreateTime.Format("2006-01-02 15:04:05"), v.Token)
+			expireTime := formatExpireTime(v.ExpireTime)
+			if v.ExpireTime == nil {
+				expireTime = expireTime + "\t\t"
+			}
+			fmt.Printf("%d\t%s\t%s\t%s\t%s\t%s\n", k+1, name, v.Perm, v.CreateTime.Format("2006-01-02 15:04:05"),
+				expireTime, displayToken(v))
 		}
 		return nil
 	},
 }
 
+// displayToken returns the fingerprint of token if tokens are stored by hash
+func displayToken(info *auth.TokenInfo) string {
+	if len(info.Token) != 0 {
+		return info.Token
+	}
+	return info.Fingerprint
+}
+
+func formatExpireTime(expireTime *time.Time) string {
+	if expireTime == nil {
+		return "never"
+	}
+	return expireTime.Format("2006-01-02 15:04:05")
+}
+
 var removeTokenCmd = &cli.Command{
 	Name:      "rm",
 	Usage:     "remove token",
-	ArgsUsage: "[token]",
+	ArgsUsage: "[token|fingerprint]",
 	Action: func(ctx *cli.Context) error {
 		if ctx.NArg() < 1 {
 			return fmt.Errorf("usage: rmToken [token]")
@@ -165,7 +278,7 @@ var removeTokenCmd = &cli.Command{
 var recoverTokenCmd = &cli.Command{
 	Name:      "recover",
 	Usage:     "recover deleted token",
-	ArgsUsage: "[token]",
+	ArgsUsage: "[token|fingerprint]",
 	Action: func(ctx *cli.Context) error {
 		if ctx.NArg() < 1 {
 			return fmt.Errorf("usage: recover [token]")
@@ -183,3 +296,51 @@ var recoverTokenCmd = &cli.Command{
 		return nil
 	},
 }
+
+var gcTokensCmd = &cli.Command{
+	Name:  "gc",
+	Usage: "hard delete tokens which have been expired or removed longer than retention",
+	Flags: []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "retention",
+			Usage: "how long expired or removed tokens are kept before being purged",
+			Value: 30 * 24 * time.Hour,
+		},
+		&cli.Int64Flag{
+			Name:  "batch-size",
+			Usage: "max number of tokens deleted in one batch",
+			Value: 100,
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "only list tokens which would be removed",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.Duration("retention") < 0 {
+			return fmt.Errorf("retention must not be negative")
+		}
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+		dryRun := ctx.Bool("dry-run")
+		res, err := client.GCTokens(ctx.Context, &auth.GCTokensRequest{
+			Retention: ctx.Duration("retention"),
+			BatchSize: ctx.Int64("batch-size"),
+			DryRun:    dryRun,
+		})
+		if err != nil {
+			return err
+		}
+		if !dryRun {
+			fmt.Printf("purged %d tokens\n", res.Count)
+			return nil
+		}
+		fmt.Printf("%d tokens would be purged\n", res.Count)
+		for _, v := range res.Tokens {
+			fmt.Printf("%s\t%s\t%s\t%s\n", v.Name, v.Perm, formatExpireTime(v.ExpireTime), displayToken(v))
+		}
+		return nil
+	},
+}
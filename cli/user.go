@@ -26,6 +26,7 @@ var userSubCommand = &cli.Command{
 		userDeleteCmd,
 		userRecoverCmd,
 		rateLimitSubCmds,
+		quotaSubCmds,
 		minerSubCmds,
 		signerSubCmds,
 	},
@@ -44,6 +45,10 @@ var userAddCmd = &cli.Command{
 			Usage: "1-enabled,2-disabled. if set to 2, the user cannot access the chain service normally",
 			Value: 1,
 		},
+		&cli.StringFlag{
+			Name:  "rate-limit-tier",
+			Usage: "rate limit tier whose rules the user inherits",
+		},
 	},
 	Action: func(ctx *cli.Context) error {
 		if ctx.NArg() != 1 {
@@ -66,6 +71,10 @@ var userAddCmd = &cli.Command{
 			comment := ctx.String("comment")
 			user.Comment = &comment
 		}
+		if ctx.IsSet("rate-limit-tier") {
+			tier := ctx.String("rate-limit-tier")
+			user.RateLimitTier = &tier
+		}
 		res, err := client.CreateUser(ctx.Context, user)
 		if err != nil {
 			return err
@@ -98,6 +107,7 @@ var userGetCmd = &cli.Command{
 		fmt.Println("name:", user.Name)
 		fmt.Println("state", user.State, "\t// 2: disable, 1: enable")
 		fmt.Println("comment:", user.Comment)
+		fmt.Println("rateLimitTier:", user.RateLimitTier)
 		fmt.Println("createTime:", time.Unix(user.CreateTime, 0).Format(time.RFC1123))
 		fmt.Println("updateTime:", time.Unix(user.CreateTime, 0).Format(time.RFC1123))
 		fmt.Println()
@@ -120,6 +130,10 @@ var userUpdateCmd = &cli.Command{
 			Name:  "state",
 			Usage: "2:disabled, 1:enabled",
 		},
+		&cli.StringFlag{
+			Name:  "rate-limit-tier",
+			Usage: "rate limit tier whose rules the user inherits, empty to leave the tier",
+		},
 	},
 	Action: func(ctx *cli.Context) error {
 		client, err := GetCli(ctx)
@@ -138,6 +152,10 @@ var userUpdateCmd = &cli.Command{
 		} else {
 			req.State = core.UserStateUndefined
 		}
+		if ctx.IsSet("rate-limit-tier") {
+			tier := ctx.String("rate-limit-tier")
+			req.RateLimitTier = &tier
+		}
 		err = client.UpdateUser(ctx.Context, req)
 		if err != nil {
 			return err
@@ -229,6 +247,9 @@ var userListCmd = &cli.Command{
 			if len(v.Comment) != 0 {
 				fmt.Println("comment:", v.Comment)
 			}
+			if len(v.RateLimitTier) != 0 {
+				fmt.Println("rateLimitTier:", v.RateLimitTier)
+			}
 			fmt.Println("createTime:", time.Unix(v.CreateTime, 0).Format(time.RFC1123))
 			fmt.Println("updateTime:", time.Unix(v.CreateTime, 0).Format(time.RFC1123))
 			fmt.Println()
@@ -307,6 +328,7 @@ var rateLimitSubCmds = &cli.Command{
 		rateLimitUpdate,
 		rateLimitGet,
 		rateLimitDel,
+		rateLimitEffective,
 	},
 }
 
@@ -336,8 +358,7 @@ var rateLimitGet = &cli.Command{
 			fmt.Printf("user have no request rate limit\n")
 		} else {
 			for _, l := range limits {
-				fmt.Printf("user:%s, limit id:%s, request limit amount:%d, duration:%.2f(h)\n",
-					l.Name, l.Id, l.ReqLimit.Cap, l.ReqLimit.ResetDur.Hours())
+				printRateLimit(l)
 			}
 		}
 		return nil
@@ -349,6 +370,9 @@ var rateLimitAdd = &cli.Command{
 	Usage: "add user request rate limit",
 	Flags: []cli.Flag{
 		&cli.StringFlag{Name: "id", Usage: "rate limit id to update"},
+		&cli.StringFlag{Name: "service", Usage: "service the limit applies to, eg. market, '*' or empty for any service"},
+		&cli.StringFlag{Name: "api", Usage: "api the limit applies to, ending with '*' for apis of the prefix, eg. Wallet*, '*' or empty for any api"},
+		&cli.StringFlag{Name: "token", Usage: "token or its fingerprint the limit applies to, empty for all tokens of the user"},
 	},
 	ArgsUsage: "user rate-limit add <name> <limitAmount> <duration(2h, 1h:20m, 2m10s)>",
 	Action: func(ctx *cli.Context) error {
@@ -363,8 +387,13 @@ var rateLimitAdd = &cli.Command{
 
 		name := ctx.Args().Get(0)
 
-		if res, _ := client.GetUserRateLimit(ctx.Context, name, ""); len(res) > 0 {
-			return fmt.Errorf("user rate limit:%s exists", res[0].Id)
+		service, api, token := ctx.String("service"), ctx.String("api"), rateLimitToken(ctx.String("token"))
+		res, _ := client.GetUserRateLimit(ctx.Context, name, "")
+		for _, l := range res {
+			// limits inherited from the tier are overridden by the new one
+			if l.Service == service && l.API == api && l.Token == token && len(l.Tier) == 0 {
+				return fmt.Errorf("user rate limit:%s exists", l.Id)
+			}
 		}
 
 		var limitAmount uint64
@@ -381,6 +410,9 @@ var rateLimitAdd = &cli.Command{
 
 		userLimit := &auth.UpsertUserRateLimitReq{
 			Name:     name,
+			Service:  service,
+			API:      api,
+			Token:    ctx.String("token"),
 			ReqLimit: storage.ReqLimit{Cap: int64(limitAmount), ResetDur: resetDuration},
 		}
 
@@ -416,7 +448,8 @@ var rateLimitUpdate = &cli.Command{
 		name := ctx.Args().Get(0)
 		id := ctx.Args().Get(1)
 
-		if res, err := client.GetUserRateLimit(ctx.Context, name, id); err != nil {
+		res, err := client.GetUserRateLimit(ctx.Context, name, id)
+		if err != nil {
 			return err
 		} else if len(res) == 0 {
 			return fmt.Errorf("user rate limit:%s NOT exists", id)
@@ -435,8 +468,14 @@ var rateLimitUpdate = &cli.Command{
 		}
 
 		userLimit := &auth.UpsertUserRateLimitReq{
-			Id: id, Name: name,
+			Id: id, Name: name, Service: res[0].Service, API: res[0].API,
 			ReqLimit: storage.ReqLimit{Cap: int64(limitAmount), ResetDur: resetDuration},
+			Quota:    res[0].Quota,
+			Token:    res[0].Token,
+		}
+		if len(res[0].Tier) != 0 {
+			// the limit inherited from the tier is overridden by a limit of the user
+			userLimit.Id = ""
 		}
 
 		if userLimit.Id, err = client.UpsertUserRateLimit(ctx.Context, userLimit); err != nil {
@@ -474,6 +513,8 @@ var rateLimitDel = &cli.Command{
 		} else if len(res) == 0 {
 			fmt.Printf("user:%s, rate-limit-id:%s Not exits\n", delReq.Name, delReq.Id)
 			return nil
+		} else if len(res[0].Tier) != 0 {
+			return fmt.Errorf("rate limit:%s is inherited from tier %s, remove the rule from the tier or leave the tier instead", delReq.Id, res[0].Tier)
 		}
 
 		var id string
@@ -484,3 +525,161 @@ var rateLimitDel = &cli.Command{
 		return nil
 	},
 }
+
+var rateLimitEffective = &cli.Command{
+	Name:  "effective",
+	Usage: "show the user request rate limit applying to an api of a service",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "service", Usage: "service of the request"},
+		&cli.StringFlag{Name: "api", Usage: "api of the request"},
+		&cli.StringFlag{Name: "token", Usage: "token or its fingerprint of the request, limits of tokens are skipped if it's empty"},
+	},
+	ArgsUsage: "<name>",
+	Action: func(ctx *cli.Context) error {
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+
+		if ctx.NArg() != 1 {
+			return xerrors.New("expect name")
+		}
+
+		res, err := client.GetEffectiveRateLimit(ctx.Context, ctx.Args().Get(0), ctx.String("token"), ctx.String("service"), ctx.String("api"))
+		if err != nil {
+			return err
+		}
+		if res.Limit == nil {
+			fmt.Printf("user have no request rate limit\n")
+			return nil
+		}
+		printRateLimit(res.Limit)
+		return nil
+	},
+}
+
+var quotaSubCmds = &cli.Command{
+	Name:  "quota",
+	Usage: "sub cmds for managing user request quotas in calendar days and months(UTC)",
+	Subcommands: []*cli.Command{
+		quotaSet,
+		quotaUsage,
+	},
+}
+
+var quotaSet = &cli.Command{
+	Name:  "set",
+	Usage: "set the quotas of the user request rate limit applying to an api of a service, the limit is added if not exists",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "service", Usage: "service the limit applies to, eg. market, '*' or empty for any service"},
+		&cli.StringFlag{Name: "api", Usage: "api the limit applies to, ending with '*' for apis of the prefix, eg. Wallet*, '*' or empty for any api"},
+		&cli.StringFlag{Name: "token", Usage: "token or its fingerprint the limit applies to, empty for all tokens of the user"},
+		&cli.Int64Flag{Name: "daily", Usage: "requests allowed in a day, 0 for no daily quota"},
+		&cli.Int64Flag{Name: "monthly", Usage: "requests allowed in a month, 0 for no monthly quota"},
+	},
+	ArgsUsage: "<name>",
+	Action: func(ctx *cli.Context) error {
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+
+		if ctx.NArg() != 1 {
+			return xerrors.New("expect name")
+		}
+		if !ctx.IsSet("daily") && !ctx.IsSet("monthly") {
+			return xerrors.New("expect daily or monthly")
+		}
+
+		name := ctx.Args().Get(0)
+		service, api, token := ctx.String("service"), ctx.String("api"), rateLimitToken(ctx.String("token"))
+		res, err := client.GetUserRateLimit(ctx.Context, name, "")
+		if err != nil {
+			return err
+		}
+
+		userLimit := &auth.UpsertUserRateLimitReq{Name: name, Service: service, API: api, Token: ctx.String("token")}
+		for _, l := range res {
+			if l.Service == service && l.API == api && l.Token == token {
+				userLimit = (*auth.UpsertUserRateLimitReq)(l)
+				if len(l.Tier) != 0 {
+					// the limit inherited from the tier is overridden by a limit of the user
+					userLimit.Id = ""
+				}
+				break
+			}
+		}
+		if ctx.IsSet("daily") {
+			userLimit.Quota.Daily = ctx.Int64("daily")
+		}
+		if ctx.IsSet("monthly") {
+			userLimit.Quota.Monthly = ctx.Int64("monthly")
+		}
+
+		if userLimit.Id, err = client.UpsertUserRateLimit(ctx.Context, userLimit); err != nil {
+			return err
+		}
+
+		fmt.Printf("set user quota success:\t%s\n", userLimit.Id)
+		return nil
+	},
+}
+
+var quotaUsage = &cli.Command{
+	Name:  "usage",
+	Usage: "show the usages of user request quotas",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "window", Usage: "day(yyyy-mm-dd) or month(yyyy-mm) in UTC, the current day and month by default"},
+	},
+	ArgsUsage: "<name>",
+	Action: func(ctx *cli.Context) error {
+		client, err := GetCli(ctx)
+		if err != nil {
+			return err
+		}
+
+		if ctx.NArg() != 1 {
+			return xerrors.New("expect name")
+		}
+
+		res, err := client.GetQuotaUsage(ctx.Context, ctx.Args().Get(0), ctx.String("window"))
+		if err != nil {
+			return err
+		}
+		if len(res) == 0 {
+			fmt.Printf("user have no request quota\n")
+			return nil
+		}
+		for _, u := range res {
+			fmt.Printf("limit id:%s, service:%s, api:%s, %s quota:%d, window:%s, used:%d\n",
+				u.LimitID, rateLimitTarget(u.Service), rateLimitTarget(u.API), u.Period, u.Quota, u.Window, u.Used)
+		}
+		return nil
+	},
+}
+
+// rateLimitToken returns the fingerprint of token, which is what limits keep
+func rateLimitToken(token string) string {
+	if len(token) == 0 {
+		return ""
+	}
+	return storage.TokenFingerprint(token)
+}
+
+func printRateLimit(l *storage.UserRateLimit) {
+	fmt.Printf("user:%s, limit id:%s, token:%s, service:%s, api:%s, request limit amount:%d, duration:%.2f(h), daily quota:%d, monthly quota:%d",
+		l.Name, l.Id, rateLimitTarget(l.Token), rateLimitTarget(l.Service), rateLimitTarget(l.API), l.ReqLimit.Cap, l.ReqLimit.ResetDur.Hours(),
+		l.Quota.Daily, l.Quota.Monthly)
+	if len(l.Tier) != 0 {
+		fmt.Printf(", inherited from tier:%s", l.Tier)
+	}
+	fmt.Println()
+}
+
+// rateLimitTarget shows the empty token, service or api of a limit as the wildcard
+func rateLimitTarget(s string) string {
+	if len(s) == 0 {
+		return auth.RateLimitWildcard
+	}
+	return s
+}
@@ -3,8 +3,10 @@ package config
 import (
 	"bytes"
 	"crypto/rand"
+	"encoding/hex"
 	"io"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/BurntSushi/toml"
@@ -20,13 +22,105 @@ type Config struct {
 	Log          *LogConfig           `json:"log"`
 	DB           *DBConfig            `json:"db"`
 	Trace        *metrics.TraceConfig `json:"traceConfig"`
+	TokenGC      *TokenGCConfig       `json:"tokenGC"`
+	Signing      *SigningConfig       `json:"signing"`
+	VerifyCache  *VerifyCacheConfig   `json:"verifyCache"`
+	Secrets      *SecretsConfig       `json:"secrets"`
+	RateLimit    *RateLimitConfig     `json:"rateLimit"`
+}
+
+type SigningAlg = string
+
+const (
+	// SigningAlgHS256 signs every token with its own random secret, tokens can only be verified by sophon-auth
+	SigningAlgHS256 SigningAlg = "HS256"
+	// SigningAlgEd25519 and SigningAlgES256 sign tokens with a server-held key,
+	// whose public key is published at `/.well-known/jwks.json`
+	SigningAlgEd25519 SigningAlg = "Ed25519"
+	SigningAlgES256   SigningAlg = "ES256"
+)
+
+type SigningConfig struct {
+	Alg SigningAlg `json:"alg"`
+}
+
+// TokenGCConfig configures the background job which hard-deletes tokens
+// soft-deleted or expired longer than `Retention`
+type TokenGCConfig struct {
+	Enable    bool          `json:"enable"`
+	Interval  time.Duration `json:"interval"`
+	Retention time.Duration `json:"retention"`
+	BatchSize int64         `json:"batchSize"`
+}
+
+// VerifyCacheConfig configures the cache of verified tokens, `Size` 0 disables the cache, which is the default.
+// The cache trades revocation for speed: instances sharing one database keep accepting tokens removed,
+// and tokens of users disabled, by other instances until `TTL` passes, so enable it knowingly.
+type VerifyCacheConfig struct {
+	Size int           `json:"size"`
+	TTL  time.Duration `json:"ttl"`
+}
+
+// RateLimitConfig configures the counter behind `/ratelimit/consume`, budgets are counted in memory,
+// they are saved to the store every `FlushInterval` if `Persist` is set, so that they survive restarts.
+// Quota usages are always counted in the store.
+type RateLimitConfig struct {
+	Persist       bool          `json:"persist"`
+	FlushInterval time.Duration `json:"flushInterval"`
+}
+
+// SecretsConfig tells where to load the master key which encrypts token secrets and signing keys at rest,
+// the key is 32 bytes hex encoded. `MasterKeyFile` is tried first, then the env var named `MasterKeyEnv`,
+// secrets are stored in plain if neither is set.
+type SecretsConfig struct {
+	MasterKeyFile string `json:"masterKeyFile"`
+	MasterKeyEnv  string `json:"masterKeyEnv"`
+}
+
+// DefaultMasterKeyEnv is the default env var of the master key
+const DefaultMasterKeyEnv = "SOPHON_AUTH_MASTER_KEY"
+
+// LoadMasterKey returns nil if no master key is configured
+func (c *SecretsConfig) LoadMasterKey() ([]byte, error) {
+	if c == nil {
+		return nil, nil
+	}
+	var encoded string
+	if len(c.MasterKeyFile) != 0 {
+		data, err := os.ReadFile(c.MasterKeyFile)
+		if err != nil {
+			return nil, xerrors.Errorf("read master key file: %w", err)
+		}
+		encoded = string(data)
+	} else if len(c.MasterKeyEnv) != 0 {
+		encoded = os.Getenv(c.MasterKeyEnv)
+	}
+	encoded = strings.TrimSpace(encoded)
+	if len(encoded) == 0 {
+		return nil, nil
+	}
+	return ParseMasterKey(encoded)
+}
+
+// ParseMasterKey decodes a hex encoded master key
+func ParseMasterKey(encoded string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, xerrors.Errorf("decode master key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, xerrors.Errorf("master key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
 }
 
 type DBType = string
 
 const (
-	Mysql  DBType = "mysql"
-	Badger DBType = "badger"
+	Mysql    DBType = "mysql"
+	Badger   DBType = "badger"
+	Sqlite   DBType = "sqlite"
+	Postgres DBType = "postgres"
 )
 
 type DBConfig struct {
@@ -37,6 +131,8 @@ type DBConfig struct {
 	MaxLifeTime  time.Duration `json:"maxLifeTime"`
 	MaxIdleTime  time.Duration `json:"maxIdleTime"`
 	Debug        bool          `json:"debug"`
+	// HashToken stores the sha256 of tokens and refresh tokens instead of them, it can't be disabled once enabled
+	HashToken bool `json:"hashToken"`
 }
 
 // RandSecret If the daemon does not have a secret key configured, it is automatically generated
@@ -71,6 +167,26 @@ func DefaultConfig() *Config {
 			MaxLifeTime:  120 * time.Second,
 			MaxIdleTime:  60 * time.Second,
 		},
+		Signing: &SigningConfig{
+			Alg: SigningAlgHS256,
+		},
+		TokenGC: &TokenGCConfig{
+			Enable:    false,
+			Interval:  time.Hour,
+			Retention: 30 * 24 * time.Hour,
+			BatchSize: 100,
+		},
+		VerifyCache: &VerifyCacheConfig{
+			Size: 0,
+			TTL:  time.Minute,
+		},
+		Secrets: &SecretsConfig{
+			MasterKeyEnv: DefaultMasterKeyEnv,
+		},
+		RateLimit: &RateLimitConfig{
+			Persist:       false,
+			FlushInterval: 10 * time.Second,
+		},
 	}
 }
 
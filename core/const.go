@@ -120,6 +120,32 @@ func (us UserState) String() string {
 	return "unknown state"
 }
 
+// SigningKeyState is the state of keys used to sign tokens
+type SigningKeyState int
+
+const (
+	// SigningKeyActive signs new tokens and verifies tokens
+	SigningKeyActive SigningKeyState = iota
+	// SigningKeyVerifyOnly only verifies tokens until its retire time
+	SigningKeyVerifyOnly
+	// SigningKeyRetired is no longer used
+	SigningKeyRetired
+)
+
+var signingKeyStateStrs = map[SigningKeyState]string{
+	SigningKeyActive:     "active",
+	SigningKeyVerifyOnly: "verify-only",
+	SigningKeyRetired:    "retired",
+}
+
+func (s SigningKeyState) String() string {
+	stateStr, exists := signingKeyStateStrs[s]
+	if exists {
+		return stateStr
+	}
+	return "unknown state"
+}
+
 const (
 	NotDelete = 0
 	Deleted   = 1
@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"strings"
 )
 
 type CtxKey int
@@ -10,6 +11,8 @@ const (
 	accountKey CtxKey = iota
 	tokenLocationKey
 	permKey
+	scopeKey
+	tokenFingerprintKey
 )
 
 func HasPerm(ctx context.Context, defaultPerms []Permission, perm Permission) bool {
@@ -61,6 +64,32 @@ func CtxGetTokenLocation(ctx context.Context) (location string, exists bool) {
 	return ctxGetString(ctx, tokenLocationKey)
 }
 
+// CtxWithTokenFingerprint sets the fingerprint of the token of request, see `storage.TokenFingerprint`
+func CtxWithTokenFingerprint(ctx context.Context, fingerprint string) context.Context {
+	return context.WithValue(ctx, tokenFingerprintKey, fingerprint)
+}
+
+func CtxGetTokenFingerprint(ctx context.Context) (fingerprint string, exists bool) {
+	return ctxGetString(ctx, tokenFingerprintKey)
+}
+
+const tokenAccountSep = "#"
+
+// TokenAccount joins the name of user and the fingerprint of token into the account
+// passed to rate limit finders, so that they could find the limits of the token
+func TokenAccount(name, fingerprint string) string {
+	return name + tokenAccountSep + fingerprint
+}
+
+// SplitTokenAccount splits the account made by `TokenAccount`, fingerprint is empty if account is a name only
+func SplitTokenAccount(account string) (name, fingerprint string) {
+	idx := strings.LastIndex(account, tokenAccountSep)
+	if idx < 0 {
+		return account, ""
+	}
+	return account[:idx], account[idx+len(tokenAccountSep):]
+}
+
 type ValueFromCtx struct{}
 
 func (vfc *ValueFromCtx) AccFromCtx(ctx context.Context) (string, bool) {
@@ -70,3 +99,22 @@ func (vfc *ValueFromCtx) AccFromCtx(ctx context.Context) (string, bool) {
 func (vfc *ValueFromCtx) HostFromCtx(ctx context.Context) (string, bool) {
 	return CtxGetTokenLocation(ctx)
 }
+
+// TokenValueFromCtx returns the account made by `TokenAccount` if the token of request is known, so that
+// rate limiters resolve the limits of the token before the ones of the user. Limiters count budgets by
+// account, so each token of the user has its own budget even for the limits of the user, use
+// `jwtclient.WarpValueFromCtx` to share them among the tokens.
+type TokenValueFromCtx struct {
+	ValueFromCtx
+}
+
+func (vfc *TokenValueFromCtx) AccFromCtx(ctx context.Context) (string, bool) {
+	name, ok := CtxGetName(ctx)
+	if !ok {
+		return "", false
+	}
+	if fingerprint, ok := CtxGetTokenFingerprint(ctx); ok && len(fingerprint) != 0 {
+		return TokenAccount(name, fingerprint), true
+	}
+	return name, true
+}
@@ -0,0 +1,32 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenAccount(t *testing.T) {
+	account := TokenAccount("user#1", "0123456789abcdef")
+	name, fingerprint := SplitTokenAccount(account)
+	assert.Equal(t, "user#1", name)
+	assert.Equal(t, "0123456789abcdef", fingerprint)
+
+	name, fingerprint = SplitTokenAccount("user")
+	assert.Equal(t, "user", name)
+	assert.Empty(t, fingerprint)
+
+	vfc := &TokenValueFromCtx{}
+	_, ok := vfc.AccFromCtx(context.Background())
+	assert.False(t, ok)
+
+	ctx := CtxWithName(context.Background(), "user")
+	acc, ok := vfc.AccFromCtx(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "user", acc)
+
+	acc, ok = vfc.AccFromCtx(CtxWithTokenFingerprint(ctx, "0123456789abcdef"))
+	assert.True(t, ok)
+	assert.Equal(t, TokenAccount("user", "0123456789abcdef"), acc)
+}
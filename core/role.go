@@ -0,0 +1,36 @@
+package core
+
+import (
+	"fmt"
+)
+
+// Role is a named set of permissions defined by administrators, tokens generated with a role
+// are granted what the role grants at verify time.
+type Role struct {
+	Name string
+	// Perm is the legacy permission granted by the role
+	Perm   Permission
+	Scopes []Scope
+}
+
+// ValidateRole checks the name, permission and scopes of role
+func ValidateRole(role *Role) error {
+	if len(role.Name) == 0 {
+		return fmt.Errorf("role name is empty")
+	}
+	if IsValid(role.Name) {
+		return fmt.Errorf("role name %s conflicts with the builtin permission", role.Name)
+	}
+	if !IsValid(role.Perm) {
+		return fmt.Errorf("invalid permission %s of role %s", role.Perm, role.Name)
+	}
+	for _, scope := range role.Scopes {
+		if err := ValidateScope(scope); err != nil {
+			return err
+		}
+		if !ScopeWithinPerm(scope, role.Perm) {
+			return fmt.Errorf("scope %s exceeds permission %s", scope, role.Perm)
+		}
+	}
+	return nil
+}
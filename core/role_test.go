@@ -0,0 +1,16 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRole(t *testing.T) {
+	assert.NoError(t, ValidateRole(&Role{Name: "market-operator", Perm: PermWrite, Scopes: []Scope{"market:write"}}))
+	assert.Error(t, ValidateRole(&Role{Name: "", Perm: PermWrite}))
+	assert.Error(t, ValidateRole(&Role{Name: PermAdmin, Perm: PermWrite}))
+	assert.Error(t, ValidateRole(&Role{Name: "market-operator", Perm: "root"}))
+	assert.Error(t, ValidateRole(&Role{Name: "market-operator", Perm: PermWrite, Scopes: []Scope{"market"}}))
+	assert.Error(t, ValidateRole(&Role{Name: "market-operator", Perm: PermWrite, Scopes: []Scope{"wallet:sign"}}))
+}
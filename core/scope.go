@@ -0,0 +1,121 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Scope grants an action on a group of API methods, in the form of `<resource>:<action>`,
+// eg: "market:read", "wallet:sign". `*` matches any resource or action, eg: "*:read", "wallet:*".
+// Actions which are legacy permissions follow the same ladder, eg: "wallet:sign" also grants "wallet:read".
+type Scope = string
+
+const (
+	ScopeWildcard  = "*"
+	scopeSeparator = ":"
+)
+
+func splitScope(scope Scope) (string, string, bool) {
+	resource, action, ok := strings.Cut(scope, scopeSeparator)
+	if !ok || len(resource) == 0 || len(action) == 0 || strings.Contains(action, scopeSeparator) {
+		return "", "", false
+	}
+	return resource, action, true
+}
+
+// ValidateScope checks scope is in the form of `<resource>:<action>`
+func ValidateScope(scope Scope) error {
+	if _, _, ok := splitScope(scope); !ok || strings.ContainsAny(scope, " \t\n") {
+		return fmt.Errorf("invalid scope %q, should be like `<resource>:<action>`", scope)
+	}
+	return nil
+}
+
+// ScopeMatch returns true if `granted` covers `required`
+func ScopeMatch(granted, required Scope) bool {
+	gRes, gAct, ok := splitScope(granted)
+	if !ok {
+		return false
+	}
+	rRes, rAct, ok := splitScope(required)
+	if !ok {
+		return false
+	}
+	if gRes != ScopeWildcard && gRes != rRes {
+		return false
+	}
+	if gAct == ScopeWildcard || gAct == rAct {
+		return true
+	}
+	for _, perm := range AdaptOldStrategy(gAct) {
+		if perm == rAct {
+			return true
+		}
+	}
+	return false
+}
+
+// ScopeWithinPerm returns false if scope grants more than `perm`, which the token also carries
+func ScopeWithinPerm(scope Scope, perm Permission) bool {
+	_, action, ok := splitScope(scope)
+	if !ok {
+		return false
+	}
+	if action == ScopeWildcard {
+		return perm == PermAdmin
+	}
+	if !IsValid(action) {
+		// custom actions are not restricted by the permission ladder
+		return true
+	}
+	for _, p := range AdaptOldStrategy(perm) {
+		if p == action {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultScopes maps a legacy permission onto scopes, eg: "sign" is "*:sign"
+func DefaultScopes(perm Permission) []Scope {
+	if !IsValid(perm) {
+		return nil
+	}
+	return []Scope{ScopeWildcard + scopeSeparator + perm}
+}
+
+// ScopesOf returns the scopes granted to a token, tokens without scopes are granted by their permission
+func ScopesOf(perm Permission, scopes []Scope) []Scope {
+	if len(scopes) != 0 {
+		return scopes
+	}
+	return DefaultScopes(perm)
+}
+
+func CtxWithScopes(ctx context.Context, scopes []Scope) context.Context {
+	return context.WithValue(ctx, scopeKey, scopes)
+}
+
+func CtxGetScopes(ctx context.Context) ([]Scope, bool) {
+	v, exist := ctx.Value(scopeKey).([]Scope)
+	return v, exist
+}
+
+// HasScope checks whether the caller is granted `required`, callers without scopes
+// in ctx are checked by their legacy permissions.
+func HasScope(ctx context.Context, required Scope) bool {
+	granted, ok := CtxGetScopes(ctx)
+	if !ok {
+		perms, _ := CtxGetPerm(ctx)
+		for _, perm := range perms {
+			granted = append(granted, DefaultScopes(perm)...)
+		}
+	}
+	for _, scope := range granted {
+		if ScopeMatch(scope, required) {
+			return true
+		}
+	}
+	return false
+}
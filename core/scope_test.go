@@ -0,0 +1,60 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopeMatch(t *testing.T) {
+	cases := []struct {
+		granted, required Scope
+		match             bool
+	}{
+		{"market:read", "market:read", true},
+		{"market:read", "market:write", false},
+		{"market:read", "wallet:read", false},
+		{"market:*", "market:deal", true},
+		{"*:read", "wallet:read", true},
+		{"*:*", "wallet:sign", true},
+		{"wallet:sign", "wallet:read", true},
+		{"wallet:read", "wallet:sign", false},
+		{"invalid", "wallet:read", false},
+		{"wallet:read", "invalid", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.match, ScopeMatch(c.granted, c.required), "%s covers %s", c.granted, c.required)
+	}
+}
+
+func TestValidateScope(t *testing.T) {
+	for _, scope := range []Scope{"market:read", "*:*", "wallet:sign"} {
+		assert.NoError(t, ValidateScope(scope))
+	}
+	for _, scope := range []Scope{"", "market", ":read", "market:", "a:b:c", "market :read"} {
+		assert.Error(t, ValidateScope(scope), scope)
+	}
+}
+
+func TestScopeWithinPerm(t *testing.T) {
+	assert.True(t, ScopeWithinPerm("market:read", PermRead))
+	assert.True(t, ScopeWithinPerm("market:deal", PermRead))
+	assert.False(t, ScopeWithinPerm("wallet:sign", PermWrite))
+	assert.False(t, ScopeWithinPerm("wallet:*", PermSign))
+	assert.True(t, ScopeWithinPerm("wallet:*", PermAdmin))
+}
+
+func TestHasScope(t *testing.T) {
+	// legacy permissions map onto default scopes
+	ctx := CtxWithPerm(context.Background(), PermSign)
+	assert.True(t, HasScope(ctx, "wallet:sign"))
+	assert.True(t, HasScope(ctx, "market:read"))
+	assert.False(t, HasScope(ctx, "market:admin"))
+
+	ctx = CtxWithScopes(ctx, []Scope{"market:read"})
+	assert.True(t, HasScope(ctx, "market:read"))
+	assert.False(t, HasScope(ctx, "wallet:sign"))
+
+	assert.False(t, HasScope(context.Background(), "market:read"))
+}
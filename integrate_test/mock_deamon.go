@@ -31,7 +31,7 @@ func setup(t *testing.T) (server *httptest.Server, dir string, token string) {
 	if err != nil {
 		t.Fatalf("Failed to init sophon-auth: %s", err)
 	}
-	token, err = app.GetDefaultAdminToken()
+	token, err = app.GetDefaultAdminToken("")
 	if err != nil {
 		t.Fatalf("Failed to get default admin token: %s", err)
 	}
@@ -3,9 +3,12 @@ package integrate
 
 import (
 	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/core"
 	"github.com/ipfs-force-community/sophon-auth/jwtclient"
 	"github.com/ipfs-force-community/sophon-auth/storage"
 	"github.com/stretchr/testify/assert"
@@ -19,6 +22,11 @@ func TestRateLimitApis(t *testing.T) {
 	t.Run("get rate limit", testGetRateLimit)
 	// stm: @VENUSAUTH_APP_DEL_USER_RATE_LIMIT_001, @VENUSAUTH_APP_DEL_USER_RATE_LIMIT_003
 	t.Run("delete rate limit", testDeleteRateLimit)
+	t.Run("effective rate limit", testEffectiveRateLimit)
+	t.Run("consume rate limit", testConsumeRateLimit)
+	t.Run("tokens share rate limit", testTokensShareRateLimit)
+	t.Run("quota usage", testQuotaUsage)
+	t.Run("rate limit tiers", testRateLimitTiers)
 }
 
 func setupAndAddRateLimits(t *testing.T) (*jwtclient.AuthClient, string) {
@@ -98,3 +106,224 @@ func testDeleteRateLimit(t *testing.T) {
 	_, err = client.DelUserRateLimit(context.TODO(), &auth.DelUserRateLimitReq{})
 	assert.Error(t, err)
 }
+
+func testEffectiveRateLimit(t *testing.T) {
+	client, tmpDir := setupAndAddRateLimits(t)
+	defer shutdown(t, tmpDir)
+
+	userName := "Rennbon"
+	apiLimit := auth.UpsertUserRateLimitReq{
+		Id:       "e4a26ee8-2ba2-4b10-9b6b-8a1f4c1a7c47",
+		Name:     userName,
+		Service:  "market",
+		API:      "Deal*",
+		ReqLimit: storage.ReqLimit{Cap: 5, ResetDur: time.Minute},
+	}
+	_, err := client.UpsertUserRateLimit(context.TODO(), &apiLimit)
+	assert.Nil(t, err)
+
+	res, err := client.GetEffectiveRateLimit(context.TODO(), userName, "", "market", "DealList")
+	assert.Nil(t, err)
+	assert.Equal(t, apiLimit.Id, res.Limit.Id)
+	res, err = client.GetEffectiveRateLimit(context.TODO(), userName, "", "market", "PieceList")
+	assert.Nil(t, err)
+	assert.Equal(t, "794fc9a4-2b80-4503-835a-7e8e27360b3d", res.Limit.Id)
+
+	finder := jwtclient.WarpLimitFinder(client)
+	limit, err := finder.GetUserLimit(userName, "market", "DealGet")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), limit.Cap)
+	limit, err = finder.GetUserLimit(userName, "", "")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), limit.Cap)
+
+	// `ShouldBind` failed
+	_, err = client.GetEffectiveRateLimit(context.TODO(), "", "", "", "")
+	assert.Error(t, err)
+}
+
+func testConsumeRateLimit(t *testing.T) {
+	client, tmpDir := setupAndAddRateLimits(t)
+	defer shutdown(t, tmpDir)
+
+	userName := "Rennbon"
+	res, err := client.ConsumeRateLimit(context.TODO(), []*auth.RateLimitConsumption{
+		{Name: userName, Count: 6},
+		{Name: userName, Service: "market", API: "DealList", Count: 6},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, res, 2)
+	assert.True(t, res[0].Allowed)
+	assert.Equal(t, int64(4), res[0].Remaining)
+	assert.False(t, res[1].Allowed)
+	assert.Equal(t, "794fc9a4-2b80-4503-835a-7e8e27360b3d", res[1].LimitID)
+
+	// instances of a service share the budget through sophon-auth
+	limiters := []*jwtclient.BatchLimiter{
+		jwtclient.NewBatchLimiter(client, 0, 0),
+		jwtclient.NewBatchLimiter(client, 0, 0),
+	}
+	allowed := 0
+	for i := 0; i < 3; i++ {
+		for _, limiter := range limiters {
+			budget, err := limiter.Allow(context.TODO(), userName, "", "")
+			assert.Nil(t, err)
+			if budget.Allowed {
+				allowed++
+			}
+		}
+	}
+	assert.Equal(t, 4, allowed)
+
+	limit, err := limiters[0].GetUserLimit(userName, "", "")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), limit.Cap)
+
+	// `ShouldBind` failed
+	_, err = client.ConsumeRateLimit(context.TODO(), []*auth.RateLimitConsumption{{Count: 1}})
+	assert.Error(t, err)
+	_, err = client.ConsumeRateLimit(context.TODO(), nil)
+	assert.Error(t, err)
+}
+
+func testTokensShareRateLimit(t *testing.T) {
+	client, tmpDir := setupAndAddRateLimits(t)
+	defer shutdown(t, tmpDir)
+
+	userName := "Rennbon"
+	ctxs := make([]context.Context, 2)
+	for idx := range ctxs {
+		token, err := client.GenerateToken(context.TODO(), userName, core.PermRead, fmt.Sprintf("token-%d", idx))
+		assert.Nil(t, err)
+		ctxs[idx] = core.CtxWithTokenFingerprint(core.CtxWithName(context.TODO(), userName), storage.TokenFingerprint(token))
+	}
+
+	// tokens without limits of their own are counted as the user by local limiters
+	valueFromCtx := jwtclient.WarpValueFromCtx(client)
+	finder := jwtclient.WarpLimitFinder(client)
+	for _, ctx := range ctxs {
+		account, ok := valueFromCtx.AccFromCtx(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, userName, account)
+		limit, err := finder.GetUserLimit(account, "", "")
+		assert.Nil(t, err)
+		assert.Equal(t, userName, limit.Account)
+		assert.Equal(t, int64(10), limit.Cap)
+	}
+
+	// and share the budget counted by sophon-auth
+	limiter := jwtclient.NewBatchLimiter(client, 0, 0)
+	allowed := 0
+	for i := 0; i < 6; i++ {
+		for _, ctx := range ctxs {
+			budget, err := limiter.Allow(ctx, userName, "", "")
+			assert.Nil(t, err)
+			if budget.Allowed {
+				allowed++
+			}
+		}
+	}
+	assert.Equal(t, 10, allowed)
+
+	// a token with limits of its own has its own budget
+	fingerprint, _ := core.CtxGetTokenFingerprint(ctxs[1])
+	_, err := client.UpsertUserRateLimit(context.TODO(), &auth.UpsertUserRateLimitReq{
+		Name: userName, Token: fingerprint, ReqLimit: storage.ReqLimit{Cap: 3, ResetDur: time.Minute},
+	})
+	assert.Nil(t, err)
+	// limits of users are cached by the value finder until its next refresh
+	account, ok := valueFromCtx.AccFromCtx(ctxs[1])
+	assert.True(t, ok)
+	assert.Equal(t, userName, account)
+	account, ok = jwtclient.WarpValueFromCtx(client).AccFromCtx(ctxs[1])
+	assert.True(t, ok)
+	assert.Equal(t, core.TokenAccount(userName, fingerprint), account)
+	limit, err := finder.GetUserLimit(account, "", "")
+	assert.Nil(t, err)
+	assert.Equal(t, account, limit.Account)
+	assert.Equal(t, int64(3), limit.Cap)
+	budget, err := limiter.Allow(ctxs[1], userName, "", "")
+	assert.Nil(t, err)
+	assert.True(t, budget.Allowed)
+	budget, err = limiter.Allow(ctxs[0], userName, "", "")
+	assert.Nil(t, err)
+	assert.False(t, budget.Allowed)
+}
+
+func testQuotaUsage(t *testing.T) {
+	client, tmpDir := setupAndAddRateLimits(t)
+	defer shutdown(t, tmpDir)
+
+	userName := "Rennbon"
+	limitID, err := client.UpsertUserRateLimit(context.TODO(), &auth.UpsertUserRateLimitReq{
+		Name: userName, Service: "market", Quota: storage.Quota{Daily: 5},
+	})
+	assert.Nil(t, err)
+
+	res, err := client.ConsumeRateLimit(context.TODO(), []*auth.RateLimitConsumption{
+		{Name: userName, Service: "market", Count: 4},
+		{Name: userName, Service: "market", Count: 2},
+	})
+	assert.Nil(t, err)
+	assert.True(t, res[0].Allowed)
+	assert.False(t, res[1].Allowed)
+	assert.Equal(t, storage.QuotaDaily, res[1].QuotaExceeded)
+
+	usages, err := client.GetQuotaUsage(context.TODO(), userName, "")
+	assert.Nil(t, err)
+	assert.Equal(t, auth.GetQuotaUsageResponse{{
+		LimitID: limitID,
+		Service: "market",
+		Period:  storage.QuotaDaily,
+		Window:  storage.QuotaWindow(storage.QuotaDaily, time.Now()),
+		Quota:   5,
+		Used:    4,
+	}}, usages)
+
+	// `ShouldBind` failed
+	_, err = client.GetQuotaUsage(context.TODO(), "", "")
+	assert.Error(t, err)
+	_, err = client.GetQuotaUsage(context.TODO(), userName, "today")
+	assert.Error(t, err)
+}
+
+func testRateLimitTiers(t *testing.T) {
+	client, tmpDir := setupAndAddRateLimits(t)
+	defer shutdown(t, tmpDir)
+
+	userName, tierName := "Rennbon", "silver"
+	tier, err := client.UpsertRateLimitTier(context.TODO(), &auth.UpsertRateLimitTierReq{
+		Name:  tierName,
+		Rules: storage.RateLimitRules{{Service: "market", ReqLimit: storage.ReqLimit{Cap: 3, ResetDur: time.Minute}}},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, tier.Rules, 1)
+	ruleID := tier.Rules[0].Id
+
+	assert.Nil(t, client.UpdateUser(context.TODO(), &auth.UpdateUserRequest{Name: userName, RateLimitTier: &tierName}))
+	user, err := client.GetUser(context.TODO(), userName)
+	assert.Nil(t, err)
+	assert.Equal(t, tierName, user.RateLimitTier)
+
+	res, err := client.GetEffectiveRateLimit(context.TODO(), userName, "", "market", "DealList")
+	assert.Nil(t, err)
+	assert.Equal(t, ruleID, res.Limit.Id)
+	assert.Equal(t, tierName, res.Limit.Tier)
+
+	tiers, err := client.ListRateLimitTiers(context.TODO())
+	assert.Nil(t, err)
+	assert.Len(t, tiers, 1)
+	assert.Equal(t, []string{userName}, tiers[0].Members)
+
+	// the tier has a member
+	assert.Error(t, client.DelRateLimitTier(context.TODO(), tierName))
+	empty := ""
+	assert.Nil(t, client.UpdateUser(context.TODO(), &auth.UpdateUserRequest{Name: userName, RateLimitTier: &empty}))
+	assert.Nil(t, client.DelRateLimitTier(context.TODO(), tierName))
+
+	// `ShouldBind` failed
+	_, err = client.GetRateLimitTier(context.TODO(), "")
+	assert.Error(t, err)
+	_, err = client.GetRateLimitTier(context.TODO(), tierName)
+	assert.Error(t, err)
+}
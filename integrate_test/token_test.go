@@ -3,6 +3,7 @@ package integrate
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -15,6 +16,7 @@ func TestTokenApis(t *testing.T) {
 	t.Run("verify token", testVerifyToken)
 	t.Run("list token", testListToken)
 	t.Run("remove and recover token", testRemoveAndRecoverToken)
+	t.Run("token with ttl", testTokenWithTTL)
 }
 
 func setupAndGenerateToken(t *testing.T, name string, perm string) (*jwtclient.AuthClient, string, string) {
@@ -88,3 +90,28 @@ func testRemoveAndRecoverToken(t *testing.T) {
 	assert.Equal(t, name, verifyResp.Name)
 	assert.Equal(t, perm, verifyResp.Perm)
 }
+
+func testTokenWithTTL(t *testing.T) {
+	name := "Rennbon"
+	perm := "admin"
+
+	client, tmpDir, _ := setupAndGenerateToken(t, name, perm)
+	defer shutdown(t, tmpDir)
+
+	token, err := client.GenerateToken(context.TODO(), name, perm, "", jwtclient.WithTTL(time.Hour))
+	assert.Nil(t, err)
+	verifyResp, err := client.Verify(context.Background(), token)
+	assert.Nil(t, err)
+	assert.NotNil(t, verifyResp.ExpirationTime)
+
+	tokens, err := client.GetToken(context.TODO(), "", token)
+	assert.Nil(t, err)
+	assert.Len(t, tokens, 1)
+	assert.NotNil(t, tokens[0].ExpireTime)
+
+	// token is not valid until an hour later
+	token, err = client.GenerateToken(context.TODO(), name, perm, "", jwtclient.WithNotBefore(time.Now().Add(time.Hour)))
+	assert.Nil(t, err)
+	_, err = client.Verify(context.Background(), token)
+	assert.NotNil(t, err)
+}
@@ -2,9 +2,11 @@ package jwtclient
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-resty/resty/v2"
@@ -42,12 +44,20 @@ type IAuthClient interface {
 	ListSigners(ctx context.Context, user string) (auth.ListSignerResp, error)
 	RegisterSigners(ctx context.Context, user string, addrs []address.Address) error
 	UnregisterSigners(ctx context.Context, user string, addrs []address.Address) error
+
+	CreateRole(ctx context.Context, req *auth.CreateRoleRequest) (*auth.RoleInfo, error)
+	UpdateRole(ctx context.Context, req *auth.UpdateRoleRequest) error
+	GetRole(ctx context.Context, name string) (*auth.RoleInfo, error)
+	ListRoles(ctx context.Context) (auth.ListRolesResponse, error)
+	DeleteRole(ctx context.Context, name string) error
 }
 
 var _ IAuthClient = (*AuthClient)(nil)
 
 type AuthClient struct {
 	cli *resty.Client
+	// accessToken is renewed in background if the client is created with a refresh token
+	accessToken atomic.Value
 }
 
 func NewAuthClient(url string, token string) (*AuthClient, error) {
@@ -84,15 +94,79 @@ func (lc *AuthClient) Verify(ctx context.Context, token string) (*auth.VerifyRes
 		Message: string(resp.Body()),
 	})
 
+	if err := verifyErrorOf(resp); err != nil {
+		return nil, err
+	}
 	return nil, fmt.Errorf("response code is : %d, msg:%s", resp.StatusCode(), resp.Body())
 }
 
-func (lc *AuthClient) GenerateToken(ctx context.Context, name, perm, extra string) (string, error) {
-	resp, err := lc.cli.R().SetContext(ctx).SetBody(auth.GenTokenRequest{
+// verifyErrorOf returns a `VerifyError` if resp is an unauthorized response with reason, otherwise nil
+func verifyErrorOf(resp *resty.Response) error {
+	if resp.StatusCode() != http.StatusUnauthorized {
+		return nil
+	}
+	failed := &auth.VerifyFailedResponse{}
+	if err := json.Unmarshal(resp.Body(), failed); err != nil || len(failed.Reason) == 0 {
+		return nil
+	}
+	return &VerifyError{Reason: failed.Reason, Msg: failed.Error}
+}
+
+// VerifyError is returned when sophon-auth rejects a token, errors.Is(err, auth.ErrorUserDisabled) etc. works with it
+type VerifyError struct {
+	Reason auth.VerifyFailedReason
+	Msg    string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("response code is : %d, reason: %s, msg:%s", http.StatusUnauthorized, e.Reason, e.Msg)
+}
+
+func (e *VerifyError) Unwrap() error {
+	return e.Reason.Err()
+}
+
+// GenTokenOption sets optional fields of the token generation request
+type GenTokenOption func(*auth.GenTokenRequest)
+
+// WithTTL makes the generated token expire after ttl
+func WithTTL(ttl time.Duration) GenTokenOption {
+	return func(req *auth.GenTokenRequest) {
+		req.TTL = ttl
+	}
+}
+
+// WithScopes restricts the generated token to scopes, eg: "market:read"
+func WithScopes(scopes ...core.Scope) GenTokenOption {
+	return func(req *auth.GenTokenRequest) {
+		req.Scopes = append(req.Scopes, scopes...)
+	}
+}
+
+// WithRole grants the generated token what the role grants, the permission is ignored
+func WithRole(role string) GenTokenOption {
+	return func(req *auth.GenTokenRequest) {
+		req.Role = role
+	}
+}
+
+// WithNotBefore makes the generated token invalid before nbf
+func WithNotBefore(nbf time.Time) GenTokenOption {
+	return func(req *auth.GenTokenRequest) {
+		req.NotBefore = nbf.Unix()
+	}
+}
+
+func (lc *AuthClient) GenerateToken(ctx context.Context, name, perm, extra string, opts ...GenTokenOption) (string, error) {
+	req := auth.GenTokenRequest{
 		Name:  name,
 		Perm:  perm,
 		Extra: extra,
-	}).SetResult(&auth.GenTokenResponse{}).SetError(&errcode.ErrMsg{}).Post("/genToken")
+	}
+	for _, opt := range opts {
+		opt(&req)
+	}
+	resp, err := lc.cli.R().SetContext(ctx).SetBody(req).SetResult(&auth.GenTokenResponse{}).SetError(&errcode.ErrMsg{}).Post("/genToken")
 	if err != nil {
 		return core.EmptyString, err
 	}
@@ -157,6 +231,86 @@ func (lc *AuthClient) RecoverToken(ctx context.Context, token string) error {
 	return resp.Error().(*errcode.ErrMsg).Err()
 }
 
+// GCTokens hard-deletes tokens which have been expired or soft-deleted longer than `req.Retention`,
+// with `req.DryRun` set, tokens which would be removed are returned instead
+func (lc *AuthClient) GCTokens(ctx context.Context, req *auth.GCTokensRequest) (*auth.GCTokensResponse, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(req).
+		SetResult(&auth.GCTokensResponse{}).
+		SetError(&errcode.ErrMsg{}).
+		Post("/token/gc")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.GCTokensResponse), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// JWKS fetches public keys which are used to verify tokens signed by sophon-auth offline
+func (lc *AuthClient) JWKS(ctx context.Context) (*auth.JWKSet, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetResult(&auth.JWKSet{}).
+		SetError(&errcode.ErrMsg{}).
+		Get(auth.JWKSPath)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.JWKSet), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+func (lc *AuthClient) ListSigningKeys(ctx context.Context) ([]*auth.SigningKeyInfo, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetResult(&[]*auth.SigningKeyInfo{}).
+		SetError(&errcode.ErrMsg{}).
+		Get("/key/list")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return *(resp.Result().(*[]*auth.SigningKeyInfo)), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// RotateSigningKey generates a new active signing key, previous active keys keep verifying tokens for `overlap`
+func (lc *AuthClient) RotateSigningKey(ctx context.Context, overlap time.Duration) (*auth.SigningKeyInfo, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(&auth.RotateSigningKeyRequest{Overlap: overlap}).
+		SetResult(&auth.SigningKeyInfo{}).
+		SetError(&errcode.ErrMsg{}).
+		Post("/key/rotate")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.SigningKeyInfo), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// RetireSigningKey retires a verify-only signing key immediately
+func (lc *AuthClient) RetireSigningKey(ctx context.Context, kid string) error {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(&auth.RetireSigningKeyRequest{Kid: kid}).
+		SetError(&errcode.ErrMsg{}).
+		Post("/key/retire")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return nil
+	}
+	return resp.Error().(*errcode.ErrMsg).Err()
+}
+
 func (lc *AuthClient) CreateUser(ctx context.Context, req *auth.CreateUserRequest) (*auth.CreateUserResponse, error) {
 	resp, err := lc.cli.R().SetContext(ctx).
 		SetHeader("Content-Type", "application/json").
@@ -290,6 +444,133 @@ func (lc *AuthClient) RecoverUser(ctx context.Context, req *auth.RecoverUserRequ
 	return resp.Error().(*errcode.ErrMsg).Err()
 }
 
+// ListAuditLogs lists audit logs of the mutations through sophon-auth in chronological order
+func (lc *AuthClient) ListAuditLogs(ctx context.Context, req *auth.ListAuditLogsRequest) (auth.ListAuditLogsResponse, error) {
+	params := map[string]string{
+		"skip":  strconv.FormatInt(req.Skip, 10),
+		"limit": strconv.FormatInt(req.Limit, 10),
+		"start": strconv.FormatInt(req.Start, 10),
+		"end":   strconv.FormatInt(req.End, 10),
+	}
+	if len(req.Actor) != 0 {
+		params["actor"] = req.Actor
+	}
+	if len(req.Action) != 0 {
+		params["action"] = req.Action
+	}
+	resp, err := lc.cli.R().SetContext(ctx).SetQueryParams(params).
+		SetResult(&auth.ListAuditLogsResponse{}).
+		SetError(&errcode.ErrMsg{}).
+		Get("/audit")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return *(resp.Result().(*auth.ListAuditLogsResponse)), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// GetAuditChainHead returns the latest audit log of the hash chain, which could be published for anchoring
+func (lc *AuthClient) GetAuditChainHead(ctx context.Context) (*auth.AuditChainHead, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetResult(&auth.AuditChainHead{}).
+		SetError(&errcode.ErrMsg{}).
+		Get("/audit/head")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.AuditChainHead), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// VerifyAuditChain walks through the hash chain of audit logs and reports the first broken link
+func (lc *AuthClient) VerifyAuditChain(ctx context.Context) (*auth.VerifyAuditChainResponse, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetResult(&auth.VerifyAuditChainResponse{}).
+		SetError(&errcode.ErrMsg{}).
+		Get("/audit/verify")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.VerifyAuditChainResponse), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+func (lc *AuthClient) CreateRole(ctx context.Context, req *auth.CreateRoleRequest) (*auth.RoleInfo, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(req).
+		SetResult(&auth.RoleInfo{}).
+		SetError(&errcode.ErrMsg{}).
+		Put("/role/new")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.RoleInfo), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+func (lc *AuthClient) UpdateRole(ctx context.Context, req *auth.UpdateRoleRequest) error {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(req).SetError(&errcode.ErrMsg{}).Post("/role/update")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return nil
+	}
+	return resp.Error().(*errcode.ErrMsg).Err()
+}
+
+func (lc *AuthClient) GetRole(ctx context.Context, name string) (*auth.RoleInfo, error) {
+	resp, err := lc.cli.R().SetContext(ctx).SetQueryParams(map[string]string{
+		"name": name,
+	}).SetResult(&auth.RoleInfo{}).SetError(&errcode.ErrMsg{}).Get("/role")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.RoleInfo), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+func (lc *AuthClient) ListRoles(ctx context.Context) (auth.ListRolesResponse, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetResult(&auth.ListRolesResponse{}).
+		SetError(&errcode.ErrMsg{}).
+		Get("/role/list")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return *(resp.Result().(*auth.ListRolesResponse)), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+func (lc *AuthClient) DeleteRole(ctx context.Context, name string) error {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetBody(&auth.DeleteRoleRequest{Name: name}).
+		SetError(&errcode.ErrMsg{}).
+		Post("/role/del")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return nil
+	}
+	return resp.Error().(*errcode.ErrMsg).Err()
+}
+
 func (lc *AuthClient) GetUserRateLimit(ctx context.Context, name, id string) (auth.GetUserRateLimitResponse, error) {
 	param := make(map[string]string)
 	if len(name) != 0 {
@@ -312,6 +593,57 @@ func (lc *AuthClient) GetUserRateLimit(ctx context.Context, name, id string) (au
 	return nil, resp.Error().(*errcode.ErrMsg).Err()
 }
 
+// GetEffectiveRateLimit returns the rate limit applying to the request of user `name` to `api` of `service`,
+// token is the token of request or its fingerprint, limits of tokens are skipped if it's empty
+func (lc *AuthClient) GetEffectiveRateLimit(ctx context.Context, name, token, service, api string) (*auth.EffectiveRateLimitResponse, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetQueryParams(map[string]string{"name": name, "token": token, "service": service, "api": api}).
+		SetResult(&auth.EffectiveRateLimitResponse{}).
+		SetError(&errcode.ErrMsg{}).
+		Get("/user/ratelimit/effective")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.EffectiveRateLimitResponse), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// ConsumeRateLimit takes requests from the budgets shared by all clients, see `BatchLimiter` to batch the calls
+func (lc *AuthClient) ConsumeRateLimit(ctx context.Context, consumptions []*auth.RateLimitConsumption) (auth.ConsumeRateLimitResponse, error) {
+	var res auth.ConsumeRateLimitResponse
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetBody(&auth.ConsumeRateLimitReq{Consumptions: consumptions}).
+		SetResult(&res).
+		SetError(&errcode.ErrMsg{}).
+		Post("/ratelimit/consume")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return res, nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// GetQuotaUsage returns the usages of the quotas of user `name` in window, the current day and month if window is empty
+func (lc *AuthClient) GetQuotaUsage(ctx context.Context, name, window string) (auth.GetQuotaUsageResponse, error) {
+	var res auth.GetQuotaUsageResponse
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetQueryParams(map[string]string{"name": name, "window": window}).
+		SetResult(&res).
+		SetError(&errcode.ErrMsg{}).
+		Get("/user/quota/usage")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return res, nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
 func (lc *AuthClient) UpsertUserRateLimit(ctx context.Context, req *auth.UpsertUserRateLimitReq) (string, error) {
 	var res string
 	resp, err := lc.cli.R().SetContext(ctx).SetBody(req).SetResult(&res).SetError(&errcode.ErrMsg{}).Post("/user/ratelimit/upsert")
@@ -336,6 +668,63 @@ func (lc *AuthClient) DelUserRateLimit(ctx context.Context, req *auth.DelUserRat
 	return "", resp.Error().(*errcode.ErrMsg).Err()
 }
 
+func (lc *AuthClient) UpsertRateLimitTier(ctx context.Context, req *auth.UpsertRateLimitTierReq) (*auth.RateLimitTierInfo, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(req).
+		SetResult(&auth.RateLimitTierInfo{}).
+		SetError(&errcode.ErrMsg{}).
+		Post("/ratelimit/tier/upsert")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.RateLimitTierInfo), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+func (lc *AuthClient) GetRateLimitTier(ctx context.Context, name string) (*auth.RateLimitTierInfo, error) {
+	resp, err := lc.cli.R().SetContext(ctx).SetQueryParams(map[string]string{
+		"name": name,
+	}).SetResult(&auth.RateLimitTierInfo{}).SetError(&errcode.ErrMsg{}).Get("/ratelimit/tier")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.RateLimitTierInfo), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+func (lc *AuthClient) ListRateLimitTiers(ctx context.Context) (auth.ListRateLimitTiersResponse, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetResult(&auth.ListRateLimitTiersResponse{}).
+		SetError(&errcode.ErrMsg{}).
+		Get("/ratelimit/tier/list")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return *(resp.Result().(*auth.ListRateLimitTiersResponse)), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+func (lc *AuthClient) DelRateLimitTier(ctx context.Context, name string) error {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetBody(&auth.DelRateLimitTierReq{Name: name}).
+		SetError(&errcode.ErrMsg{}).
+		Post("/ratelimit/tier/del")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return nil
+	}
+	return resp.Error().(*errcode.ErrMsg).Err()
+}
+
 func (lc *AuthClient) UpsertMiner(ctx context.Context, user, miner string, openMining bool) (bool, error) {
 	if _, err := address.NewFromString(miner); err != nil {
 		return false, xerrors.Errorf("invalid miner address:%s", miner)
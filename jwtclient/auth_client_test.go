@@ -2,13 +2,17 @@
 package jwtclient
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/filecoin-project/go-address"
 	"github.com/gin-gonic/gin"
@@ -17,6 +21,7 @@ import (
 	"github.com/ipfs-force-community/sophon-auth/auth"
 	"github.com/ipfs-force-community/sophon-auth/config"
 	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/storage"
 	"github.com/ipfs-force-community/sophon-auth/util"
 )
 
@@ -49,7 +54,7 @@ func TestMain(m *testing.M) {
 	if err != nil {
 		log.Fatalf("Failed to init oauthApp : %s", err)
 	}
-	token, err := app.GetDefaultAdminToken()
+	token, err := app.GetDefaultAdminToken("")
 	if err != nil {
 		log.Fatalf("Failed to get default admin token : %s", err)
 	}
@@ -63,9 +68,13 @@ func TestMain(m *testing.M) {
 		IdleTimeout:  cnf.IdleTimeout,
 	}
 
+	listener, err := net.Listen("tcp", cnf.Listen)
+	if err != nil {
+		log.Fatalf("failed to listen on %s err:%s", cnf.Listen, err)
+	}
 	go func() {
 		log.Infof("server start and listen on %s", cnf.Listen)
-		if err = server.ListenAndServe(); err != nil {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
 			log.Errorf("start serve failed: %v", err)
 		}
 	}() //nolint
@@ -282,6 +291,97 @@ func TestClient_Verify(t *testing.T) {
 	}
 }
 
+func TestClient_VerifyDisabledUser(t *testing.T) {
+	ctx := context.TODO()
+	name := "verify_disabled_user"
+	_, err := cli.CreateUser(ctx, &auth.CreateUserRequest{Name: name, State: core.UserStateEnabled})
+	assert.NoError(t, err)
+	token, err := cli.GenerateToken(ctx, name, core.PermRead, "")
+	assert.NoError(t, err)
+
+	assert.NoError(t, cli.UpdateUser(ctx, &auth.UpdateUserRequest{Name: name, State: core.UserStateDisabled}))
+	_, err = cli.Verify(ctx, token)
+	assert.ErrorIs(t, err, auth.ErrorUserDisabled)
+	var verifyErr *VerifyError
+	assert.True(t, errors.As(err, &verifyErr))
+	assert.Equal(t, auth.ReasonUserDisabled, verifyErr.Reason)
+}
+
+func TestClient_RefreshToken(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	name := "refresh_token_user"
+	_, err := cli.CreateUser(ctx, &auth.CreateUserRequest{Name: name, State: core.UserStateEnabled})
+	assert.NoError(t, err)
+
+	pair, err := cli.GenerateTokenPair(ctx, name, core.PermAdmin, "", 2*time.Second, time.Hour)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, pair.RefreshToken)
+
+	refreshed := make(chan *auth.GenTokenResponse, 10)
+	rc, err := NewAuthClientWithRefreshToken(ctx, cli.cli.HostURL, pair.RefreshToken, func(res *auth.GenTokenResponse) {
+		refreshed <- res
+	})
+	assert.NoError(t, err)
+	first := <-refreshed
+	assert.NotEqual(t, pair.RefreshToken, first.RefreshToken)
+
+	// the access token is renewed in background before it expires
+	var latest *auth.GenTokenResponse
+	select {
+	case latest = <-refreshed:
+		assert.NotEqual(t, first.RefreshToken, latest.RefreshToken)
+	case <-time.After(5 * time.Second):
+		t.Fatal("access token isn't refreshed")
+	}
+	_, err = rc.ListRoles(ctx)
+	assert.NoError(t, err)
+	cancel()
+
+	// reusing a refresh token revokes its family
+	_, err = cli.RefreshToken(context.Background(), pair.RefreshToken)
+	assert.ErrorIs(t, err, auth.ErrorRefreshTokenReused)
+	_, err = cli.RefreshToken(context.Background(), latest.RefreshToken)
+	assert.ErrorIs(t, err, auth.ErrorInvalidRefreshToken)
+}
+
+func TestClient_Backup(t *testing.T) {
+	ctx := context.Background()
+	var full bytes.Buffer
+	since, err := cli.Backup(ctx, &full, 0)
+	if err != nil && err.Error() == storage.ErrBackupNotSupported.Error() {
+		t.Skip(err)
+	}
+	assert.NoError(t, err)
+	assert.NotZero(t, full.Len())
+
+	name := "backup_user"
+	_, err = cli.CreateUser(ctx, &auth.CreateUserRequest{Name: name, State: core.UserStateEnabled})
+	assert.NoError(t, err)
+	var incremental bytes.Buffer
+	next, err := cli.Backup(ctx, &incremental, since)
+	assert.NoError(t, err)
+	assert.Greater(t, next, since)
+	assert.Less(t, incremental.Len(), full.Len())
+
+	// nothing changed after the incremental backup
+	var empty bytes.Buffer
+	last, err := cli.Backup(ctx, &empty, next)
+	assert.NoError(t, err)
+	assert.Equal(t, next, last)
+
+	dataPath := t.TempDir()
+	assert.NoError(t, storage.RestoreBadger(dataPath, &full, &incremental, &empty))
+	store, err := storage.NewStore(&config.DBConfig{Type: config.Badger}, dataPath)
+	assert.NoError(t, err)
+	has, err := store.HasUser(name)
+	assert.NoError(t, err)
+	assert.True(t, has)
+
+	// the store is in use
+	assert.ErrorIs(t, storage.RestoreBadger(dataPath), storage.ErrStoreInUse)
+}
+
 func TestJWTClient_ListUsers(t *testing.T) {
 	if os.Getenv("CI") == "test" {
 		t.Skip()
@@ -1,13 +1,17 @@
 package jwtclient
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"reflect"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/ipfs-force-community/sophon-auth/auth"
 	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/storage"
 
 	logging "github.com/ipfs/go-log/v2"
 )
@@ -84,6 +88,20 @@ func (authMux *AuthMux) trustedHandler(uri string) http.Handler {
 	return nil
 }
 
+// logVerifyFailed logs why a request is rejected, with the reason of sophon-auth if there is one
+func logVerifyFailed(r *http.Request, err error) {
+	var verifyErr *VerifyError
+	reason := auth.VerifyFailedReasonOf(err)
+	if errors.As(err, &verifyErr) {
+		reason = verifyErr.Reason
+	}
+	if len(reason) != 0 {
+		log.Warnf("JWT Verification failed (originating from %s, reason: %s): %s", r.RemoteAddr, reason, err)
+		return
+	}
+	log.Warnf("JWT Verification failed (originating from %s): %s", r.RemoteAddr, err)
+}
+
 func (authMux *AuthMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if h := authMux.trustedHandler(r.RequestURI); h != nil {
 		h.ServeHTTP(w, r)
@@ -108,47 +126,85 @@ func (authMux *AuthMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	token = strings.TrimPrefix(token, "Bearer ")
 
+	// reject expired tokens early, signature is still checked by local or remote client
+	if unverified, err := auth.JwtPayloadFromToken(token); err == nil {
+		if err := unverified.Valid(time.Now()); err != nil {
+			logVerifyFailed(r, err)
+			w.WriteHeader(401)
+			return
+		}
+	}
+
+	// payload is what the token is granted, never use the unverified one to build ctx
+	var payload *auth.VerifyResponse
 	var err error
-	var perm core.Permission
 	host := r.RemoteAddr
 
 	ctx = core.CtxWithTokenLocation(ctx, host)
 
 	if !isNil(authMux.local) {
-		if perm, err = authMux.local.Verify(ctx, token); err != nil {
+		if payload, err = verifyPayload(ctx, authMux.local, token); err != nil {
 			if !isNil(authMux.remote) {
-				if perm, err = authMux.remote.Verify(ctx, token); err != nil {
-					log.Warnf("JWT Verification failed (originating from %s): %s", r.RemoteAddr, err)
+				if payload, err = verifyPayload(ctx, authMux.remote, token); err != nil {
+					logVerifyFailed(r, err)
 					w.WriteHeader(401)
 					return
 				}
 			} else {
-				log.Warnf("JWT Verification failed (originating from %s): %s", r.RemoteAddr, err)
+				logVerifyFailed(r, err)
 				w.WriteHeader(401)
 				return
 			}
 		}
 	} else {
 		if !isNil(authMux.remote) {
-			if perm, err = authMux.remote.Verify(ctx, token); err != nil {
-				log.Warnf("JWT Verification failed (originating from %s): %s", r.RemoteAddr, err)
+			if payload, err = verifyPayload(ctx, authMux.remote, token); err != nil {
+				logVerifyFailed(r, err)
 				w.WriteHeader(401)
 				return
 			}
 		}
 	}
 
-	ctx = core.CtxWithPerm(ctx, perm)
-
-	if name, _ := auth.JwtUserFromToken(token); len(name) != 0 {
-		ctx = core.CtxWithName(ctx, name)
+	if payload != nil {
+		ctx = core.CtxWithPerm(ctx, payload.Perm)
+		ctx = core.CtxWithScopes(ctx, core.ScopesOf(payload.Perm, payload.Scopes))
+		if len(payload.Name) != 0 {
+			ctx = core.CtxWithName(ctx, payload.Name)
+		}
+	} else {
+		ctx = core.CtxWithPerm(ctx, "")
 	}
+	// identifies the token without keeping it, so that the limits of the token could be resolved
+	ctx = core.CtxWithTokenFingerprint(ctx, storage.TokenFingerprint(token))
 
 	*r = *(r.WithContext(ctx))
 
 	authMux.handler.ServeHTTP(w, r)
 }
 
+// verifyPayload returns what token is granted if client implements `IJwtPayloadVerifier`, otherwise the
+// payload of token with the permission returned by client, tokens bound to a role are rejected then as
+// their scopes are the role's, which client doesn't tell
+func verifyPayload(ctx context.Context, client IJwtAuthClient, token string) (*auth.VerifyResponse, error) {
+	if v, ok := client.(IJwtPayloadVerifier); ok {
+		return v.VerifyPayload(ctx, token)
+	}
+	perm, err := client.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := auth.JwtPayloadFromToken(token)
+	if err != nil {
+		return &auth.VerifyResponse{Perm: perm}, nil
+	}
+	if err := checkOfflinePayload(payload); err != nil {
+		return nil, err
+	}
+	payload.Perm = perm
+	return payload, nil
+}
+
 func isNil(ac IJwtAuthClient) bool {
 	if ac != nil && !reflect.ValueOf(ac).IsNil() {
 		return false
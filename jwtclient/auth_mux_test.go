@@ -3,12 +3,17 @@ package jwtclient
 import (
 	"context"
 	"net/http"
+	"net/http/httptest"
 	"regexp"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/config"
 	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/storage"
 )
 
 type mockImp struct{}
@@ -43,3 +48,97 @@ func TestTruthHandle(t *testing.T) {
 	path := "/piece/xfdfs1fs"
 	assert.NotNil(t, mux.trustedHandler(path))
 }
+
+func TestAuthMuxContext(t *testing.T) {
+	local, token, err := NewLocalAuthClient()
+	require.NoError(t, err)
+
+	var ctx context.Context
+	mux := NewAuthMux(local, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/rpc/v0", nil)
+	req.Header.Set(core.AuthorizationHeader, "Bearer "+string(token))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	name, _ := core.CtxGetName(ctx)
+	assert.Equal(t, auth.DefaultAdminTokenName, name)
+	fingerprint, _ := core.CtxGetTokenFingerprint(ctx)
+	assert.Equal(t, storage.TokenFingerprint(string(token)), fingerprint)
+	acc, _ := (&core.TokenValueFromCtx{}).AccFromCtx(ctx)
+	assert.Equal(t, core.TokenAccount(name, fingerprint), acc)
+}
+
+func TestAuthMuxRoleScopes(t *testing.T) {
+	cnf := config.DefaultConfig()
+	app, err := auth.NewOAuthApp(t.TempDir(), cnf.DB,
+		auth.WithSigningConfig(&config.SigningConfig{Alg: config.SigningAlgEd25519}))
+	require.NoError(t, err)
+	adminToken, err := app.GetDefaultAdminToken("")
+	require.NoError(t, err)
+	srv := httptest.NewServer(auth.InitRouter(app))
+	defer srv.Close()
+
+	client, err := NewAuthClient(srv.URL, adminToken)
+	require.NoError(t, err)
+	ctx := context.Background()
+	_, err = client.CreateUser(ctx, &auth.CreateUserRequest{Name: "role-user"})
+	require.NoError(t, err)
+	_, err = client.CreateRole(ctx, &auth.CreateRoleRequest{Name: "market-writer", Perm: core.PermWrite, Scopes: []core.Scope{"market:write"}})
+	require.NoError(t, err)
+	token, err := client.GenerateToken(ctx, "role-user", "", "", WithRole("market-writer"))
+	require.NoError(t, err)
+
+	// the role can't be resolved offline, so the token is verified by the remote client
+	local := NewJWKSVerifier(client, 0)
+	_, err = local.Verify(ctx, token)
+	require.Error(t, err)
+
+	var reqCtx context.Context
+	mux := NewAuthMux(local, WarpIJwtAuthClient(client), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqCtx = r.Context()
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/rpc/v0", nil)
+	req.Header.Set(core.AuthorizationHeader, "Bearer "+token)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	scopes, _ := core.CtxGetScopes(reqCtx)
+	assert.Equal(t, []core.Scope{"market:write"}, scopes)
+	perms, _ := core.CtxGetPerm(reqCtx)
+	assert.Equal(t, core.AdaptOldStrategy(core.PermWrite), perms)
+	name, _ := core.CtxGetName(reqCtx)
+	assert.Equal(t, "role-user", name)
+
+	// clients telling the permission only can't resolve the scopes of the role
+	mux = NewAuthMux(nil, &permVerifier{client: WarpIJwtAuthClient(client)}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqCtx = r.Context()
+	}))
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// but they still verify other tokens
+	plainToken, err := client.GenerateToken(ctx, "role-user", core.PermRead, "")
+	require.NoError(t, err)
+	req.Header.Set(core.AuthorizationHeader, "Bearer "+plainToken)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	perms, _ = core.CtxGetPerm(reqCtx)
+	assert.Equal(t, core.AdaptOldStrategy(core.PermRead), perms)
+	name, _ = core.CtxGetName(reqCtx)
+	assert.Equal(t, "role-user", name)
+}
+
+// permVerifier implements `IJwtAuthClient` only
+type permVerifier struct {
+	client IJwtAuthClient
+}
+
+func (v *permVerifier) Verify(ctx context.Context, token string) (core.Permission, error) {
+	return v.client.Verify(ctx, token)
+}
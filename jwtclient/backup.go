@@ -0,0 +1,49 @@
+package jwtclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
+)
+
+// Backup streams a backup of the store of sophon-auth to w, only badger store supports it.
+// `since` is what the previous backup returns, 0 means a full backup. It returns the `since`
+// of the next incremental backup.
+func (lc *AuthClient) Backup(ctx context.Context, w io.Writer, since uint64) (uint64, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetDoNotParseResponse(true).
+		SetHeader("Accept", "application/octet-stream").
+		SetQueryParam("since", strconv.FormatUint(since, 10)).
+		Get(auth.BackupPath)
+	if err != nil {
+		return 0, err
+	}
+	body := resp.RawBody()
+	defer body.Close() //nolint:errcheck
+	if resp.StatusCode() != http.StatusOK {
+		errMsg := &errcode.ErrMsg{}
+		if err := json.NewDecoder(body).Decode(errMsg); err != nil {
+			return 0, fmt.Errorf("response code is : %d", resp.StatusCode())
+		}
+		return 0, errMsg.Err()
+	}
+
+	if _, err := io.Copy(w, body); err != nil {
+		return 0, err
+	}
+	// trailers are available once the body is read to the end
+	next := resp.RawResponse.Trailer.Get(auth.BackupSinceTrailer)
+	if len(next) == 0 {
+		next = resp.Header().Get(auth.BackupSinceTrailer)
+	}
+	if len(next) == 0 {
+		return 0, fmt.Errorf("backup is incomplete")
+	}
+	return strconv.ParseUint(next, 10, 64)
+}
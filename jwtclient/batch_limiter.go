@@ -0,0 +1,152 @@
+package jwtclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ipfs-force-community/metrics/ratelimit"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/core"
+)
+
+// IRateLimitConsumer takes requests from the rate limit budgets counted by sophon-auth,
+// which are shared by all instances of services
+type IRateLimitConsumer interface {
+	ConsumeRateLimit(ctx context.Context, consumptions []*auth.RateLimitConsumption) (auth.ConsumeRateLimitResponse, error)
+}
+
+var (
+	_ IRateLimitConsumer     = (*AuthClient)(nil)
+	_ IRateLimitConsumer     = (*BatchLimiter)(nil)
+	_ ratelimit.ILimitFinder = (*BatchLimiter)(nil)
+)
+
+const (
+	DefaultBatchDelay = 5 * time.Millisecond
+	DefaultBatchSize  = 100
+)
+
+// BatchLimiter consumes the budgets counted by sophon-auth, consumptions made within `delay` are sent
+// in one request, or as soon as `size` consumptions are pending. Consumptions are taken even if
+// their callers are gone before the budgets return.
+// It finds limits like `WarpLimitFinder` too, so it could replace the finder of a local limiter.
+type BatchLimiter struct {
+	ratelimit.ILimitFinder
+	consumer IRateLimitConsumer
+	delay    time.Duration
+	size     int
+
+	lk      sync.Mutex
+	pending []*pendingConsumption
+	// timer sends pending consumptions once `delay` passes, it's nil if nothing is pending
+	timer *time.Timer
+}
+
+type pendingConsumption struct {
+	consumption *auth.RateLimitConsumption
+	done        chan consumeResult
+}
+
+type consumeResult struct {
+	budget *auth.RateLimitBudget
+	err    error
+}
+
+// NewBatchLimiter returns a limiter batching the consumptions sent by client,
+// `DefaultBatchDelay` and `DefaultBatchSize` are used if delay or size is not positive
+func NewBatchLimiter(client *AuthClient, delay time.Duration, size int) *BatchLimiter {
+	return newBatchLimiter(WarpLimitFinder(client), client, delay, size)
+}
+
+func newBatchLimiter(finder ratelimit.ILimitFinder, consumer IRateLimitConsumer, delay time.Duration, size int) *BatchLimiter {
+	if delay <= 0 {
+		delay = DefaultBatchDelay
+	}
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	return &BatchLimiter{ILimitFinder: finder, consumer: consumer, delay: delay, size: size}
+}
+
+// Allow consumes one request of user `name` to `api` of `service`, the limits of the token placed in ctx
+// by `AuthMux` are resolved before the ones of the user
+func (l *BatchLimiter) Allow(ctx context.Context, name, service, api string) (*auth.RateLimitBudget, error) {
+	token, _ := core.CtxGetTokenFingerprint(ctx)
+	res, err := l.ConsumeRateLimit(ctx, []*auth.RateLimitConsumption{{Name: name, Token: token, Service: service, API: api, Count: 1}})
+	if err != nil {
+		return nil, err
+	}
+	return res[0], nil
+}
+
+// ConsumeRateLimit queues consumptions to the next batch and waits for their budgets
+func (l *BatchLimiter) ConsumeRateLimit(ctx context.Context, consumptions []*auth.RateLimitConsumption) (auth.ConsumeRateLimitResponse, error) {
+	waits := make([]chan consumeResult, len(consumptions))
+	l.lk.Lock()
+	for idx, cons := range consumptions {
+		waits[idx] = make(chan consumeResult, 1)
+		l.pending = append(l.pending, &pendingConsumption{consumption: cons, done: waits[idx]})
+	}
+	if len(l.pending) >= l.size {
+		go l.send(l.takePending())
+	} else if l.timer == nil && len(l.pending) > 0 {
+		l.timer = time.AfterFunc(l.delay, l.flush)
+	}
+	l.lk.Unlock()
+
+	res := make(auth.ConsumeRateLimitResponse, len(consumptions))
+	for idx, wait := range waits {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case r := <-wait:
+			if r.err != nil {
+				return nil, r.err
+			}
+			res[idx] = r.budget
+		}
+	}
+	return res, nil
+}
+
+func (l *BatchLimiter) flush() {
+	l.lk.Lock()
+	batch := l.takePending()
+	l.lk.Unlock()
+	l.send(batch)
+}
+
+// takePending must be called with `lk` held
+func (l *BatchLimiter) takePending() []*pendingConsumption {
+	batch := l.pending
+	l.pending = nil
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	return batch
+}
+
+func (l *BatchLimiter) send(batch []*pendingConsumption) {
+	if len(batch) == 0 {
+		return
+	}
+	consumptions := make([]*auth.RateLimitConsumption, len(batch))
+	for idx, p := range batch {
+		consumptions[idx] = p.consumption
+	}
+	res, err := l.consumer.ConsumeRateLimit(context.Background(), consumptions)
+	if err == nil && len(res) != len(batch) {
+		err = fmt.Errorf("expect %d rate limit budgets, got %d", len(batch), len(res))
+	}
+	for idx, p := range batch {
+		if err != nil {
+			p.done <- consumeResult{err: err}
+			continue
+		}
+		p.done <- consumeResult{budget: res[idx]}
+	}
+}
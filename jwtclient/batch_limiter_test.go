@@ -0,0 +1,113 @@
+package jwtclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/core"
+)
+
+type fakeConsumer struct {
+	lk      sync.Mutex
+	batches [][]*auth.RateLimitConsumption
+	used    map[string]int64
+	cap     int64
+	err     error
+}
+
+func (f *fakeConsumer) ConsumeRateLimit(ctx context.Context, consumptions []*auth.RateLimitConsumption) (auth.ConsumeRateLimitResponse, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	f.batches = append(f.batches, consumptions)
+	if f.err != nil {
+		return nil, f.err
+	}
+	res := make(auth.ConsumeRateLimitResponse, 0, len(consumptions))
+	for _, cons := range consumptions {
+		allowed := f.used[cons.Name]+cons.Count <= f.cap
+		if allowed {
+			f.used[cons.Name] += cons.Count
+		}
+		res = append(res, &auth.RateLimitBudget{Allowed: allowed, Cap: f.cap, Remaining: f.cap - f.used[cons.Name]})
+	}
+	return res, nil
+}
+
+func (f *fakeConsumer) batchCount() int {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	return len(f.batches)
+}
+
+func TestBatchLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("batch by delay", func(t *testing.T) {
+		fake := &fakeConsumer{used: map[string]int64{}, cap: 5}
+		limiter := newBatchLimiter(nil, fake, 200*time.Millisecond, 100)
+
+		var wg sync.WaitGroup
+		var lk sync.Mutex
+		allowed := 0
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				budget, err := limiter.Allow(ctx, "user", "market", "DealList")
+				require.NoError(t, err)
+				if budget.Allowed {
+					lk.Lock()
+					allowed++
+					lk.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		require.Equal(t, 5, allowed)
+		require.Equal(t, 1, fake.batchCount())
+	})
+
+	t.Run("batch by size", func(t *testing.T) {
+		fake := &fakeConsumer{used: map[string]int64{}, cap: 100}
+		limiter := newBatchLimiter(nil, fake, time.Hour, 3)
+
+		consumptions := []*auth.RateLimitConsumption{
+			{Name: "user", Count: 1}, {Name: "user", Count: 2}, {Name: "user", Count: 3},
+		}
+		res, err := limiter.ConsumeRateLimit(ctx, consumptions)
+		require.NoError(t, err)
+		require.Len(t, res, 3)
+		require.Equal(t, int64(94), res[2].Remaining)
+		require.Equal(t, 1, fake.batchCount())
+	})
+
+	t.Run("token of request", func(t *testing.T) {
+		fake := &fakeConsumer{used: map[string]int64{}, cap: 1}
+		limiter := newBatchLimiter(nil, fake, time.Millisecond, 100)
+		_, err := limiter.Allow(core.CtxWithTokenFingerprint(ctx, "0123456789abcdef"), "user", "", "")
+		require.NoError(t, err)
+		require.Equal(t, "0123456789abcdef", fake.batches[0][0].Token)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		fake := &fakeConsumer{used: map[string]int64{}, err: errors.New("unavailable")}
+		limiter := newBatchLimiter(nil, fake, time.Millisecond, 100)
+		_, err := limiter.Allow(ctx, "user", "", "")
+		require.ErrorIs(t, err, fake.err)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		fake := &fakeConsumer{used: map[string]int64{}, cap: 1}
+		limiter := newBatchLimiter(nil, fake, time.Hour, 100)
+		cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err := limiter.Allow(cctx, "user", "", "")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
@@ -0,0 +1,276 @@
+package jwtclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+	"github.com/ipfs-force-community/sophon-auth/util"
+)
+
+// CacheConfig configures the cache of `CachedAuthClient`
+type CacheConfig struct {
+	// Size is the max count of entries of each cached method
+	Size int
+	// TTL is how long a successful result is cached
+	TTL time.Duration
+	// NegativeTTL is how long a rejected result is cached, eg: invalid token, miner not found.
+	// errors like network failure are never cached.
+	NegativeTTL time.Duration
+}
+
+func DefaultCacheConfig() *CacheConfig {
+	return &CacheConfig{
+		Size:        10000,
+		TTL:         time.Minute,
+		NegativeTTL: 5 * time.Second,
+	}
+}
+
+// CacheStats is the hit/miss counters of a cached method
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+}
+
+const (
+	cacheVerify            = "Verify"
+	cacheGetUserByMiner    = "GetUserByMiner"
+	cacheMinerExistInUser  = "MinerExistInUser"
+	cacheSignerExistInUser = "SignerExistInUser"
+)
+
+type cacheResult[V any] struct {
+	val V
+	err error
+}
+
+type methodCache[K comparable, V any] struct {
+	lru          *util.LRU[K, cacheResult[V]]
+	hits, misses int64
+}
+
+func newMethodCache[K comparable, V any](size int) *methodCache[K, V] {
+	return &methodCache[K, V]{lru: util.NewLRU[K, cacheResult[V]](size)}
+}
+
+func (mc *methodCache[K, V]) stats() CacheStats {
+	return CacheStats{Hits: atomic.LoadInt64(&mc.hits), Misses: atomic.LoadInt64(&mc.misses)}
+}
+
+// get returns the cached result of key, calls `load` and caches its result if missed.
+// `ttl` decides how long the loaded result is cached, result isn't cached if ttl <= 0.
+func (mc *methodCache[K, V]) get(key K, load func() (V, error), ttl func(V, error) time.Duration) (V, error) {
+	if res, ok := mc.lru.Get(key); ok {
+		atomic.AddInt64(&mc.hits, 1)
+		return res.val, res.err
+	}
+	atomic.AddInt64(&mc.misses, 1)
+
+	val, err := load()
+	if d := ttl(val, err); d > 0 {
+		mc.lru.Add(key, cacheResult[V]{val: val, err: err}, d)
+	}
+	return val, err
+}
+
+type addrUserKey struct {
+	addr address.Address
+	user string
+}
+
+// CachedAuthClient caches the results of the hot methods of `IAuthClient`,
+// other methods are passed to the wrapped client directly.
+type CachedAuthClient struct {
+	IAuthClient
+	cnf *CacheConfig
+
+	verify        *methodCache[string, *auth.VerifyResponse]
+	userByMiner   *methodCache[address.Address, *auth.OutputUser]
+	minerInUser   *methodCache[addrUserKey, bool]
+	signerInUser  *methodCache[addrUserKey, bool]
+	cachedMethods map[string]func() CacheStats
+}
+
+var _ IAuthClient = (*CachedAuthClient)(nil)
+
+func NewCachedAuthClient(cli IAuthClient, cnf *CacheConfig) *CachedAuthClient {
+	if cnf == nil {
+		cnf = DefaultCacheConfig()
+	}
+	c := &CachedAuthClient{
+		IAuthClient:  cli,
+		cnf:          cnf,
+		verify:       newMethodCache[string, *auth.VerifyResponse](cnf.Size),
+		userByMiner:  newMethodCache[address.Address, *auth.OutputUser](cnf.Size),
+		minerInUser:  newMethodCache[addrUserKey, bool](cnf.Size),
+		signerInUser: newMethodCache[addrUserKey, bool](cnf.Size),
+	}
+	c.cachedMethods = map[string]func() CacheStats{
+		cacheVerify:            c.verify.stats,
+		cacheGetUserByMiner:    c.userByMiner.stats,
+		cacheMinerExistInUser:  c.minerInUser.stats,
+		cacheSignerExistInUser: c.signerInUser.stats,
+	}
+	return c
+}
+
+// Stats returns hit/miss counters by method name
+func (c *CachedAuthClient) Stats() map[string]CacheStats {
+	stats := make(map[string]CacheStats, len(c.cachedMethods))
+	for method, fn := range c.cachedMethods {
+		stats[method] = fn()
+	}
+	return stats
+}
+
+func (c *CachedAuthClient) Verify(ctx context.Context, token string) (*auth.VerifyResponse, error) {
+	res, err := c.verify.get(token, func() (*auth.VerifyResponse, error) {
+		return c.IAuthClient.Verify(ctx, token)
+	}, func(res *auth.VerifyResponse, err error) time.Duration {
+		ttl := c.ttl(err)
+		// never cache a token longer than its lifetime
+		if err == nil && res.ExpirationTime != nil {
+			if left := time.Until(res.ExpirationTime.Time); left < ttl {
+				ttl = left
+			}
+		}
+		return ttl
+	})
+	if err != nil {
+		return nil, err
+	}
+	// return a copy, in case of the cached one is modified by caller
+	cpy := *res
+	return &cpy, nil
+}
+
+func (c *CachedAuthClient) GetUserByMiner(ctx context.Context, miner address.Address) (*auth.OutputUser, error) {
+	user, err := c.userByMiner.get(miner, func() (*auth.OutputUser, error) {
+		return c.IAuthClient.GetUserByMiner(ctx, miner)
+	}, func(_ *auth.OutputUser, err error) time.Duration {
+		return c.ttl(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	cpy := *user
+	return &cpy, nil
+}
+
+func (c *CachedAuthClient) MinerExistInUser(ctx context.Context, user string, miner address.Address) (bool, error) {
+	return c.minerInUser.get(addrUserKey{addr: miner, user: user}, func() (bool, error) {
+		return c.IAuthClient.MinerExistInUser(ctx, user, miner)
+	}, c.boolTTL)
+}
+
+func (c *CachedAuthClient) SignerExistInUser(ctx context.Context, user string, signer address.Address) (bool, error) {
+	return c.signerInUser.get(addrUserKey{addr: signer, user: user}, func() (bool, error) {
+		return c.IAuthClient.SignerExistInUser(ctx, user, signer)
+	}, c.boolTTL)
+}
+
+// Purge drops all the cached results
+func (c *CachedAuthClient) Purge() {
+	c.verify.lru.Purge()
+	c.userByMiner.lru.Purge()
+	c.minerInUser.lru.Purge()
+	c.signerInUser.lru.Purge()
+}
+
+// Invalidate drops the cached results affected by `ev`
+func (c *CachedAuthClient) Invalidate(ev *auth.ChangeEvent) {
+	switch ev.Type {
+	case auth.ChangeTokenRemoved, auth.ChangeTokenRecovered:
+		if len(ev.Token) != 0 {
+			c.verify.lru.Remove(ev.Token)
+			return
+		}
+		c.verify.lru.RemoveIf(func(token string, _ cacheResult[*auth.VerifyResponse]) bool {
+			return storage.TokenFingerprint(token) == ev.Fingerprint
+		})
+	case auth.ChangeUser:
+		c.verify.lru.RemoveIf(func(_ string, res cacheResult[*auth.VerifyResponse]) bool {
+			// the owner of a rejected token is unknown
+			return res.err != nil || res.val.Name == ev.User
+		})
+		c.userByMiner.lru.RemoveIf(func(_ address.Address, res cacheResult[*auth.OutputUser]) bool {
+			return res.err != nil || res.val.Name == ev.User
+		})
+		removeByUser(c.minerInUser, ev.User)
+		removeByUser(c.signerInUser, ev.User)
+	case auth.ChangeMiner:
+		addr, err := address.NewFromString(ev.Address)
+		if err != nil {
+			c.userByMiner.lru.Purge()
+			c.minerInUser.lru.Purge()
+			return
+		}
+		c.userByMiner.lru.Remove(addr)
+		removeByAddr(c.minerInUser, addr)
+	case auth.ChangeSigner:
+		addr, err := address.NewFromString(ev.Address)
+		if err != nil {
+			c.signerInUser.lru.Purge()
+			return
+		}
+		removeByAddr(c.signerInUser, addr)
+	case auth.ChangeRole:
+		c.verify.lru.RemoveIf(func(_ string, res cacheResult[*auth.VerifyResponse]) bool {
+			return res.err != nil || res.val.Role == ev.Role
+		})
+	case auth.ChangeSigningKey:
+		c.verify.lru.Purge()
+	case auth.ChangeRateLimit:
+		// rate limits are not cached here
+	default:
+		c.Purge()
+	}
+}
+
+// StartInvalidation subscribes the changes of sophon-auth in background, and invalidates the
+// affected results until ctx is done.
+func (c *CachedAuthClient) StartInvalidation(ctx context.Context, streamer ChangeStreamer) {
+	go RunChangeSubscriber(ctx, streamer, c.Invalidate, DefaultChangeRetryInterval)
+}
+
+func removeByUser(mc *methodCache[addrUserKey, bool], user string) {
+	mc.lru.RemoveIf(func(key addrUserKey, _ cacheResult[bool]) bool {
+		return key.user == user
+	})
+}
+
+func removeByAddr(mc *methodCache[addrUserKey, bool], addr address.Address) {
+	mc.lru.RemoveIf(func(key addrUserKey, _ cacheResult[bool]) bool {
+		return key.addr == addr
+	})
+}
+
+func (c *CachedAuthClient) ttl(err error) time.Duration {
+	if err == nil {
+		return c.cnf.TTL
+	}
+	if isTransientErr(err) {
+		return 0
+	}
+	return c.cnf.NegativeTTL
+}
+
+func (c *CachedAuthClient) boolTTL(exist bool, err error) time.Duration {
+	if err == nil && !exist {
+		return c.cnf.NegativeTTL
+	}
+	return c.ttl(err)
+}
+
+// isTransientErr returns true if err is not a response of sophon-auth, eg: network failure
+func isTransientErr(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
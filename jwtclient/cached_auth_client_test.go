@@ -0,0 +1,104 @@
+package jwtclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/core"
+)
+
+type fakeAuthClient struct {
+	IAuthClient
+	calls map[string]int
+	err   error
+}
+
+func (f *fakeAuthClient) Verify(ctx context.Context, token string) (*auth.VerifyResponse, error) {
+	f.calls[cacheVerify]++
+	if f.err != nil {
+		return nil, f.err
+	}
+	if token == "invalid" {
+		return nil, errors.New("token not exist")
+	}
+	return &auth.VerifyResponse{Name: "user", Perm: core.PermRead}, nil
+}
+
+func (f *fakeAuthClient) MinerExistInUser(ctx context.Context, user string, miner address.Address) (bool, error) {
+	f.calls[cacheMinerExistInUser]++
+	return user == "user", nil
+}
+
+func TestCachedAuthClient(t *testing.T) {
+	ctx := context.Background()
+	newClient := func() (*fakeAuthClient, *CachedAuthClient) {
+		fake := &fakeAuthClient{calls: map[string]int{}}
+		return fake, NewCachedAuthClient(fake, &CacheConfig{Size: 10, TTL: time.Minute, NegativeTTL: 50 * time.Millisecond})
+	}
+
+	t.Run("verify", func(t *testing.T) {
+		fake, cli := newClient()
+		for i := 0; i < 3; i++ {
+			res, err := cli.Verify(ctx, "token")
+			require.NoError(t, err)
+			require.Equal(t, "user", res.Name)
+			// modify returned value should not pollute the cache
+			res.Name = "other"
+		}
+		require.Equal(t, 1, fake.calls[cacheVerify])
+		require.Equal(t, CacheStats{Hits: 2, Misses: 1}, cli.Stats()[cacheVerify])
+
+		cli.Purge()
+		_, err := cli.Verify(ctx, "token")
+		require.NoError(t, err)
+		require.Equal(t, 2, fake.calls[cacheVerify])
+	})
+
+	t.Run("negative ttl", func(t *testing.T) {
+		fake, cli := newClient()
+		for i := 0; i < 2; i++ {
+			_, err := cli.Verify(ctx, "invalid")
+			require.Error(t, err)
+		}
+		require.Equal(t, 1, fake.calls[cacheVerify])
+
+		time.Sleep(100 * time.Millisecond)
+		_, err := cli.Verify(ctx, "invalid")
+		require.Error(t, err)
+		require.Equal(t, 2, fake.calls[cacheVerify])
+	})
+
+	t.Run("transient error not cached", func(t *testing.T) {
+		fake, cli := newClient()
+		fake.err = context.DeadlineExceeded
+		_, err := cli.Verify(ctx, "token")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		fake.err = nil
+		_, err = cli.Verify(ctx, "token")
+		require.NoError(t, err)
+		require.Equal(t, 2, fake.calls[cacheVerify])
+	})
+
+	t.Run("miner exist", func(t *testing.T) {
+		fake, cli := newClient()
+		miner, err := address.NewIDAddress(1000)
+		require.NoError(t, err)
+		for i := 0; i < 2; i++ {
+			exist, err := cli.MinerExistInUser(ctx, "user", miner)
+			require.NoError(t, err)
+			require.True(t, exist)
+			exist, err = cli.MinerExistInUser(ctx, "other", miner)
+			require.NoError(t, err)
+			require.False(t, exist)
+		}
+		require.Equal(t, 2, fake.calls[cacheMinerExistInUser])
+		require.Equal(t, CacheStats{Hits: 2, Misses: 2}, cli.Stats()[cacheMinerExistInUser])
+	})
+}
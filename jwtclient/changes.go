@@ -0,0 +1,125 @@
+package jwtclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
+)
+
+// ChangeStreamer opens a stream of change events after `lastEventID`
+type ChangeStreamer interface {
+	SubscribeChanges(ctx context.Context, lastEventID string) (<-chan *auth.ChangeEvent, error)
+}
+
+var _ ChangeStreamer = (*AuthClient)(nil)
+
+// SubscribeChanges opens the server-sent events stream of sophon-auth, the returned channel is
+// closed when the stream ends, callers should resume with the id of the last received event.
+func (lc *AuthClient) SubscribeChanges(ctx context.Context, lastEventID string) (<-chan *auth.ChangeEvent, error) {
+	req := lc.cli.R().SetContext(ctx).
+		SetDoNotParseResponse(true).
+		SetHeader("Accept", "text/event-stream")
+	if len(lastEventID) > 0 {
+		req.SetHeader(auth.LastEventIDHeader, lastEventID)
+	}
+	resp, err := req.Get(auth.ChangesPath)
+	if err != nil {
+		return nil, err
+	}
+	body := resp.RawBody()
+	if resp.StatusCode() != http.StatusOK {
+		defer body.Close() //nolint:errcheck
+		errMsg := &errcode.ErrMsg{}
+		if err := json.NewDecoder(body).Decode(errMsg); err != nil {
+			return nil, fmt.Errorf("response code is : %d", resp.StatusCode())
+		}
+		return nil, errMsg.Err()
+	}
+
+	ch := make(chan *auth.ChangeEvent)
+	go func() {
+		defer close(ch)
+		defer body.Close() //nolint:errcheck
+		err := readChangeEvents(body, func(ev *auth.ChangeEvent) bool {
+			select {
+			case ch <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Warnf("read change events: %v", err)
+		}
+	}()
+	return ch, nil
+}
+
+// readChangeEvents parses the `data` fields of server-sent events, until `r` ends or `fn` returns false
+func readChangeEvents(r io.Reader, fn func(*auth.ChangeEvent) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), 1<<20)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case len(line) == 0:
+			// a blank line dispatches the event
+			if data.Len() == 0 {
+				continue
+			}
+			ev := &auth.ChangeEvent{}
+			if err := json.Unmarshal([]byte(data.String()), ev); err != nil {
+				return fmt.Errorf("decode change event: %w", err)
+			}
+			data.Reset()
+			if !fn(ev) {
+				return nil
+			}
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	return scanner.Err()
+}
+
+// DefaultChangeRetryInterval is how long to wait before reconnecting to the change stream
+const DefaultChangeRetryInterval = 5 * time.Second
+
+// RunChangeSubscriber calls `handler` with every change event until ctx is done. It reconnects
+// after `retry` when the stream breaks, and resumes from the last received event, the first event
+// is `auth.ChangeReset` if sophon-auth can't replay the missed events.
+func RunChangeSubscriber(ctx context.Context, streamer ChangeStreamer, handler func(*auth.ChangeEvent), retry time.Duration) {
+	if retry <= 0 {
+		retry = DefaultChangeRetryInterval
+	}
+	var lastEventID string
+	for {
+		ch, err := streamer.SubscribeChanges(ctx, lastEventID)
+		if err != nil {
+			log.Warnf("subscribe changes: %v", err)
+		} else {
+			for ev := range ch {
+				handler(ev)
+				lastEventID = ev.ID()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
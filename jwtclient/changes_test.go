@@ -0,0 +1,56 @@
+package jwtclient
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/core"
+)
+
+func TestCachedAuthClientInvalidation(t *testing.T) {
+	cnf := config.DefaultConfig()
+	app, err := auth.NewOAuthApp(t.TempDir(), cnf.DB)
+	require.NoError(t, err)
+	adminToken, err := app.GetDefaultAdminToken("")
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(auth.InitRouter(app))
+	defer srv.Close()
+
+	client, err := NewAuthClient(srv.URL, adminToken)
+	require.NoError(t, err)
+	cached := NewCachedAuthClient(client, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan *auth.ChangeEvent, 10)
+	go RunChangeSubscriber(ctx, client, func(ev *auth.ChangeEvent) {
+		cached.Invalidate(ev)
+		events <- ev
+	}, time.Second)
+	ev := <-events
+	require.Equal(t, auth.ChangeReset, ev.Type)
+
+	_, err = client.CreateUser(ctx, &auth.CreateUserRequest{Name: "user"})
+	require.NoError(t, err)
+	token, err := client.GenerateToken(ctx, "user", core.PermRead, "")
+	require.NoError(t, err)
+	_, err = cached.Verify(ctx, token)
+	require.NoError(t, err)
+	_, err = cached.Verify(ctx, token)
+	require.NoError(t, err)
+	require.Equal(t, CacheStats{Hits: 1, Misses: 1}, cached.Stats()[cacheVerify])
+
+	require.NoError(t, client.RemoveToken(ctx, token))
+	ev = <-events
+	require.Equal(t, auth.ChangeTokenRemoved, ev.Type)
+	_, err = cached.Verify(ctx, token)
+	require.Error(t, err)
+	require.Equal(t, CacheStats{Hits: 1, Misses: 2}, cached.Stats()[cacheVerify])
+}
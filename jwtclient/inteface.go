@@ -2,7 +2,9 @@ package jwtclient
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/ipfs-force-community/sophon-auth/auth"
 	"github.com/ipfs-force-community/sophon-auth/core"
 )
 
@@ -10,11 +12,21 @@ type IJwtAuthClient interface {
 	Verify(ctx context.Context, token string) (core.Permission, error)
 }
 
+// IJwtPayloadVerifier is implemented by the `IJwtAuthClient`s able to return what the token is granted,
+// eg. `Perm` and `Scopes` of a token bound to a role are the role's. `AuthMux` builds the context of
+// request from the payload returned if its clients implement it.
+type IJwtPayloadVerifier interface {
+	VerifyPayload(ctx context.Context, token string) (*auth.VerifyResponse, error)
+}
+
 type jwtAuthClient struct {
 	IAuthClient
 }
 
-var _ IJwtAuthClient = &jwtAuthClient{}
+var (
+	_ IJwtAuthClient      = &jwtAuthClient{}
+	_ IJwtPayloadVerifier = &jwtAuthClient{}
+)
 
 func (c *jwtAuthClient) Verify(ctx context.Context, token string) (core.Permission, error) {
 	res, err := c.IAuthClient.Verify(ctx, token)
@@ -25,6 +37,19 @@ func (c *jwtAuthClient) Verify(ctx context.Context, token string) (core.Permissi
 	return res.Perm, nil
 }
 
+func (c *jwtAuthClient) VerifyPayload(ctx context.Context, token string) (*auth.VerifyResponse, error) {
+	return c.IAuthClient.Verify(ctx, token)
+}
+
+// checkOfflinePayload rejects tokens bound to a role when they are verified offline,
+// roles are only resolved by sophon-auth
+func checkOfflinePayload(p *auth.JWTPayload) error {
+	if len(p.Role) != 0 {
+		return fmt.Errorf("token of role %s can't be verified offline", p.Role)
+	}
+	return nil
+}
+
 func WarpIJwtAuthClient(cli IAuthClient) IJwtAuthClient {
 	return &jwtAuthClient{IAuthClient: cli}
 }
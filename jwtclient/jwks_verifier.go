@@ -0,0 +1,156 @@
+package jwtclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	jwt3 "github.com/gbrlsnchs/jwt/v3"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/core"
+)
+
+const (
+	// DefaultJWKSRefreshInterval is how long the fetched public keys are cached by default
+	DefaultJWKSRefreshInterval = 10 * time.Minute
+	// minJWKSRefreshInterval limits how often public keys are re-fetched for an unknown `kid`
+	minJWKSRefreshInterval = 10 * time.Second
+)
+
+type JWKSFetcher interface {
+	JWKS(ctx context.Context) (*auth.JWKSet, error)
+}
+
+var _ JWKSFetcher = (*AuthClient)(nil)
+
+// JWKSVerifier verifies tokens signed by the server-held keys of sophon-auth without a round-trip,
+// public keys are fetched from `/.well-known/jwks.json` and cached for `refreshInterval`.
+// Notice that removed tokens are still accepted by JWKSVerifier until they are expired,
+// and tokens signed with HS256 are always rejected, so use it as the `local` client of `AuthMux`
+// with a remote one as fallback.
+type JWKSVerifier struct {
+	fetcher         JWKSFetcher
+	refreshInterval time.Duration
+
+	fetchLk sync.Mutex
+
+	lk        sync.RWMutex
+	keys      map[string]jwt3.Algorithm
+	lastFetch time.Time
+}
+
+var (
+	_ IJwtAuthClient      = (*JWKSVerifier)(nil)
+	_ IJwtPayloadVerifier = (*JWKSVerifier)(nil)
+)
+
+func NewJWKSVerifier(fetcher JWKSFetcher, refreshInterval time.Duration) *JWKSVerifier {
+	if refreshInterval <= 0 {
+		refreshInterval = DefaultJWKSRefreshInterval
+	}
+	return &JWKSVerifier{
+		fetcher:         fetcher,
+		refreshInterval: refreshInterval,
+		keys:            make(map[string]jwt3.Algorithm),
+	}
+}
+
+func (v *JWKSVerifier) Verify(ctx context.Context, token string) (core.Permission, error) {
+	payload, err := v.VerifyPayload(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	return payload.Perm, nil
+}
+
+// VerifyPayload checks signature and time claims of token, returns its payload.
+// Tokens bound to a role are rejected, as the role can't be resolved offline.
+func (v *JWKSVerifier) VerifyPayload(ctx context.Context, token string) (*auth.JWTPayload, error) {
+	header, err := auth.JwtHeaderFromToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if len(header.KeyID) == 0 {
+		return nil, fmt.Errorf("token without kid can't be verified offline")
+	}
+	alg, err := v.key(ctx, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload auth.JWTPayload
+	if _, err := jwt3.Verify([]byte(token), alg, &payload, jwt3.ValidateHeader); err != nil {
+		return nil, err
+	}
+	if err := payload.Valid(time.Now()); err != nil {
+		return nil, err
+	}
+	if err := checkOfflinePayload(&payload); err != nil {
+		return nil, err
+	}
+	return &payload, nil
+}
+
+func (v *JWKSVerifier) key(ctx context.Context, kid string) (jwt3.Algorithm, error) {
+	v.lk.RLock()
+	alg, ok := v.keys[kid]
+	sinceFetch := time.Since(v.lastFetch)
+	v.lk.RUnlock()
+
+	if ok && sinceFetch < v.refreshInterval {
+		return alg, nil
+	}
+	if !ok && sinceFetch < minJWKSRefreshInterval {
+		return nil, fmt.Errorf("signing key %s not found", kid)
+	}
+
+	if err := v.refresh(ctx); err != nil {
+		if ok {
+			log.Warnf("refresh jwks failed, use the cached key %s: %s", kid, err)
+			return alg, nil
+		}
+		return nil, fmt.Errorf("refresh jwks: %w", err)
+	}
+
+	v.lk.RLock()
+	defer v.lk.RUnlock()
+	if alg, ok = v.keys[kid]; !ok {
+		return nil, fmt.Errorf("signing key %s not found", kid)
+	}
+	return alg, nil
+}
+
+// refresh re-fetches public keys, concurrent calls are merged into one request
+func (v *JWKSVerifier) refresh(ctx context.Context) error {
+	v.fetchLk.Lock()
+	defer v.fetchLk.Unlock()
+
+	v.lk.RLock()
+	fetched := time.Since(v.lastFetch) < minJWKSRefreshInterval
+	v.lk.RUnlock()
+	if fetched {
+		return nil
+	}
+
+	set, err := v.fetcher.JWKS(ctx)
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]jwt3.Algorithm, len(set.Keys))
+	for _, jwk := range set.Keys {
+		alg, err := jwk.Verifier()
+		if err != nil {
+			log.Warnf("ignore invalid jwk %s: %s", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = alg
+	}
+
+	v.lk.Lock()
+	defer v.lk.Unlock()
+	v.keys = keys
+	v.lastFetch = time.Now()
+	return nil
+}
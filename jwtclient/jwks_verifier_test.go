@@ -0,0 +1,63 @@
+package jwtclient
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/core"
+)
+
+type countFetcher struct {
+	JWKSFetcher
+	count int64
+}
+
+func (f *countFetcher) JWKS(ctx context.Context) (*auth.JWKSet, error) {
+	atomic.AddInt64(&f.count, 1)
+	return f.JWKSFetcher.JWKS(ctx)
+}
+
+func TestJWKSVerifier(t *testing.T) {
+	cnf := config.DefaultConfig()
+	app, err := auth.NewOAuthApp(t.TempDir(), cnf.DB,
+		auth.WithSigningConfig(&config.SigningConfig{Alg: config.SigningAlgEd25519}))
+	require.NoError(t, err)
+	token, err := app.GetDefaultAdminToken("")
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(auth.InitRouter(app))
+	defer srv.Close()
+
+	client, err := NewAuthClient(srv.URL, token)
+	require.NoError(t, err)
+	fetcher := &countFetcher{JWKSFetcher: client}
+	verifier := NewJWKSVerifier(fetcher, 0)
+
+	ctx := context.Background()
+	perm, err := verifier.Verify(ctx, token)
+	require.NoError(t, err)
+	require.Equal(t, core.PermAdmin, perm)
+
+	// public keys are cached
+	payload, err := verifier.VerifyPayload(ctx, token)
+	require.NoError(t, err)
+	require.Equal(t, auth.DefaultAdminTokenName, payload.Name)
+	require.Equal(t, int64(1), atomic.LoadInt64(&fetcher.count))
+
+	// tokens signed with HS256 can't be verified offline
+	_, hsToken, err := NewLocalAuthClient()
+	require.NoError(t, err)
+	_, err = verifier.Verify(ctx, string(hsToken))
+	require.Error(t, err)
+
+	// unknown kid doesn't trigger fetching too frequently
+	_, err = verifier.key(ctx, "unknown-kid")
+	require.Error(t, err)
+	require.Equal(t, int64(1), atomic.LoadInt64(&fetcher.count))
+}
@@ -3,8 +3,13 @@ package jwtclient
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/ipfs-force-community/metrics/ratelimit"
+
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/storage"
+	"github.com/ipfs-force-community/sophon-auth/util"
 )
 
 type limitFinder struct {
@@ -19,21 +24,93 @@ func WarpLimitFinder(client IAuthClient) ratelimit.ILimitFinder {
 	return &limitFinder{IAuthClient: client}
 }
 
-func (l *limitFinder) GetUserLimit(name, service, api string) (*ratelimit.Limit, error) {
+// GetUserLimit finds the limit of account, which could be made by `core.TokenAccount` so that
+// the limits of the token are resolved before the ones of the user, see `WarpValueFromCtx`
+func (l *limitFinder) GetUserLimit(account, service, api string) (*ratelimit.Limit, error) {
 	if l.IAuthClient == nil {
 		return nil, errNilJwtClient
 	}
 
+	name, fingerprint := splitTokenAccount(account)
 	res, err := l.GetUserRateLimit(context.Background(), name, "")
 	if err != nil {
 		return nil, err
 	}
 
 	limit := &ratelimit.Limit{Account: name, Cap: 0, Duration: 0}
-	if l := res.MatchedLimit(service, api); l != nil {
+	if l := res.MatchedLimit(fingerprint, service, api); l != nil {
+		if len(l.Token) != 0 {
+			limit.Account = account
+		}
 		limit.Cap = l.ReqLimit.Cap
 		limit.Duration = l.ReqLimit.ResetDur
 	}
 
 	return limit, nil
 }
+
+const (
+	tokenLimitsCacheSize = 10000
+	// tokenLimitsTTL is the interval `ratelimit.RateLimiter` refreshes the limits of users
+	tokenLimitsTTL = time.Minute
+)
+
+type limitValueFromCtx struct {
+	core.ValueFromCtx
+	IAuthClient
+	// tokenLimits caches the fingerprints of the tokens with limits of their own by user
+	tokenLimits *util.LRU[string, map[string]struct{}]
+}
+
+var _ ratelimit.IValueFromCtx = (*limitValueFromCtx)(nil)
+
+// WarpValueFromCtx returns the value finder for local rate limiters, which count budgets by the account
+// of request. The account is made by `core.TokenAccount` only if the token placed in ctx by `AuthMux`
+// has limits of its own, otherwise it's the name of user, so that all tokens of the user share
+// the budgets of the limits of the user. The limits of users are resolved once a minute, the same as
+// the limiter refreshes them.
+func WarpValueFromCtx(client IAuthClient) ratelimit.IValueFromCtx {
+	return &limitValueFromCtx{
+		IAuthClient: client,
+		tokenLimits: util.NewLRU[string, map[string]struct{}](tokenLimitsCacheSize),
+	}
+}
+
+func (v *limitValueFromCtx) AccFromCtx(ctx context.Context) (string, bool) {
+	name, ok := core.CtxGetName(ctx)
+	if !ok {
+		return "", false
+	}
+	fingerprint, _ := core.CtxGetTokenFingerprint(ctx)
+	if len(fingerprint) == 0 || v.IAuthClient == nil {
+		return name, true
+	}
+	tokens, ok := v.tokenLimits.Get(name)
+	if !ok {
+		res, err := v.GetUserRateLimit(ctx, name, "")
+		if err != nil {
+			return name, true
+		}
+		tokens = make(map[string]struct{})
+		for _, l := range res {
+			if len(l.Token) != 0 {
+				tokens[l.Token] = struct{}{}
+			}
+		}
+		v.tokenLimits.Add(name, tokens, tokenLimitsTTL)
+	}
+	if _, ok := tokens[fingerprint]; ok {
+		return core.TokenAccount(name, fingerprint), true
+	}
+	return name, true
+}
+
+// splitTokenAccount returns the name and the token fingerprint of account, account is a name only
+// if it doesn't end with a fingerprint
+func splitTokenAccount(account string) (string, string) {
+	name, fingerprint := core.SplitTokenAccount(account)
+	if !storage.IsTokenFingerprint(fingerprint) {
+		return account, ""
+	}
+	return name, fingerprint
+}
@@ -2,6 +2,7 @@ package jwtclient
 
 import (
 	"context"
+	"time"
 
 	jwt3 "github.com/gbrlsnchs/jwt/v3"
 	"github.com/ipfs-force-community/sophon-auth/auth"
@@ -22,9 +23,13 @@ func NewLocalAuthClient() (*LocalAuthClient, []byte, error) {
 	return NewLocalAuthClientWithSecret(secret)
 }
 
+var (
+	_ IJwtAuthClient      = (*LocalAuthClient)(nil)
+	_ IJwtPayloadVerifier = (*LocalAuthClient)(nil)
+)
+
 func (c *LocalAuthClient) Verify(ctx context.Context, token string) (core.Permission, error) {
-	var payload auth.JWTPayload
-	_, err := jwt3.Verify([]byte(token), c.alg, &payload)
+	payload, err := c.VerifyPayload(ctx, token)
 	if err != nil {
 		return "", err
 	}
@@ -32,6 +37,24 @@ func (c *LocalAuthClient) Verify(ctx context.Context, token string) (core.Permis
 	return payload.Perm, nil
 }
 
+// VerifyPayload checks signature and time claims of token, returns its payload.
+// Tokens bound to a role are rejected, as the role can't be resolved offline.
+func (c *LocalAuthClient) VerifyPayload(ctx context.Context, token string) (*auth.VerifyResponse, error) {
+	var payload auth.JWTPayload
+	_, err := jwt3.Verify([]byte(token), c.alg, &payload)
+	if err != nil {
+		return nil, err
+	}
+	if err := payload.Valid(time.Now()); err != nil {
+		return nil, err
+	}
+	if err := checkOfflinePayload(&payload); err != nil {
+		return nil, err
+	}
+
+	return &payload, nil
+}
+
 func NewLocalAuthClientWithSecret(secret []byte) (*LocalAuthClient, []byte, error) {
 	payload := auth.JWTPayload{
 		Perm: core.PermAdmin,
@@ -3,7 +3,11 @@ package jwtclient
 import (
 	"context"
 	"testing"
+	"time"
 
+	jwt3 "github.com/gbrlsnchs/jwt/v3"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
 	"github.com/ipfs-force-community/sophon-auth/config"
 	"github.com/ipfs-force-community/sophon-auth/core"
 	"github.com/stretchr/testify/assert"
@@ -27,6 +31,33 @@ func TestLocalAuthClient(t *testing.T) {
 	testClientWithAdminPerm(t, client, string(token2))
 }
 
+func TestLocalAuthClientTimeClaims(t *testing.T) {
+	secret, err := config.RandSecret()
+	assert.NoError(t, err)
+
+	client, _, err := NewLocalAuthClientWithSecret(secret)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	expired, err := jwt3.Sign(auth.JWTPayload{
+		Name:           auth.DefaultAdminTokenName,
+		Perm:           core.PermAdmin,
+		ExpirationTime: jwt3.NumericDate(now.Add(-time.Minute)),
+	}, jwt3.NewHS256(secret))
+	assert.NoError(t, err)
+	_, err = client.Verify(context.Background(), string(expired))
+	assert.ErrorIs(t, err, auth.ErrorTokenExpired)
+
+	notYet, err := jwt3.Sign(auth.JWTPayload{
+		Name:      auth.DefaultAdminTokenName,
+		Perm:      core.PermAdmin,
+		NotBefore: jwt3.NumericDate(now.Add(time.Minute)),
+	}, jwt3.NewHS256(secret))
+	assert.NoError(t, err)
+	_, err = client.Verify(context.Background(), string(notYet))
+	assert.ErrorIs(t, err, auth.ErrorTokenNotValidYet)
+}
+
 func testClientWithAdminPerm(t *testing.T, client *LocalAuthClient, token string) {
 	ctx := context.Background()
 	permission, err := client.Verify(ctx, token)
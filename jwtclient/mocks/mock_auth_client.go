@@ -9,9 +9,9 @@ import (
 	reflect "reflect"
 
 	address "github.com/filecoin-project/go-address"
+	gomock "github.com/golang/mock/gomock"
 	auth "github.com/ipfs-force-community/sophon-auth/auth"
 	core "github.com/ipfs-force-community/sophon-auth/core"
-	gomock "github.com/golang/mock/gomock"
 )
 
 // MockIAuthClient is a mock of IAuthClient interface.
@@ -37,6 +37,50 @@ func (m *MockIAuthClient) EXPECT() *MockIAuthClientMockRecorder {
 	return m.recorder
 }
 
+// CreateRole mocks base method.
+func (m *MockIAuthClient) CreateRole(arg0 context.Context, arg1 *auth.CreateRoleRequest) (*auth.RoleInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateRole", arg0, arg1)
+	ret0, _ := ret[0].(*auth.RoleInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateRole indicates an expected call of CreateRole.
+func (mr *MockIAuthClientMockRecorder) CreateRole(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateRole", reflect.TypeOf((*MockIAuthClient)(nil).CreateRole), arg0, arg1)
+}
+
+// DeleteRole mocks base method.
+func (m *MockIAuthClient) DeleteRole(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteRole", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteRole indicates an expected call of DeleteRole.
+func (mr *MockIAuthClientMockRecorder) DeleteRole(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteRole", reflect.TypeOf((*MockIAuthClient)(nil).DeleteRole), arg0, arg1)
+}
+
+// GetRole mocks base method.
+func (m *MockIAuthClient) GetRole(arg0 context.Context, arg1 string) (*auth.RoleInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRole", arg0, arg1)
+	ret0, _ := ret[0].(*auth.RoleInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRole indicates an expected call of GetRole.
+func (mr *MockIAuthClientMockRecorder) GetRole(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRole", reflect.TypeOf((*MockIAuthClient)(nil).GetRole), arg0, arg1)
+}
+
 // GetUser mocks base method.
 func (m *MockIAuthClient) GetUser(arg0 context.Context, arg1 string) (*auth.OutputUser, error) {
 	m.ctrl.T.Helper()
@@ -157,6 +201,21 @@ func (mr *MockIAuthClientMockRecorder) ListMiners(arg0, arg1 interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMiners", reflect.TypeOf((*MockIAuthClient)(nil).ListMiners), arg0, arg1)
 }
 
+// ListRoles mocks base method.
+func (m *MockIAuthClient) ListRoles(arg0 context.Context) ([]*auth.RoleInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListRoles", arg0)
+	ret0, _ := ret[0].([]*auth.RoleInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListRoles indicates an expected call of ListRoles.
+func (mr *MockIAuthClientMockRecorder) ListRoles(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListRoles", reflect.TypeOf((*MockIAuthClient)(nil).ListRoles), arg0)
+}
+
 // ListSigners mocks base method.
 func (m *MockIAuthClient) ListSigners(arg0 context.Context, arg1 string) (auth.ListSignerResp, error) {
 	m.ctrl.T.Helper()
@@ -260,6 +319,20 @@ func (mr *MockIAuthClientMockRecorder) UnregisterSigners(arg0, arg1, arg2 interf
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnregisterSigners", reflect.TypeOf((*MockIAuthClient)(nil).UnregisterSigners), arg0, arg1, arg2)
 }
 
+// UpdateRole mocks base method.
+func (m *MockIAuthClient) UpdateRole(arg0 context.Context, arg1 *auth.UpdateRoleRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateRole", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateRole indicates an expected call of UpdateRole.
+func (mr *MockIAuthClientMockRecorder) UpdateRole(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateRole", reflect.TypeOf((*MockIAuthClient)(nil).UpdateRole), arg0, arg1)
+}
+
 // UpsertMiner mocks base method.
 func (m *MockIAuthClient) UpsertMiner(arg0 context.Context, arg1, arg2 string, arg3 bool) (bool, error) {
 	m.ctrl.T.Helper()
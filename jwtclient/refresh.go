@@ -0,0 +1,141 @@
+package jwtclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+
+	"github.com/ipfs-force-community/sophon-auth/auth"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/errcode"
+)
+
+const (
+	// DefaultRefreshRetryInterval is how long to wait before retrying a failed refresh
+	DefaultRefreshRetryInterval = 10 * time.Second
+	// minRefreshInterval avoids refreshing in a busy loop when the access token is very short-lived
+	minRefreshInterval = time.Second
+)
+
+// GenerateTokenPair generates an access token expiring after `ttl` and a refresh token to renew it,
+// the refresh token and its successors expire after `refreshTTL`, never if it's zero.
+func (lc *AuthClient) GenerateTokenPair(ctx context.Context, name, perm, extra string, ttl, refreshTTL time.Duration, opts ...GenTokenOption) (*auth.GenTokenResponse, error) {
+	req := auth.GenTokenRequest{
+		Name:       name,
+		Perm:       perm,
+		Extra:      extra,
+		TTL:        ttl,
+		Refresh:    true,
+		RefreshTTL: refreshTTL,
+	}
+	for _, opt := range opts {
+		opt(&req)
+	}
+	resp, err := lc.cli.R().SetContext(ctx).SetBody(req).SetResult(&auth.GenTokenResponse{}).SetError(&errcode.ErrMsg{}).Post("/genToken")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.GenTokenResponse), nil
+	}
+	return nil, resp.Error().(*errcode.ErrMsg).Err()
+}
+
+// RefreshToken exchanges refreshToken for a new access token and a new refresh token, refreshToken can't be used again.
+func (lc *AuthClient) RefreshToken(ctx context.Context, refreshToken string) (*auth.GenTokenResponse, error) {
+	resp, err := lc.cli.R().SetContext(ctx).
+		SetBody(&auth.RefreshTokenRequest{RefreshToken: refreshToken}).
+		SetResult(&auth.GenTokenResponse{}).
+		SetError(&errcode.ErrMsg{}).
+		Post(auth.RefreshTokenPath)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusOK {
+		return resp.Result().(*auth.GenTokenResponse), nil
+	}
+	if err := verifyErrorOf(resp); err != nil {
+		return nil, err
+	}
+	if errMsg, ok := resp.Error().(*errcode.ErrMsg); ok && len(errMsg.Error) != 0 {
+		return nil, errMsg.Err()
+	}
+	return nil, fmt.Errorf("response code is : %d, msg:%s", resp.StatusCode(), resp.Body())
+}
+
+// NewAuthClientWithRefreshToken creates a client which authorizes requests with access tokens issued by refreshToken,
+// and renews the access token in background before it expires until ctx is done.
+//
+// Refresh tokens are rotated on use, `onRefresh` is called with every new pair, callers should persist
+// `RefreshToken` of it to restart with, the previous one is rejected and revokes all its successors if used again.
+func NewAuthClientWithRefreshToken(ctx context.Context, url, refreshToken string, onRefresh func(*auth.GenTokenResponse)) (*AuthClient, error) {
+	if len(refreshToken) == 0 {
+		return nil, fmt.Errorf("refresh token is empty")
+	}
+	lc := &AuthClient{}
+	lc.cli = resty.New().
+		SetHostURL(url).
+		SetHeader("Accept", "application/json").
+		OnBeforeRequest(func(_ *resty.Client, req *resty.Request) error {
+			if token, ok := lc.accessToken.Load().(string); ok {
+				req.SetHeader(core.AuthorizationHeader, "Bearer "+token)
+			}
+			return nil
+		})
+
+	res, err := lc.RefreshToken(ctx, refreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("refresh token: %w", err)
+	}
+	lc.accessToken.Store(res.Token)
+	if onRefresh != nil {
+		onRefresh(res)
+	}
+	go lc.refreshLoop(ctx, res, onRefresh)
+	return lc, nil
+}
+
+func (lc *AuthClient) refreshLoop(ctx context.Context, last *auth.GenTokenResponse, onRefresh func(*auth.GenTokenResponse)) {
+	wait := refreshDelay(last.ExpireTime, time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		res, err := lc.RefreshToken(ctx, last.RefreshToken)
+		if err != nil {
+			var verifyErr *VerifyError
+			if errors.As(err, &verifyErr) {
+				log.Errorf("refresh token is rejected, stop refreshing: %v", err)
+				return
+			}
+			log.Warnf("refresh token failed, retry after %s: %v", DefaultRefreshRetryInterval, err)
+			wait = DefaultRefreshRetryInterval
+			continue
+		}
+		lc.accessToken.Store(res.Token)
+		if onRefresh != nil {
+			onRefresh(res)
+		}
+		last = res
+		wait = refreshDelay(last.ExpireTime, time.Now())
+	}
+}
+
+// refreshDelay renews the access token when 80% of its lifetime passed
+func refreshDelay(expireTime *time.Time, now time.Time) time.Duration {
+	if expireTime == nil {
+		return DefaultRefreshRetryInterval
+	}
+	delay := expireTime.Sub(now) * 4 / 5
+	if delay < minRefreshInterval {
+		return minRefreshInterval
+	}
+	return delay
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"io"
+	"strings"
+
+	"github.com/dgraph-io/badger/v3"
+	"golang.org/x/xerrors"
+)
+
+var (
+	ErrBackupNotSupported = xerrors.New("online backup is only supported by badger store")
+	ErrStoreInUse         = xerrors.New("store is in use, stop sophon-auth first")
+)
+
+// Backuper is implemented by stores which could be backed up while they are serving
+type Backuper interface {
+	// Backup writes the records changed since version `since` to w, 0 means a full backup.
+	// It returns the `since` of the next incremental backup.
+	Backup(w io.Writer, since uint64) (uint64, error)
+}
+
+var _ Backuper = (*badgerStore)(nil)
+
+func (s *badgerStore) Backup(w io.Writer, since uint64) (uint64, error) {
+	// version is the latest version written, or 0 if nothing is written. Though badger suggests
+	// `version+1` for the next backup, it only backs up entries of versions greater than `since`.
+	version, err := s.db.Backup(w, since)
+	if err != nil {
+		return 0, err
+	}
+	if version < since {
+		return since, nil
+	}
+	return version, nil
+}
+
+// RestoreBadger loads backups written by `badgerStore.Backup` into the badger db of dataPath,
+// incremental backups must be loaded in order after the full backup they are based on.
+// The db is opened exclusively, so it fails with `ErrStoreInUse` if sophon-auth is running.
+func RestoreBadger(dataPath string, backups ...io.Reader) error {
+	db, err := badger.Open(badger.DefaultOptions(dataPath))
+	if err != nil {
+		if strings.Contains(err.Error(), "Cannot acquire directory lock") {
+			return ErrStoreInUse
+		}
+		return xerrors.Errorf("open db failed :%w", err)
+	}
+	for idx, r := range backups {
+		if err := db.Load(r, 256); err != nil {
+			_ = db.Close()
+			return xerrors.Errorf("load backup %d: %w", idx, err)
+		}
+	}
+	return db.Close()
+}
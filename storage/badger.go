@@ -3,6 +3,7 @@ package storage
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/dgraph-io/badger/v3"
@@ -62,6 +63,7 @@ func (s *badgerStore) Recover(token Token) error {
 	}
 
 	kp.IsDeleted = core.NotDelete
+	kp.DeleteTime = nil
 	return s.putBadgerObj(&kp)
 }
 
@@ -102,6 +104,42 @@ func (s *badgerStore) UpdateToken(kp *KeyPair) error {
 	return s.putBadgerObj(kp)
 }
 
+func (s *badgerStore) TokensByPrefix(prefix Token, limit int64) ([]*KeyPair, error) {
+	var kps []*KeyPair
+	if err := s.walkThroughPrefix(tokenKey(prefix.String()), func(item *badger.Item) (bool, error) {
+		if err := item.Value(func(val []byte) error {
+			kp := new(KeyPair)
+			if err := kp.FromBytes(val); err != nil {
+				return err
+			}
+			kps = append(kps, kp)
+			return nil
+		}); err != nil {
+			return false, err
+		}
+		return limit <= 0 || int64(len(kps)) < limit, nil
+	}); err != nil {
+		return nil, err
+	}
+	return kps, nil
+}
+
+func (s *badgerStore) RenameToken(old Token, kp *KeyPair) error {
+	data, err := kp.Bytes()
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		if _, err := txn.Get(tokenKey(old.String())); err != nil {
+			return err
+		}
+		if err := txn.Delete(tokenKey(old.String())); err != nil {
+			return err
+		}
+		return txn.Set(kp.key(), data)
+	})
+}
+
 func (s *badgerStore) List(skip, limit int64) ([]*KeyPair, error) {
 	var offset int64
 	var kps []*KeyPair
@@ -131,6 +169,46 @@ func (s *badgerStore) List(skip, limit int64) ([]*KeyPair, error) {
 	return kps, nil
 }
 
+func (s *badgerStore) ListStaleTokens(before time.Time, limit int64) ([]*KeyPair, error) {
+	var kps []*KeyPair
+	if err := s.walkThroughPrefix([]byte(PrefixToken), func(item *badger.Item) (bool, error) {
+		if err := item.Value(func(val []byte) error {
+			kp := new(KeyPair)
+			if err := kp.FromBytes(val); err != nil {
+				return err
+			}
+			if kp.isStale(before) {
+				kps = append(kps, kp)
+			}
+			return nil
+		}); err != nil {
+			return false, err
+		}
+		return limit == 0 || int64(len(kps)) < limit, nil
+	}); err != nil {
+		return nil, err
+	}
+	return kps, nil
+}
+
+func (s *badgerStore) PurgeStaleTokens(before time.Time, limit int64) (int64, error) {
+	kps, err := s.ListStaleTokens(before, limit)
+	if err != nil {
+		return 0, err
+	}
+	if len(kps) == 0 {
+		return 0, nil
+	}
+	return int64(len(kps)), s.db.Update(func(txn *badger.Txn) error {
+		for _, kp := range kps {
+			if err := txn.Delete(kp.key()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (s *badgerStore) GetUser(name string) (*User, error) {
 	user := new(User)
 	return user, s.getUsableObj(userKey(name), user)
@@ -288,6 +366,274 @@ func (s *badgerStore) RecoverUser(name string) error {
 	return s.putBadgerObj(&user)
 }
 
+func (s *badgerStore) PutSigningKey(key *SigningKey) error {
+	return s.putBadgerObj(key)
+}
+
+func (s *badgerStore) GetSigningKey(kid string) (*SigningKey, error) {
+	var key SigningKey
+	return &key, s.getObj(signingKeyKey(kid), &key)
+}
+
+func (s *badgerStore) ListSigningKeys() ([]*SigningKey, error) {
+	var keys []*SigningKey
+	if err := s.walkThroughPrefix([]byte(PrefixSignKey), func(item *badger.Item) (bool, error) {
+		if err := item.Value(func(val []byte) error {
+			key := new(SigningKey)
+			if err := key.FromBytes(val); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+			return nil
+		}); err != nil {
+			return false, err
+		}
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *badgerStore) PutRole(role *Role) error {
+	return s.putBadgerObj(role)
+}
+
+func (s *badgerStore) GetRole(name string) (*Role, error) {
+	var role Role
+	if err := s.getObj(roleKey(name), &role); err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (s *badgerStore) ListRoles() ([]*Role, error) {
+	var roles []*Role
+	if err := s.walkThroughPrefix([]byte(PrefixRole), func(item *badger.Item) (bool, error) {
+		if err := item.Value(func(val []byte) error {
+			role := new(Role)
+			if err := role.FromBytes(val); err != nil {
+				return err
+			}
+			roles = append(roles, role)
+			return nil
+		}); err != nil {
+			return false, err
+		}
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (s *badgerStore) DelRole(name string) error {
+	if err := s.delObj(roleKey(name)); err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrRoleNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *badgerStore) PutRateLimitTier(tier *RateLimitTier) error {
+	return s.putBadgerObj(tier)
+}
+
+func (s *badgerStore) GetRateLimitTier(name string) (*RateLimitTier, error) {
+	var tier RateLimitTier
+	if err := s.getObj(rateLimitTierKey(name), &tier); err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, ErrRateLimitTierNotFound
+		}
+		return nil, err
+	}
+	return &tier, nil
+}
+
+func (s *badgerStore) ListRateLimitTiers() ([]*RateLimitTier, error) {
+	var tiers []*RateLimitTier
+	return tiers, s.walkThroughPrefix([]byte(PrefixTier), func(item *badger.Item) (bool, error) {
+		tier := new(RateLimitTier)
+		if err := item.Value(tier.FromBytes); err != nil {
+			return false, err
+		}
+		tiers = append(tiers, tier)
+		return true, nil
+	})
+}
+
+func (s *badgerStore) DelRateLimitTier(name string) error {
+	if err := s.delObj(rateLimitTierKey(name)); err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrRateLimitTierNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *badgerStore) PutRefreshToken(rt *RefreshToken) error {
+	return s.putBadgerObj(rt)
+}
+
+func (s *badgerStore) GetRefreshToken(token string) (*RefreshToken, error) {
+	var rt RefreshToken
+	if err := s.getObj(refreshTokenKey(token), &rt); err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, ErrRefreshTokenNotFound
+		}
+		return nil, err
+	}
+	return &rt, nil
+}
+
+func (s *badgerStore) UseRefreshToken(token string, usedAt time.Time) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(refreshTokenKey(token))
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return ErrRefreshTokenNotFound
+			}
+			return err
+		}
+		var rt RefreshToken
+		if err := item.Value(rt.FromBytes); err != nil {
+			return err
+		}
+		if rt.UsedTime != nil {
+			return ErrRefreshTokenUsed
+		}
+		rt.UsedTime = &usedAt
+		val, err := rt.Bytes()
+		if err != nil {
+			return err
+		}
+		return txn.Set(rt.key(), val)
+	})
+}
+
+func (s *badgerStore) RenameRefreshToken(old, token string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(refreshTokenKey(old))
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return ErrRefreshTokenNotFound
+			}
+			return err
+		}
+		var rt RefreshToken
+		if err := item.Value(rt.FromBytes); err != nil {
+			return err
+		}
+		rt.Token = token
+		val, err := rt.Bytes()
+		if err != nil {
+			return err
+		}
+		if err := txn.Delete(refreshTokenKey(old)); err != nil {
+			return err
+		}
+		return txn.Set(rt.key(), val)
+	})
+}
+
+func (s *badgerStore) RevokeRefreshTokens(family string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		var revoked []*RefreshToken
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		prefix := []byte(PrefixRefresh)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			rt := new(RefreshToken)
+			if err := it.Item().Value(rt.FromBytes); err != nil {
+				it.Close()
+				return err
+			}
+			if rt.Family == family && !rt.Revoked {
+				rt.Revoked = true
+				revoked = append(revoked, rt)
+			}
+		}
+		it.Close()
+
+		for _, rt := range revoked {
+			val, err := rt.Bytes()
+			if err != nil {
+				return err
+			}
+			if err := txn.Set(rt.key(), val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *badgerStore) PutAuditLog(entry *AuditLog) error {
+	return s.putBadgerObj(entry)
+}
+
+func (s *badgerStore) ListAuditLogs(filter *AuditLogFilter) ([]*AuditLog, error) {
+	var logs []*AuditLog
+	matched := int64(0)
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte(PrefixAudit)
+		start := prefix
+		if !filter.Start.IsZero() {
+			start = auditLogKey(filter.Start, "")
+		}
+		for it.Seek(start); it.ValidForPrefix(prefix); it.Next() {
+			entry := new(AuditLog)
+			if err := it.Item().Value(entry.FromBytes); err != nil {
+				return err
+			}
+			if !filter.End.IsZero() && !entry.Time.Before(filter.End) {
+				break
+			}
+			if !filter.match(entry) {
+				continue
+			}
+			matched++
+			if matched <= filter.Skip {
+				continue
+			}
+			logs = append(logs, entry)
+			if filter.Limit > 0 && int64(len(logs)) >= filter.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return logs, err
+}
+
+func (s *badgerStore) LastAuditLog() (*AuditLog, error) {
+	entry := new(AuditLog)
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte(PrefixAudit)
+		// seek to the end of prefix for reverse iteration
+		it.Seek(append([]byte(PrefixAudit), 0xff))
+		if !it.ValidForPrefix(prefix) {
+			return ErrAuditLogNotFound
+		}
+		return it.Item().Value(entry.FromBytes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
 func (s *badgerStore) GetRateLimits(name, id string) ([]*UserRateLimit, error) {
 	mRateLimits, err := s.listRateLimits(name, id)
 	if err != nil {
@@ -344,6 +690,137 @@ func (s *badgerStore) DelRateLimit(name, id string) error {
 	return s.updateUserRateLimit(name, mRateLimit)
 }
 
+func (s *badgerStore) ListRateLimitBuckets() ([]*RateLimitBucket, error) {
+	var buckets []*RateLimitBucket
+	return buckets, s.walkThroughPrefix([]byte(PrefixBucket), func(item *badger.Item) (bool, error) {
+		bucket := new(RateLimitBucket)
+		if err := item.Value(bucket.FromBytes); err != nil {
+			return false, err
+		}
+		buckets = append(buckets, bucket)
+		return true, nil
+	})
+}
+
+func (s *badgerStore) PutRateLimitBuckets(buckets []*RateLimitBucket) error {
+	wb := s.db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, bucket := range buckets {
+		val, err := bucket.Bytes()
+		if err != nil {
+			return err
+		}
+		if err := wb.Set(bucket.key(), val); err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
+func (s *badgerStore) PurgeRateLimitBuckets(before time.Time) (int64, error) {
+	buckets, err := s.ListRateLimitBuckets()
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	err = s.db.Update(func(txn *badger.Txn) error {
+		for _, bucket := range buckets {
+			if !bucket.ResetAt.Before(before) {
+				continue
+			}
+			if err := txn.Delete(bucket.key()); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+func (s *badgerStore) AddQuotaUsages(usages []*QuotaUsage) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		for _, u := range usages {
+			stored := *u
+			item, err := txn.Get(u.key())
+			if err == nil {
+				var prev QuotaUsage
+				if err := item.Value(prev.FromBytes); err != nil {
+					return err
+				}
+				stored.Used += prev.Used
+			} else if !errors.Is(err, badger.ErrKeyNotFound) {
+				return err
+			}
+			val, err := stored.Bytes()
+			if err != nil {
+				return err
+			}
+			if err := txn.Set(stored.key(), val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *badgerStore) TakeQuotaUsages(usages []*QuotaUsage, quotas []int64) (*QuotaUsage, error) {
+	for {
+		var exceeded *QuotaUsage
+		err := s.db.Update(func(txn *badger.Txn) error {
+			stored := make([]*QuotaUsage, 0, len(usages))
+			for idx, u := range usages {
+				taken := *u
+				item, err := txn.Get(u.key())
+				if err == nil {
+					var prev QuotaUsage
+					if err := item.Value(prev.FromBytes); err != nil {
+						return err
+					}
+					taken.Used += prev.Used
+				} else if !errors.Is(err, badger.ErrKeyNotFound) {
+					return err
+				}
+				if taken.Used > quotas[idx] {
+					exceeded = u
+					return nil
+				}
+				stored = append(stored, &taken)
+			}
+			for _, u := range stored {
+				val, err := u.Bytes()
+				if err != nil {
+					return err
+				}
+				if err := txn.Set(u.key(), val); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		// concurrent takes from the same quota conflict, try again with the new usage
+		if errors.Is(err, badger.ErrConflict) {
+			continue
+		}
+		return exceeded, err
+	}
+}
+
+func (s *badgerStore) ListQuotaUsages(name string, period QuotaPeriod, window string) ([]*QuotaUsage, error) {
+	var usages []*QuotaUsage
+	return usages, s.walkThroughPrefix(quotaUsagePrefix(name, period, window), func(item *badger.Item) (bool, error) {
+		u := new(QuotaUsage)
+		if err := item.Value(u.FromBytes); err != nil {
+			return false, err
+		}
+		// user names containing ':' share the prefix
+		if u.Name == name {
+			usages = append(usages, u)
+		}
+		return true, nil
+	})
+}
+
 func (s *badgerStore) listRateLimits(user, id string) (map[string]*UserRateLimit, error) {
 	var mRateLimits mapedRatelimit
 	if err := s.getObj(rateLimitKey(user), &mRateLimits); err != nil {
@@ -659,3 +1136,64 @@ func (s *badgerStore) GetUserBySigner(addr address.Address) ([]*User, error) {
 
 	return users, nil
 }
+
+var recordPrefixes = map[RecordKind]Prefix{
+	RecordUser:         PrefixUser,
+	RecordToken:        PrefixToken,
+	RecordMiner:        PrefixMiner,
+	RecordSigner:       PrefixSigner,
+	RecordRateLimit:    PrefixReqLimit,
+	RecordSigningKey:   PrefixSignKey,
+	RecordRole:         PrefixRole,
+	RecordRefreshToken: PrefixRefresh,
+	RecordAuditLog:     PrefixAudit,
+	RecordQuotaUsage:   PrefixQuota,
+	RecordTier:         PrefixTier,
+}
+
+func (s *badgerStore) WalkRecords(kind RecordKind, fn func(record interface{}) error) error {
+	prefix, ok := recordPrefixes[kind]
+	if !ok {
+		return fmt.Errorf("unknown record kind %q", kind)
+	}
+	return s.walkThroughPrefix([]byte(prefix), func(item *badger.Item) (bool, error) {
+		// rate limits of a user are stored together
+		if kind == RecordRateLimit {
+			var limits mapedRatelimit
+			if err := item.Value(limits.FromBytes); err != nil {
+				return false, err
+			}
+			ids := make([]string, 0, len(limits))
+			for id := range limits {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			for _, id := range ids {
+				if err := fn(limits[id]); err != nil {
+					return false, err
+				}
+			}
+			return true, nil
+		}
+
+		record, err := NewRecord(kind)
+		if err != nil {
+			return false, err
+		}
+		if err := item.Value(record.(iStreamableObj).FromBytes); err != nil {
+			return false, err
+		}
+		return true, fn(record)
+	})
+}
+
+func (s *badgerStore) RestoreRecord(kind RecordKind, record interface{}) error {
+	if err := checkRecord(kind, record); err != nil {
+		return err
+	}
+	if limit, ok := record.(*UserRateLimit); ok {
+		_, err := s.PutRateLimit(limit)
+		return err
+	}
+	return s.putBadgerObj(record.(iBadgerObj))
+}
@@ -20,6 +20,13 @@ const (
 	PrefixReqLimit Prefix = "ReqLimit:"
 	PrefixMiner    Prefix = "MINERS:"
 	PrefixSigner   Prefix = "SIGNERS:"
+	PrefixSignKey  Prefix = "SIGNING_KEY:"
+	PrefixRole     Prefix = "ROLE:"
+	PrefixRefresh  Prefix = "REFRESH_TOKEN:"
+	PrefixAudit    Prefix = "AUDIT:"
+	PrefixBucket   Prefix = "RATE_LIMIT_BUCKET:"
+	PrefixQuota    Prefix = "QUOTA_USAGE:"
+	PrefixTier     Prefix = "RATE_LIMIT_TIER:"
 )
 
 var storeVersionKey = []byte("StoreVersion")
@@ -44,6 +51,47 @@ func signerKey(signer string) []byte {
 	return []byte(PrefixSigner + signer)
 }
 
+func signingKeyKey(kid string) []byte {
+	return []byte(PrefixSignKey + kid)
+}
+
+func roleKey(name string) []byte {
+	return []byte(PrefixRole + name)
+}
+
+func rateLimitTierKey(name string) []byte {
+	return []byte(PrefixTier + name)
+}
+
+func refreshTokenKey(token string) []byte {
+	return []byte(PrefixRefresh + token)
+}
+
+func rateLimitBucketKey(key string) []byte {
+	return []byte(PrefixBucket + key)
+}
+
+func quotaUsageKey(name, period, window, limitID string) []byte {
+	return []byte(fmt.Sprintf("%s%s:%s:%s:%s", PrefixQuota, name, period, window, limitID))
+}
+
+// quotaUsagePrefix is the prefix of the quota usages of user `name` in period and window
+func quotaUsagePrefix(name, period, window string) []byte {
+	prefix := PrefixQuota + name + ":"
+	if len(period) != 0 {
+		prefix += period + ":"
+		if len(window) != 0 {
+			prefix += window + ":"
+		}
+	}
+	return []byte(prefix)
+}
+
+// auditLogKey sorts audit logs by time
+func auditLogKey(t time.Time, id string) []byte {
+	return []byte(fmt.Sprintf("%s%020d:%s", PrefixAudit, t.UnixNano(), id))
+}
+
 func signerForUserKey(signer, userName string) []byte {
 	return []byte(fmt.Sprintf("%s%s:%s", PrefixSigner, signer, userName))
 }
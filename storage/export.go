@@ -0,0 +1,326 @@
+package storage
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/xerrors"
+)
+
+// An export file is NDJSON, the first line is an `ExportHeader`, each of the following lines is
+// a record in the form of `{"kind":"user","record":{...}}`, `record` is the json of the record
+// type of `kind`, see `RecordKind`. Records are ordered by kind as `RecordKinds`.
+// If the header has `encryption`, secret fields are encrypted with a key derived from a
+// passphrase, they are `KeyPair.Secret`, `KeyPair.Token`, `SigningKey.PrivateKey` and
+// `RefreshToken.Token`, an encrypted field is base64 of the nonce followed by the sealed value.
+const (
+	ExportFormat = "sophon-auth-export"
+	// ExportVersion is increased once the format changes incompatibly
+	ExportVersion = 1
+)
+
+var (
+	ErrPassphraseRequired = xerrors.New("secrets are encrypted, passphrase is required")
+	ErrWrongPassphrase    = xerrors.New("wrong passphrase")
+)
+
+type ExportHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	// StoreVersion is the version of the store exported from
+	StoreVersion uint64            `json:"storeVersion"`
+	CreateTime   time.Time         `json:"createTime"`
+	Encryption   *ExportEncryption `json:"encryption,omitempty"`
+}
+
+// ExportEncryption tells how secrets are encrypted, the key is derived by scrypt
+// and secrets are encrypted by aes-256-gcm
+type ExportEncryption struct {
+	Salt []byte `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	// Check is `exportCheckText` encrypted, to tell whether a passphrase is right
+	Check string `json:"check"`
+}
+
+type exportLine struct {
+	Kind   RecordKind      `json:"kind"`
+	Record json.RawMessage `json:"record"`
+}
+
+const exportCheckText = ExportFormat
+
+type secretCipher struct {
+	aead cipher.AEAD
+}
+
+func newSecretCipher(passphrase string, enc *ExportEncryption) (*secretCipher, error) {
+	key, err := scrypt.Key([]byte(passphrase), enc.Salt, enc.N, enc.R, enc.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &secretCipher{aead: aead}, nil
+}
+
+func (c *secretCipher) encrypt(plain string) (string, error) {
+	return seal(c.aead, []byte(plain))
+}
+
+func (c *secretCipher) decrypt(sealed string) (string, error) {
+	plain, err := open(c.aead, sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// secretFields returns the secret fields of record, which are encrypted in export files
+func secretFields(record interface{}) []*string {
+	switch r := record.(type) {
+	case *KeyPair:
+		return []*string{&r.Secret, (*string)(&r.Token)}
+	case *SigningKey:
+		return []*string{&r.PrivateKey}
+	case *RefreshToken:
+		return []*string{&r.Token}
+	}
+	return nil
+}
+
+// Export writes all records of store to w, secrets are encrypted if passphrase is not empty.
+// It returns the count of records of each kind exported.
+func Export(store Store, w io.Writer, passphrase string) (map[RecordKind]int64, error) {
+	version, err := store.Version()
+	if err != nil {
+		return nil, err
+	}
+	header := ExportHeader{
+		Format:       ExportFormat,
+		Version:      ExportVersion,
+		StoreVersion: version,
+		CreateTime:   time.Now(),
+	}
+	var sc *secretCipher
+	if len(passphrase) != 0 {
+		enc := &ExportEncryption{Salt: make([]byte, 16), N: 1 << 15, R: 8, P: 1}
+		if _, err := rand.Read(enc.Salt); err != nil {
+			return nil, err
+		}
+		if sc, err = newSecretCipher(passphrase, enc); err != nil {
+			return nil, err
+		}
+		if enc.Check, err = sc.encrypt(exportCheckText); err != nil {
+			return nil, err
+		}
+		header.Encryption = enc
+	}
+
+	bw := bufio.NewWriter(w)
+	encoder := json.NewEncoder(bw)
+	if err := encoder.Encode(header); err != nil {
+		return nil, err
+	}
+	counts := make(map[RecordKind]int64, len(RecordKinds))
+	for _, kind := range RecordKinds {
+		if err := store.WalkRecords(kind, func(record interface{}) error {
+			if sc != nil {
+				for _, field := range secretFields(record) {
+					if len(*field) == 0 {
+						continue
+					}
+					if *field, err = sc.encrypt(*field); err != nil {
+						return err
+					}
+				}
+			}
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			counts[kind]++
+			return encoder.Encode(exportLine{Kind: kind, Record: data})
+		}); err != nil {
+			return nil, xerrors.Errorf("export %s records: %w", kind, err)
+		}
+	}
+	return counts, bw.Flush()
+}
+
+type ImportMode string
+
+const (
+	// ImportMerge keeps the existing record if a record conflicts with it
+	ImportMerge ImportMode = "merge"
+	// ImportReplace replaces the existing record with the imported one if they conflict
+	ImportReplace ImportMode = "replace"
+)
+
+type ImportOptions struct {
+	Mode ImportMode
+	// DryRun reports what would be imported and the conflicts, without writing the store
+	DryRun     bool
+	Passphrase string
+}
+
+type ImportCount struct {
+	Total int64
+	// Created is the count of records which didn't exist in the store
+	Created int64
+	// Replaced is the count of conflicting records replaced by the imported ones
+	Replaced int64
+	// Skipped is the count of conflicting records which are kept
+	Skipped int64
+}
+
+// ImportConflict is an imported record which has the same key as an existing one,
+// eg. users of the same name, miners of the same address. Keys of tokens are their hash.
+type ImportConflict struct {
+	Kind RecordKind
+	Key  string
+}
+
+type ImportReport struct {
+	Header    ExportHeader
+	Counts    map[RecordKind]*ImportCount
+	Conflicts []ImportConflict
+}
+
+// Import reads records exported by `Export` from r, and writes them to store as `opts.Mode` says.
+func Import(store Store, r io.Reader, opts ImportOptions) (*ImportReport, error) {
+	if opts.Mode != ImportMerge && opts.Mode != ImportReplace {
+		return nil, fmt.Errorf("unknown import mode %q", opts.Mode)
+	}
+	scanner := bufio.NewScanner(r)
+	// records are small, but leave enough room for long comments or extra
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	report := &ImportReport{Counts: make(map[RecordKind]*ImportCount, len(RecordKinds))}
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("empty export file")
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &report.Header); err != nil {
+		return nil, xerrors.Errorf("decode header: %w", err)
+	}
+	header := report.Header
+	if header.Format != ExportFormat {
+		return nil, fmt.Errorf("not an export file of sophon-auth, format: %q", header.Format)
+	}
+	if header.Version > ExportVersion {
+		return nil, fmt.Errorf("export version %d is not supported, the latest supported is %d", header.Version, ExportVersion)
+	}
+	version, err := store.Version()
+	if err != nil {
+		return nil, err
+	}
+	if header.StoreVersion > version {
+		return nil, fmt.Errorf("exported from store version %d, which is newer than %d of the store", header.StoreVersion, version)
+	}
+	var sc *secretCipher
+	if header.Encryption != nil {
+		if len(opts.Passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+		if sc, err = newSecretCipher(opts.Passphrase, header.Encryption); err != nil {
+			return nil, err
+		}
+		if check, err := sc.decrypt(header.Encryption.Check); err != nil || check != exportCheckText {
+			return nil, ErrWrongPassphrase
+		}
+	}
+
+	existing := make(map[RecordKind]map[string]interface{}, len(RecordKinds))
+	for _, kind := range RecordKinds {
+		report.Counts[kind] = &ImportCount{}
+		records := make(map[string]interface{})
+		if err := store.WalkRecords(kind, func(record interface{}) error {
+			records[recordKey(record)] = record
+			return nil
+		}); err != nil {
+			return nil, xerrors.Errorf("walk %s records: %w", kind, err)
+		}
+		existing[kind] = records
+	}
+
+	for lineNo := 2; scanner.Scan(); lineNo++ {
+		var line exportLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, xerrors.Errorf("decode line %d: %w", lineNo, err)
+		}
+		record, err := NewRecord(line.Kind)
+		if err != nil {
+			return nil, xerrors.Errorf("line %d: %w", lineNo, err)
+		}
+		if err := json.Unmarshal(line.Record, record); err != nil {
+			return nil, xerrors.Errorf("decode %s record of line %d: %w", line.Kind, lineNo, err)
+		}
+		if sc != nil {
+			for _, field := range secretFields(record) {
+				if len(*field) == 0 {
+					continue
+				}
+				if *field, err = sc.decrypt(*field); err != nil {
+					return nil, xerrors.Errorf("decrypt %s record of line %d: %w", line.Kind, lineNo, err)
+				}
+			}
+		}
+
+		count := report.Counts[line.Kind]
+		count.Total++
+		key := recordKey(record)
+		if old, ok := existing[line.Kind][key]; ok {
+			report.Conflicts = append(report.Conflicts, ImportConflict{Kind: line.Kind, Key: conflictKey(record)})
+			if opts.Mode == ImportMerge {
+				count.Skipped++
+				continue
+			}
+			// users are identified by name, keep the id of the existing one
+			if user, ok := record.(*User); ok {
+				user.Id = old.(*User).Id
+			}
+			count.Replaced++
+		} else {
+			count.Created++
+		}
+		existing[line.Kind][key] = record
+		if opts.DryRun {
+			continue
+		}
+		if err := store.RestoreRecord(line.Kind, record); err != nil {
+			return nil, xerrors.Errorf("import %s record of line %d: %w", line.Kind, lineNo, err)
+		}
+	}
+	return report, scanner.Err()
+}
+
+// conflictKey is the key of record to report, tokens are reported by their hash
+func conflictKey(record interface{}) string {
+	switch r := record.(type) {
+	case *KeyPair:
+		return fmt.Sprintf("%s(sha256:%s)", r.Name, TokenFingerprint(r.Token.String()))
+	case *RefreshToken:
+		return fmt.Sprintf("%s(sha256:%s)", r.Name, hashPrefix(r.Token))
+	}
+	return recordKey(record)
+}
+
+func hashPrefix(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+)
+
+func TestExportImport(t *testing.T) {
+	from, err := NewStore(&config.DBConfig{Type: config.Badger}, t.TempDir())
+	require.NoError(t, err)
+	fillRecords(t, from)
+	counts, err := CountRecords(from)
+	require.NoError(t, err)
+
+	t.Run("plain", func(t *testing.T) {
+		var buf bytes.Buffer
+		exported, err := Export(from, &buf, "")
+		require.NoError(t, err)
+		require.Equal(t, counts, exported)
+		require.Contains(t, buf.String(), "jwt.copy-token-01")
+
+		to, err := NewStore(&config.DBConfig{Type: config.Badger}, t.TempDir())
+		require.NoError(t, err)
+		report, err := Import(to, bytes.NewReader(buf.Bytes()), ImportOptions{Mode: ImportMerge})
+		require.NoError(t, err)
+		require.Empty(t, report.Conflicts)
+		for _, kind := range RecordKinds {
+			require.Equal(t, ImportCount{Total: counts[kind], Created: counts[kind]}, *report.Counts[kind], kind)
+		}
+		toCounts, err := CountRecords(to)
+		require.NoError(t, err)
+		require.Equal(t, counts, toCounts)
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, err := Export(from, &buf, "passphrase")
+		require.NoError(t, err)
+		require.NotContains(t, buf.String(), "jwt.copy-token-01")
+		require.NotContains(t, buf.String(), "refresh-01")
+
+		to, err := NewStore(&config.DBConfig{Type: config.Sqlite}, t.TempDir())
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, closeSQLiteStore(to.(*sqliteStore)))
+		}()
+
+		_, err = Import(to, bytes.NewReader(buf.Bytes()), ImportOptions{Mode: ImportMerge})
+		require.ErrorIs(t, err, ErrPassphraseRequired)
+		_, err = Import(to, bytes.NewReader(buf.Bytes()), ImportOptions{Mode: ImportMerge, Passphrase: "wrong"})
+		require.ErrorIs(t, err, ErrWrongPassphrase)
+
+		_, err = Import(to, bytes.NewReader(buf.Bytes()), ImportOptions{Mode: ImportMerge, Passphrase: "passphrase"})
+		require.NoError(t, err)
+		toCounts, err := CountRecords(to)
+		require.NoError(t, err)
+		require.Equal(t, counts, toCounts)
+		kp, err := to.Get("jwt.copy-token-01")
+		require.NoError(t, err)
+		require.Equal(t, "secret", kp.Secret)
+
+		// everything conflicts now, a dry run writes nothing
+		user, err := to.GetUser("copy_user_01")
+		require.NoError(t, err)
+		user.Comment = "changed"
+		require.NoError(t, to.UpdateUser(user))
+		report, err := Import(to, bytes.NewReader(buf.Bytes()), ImportOptions{Mode: ImportReplace, DryRun: true, Passphrase: "passphrase"})
+		require.NoError(t, err)
+		var total int64
+		for _, count := range counts {
+			total += count
+		}
+		require.Len(t, report.Conflicts, int(total))
+		require.Equal(t, ImportCount{Total: 2, Replaced: 2}, *report.Counts[RecordUser])
+		for _, conflict := range report.Conflicts {
+			if conflict.Kind == RecordToken {
+				require.True(t, strings.Contains(conflict.Key, "sha256:"))
+				require.NotContains(t, conflict.Key, "jwt.")
+			}
+		}
+		user, err = to.GetUser("copy_user_01")
+		require.NoError(t, err)
+		require.Equal(t, "changed", user.Comment)
+
+		// merge keeps the existing records
+		report, err = Import(to, bytes.NewReader(buf.Bytes()), ImportOptions{Mode: ImportMerge, Passphrase: "passphrase"})
+		require.NoError(t, err)
+		require.Equal(t, ImportCount{Total: 2, Skipped: 2}, *report.Counts[RecordUser])
+		user, err = to.GetUser("copy_user_01")
+		require.NoError(t, err)
+		require.Equal(t, "changed", user.Comment)
+
+		// replace overwrites them
+		_, err = Import(to, bytes.NewReader(buf.Bytes()), ImportOptions{Mode: ImportReplace, Passphrase: "passphrase"})
+		require.NoError(t, err)
+		user, err = to.GetUser("copy_user_01")
+		require.NoError(t, err)
+		require.Empty(t, user.Comment)
+		toCounts, err = CountRecords(to)
+		require.NoError(t, err)
+		require.Equal(t, counts, toCounts)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := Import(from, strings.NewReader(`{"format":"other","version":1}`), ImportOptions{Mode: ImportMerge})
+		require.Error(t, err)
+		_, err = Import(from, strings.NewReader(`{"format":"sophon-auth-export","version":2}`), ImportOptions{Mode: ImportMerge})
+		require.Error(t, err)
+		_, err = Import(from, strings.NewReader(`{"format":"sophon-auth-export","version":1}`), ImportOptions{Mode: "unknown"})
+		require.Error(t, err)
+	})
+}
@@ -18,6 +18,14 @@ import (
 	"github.com/ipfs-force-community/sophon-auth/log"
 )
 
+// columns which are keywords or case-sensitive in some databases are quoted by the dialect,
+// so that queries are shared by the sql stores, eg. `user` is a keyword of postgres.
+var (
+	columnUser        = clause.Column{Name: "user"}
+	columnCreateTime  = clause.Column{Name: "createTime"}
+	orderByCreateTime = clause.OrderByColumn{Column: columnCreateTime}
+)
+
 type mysqlStore struct {
 	db *gorm.DB
 }
@@ -62,24 +70,32 @@ func newMySQLStore(cnf *config.DBConfig) (Store, error) {
 		}
 	}
 
-	if err = session.AutoMigrate(&KeyPair{}, &User{}, &Signer{}, &UserRateLimit{}, &StoreVersion{}); err != nil {
+	if err = autoMigrate(session); err != nil {
 		return nil, err
 	}
 
+	return &mysqlStore{db: db}, nil
+}
+
+// autoMigrate creates or updates tables of all models, it's shared by the sql stores
+func autoMigrate(session *gorm.DB) error {
+	if err := session.AutoMigrate(&KeyPair{}, &User{}, &Signer{}, &UserRateLimit{}, &StoreVersion{}, &SigningKey{}, &Role{}, &RefreshToken{}, &AuditLog{}, &RateLimitBucket{}, &QuotaUsage{}, &RateLimitTier{}); err != nil {
+		return err
+	}
+
 	// `miners` table changes the primary key in V1.9.0. AutoMigrate will fail, so need to handle migration independently.
 	if bHas := session.Migrator().HasTable(&Miner{}); !bHas {
 		if err := session.Migrator().CreateTable(&Miner{}); err != nil {
-			return nil, err
+			return err
 		}
 	} else {
 		if bHas := session.Migrator().HasColumn(&Miner{}, "ID"); bHas {
 			if err := session.AutoMigrate(&Miner{}); err != nil {
-				return nil, err
+				return err
 			}
 		}
 	}
-
-	return &mysqlStore{db: db}, nil
+	return nil
 }
 
 func (s *mysqlStore) Put(kp *KeyPair) error {
@@ -94,7 +110,8 @@ func (s mysqlStore) Delete(token Token) error {
 	if !has {
 		return gorm.ErrRecordNotFound
 	}
-	return s.db.Table("token").Where("token=?", token.String()).Update("is_deleted", core.Deleted).Error
+	return s.db.Table("token").Where("token=?", token.String()).
+		Updates(map[string]interface{}{"is_deleted": core.Deleted, "delete_time": time.Now()}).Error
 }
 
 func (s mysqlStore) Recover(token Token) error {
@@ -105,7 +122,8 @@ func (s mysqlStore) Recover(token Token) error {
 	}
 
 	if count > 0 {
-		return s.db.Table("token").Where("token=?", token.String()).Update("is_deleted", core.NotDelete).Error
+		return s.db.Table("token").Where("token=?", token.String()).
+			Updates(map[string]interface{}{"is_deleted": core.NotDelete, "delete_time": nil}).Error
 	}
 
 	return gorm.ErrRecordNotFound
@@ -146,16 +164,83 @@ func (s mysqlStore) List(skip, limit int64) ([]*KeyPair, error) {
 }
 
 func (s *mysqlStore) UpdateToken(kp *KeyPair) error {
-	columns := map[string]interface{}{
-		"name":       kp.Name,
-		"perm":       kp.Perm,
-		"secret":     kp.Secret,
-		"extra":      kp.Extra,
-		"token":      kp.Token,
-		"createTime": kp.CreateTime,
-		"is_deleted": kp.IsDeleted,
+	return s.db.Table("token").Where("token = ?", kp.Token.String()).UpdateColumns(tokenColumns(kp)).Error
+}
+
+func tokenColumns(kp *KeyPair) map[string]interface{} {
+	return map[string]interface{}{
+		"name":           kp.Name,
+		"perm":           kp.Perm,
+		"secret":         kp.Secret,
+		"extra":          kp.Extra,
+		"token":          kp.Token,
+		"createTime":     kp.CreateTime,
+		"is_deleted":     kp.IsDeleted,
+		"expire_time":    kp.ExpireTime,
+		"delete_time":    kp.DeleteTime,
+		"unsigned_token": kp.UnsignedToken,
 	}
-	return s.db.Table("token").Where("token = ?", kp.Token.String()).UpdateColumns(columns).Error
+}
+
+func (s *mysqlStore) TokensByPrefix(prefix Token, limit int64) ([]*KeyPair, error) {
+	var tokens []*KeyPair
+	exec := s.db.Table("token").Where("token like ?", prefix.String()+"%").Order("token")
+	if limit > 0 {
+		exec = exec.Limit(int(limit))
+	}
+	if err := exec.Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (s *mysqlStore) RenameToken(old Token, kp *KeyPair) error {
+	db := s.db.Table("token").Where("token = ?", old.String()).UpdateColumns(tokenColumns(kp))
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (s *mysqlStore) staleTokensQuery(tx *gorm.DB, before time.Time) *gorm.DB {
+	return tx.Table("token").Where("expire_time < ? or (is_deleted = ? and "+
+		"(delete_time < ? or (delete_time is null and ? < ?)))",
+		before, core.Deleted, before, columnCreateTime, before)
+}
+
+func (s *mysqlStore) ListStaleTokens(before time.Time, limit int64) ([]*KeyPair, error) {
+	var tokens []*KeyPair
+	exec := s.staleTokensQuery(s.db, before)
+	if limit > 0 {
+		exec = exec.Limit(int(limit))
+	}
+	if err := exec.Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (s *mysqlStore) PurgeStaleTokens(before time.Time, limit int64) (int64, error) {
+	var count int64
+	return count, s.db.Transaction(func(tx *gorm.DB) error {
+		var tokens []string
+		exec := s.staleTokensQuery(tx, before)
+		if limit > 0 {
+			exec = exec.Limit(int(limit))
+		}
+		if err := exec.Pluck("token", &tokens).Error; err != nil {
+			return err
+		}
+		if len(tokens) == 0 {
+			return nil
+		}
+		db := tx.Table("token").Where("token in ?", tokens).Delete(nil)
+		count = db.RowsAffected
+		return db.Error
+	})
 }
 
 func (s mysqlStore) HasUser(name string) (bool, error) {
@@ -183,7 +268,7 @@ func (s *mysqlStore) ListUsers(skip, limit int64, state core.UserState) ([]*User
 		exec = exec.Where("state=?", state)
 	}
 	arr := make([]*User, 0)
-	err := exec.Where("is_deleted=?", core.NotDelete).Order("createTime").Offset(int(skip)).Limit(int(limit)).Scan(&arr).Error
+	err := exec.Where("is_deleted=?", core.NotDelete).Order(orderByCreateTime).Offset(int(skip)).Limit(int(limit)).Scan(&arr).Error
 	if err != nil {
 		return nil, err
 	}
@@ -264,6 +349,136 @@ func (s *mysqlStore) RecoverUser(userName string) error {
 	return s.innerUpdateUser(s.db, &user)
 }
 
+func (s *mysqlStore) PutSigningKey(key *SigningKey) error {
+	return s.db.Table("signing_keys").Save(key).Error
+}
+
+func (s *mysqlStore) GetSigningKey(kid string) (*SigningKey, error) {
+	var key SigningKey
+	return &key, s.db.Table("signing_keys").Take(&key, "kid = ?", kid).Error
+}
+
+func (s *mysqlStore) ListSigningKeys() ([]*SigningKey, error) {
+	var keys []*SigningKey
+	return keys, s.db.Table("signing_keys").Order(orderByCreateTime).Find(&keys).Error
+}
+
+func (s *mysqlStore) PutRole(role *Role) error {
+	return s.db.Table("roles").Save(role).Error
+}
+
+func (s *mysqlStore) GetRole(name string) (*Role, error) {
+	var role Role
+	if err := s.db.Table("roles").Take(&role, "name = ?", name).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (s *mysqlStore) ListRoles() ([]*Role, error) {
+	var roles []*Role
+	return roles, s.db.Table("roles").Order("name").Find(&roles).Error
+}
+
+func (s *mysqlStore) DelRole(name string) error {
+	res := s.db.Table("roles").Where("name = ?", name).Delete(&Role{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+func (s *mysqlStore) PutRefreshToken(rt *RefreshToken) error {
+	return s.db.Table("refresh_tokens").Save(rt).Error
+}
+
+func (s *mysqlStore) GetRefreshToken(token string) (*RefreshToken, error) {
+	var rt RefreshToken
+	if err := s.db.Table("refresh_tokens").Take(&rt, "token = ?", token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRefreshTokenNotFound
+		}
+		return nil, err
+	}
+	return &rt, nil
+}
+
+func (s *mysqlStore) UseRefreshToken(token string, usedAt time.Time) error {
+	// the condition on `used_time` makes concurrent exchanges of the same token fail except one
+	res := s.db.Table("refresh_tokens").Where("token = ? AND used_time IS NULL", token).Update("used_time", usedAt)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		if _, err := s.GetRefreshToken(token); err != nil {
+			return err
+		}
+		return ErrRefreshTokenUsed
+	}
+	return nil
+}
+
+func (s *mysqlStore) RenameRefreshToken(old, token string) error {
+	res := s.db.Table("refresh_tokens").Where("token = ?", old).Update("token", token)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRefreshTokenNotFound
+	}
+	return nil
+}
+
+func (s *mysqlStore) RevokeRefreshTokens(family string) error {
+	return s.db.Table("refresh_tokens").Where("family = ?", family).Update("revoked", true).Error
+}
+
+func (s *mysqlStore) PutAuditLog(entry *AuditLog) error {
+	return s.db.Table("audit_logs").Create(entry).Error
+}
+
+func (s *mysqlStore) ListAuditLogs(filter *AuditLogFilter) ([]*AuditLog, error) {
+	exec := s.db.Table("audit_logs")
+	if !filter.Start.IsZero() {
+		exec = exec.Where("time >= ?", filter.Start)
+	}
+	if !filter.End.IsZero() {
+		exec = exec.Where("time < ?", filter.End)
+	}
+	if len(filter.Actor) != 0 {
+		exec = exec.Where("actor = ?", filter.Actor)
+	}
+	if len(filter.Action) != 0 {
+		exec = exec.Where("action = ?", filter.Action)
+	}
+	exec = exec.Order("time")
+	if filter.Skip > 0 {
+		exec = exec.Offset(int(filter.Skip))
+	}
+	if filter.Limit > 0 {
+		exec = exec.Limit(int(filter.Limit))
+	}
+	var logs []*AuditLog
+	return logs, exec.Find(&logs).Error
+}
+
+func (s *mysqlStore) LastAuditLog() (*AuditLog, error) {
+	var entry AuditLog
+	if err := s.db.Table("audit_logs").Order("time desc").Take(&entry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAuditLogNotFound
+		}
+		return nil, err
+	}
+	return &entry, nil
+}
+
 func (s *mysqlStore) GetRateLimits(name string, id string) ([]*UserRateLimit, error) {
 	var limits []*UserRateLimit
 	tmp := s.db.Model((*UserRateLimit)(nil)).Where("name = ?", name)
@@ -290,12 +505,127 @@ func (s *mysqlStore) DelRateLimit(name, id string) error {
 		Delete(nil).Error
 }
 
+func (s *mysqlStore) ListRateLimitBuckets() ([]*RateLimitBucket, error) {
+	var buckets []*RateLimitBucket
+	return buckets, s.db.Table("rate_limit_buckets").Find(&buckets).Error
+}
+
+func (s *mysqlStore) PutRateLimitBuckets(buckets []*RateLimitBucket) error {
+	if len(buckets) == 0 {
+		return nil
+	}
+	return s.db.Table("rate_limit_buckets").Save(buckets).Error
+}
+
+func (s *mysqlStore) PurgeRateLimitBuckets(before time.Time) (int64, error) {
+	db := s.db.Table("rate_limit_buckets").Where("reset_at < ?", before).Delete(nil)
+	return db.RowsAffected, db.Error
+}
+
+func (s *mysqlStore) PutRateLimitTier(tier *RateLimitTier) error {
+	return s.db.Table("rate_limit_tiers").Save(tier).Error
+}
+
+func (s *mysqlStore) GetRateLimitTier(name string) (*RateLimitTier, error) {
+	var tier RateLimitTier
+	if err := s.db.Table("rate_limit_tiers").Take(&tier, "name = ?", name).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRateLimitTierNotFound
+		}
+		return nil, err
+	}
+	return &tier, nil
+}
+
+func (s *mysqlStore) ListRateLimitTiers() ([]*RateLimitTier, error) {
+	var tiers []*RateLimitTier
+	return tiers, s.db.Table("rate_limit_tiers").Order("name").Find(&tiers).Error
+}
+
+func (s *mysqlStore) DelRateLimitTier(name string) error {
+	res := s.db.Table("rate_limit_tiers").Where("name = ?", name).Delete(&RateLimitTier{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRateLimitTierNotFound
+	}
+	return nil
+}
+
+func (s *mysqlStore) AddQuotaUsages(usages []*QuotaUsage) error {
+	if len(usages) == 0 {
+		return nil
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, u := range usages {
+			if err := tx.Table("quota_usages").Clauses(clause.OnConflict{
+				Columns:   recordKeys[RecordQuotaUsage],
+				DoUpdates: clause.Assignments(map[string]interface{}{"used": gorm.Expr("quota_usages.used + ?", u.Used)}),
+			}).Create(u).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// errQuotaExceeded rolls back the transaction of `TakeQuotaUsages`
+var errQuotaExceeded = xerrors.New("quota exceeded")
+
+func (s *mysqlStore) TakeQuotaUsages(usages []*QuotaUsage, quotas []int64) (*QuotaUsage, error) {
+	var exceeded *QuotaUsage
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for idx, u := range usages {
+			empty := &QuotaUsage{Name: u.Name, LimitID: u.LimitID, Period: u.Period, Window: u.Window}
+			if err := tx.Table("quota_usages").Clauses(clause.OnConflict{DoNothing: true}).Create(empty).Error; err != nil {
+				return err
+			}
+			// the condition makes concurrent takes from the same quota never exceed it
+			res := tx.Table("quota_usages").
+				Where("name = ? AND limit_id = ? AND period = ? AND quota_window = ? AND used + ? <= ?",
+					u.Name, u.LimitID, u.Period, u.Window, u.Used, quotas[idx]).
+				Update("used", gorm.Expr("used + ?", u.Used))
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				exceeded = u
+				return errQuotaExceeded
+			}
+		}
+		return nil
+	})
+	if exceeded != nil {
+		return exceeded, nil
+	}
+	return nil, err
+}
+
+func (s *mysqlStore) ListQuotaUsages(name string, period QuotaPeriod, window string) ([]*QuotaUsage, error) {
+	var usages []*QuotaUsage
+	exec := s.db.Table("quota_usages").Where("name = ?", name)
+	if len(period) != 0 {
+		exec = exec.Where("period = ?", period)
+		if len(window) != 0 {
+			exec = exec.Where("quota_window = ?", window)
+		}
+	}
+	return usages, exec.Order("quota_window").Order("limit_id").Find(&usages).Error
+}
+
 func (s *mysqlStore) GetUserByMiner(miner address.Address) (*User, error) {
 	var user User
-	if err := s.db.Model(&Miner{}).Select("users.*").
-		Joins("inner join users on miners.`miner` = ? and users.`name` = miners.`user` and users.`is_deleted` = ?", storedAddress(miner), core.NotDelete).
-		Scan(&user).Error; err != nil {
-		return nil, err
+	db := s.db.Model(&Miner{}).Select("users.*").
+		Joins("inner join users on miners.miner = ? and users.name = ? and users.is_deleted = ?",
+			storedAddress(miner), clause.Column{Table: "miners", Name: "user"}, core.NotDelete).
+		Scan(&user)
+	if db.Error != nil {
+		return nil, db.Error
+	}
+	// `Scan` doesn't fail if there is no such row
+	if db.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
 	}
 
 	return &user, nil
@@ -337,7 +667,7 @@ func (s mysqlStore) HasMiner(mAddr address.Address) (bool, error) {
 
 func (s mysqlStore) MinerExistInUser(mAddr address.Address, userName string) (bool, error) {
 	var count int64
-	if err := s.db.Table("miners").Where("miner = ? AND user = ? AND deleted_at IS NULL", storedAddress(mAddr), userName).Count(&count).Error; err != nil {
+	if err := s.db.Table("miners").Where("miner = ? AND ? = ? AND deleted_at IS NULL", storedAddress(mAddr), columnUser, userName).Count(&count).Error; err != nil {
 		return false, nil
 	}
 
@@ -360,7 +690,7 @@ func (s *mysqlStore) ListMiners(user string) ([]*Miner, error) {
 
 func (s *mysqlStore) innerListMiners(tx *gorm.DB, user string) ([]*Miner, error) {
 	var miners []*Miner
-	if err := tx.Model((*Miner)(nil)).Find(&miners, "user = ?", user).Error; err != nil {
+	if err := tx.Model((*Miner)(nil)).Find(&miners, "? = ?", columnUser, user).Error; err != nil {
 		return nil, err
 	}
 	return miners, nil
@@ -370,7 +700,7 @@ func (s *mysqlStore) RegisterSigner(addr address.Address, userName string) error
 	storedSigner := storedAddress(addr)
 	return s.db.Transaction(func(tx *gorm.DB) error {
 		var user User
-		if err := tx.Model(&user).First(&user, "`name` = ?", userName).Error; err != nil {
+		if err := tx.Model(&user).First(&user, "name = ?", userName).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				return xerrors.Errorf("can't bind signer:%s to not exist user:%s", addr.String(), userName)
 			}
@@ -387,7 +717,7 @@ func (s *mysqlStore) RegisterSigner(addr address.Address, userName string) error
 
 func (s mysqlStore) SignerExistInUser(addr address.Address, userName string) (bool, error) {
 	var count int64
-	if err := s.db.Table("signers").Where("`signer` = ? AND `user` = ? AND deleted_at IS NULL", storedAddress(addr), userName).Count(&count).Error; err != nil {
+	if err := s.db.Table("signers").Where("signer = ? AND ? = ? AND deleted_at IS NULL", storedAddress(addr), columnUser, userName).Count(&count).Error; err != nil {
 		return false, nil
 	}
 
@@ -396,7 +726,7 @@ func (s mysqlStore) SignerExistInUser(addr address.Address, userName string) (bo
 
 func (s *mysqlStore) innerListSigners(tx *gorm.DB, user string) ([]*Signer, error) {
 	var signers []*Signer
-	if err := tx.Model((*Signer)(nil)).Find(&signers, "`user` = ?", user).Error; err != nil {
+	if err := tx.Model((*Signer)(nil)).Find(&signers, "? = ?", columnUser, user).Error; err != nil {
 		return nil, err
 	}
 	return signers, nil
@@ -407,14 +737,14 @@ func (s *mysqlStore) ListSigner(user string) ([]*Signer, error) {
 }
 
 func (s *mysqlStore) UnregisterSigner(addr address.Address, userName string) error {
-	db := s.db.Model((*Signer)(nil)).Delete(&Signer{}, "`signer` = ? AND `user` = ?", storedAddress(addr), userName)
+	db := s.db.Model((*Signer)(nil)).Delete(&Signer{}, "signer = ? AND ? = ?", storedAddress(addr), columnUser, userName)
 
 	return db.Error
 }
 
 func (s mysqlStore) HasSigner(addr address.Address) (bool, error) {
 	var count int64
-	if err := s.db.Table("signers").Where("`signer` = ? AND deleted_at IS NULL", storedAddress(addr)).Count(&count).Error; err != nil {
+	if err := s.db.Table("signers").Where("signer = ? AND deleted_at IS NULL", storedAddress(addr)).Count(&count).Error; err != nil {
 		return false, nil
 	}
 
@@ -422,7 +752,7 @@ func (s mysqlStore) HasSigner(addr address.Address) (bool, error) {
 }
 
 func (s *mysqlStore) DelSigner(addr address.Address) (bool, error) {
-	db := s.db.Model((*Signer)(nil)).Delete(&Signer{}, "`signer` = ?", storedAddress(addr))
+	db := s.db.Model((*Signer)(nil)).Delete(&Signer{}, "signer = ?", storedAddress(addr))
 
 	return db.RowsAffected > 0, db.Error
 }
@@ -430,7 +760,8 @@ func (s *mysqlStore) DelSigner(addr address.Address) (bool, error) {
 func (s *mysqlStore) GetUserBySigner(addr address.Address) ([]*User, error) {
 	var users []*User
 	if err := s.db.Model(&Signer{}).Select("users.*").
-		Joins("inner join users on signers.`signer` = ? and users.`name` = signers.`user` and users.`is_deleted` = ?", storedAddress(addr), core.NotDelete).
+		Joins("inner join users on signers.signer = ? and users.name = ? and users.is_deleted = ?",
+			storedAddress(addr), clause.Column{Table: "signers", Name: "user"}, core.NotDelete).
 		Scan(&users).Error; err != nil {
 		return nil, err
 	}
@@ -441,11 +772,80 @@ func (s *mysqlStore) GetUserBySigner(addr address.Address) ([]*User, error) {
 }
 
 func (s *mysqlStore) innerDelSignerOfUser(tx *gorm.DB, userName string) (int64, error) {
-	db := tx.Model((*Signer)(nil)).Delete(&Signer{}, "`user` = ?", userName)
+	db := tx.Model((*Signer)(nil)).Delete(&Signer{}, "? = ?", columnUser, userName)
 
 	return db.RowsAffected, db.Error
 }
 
+// recordKeys are the columns identifying records of each kind, records are walked in their order
+// and restored by upserting on them.
+var recordKeys = map[RecordKind][]clause.Column{
+	RecordUser:         {{Name: "id"}},
+	RecordToken:        {{Name: "token"}},
+	RecordMiner:        {{Name: "miner"}},
+	RecordSigner:       {{Name: "signer"}, columnUser},
+	RecordRateLimit:    {{Name: "id"}},
+	RecordSigningKey:   {{Name: "kid"}},
+	RecordRole:         {{Name: "name"}},
+	RecordRefreshToken: {{Name: "token"}},
+	RecordAuditLog:     {{Name: "id"}},
+	RecordQuotaUsage:   {{Name: "name"}, {Name: "limit_id"}, {Name: "period"}, {Name: "quota_window"}},
+	RecordTier:         {{Name: "name"}},
+}
+
+func (s *mysqlStore) WalkRecords(kind RecordKind, fn func(record interface{}) error) error {
+	model, err := NewRecord(kind)
+	if err != nil {
+		return err
+	}
+	// soft-deleted miners and signers are walked too
+	exec := s.db.Unscoped().Model(model)
+	for _, col := range recordKeys[kind] {
+		exec = exec.Order(clause.OrderByColumn{Column: col})
+	}
+	rows, err := exec.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close() // nolint
+
+	for rows.Next() {
+		record, _ := NewRecord(kind)
+		if err := s.db.ScanRows(rows, record); err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *mysqlStore) RestoreRecord(kind RecordKind, record interface{}) error {
+	if err := checkRecord(kind, record); err != nil {
+		return err
+	}
+	// ids of miners and signers are only meaningful in the store they come from,
+	// and miners or signers which are not deleted may be marked as not deleted by badger
+	switch r := record.(type) {
+	case *Miner:
+		m := *r
+		m.ID = 0
+		if !m.isDeleted() {
+			m.DeletedAt = gorm.DeletedAt{}
+		}
+		record = &m
+	case *Signer:
+		signer := *r
+		signer.ID = 0
+		if !signer.isDeleted() {
+			signer.DeletedAt = gorm.DeletedAt{}
+		}
+		record = &signer
+	}
+	return s.db.Clauses(clause.OnConflict{Columns: recordKeys[kind], UpdateAll: true}).Create(record).Error
+}
+
 func (s *mysqlStore) Version() (uint64, error) {
 	var v StoreVersion
 	if err := s.db.Model(&StoreVersion{}).First(&v).Error; err != nil {
@@ -122,6 +122,20 @@ func TestMysqlStore(t *testing.T) {
 	t.Run("mysql unregister signer", wrapper(testMySQLUnregisterSigner, mySQLStore, mock))
 	t.Run("mysql delete signer", wrapper(testMySQLDeleteSigner, mySQLStore, mock))
 
+	// Signing key
+	t.Run("mysql put signing key", wrapper(testMySQLPutSigningKey, mySQLStore, mock))
+	t.Run("mysql list signing keys", wrapper(testMySQLListSigningKeys, mySQLStore, mock))
+
+	t.Run("mysql put role", wrapper(testMySQLPutRole, mySQLStore, mock))
+	t.Run("mysql list roles", wrapper(testMySQLListRoles, mySQLStore, mock))
+	t.Run("mysql delete role", wrapper(testMySQLDeleteRole, mySQLStore, mock))
+
+	t.Run("mysql use refresh token", wrapper(testMySQLUseRefreshToken, mySQLStore, mock))
+	t.Run("mysql revoke refresh tokens", wrapper(testMySQLRevokeRefreshTokens, mySQLStore, mock))
+
+	t.Run("mysql list audit logs", wrapper(testMySQLListAuditLogs, mySQLStore, mock))
+	t.Run("mysql last audit log", wrapper(testMySQLLastAuditLog, mySQLStore, mock))
+
 	// Version
 	t.Run("mysql get version", wrapper(testMySQLVersion, mySQLStore, mock))
 	t.Run("mysql migrate to v1", wrapper(testMySQLMigrateToV1, mySQLStore, mock))
@@ -144,8 +158,8 @@ func testMySQLPutToken(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmoc
 
 	mock.ExpectBegin()
 	mock.ExpectExec(regexp.QuoteMeta(
-		"INSERT INTO `token` (`name`,`perm`,`secret`,`extra`,`token`,`createTime`,`is_deleted`) VALUES (?,?,?,?,?,?,?)")).
-		WithArgs(kp.Name, kp.Perm, kp.Secret, kp.Extra, kp.Token, kp.CreateTime, kp.IsDeleted).
+		"INSERT INTO `token` (`name`,`perm`,`secret`,`extra`,`token`,`createTime`,`is_deleted`,`expire_time`,`delete_time`,`unsigned_token`) VALUES (?,?,?,?,?,?,?,?,?,?)")).
+		WithArgs(kp.Name, kp.Perm, kp.Secret, kp.Extra, kp.Token, kp.CreateTime, kp.IsDeleted, nil, nil, "").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
@@ -164,14 +178,14 @@ func testMySQLUpdateToken(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sql
 		IsDeleted:  0,
 	}
 
-	sql := "UPDATE `token` SET `createTime`=?,`extra`=?,`is_deleted`=?,`name`=?,`perm`=?,`secret`=?,`token`=? WHERE token = ?"
+	sql := "UPDATE `token` SET `createTime`=?,`delete_time`=?,`expire_time`=?,`extra`=?,`is_deleted`=?,`name`=?,`perm`=?,`secret`=?,`token`=?,`unsigned_token`=? WHERE token = ?"
 	sqlMockExpect(mock, sql, false,
-		kp.CreateTime, kp.Extra, kp.IsDeleted, kp.Name, kp.Perm, kp.Secret, kp.Token, kp.Token)
+		kp.CreateTime, nil, nil, kp.Extra, kp.IsDeleted, kp.Name, kp.Perm, kp.Secret, kp.Token, "", kp.Token)
 	err := mySQLStore.UpdateToken(kp)
 	assert.Nil(t, err)
 
 	sqlMockExpect(mock, sql, true,
-		kp.CreateTime, kp.Extra, kp.IsDeleted, kp.Name, kp.Perm, kp.Secret, kp.Token, kp.Token)
+		kp.CreateTime, nil, nil, kp.Extra, kp.IsDeleted, kp.Name, kp.Perm, kp.Secret, kp.Token, "", kp.Token)
 	assert.Error(t, mySQLStore.UpdateToken(kp))
 }
 
@@ -259,8 +273,8 @@ func testMySQLDeleteToken(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sql
 
 	mock.ExpectBegin()
 	mock.ExpectExec(regexp.QuoteMeta(
-		"UPDATE `token` SET `is_deleted`=? WHERE token=?")).
-		WithArgs(core.Deleted, token).
+		"UPDATE `token` SET `delete_time`=?,`is_deleted`=? WHERE token=?")).
+		WithArgs(anyTime{}, core.Deleted, token).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
@@ -291,8 +305,8 @@ func testMySQLRecoverToken(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sq
 
 	mock.ExpectBegin()
 	mock.ExpectExec(regexp.QuoteMeta(
-		"UPDATE `token` SET `is_deleted`=? WHERE token=?")).
-		WithArgs(core.NotDelete, token).
+		"UPDATE `token` SET `delete_time`=?,`is_deleted`=? WHERE token=?")).
+		WithArgs(nil, core.NotDelete, token).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
@@ -311,6 +325,136 @@ func testMySQLRecoverToken(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sq
 	assert.Equal(t, mySQLStore.Recover(token), gorm.ErrRecordNotFound)
 }
 
+func testMySQLPutSigningKey(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	key := &SigningKey{
+		Kid:        uuid.NewString(),
+		Alg:        "Ed25519",
+		PrivateKey: "d6234bf3f14a568a9c8315a6ee4f474e380beb2b65a64e6ba0142df72b454f4e",
+		CreateTime: time.Now(),
+	}
+
+	sql := "UPDATE `signing_keys` SET `alg`=?,`private_key`=?,`state`=?,`createTime`=?,`retire_time`=? WHERE `kid` = ?"
+	sqlMockExpect(mock, sql, false, key.Alg, key.PrivateKey, key.State, key.CreateTime, nil, key.Kid)
+	assert.Nil(t, mySQLStore.PutSigningKey(key))
+
+	sqlMockExpect(mock, sql, true, key.Alg, key.PrivateKey, key.State, key.CreateTime, nil, key.Kid)
+	assert.Error(t, mySQLStore.PutSigningKey(key))
+}
+
+func testMySQLListSigningKeys(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `signing_keys` ORDER BY `createTime`")).
+		WillReturnRows(sqlmock.NewRows([]string{"kid", "alg"}).AddRow("kid-01", "Ed25519").AddRow("kid-02", "ES256"))
+	keys, err := mySQLStore.ListSigningKeys()
+	assert.Nil(t, err)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, "kid-02", keys[1].Kid)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `signing_keys` ORDER BY `createTime`")).
+		WillReturnError(errSimulated)
+	_, err = mySQLStore.ListSigningKeys()
+	assert.Error(t, err)
+}
+
+func testMySQLUseRefreshToken(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	sql := "UPDATE `refresh_tokens` SET `used_time`=? WHERE token = ? AND used_time IS NULL"
+	now := time.Now()
+	sqlMockExpect(mock, sql, false, now, "refresh-01")
+	assert.Nil(t, mySQLStore.UseRefreshToken("refresh-01", now))
+
+	// used before
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(sql)).WithArgs(now, "refresh-01").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `refresh_tokens` WHERE token = ? LIMIT 1")).
+		WithArgs("refresh-01").
+		WillReturnRows(sqlmock.NewRows([]string{"token", "family"}).AddRow("refresh-01", "family-01"))
+	assert.ErrorIs(t, mySQLStore.UseRefreshToken("refresh-01", now), ErrRefreshTokenUsed)
+
+	// not found
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(sql)).WithArgs(now, "refresh-02").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `refresh_tokens` WHERE token = ? LIMIT 1")).
+		WithArgs("refresh-02").
+		WillReturnRows(sqlmock.NewRows([]string{"token", "family"}))
+	assert.ErrorIs(t, mySQLStore.UseRefreshToken("refresh-02", now), ErrRefreshTokenNotFound)
+}
+
+func testMySQLRevokeRefreshTokens(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	sql := "UPDATE `refresh_tokens` SET `revoked`=? WHERE family = ?"
+	sqlMockExpect(mock, sql, false, true, "family-01")
+	assert.Nil(t, mySQLStore.RevokeRefreshTokens("family-01"))
+
+	sqlMockExpect(mock, sql, true, true, "family-01")
+	assert.Error(t, mySQLStore.RevokeRefreshTokens("family-01"))
+}
+
+func testMySQLListAuditLogs(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	start := time.Now().Add(-time.Hour)
+	end := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `audit_logs` WHERE time >= ? AND time < ? AND (actor = ?) AND action = ? ORDER BY time LIMIT 10 OFFSET 10")).
+		WithArgs(start, end, "admin", "user.create").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "actor", "action"}).AddRow("audit-01", "admin", "user.create"))
+	logs, err := mySQLStore.ListAuditLogs(&AuditLogFilter{Start: start, End: end, Actor: "admin", Action: "user.create", Skip: 10, Limit: 10})
+	assert.Nil(t, err)
+	assert.Len(t, logs, 1)
+	assert.Equal(t, "audit-01", logs[0].Id)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `audit_logs` ORDER BY time")).WillReturnError(errSimulated)
+	_, err = mySQLStore.ListAuditLogs(&AuditLogFilter{})
+	assert.Error(t, err)
+}
+
+func testMySQLLastAuditLog(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	sql := regexp.QuoteMeta("SELECT * FROM `audit_logs` ORDER BY time desc LIMIT 1")
+	mock.ExpectQuery(sql).WillReturnRows(sqlmock.NewRows([]string{"id", "hash"}).AddRow("audit-01", "hash-01"))
+	entry, err := mySQLStore.LastAuditLog()
+	assert.Nil(t, err)
+	assert.Equal(t, "hash-01", entry.Hash)
+
+	mock.ExpectQuery(sql).WillReturnRows(sqlmock.NewRows([]string{"id", "hash"}))
+	_, err = mySQLStore.LastAuditLog()
+	assert.ErrorIs(t, err, ErrAuditLogNotFound)
+}
+
+func testMySQLPutRole(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	now := time.Now()
+	role := &Role{
+		Name:       "market-operator",
+		Perm:       core.PermWrite,
+		Scopes:     StringList{"market:write"},
+		CreateTime: now,
+		UpdateTime: now,
+	}
+
+	sql := "UPDATE `roles` SET `perm`=?,`scopes`=?,`comment`=?,`createTime`=?,`updateTime`=? WHERE `name` = ?"
+	sqlMockExpect(mock, sql, false, role.Perm, `["market:write"]`, role.Comment, role.CreateTime, role.UpdateTime, role.Name)
+	assert.Nil(t, mySQLStore.PutRole(role))
+
+	sqlMockExpect(mock, sql, true, role.Perm, `["market:write"]`, role.Comment, role.CreateTime, role.UpdateTime, role.Name)
+	assert.Error(t, mySQLStore.PutRole(role))
+}
+
+func testMySQLListRoles(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `roles` ORDER BY name")).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "perm", "scopes"}).
+			AddRow("market-operator", "write", `["market:write"]`).
+			AddRow("wallet-signer", "sign", `["wallet:sign"]`))
+	roles, err := mySQLStore.ListRoles()
+	assert.Nil(t, err)
+	assert.Len(t, roles, 2)
+	assert.Equal(t, StringList{"wallet:sign"}, roles[1].Scopes)
+}
+
+func testMySQLDeleteRole(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
+	sql := "DELETE FROM `roles` WHERE name = ?"
+	sqlMockExpect(mock, sql, false, "market-operator")
+	assert.Nil(t, mySQLStore.DelRole("market-operator"))
+
+	sqlMockExpect(mock, sql, true, "market-operator")
+	assert.Error(t, mySQLStore.DelRole("market-operator"))
+}
+
 func testMySQLPutUser(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock) {
 	now := time.Now()
 	user := &User{
@@ -320,13 +464,13 @@ func testMySQLPutUser(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmock
 		CreateTime: now,
 	}
 
-	sql := "INSERT INTO `users` (`id`,`name`,`comment`,`state`,`createTime`,`updateTime`,`is_deleted`) VALUES (?,?,?,?,?,?,?)"
+	sql := "INSERT INTO `users` (`id`,`name`,`comment`,`state`,`createTime`,`updateTime`,`is_deleted`,`rate_limit_tier`) VALUES (?,?,?,?,?,?,?,?)"
 	sqlMockExpect(mock, sql, false,
-		user.Id, user.Name, user.Comment, user.State, user.CreateTime, user.UpdateTime, user.IsDeleted)
+		user.Id, user.Name, user.Comment, user.State, user.CreateTime, user.UpdateTime, user.IsDeleted, user.RateLimitTier)
 	assert.Nil(t, mySQLStore.PutUser(user))
 
 	sqlMockExpect(mock, sql, true,
-		user.Id, user.Name, user.Comment, user.State, user.CreateTime, user.UpdateTime, user.IsDeleted)
+		user.Id, user.Name, user.Comment, user.State, user.CreateTime, user.UpdateTime, user.IsDeleted, user.RateLimitTier)
 	assert.Error(t, mySQLStore.PutUser(user))
 }
 
@@ -340,15 +484,15 @@ func testMySQLUpdateUser(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlm
 		IsDeleted:  core.NotDelete,
 	}
 
-	sql := "UPDATE `users` SET `name`=?,`comment`=?,`state`=?,`createTime`=?,`updateTime`=?,`is_deleted`=? WHERE `id` = ?"
+	sql := "UPDATE `users` SET `name`=?,`comment`=?,`state`=?,`createTime`=?,`updateTime`=?,`is_deleted`=?,`rate_limit_tier`=? WHERE `id` = ?"
 
 	sqlMockExpect(mock, sql, false,
-		user.Name, user.Comment, user.State, user.CreateTime, user.UpdateTime, user.IsDeleted, user.Id)
+		user.Name, user.Comment, user.State, user.CreateTime, user.UpdateTime, user.IsDeleted, user.RateLimitTier, user.Id)
 	err := mySQLStore.UpdateUser(user)
 	assert.Nil(t, err)
 
 	sqlMockExpect(mock, sql, true,
-		user.Name, user.Comment, user.State, user.CreateTime, user.UpdateTime, user.IsDeleted, user.Id)
+		user.Name, user.Comment, user.State, user.CreateTime, user.UpdateTime, user.IsDeleted, user.RateLimitTier, user.Id)
 	err = mySQLStore.UpdateUser(user)
 	assert.Error(t, err)
 }
@@ -415,7 +559,7 @@ func testMySQLDeleteUser(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlm
 		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow(user))
 
 	mock.ExpectQuery(regexp.QuoteMeta(
-		"SELECT * FROM `miners` WHERE user = ? AND `miners`.`deleted_at` IS NULL")).
+		"SELECT * FROM `miners` WHERE `user` = ? AND `miners`.`deleted_at` IS NULL")).
 		WithArgs(user).
 		// TODO: name "miner": non-string types unsupported
 		WillReturnRows(sqlmock.NewRows([]string{"aa"}).AddRow("f01222345678999"))
@@ -431,8 +575,8 @@ func testMySQLDeleteUser(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlm
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	mock.ExpectExec(regexp.QuoteMeta(""+
-		"INSERT INTO `users` (`id`,`name`,`comment`,`state`,`createTime`,`updateTime`,`is_deleted`) VALUES (?,?,?,?,?,?,?)")).
-		WithArgs("", user, "", 0, anyTime{}, anyTime{}, 1).
+		"INSERT INTO `users` (`id`,`name`,`comment`,`state`,`createTime`,`updateTime`,`is_deleted`,`rate_limit_tier`) VALUES (?,?,?,?,?,?,?,?)")).
+		WithArgs("", user, "", 0, anyTime{}, anyTime{}, 1, "").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	mock.ExpectCommit()
@@ -463,6 +607,7 @@ func testMySQLPutRateLimits(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.S
 		Name:    "name",
 		Service: "service",
 		API:     "",
+		Token:   "0123456789abcdef",
 		ReqLimit: ReqLimit{
 			Cap:      1,
 			ResetDur: 10,
@@ -471,8 +616,8 @@ func testMySQLPutRateLimits(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.S
 
 	mock.ExpectBegin()
 	mock.ExpectExec(regexp.QuoteMeta(
-		"UPDATE `user_rate_limits` SET `name`=?,`service`=?,`api`=?,`reqLimit`=? WHERE `id` = ?")).
-		WithArgs(rateLimit.Name, rateLimit.Service, rateLimit.API, rateLimit.ReqLimit, rateLimit.Id).
+		"UPDATE `user_rate_limits` SET `name`=?,`service`=?,`api`=?,`reqLimit`=?,`quota`=?,`token`=? WHERE `id` = ?")).
+		WithArgs(rateLimit.Name, rateLimit.Service, rateLimit.API, rateLimit.ReqLimit, rateLimit.Quota, rateLimit.Token, rateLimit.Id).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
@@ -515,7 +660,7 @@ func testMySQLMinerExistInUser(t *testing.T, mySQLStore *mysqlStore, mock sqlmoc
 	assert.Nil(t, err)
 
 	mock.ExpectQuery(regexp.QuoteMeta(
-		"SELECT count(*) FROM `miners` WHERE miner = ? AND user = ? AND deleted_at IS NULL")).
+		"SELECT count(*) FROM `miners` WHERE miner = ? AND `user` = ? AND deleted_at IS NULL")).
 		WithArgs(storedAddress(addr), "test").
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
 
@@ -531,7 +676,7 @@ func testMySQLGetUserByMiner(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.
 	userId := "id"
 
 	mock.ExpectQuery(regexp.QuoteMeta(
-		"SELECT users.* FROM `miners` inner join users on miners.`miner` = ? and users.`name` = miners.`user` and users.`is_deleted` = ? WHERE `miners`.`deleted_at` IS NULL")).
+		"SELECT users.* FROM `miners` inner join users on miners.miner = ? and users.name = `miners`.`user` and users.is_deleted = ? WHERE `miners`.`deleted_at` IS NULL")).
 		WithArgs(storedAddress(addr), core.NotDelete).
 		WillReturnRows(sqlmock.NewRows([]string{"name", "id"}).AddRow(userName, userId))
 
@@ -545,7 +690,7 @@ func testMySQLListMiner(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmo
 	userName := "user_name"
 
 	mock.ExpectQuery(regexp.QuoteMeta(
-		"SELECT * FROM `miners` WHERE user = ? AND `miners`.`deleted_at` IS NULL")).
+		"SELECT * FROM `miners` WHERE `user` = ? AND `miners`.`deleted_at` IS NULL")).
 		WithArgs(userName).
 		WillReturnRows(sqlmock.NewRows([]string{"user"}).
 			AddRow(userName).AddRow(userName))
@@ -610,7 +755,7 @@ func testMySQLRegisterSigner(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.
 	mockUser := "user"
 	mock.ExpectBegin()
 	mock.ExpectQuery(regexp.QuoteMeta(
-		"SELECT * FROM `users` WHERE `name` = ? ORDER BY `users`.`id` LIMIT 1")).
+		"SELECT * FROM `users` WHERE name = ? ORDER BY `users`.`id` LIMIT 1")).
 		WithArgs(mockUser).
 		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow(mockUser))
 
@@ -633,7 +778,7 @@ func testMySQLSignerExistInUser(t *testing.T, mySQLStore *mysqlStore, mock sqlmo
 
 	mockUser := "user"
 	mock.ExpectQuery(regexp.QuoteMeta(
-		"SELECT count(*) FROM `signers` WHERE `signer` = ? AND `user` = ? AND deleted_at IS NULL")).
+		"SELECT count(*) FROM `signers` WHERE signer = ? AND `user` = ? AND deleted_at IS NULL")).
 		WithArgs(storedAddress(addr), mockUser).
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
 
@@ -662,7 +807,7 @@ func testMySQLHasSigner(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sqlmo
 	assert.Nil(t, err)
 
 	mock.ExpectQuery(regexp.QuoteMeta(
-		"SELECT count(*) FROM `signers` WHERE `signer` = ? AND deleted_at IS NULL")).
+		"SELECT count(*) FROM `signers` WHERE signer = ? AND deleted_at IS NULL")).
 		WithArgs(storedAddress(addr)).
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
 
@@ -677,7 +822,7 @@ func testMySQLGetUserBySigner(t *testing.T, mySQLStore *mysqlStore, mock sqlmock
 	userName := "name"
 
 	mock.ExpectQuery(regexp.QuoteMeta(
-		"SELECT users.* FROM `signers` inner join users on signers.`signer` = ? and users.`name` = signers.`user` and users.`is_deleted` = ? WHERE `signers`.`deleted_at` IS NULL")).
+		"SELECT users.* FROM `signers` inner join users on signers.signer = ? and users.name = `signers`.`user` and users.is_deleted = ? WHERE `signers`.`deleted_at` IS NULL")).
 		WithArgs(storedAddress(addr), core.NotDelete).
 		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow(userName))
 
@@ -694,7 +839,7 @@ func testMySQLUnregisterSigner(t *testing.T, mySQLStore *mysqlStore, mock sqlmoc
 
 	mock.ExpectBegin()
 	mock.ExpectExec(regexp.QuoteMeta(
-		"UPDATE `signers` SET `deleted_at`=? WHERE (`signer` = ? AND `user` = ?) AND `signers`.`deleted_at` IS NULL")).
+		"UPDATE `signers` SET `deleted_at`=? WHERE (signer = ? AND `user` = ?) AND `signers`.`deleted_at` IS NULL")).
 		WithArgs(anyTime{}, storedAddress(addr), userName).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
@@ -709,7 +854,7 @@ func testMySQLDeleteSigner(t *testing.T, mySQLStore *mysqlStore, mock sqlmock.Sq
 
 	mock.ExpectBegin()
 	mock.ExpectExec(regexp.QuoteMeta(
-		"UPDATE `signers` SET `deleted_at`=? WHERE `signer` = ? AND `signers`.`deleted_at` IS NULL")).
+		"UPDATE `signers` SET `deleted_at`=? WHERE signer = ? AND `signers`.`deleted_at` IS NULL")).
 		WithArgs(anyTime{}, storedAddress(addr)).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
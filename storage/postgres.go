@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+)
+
+// postgresStore shares the models and queries of mysqlStore, the column types and migrations
+// specific to mysql are translated for postgres.
+type postgresStore struct {
+	*mysqlStore
+}
+
+func newPostgresStore(cnf *config.DBConfig) (Store, error) {
+	db, err := gorm.Open(&postgresDialector{Dialector: postgres.Open(cnf.DSN).(*postgres.Dialector)})
+	if err != nil {
+		return nil, xerrors.Errorf("[db connection failed] Database name: %s %w", cnf.DSN, err)
+	}
+	if cnf.Debug {
+		db = db.Debug()
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(cnf.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cnf.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cnf.MaxLifeTime)
+	sqlDB.SetConnMaxIdleTime(cnf.MaxIdleTime)
+
+	if err = autoMigrate(db.Session(&gorm.Session{})); err != nil {
+		return nil, err
+	}
+	return &postgresStore{mysqlStore: &mysqlStore{db: db}}, nil
+}
+
+// MigrateToV3 is the postgres version of `mysqlStore.MigrateToV3`, which changes the primary key of `miners` to `id`
+func (s *postgresStore) MigrateToV3() error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if bHas := tx.Migrator().HasColumn(&Miner{}, "ID"); !bHas {
+			for _, ddl := range []string{
+				`alter table "miners" drop constraint if exists "miners_pkey"`,
+				`alter table "miners" add column "id" bigserial primary key`,
+				// normal index to unique index
+				`drop index if exists "user_miner_idx"`,
+				`create unique index "miner_idx" on "miners" ("miner")`,
+			} {
+				if err := tx.Exec(ddl).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return tx.Model(&StoreVersion{}).
+			Clauses(clause.OnConflict{UpdateAll: true}).
+			Create(&StoreVersion{ID: 1, Version: 3}).Error
+	})
+}
+
+// postgresDialector translates the mysql column types of models, eg. `tinyint(4)` and `datetime`
+type postgresDialector struct {
+	*postgres.Dialector
+}
+
+func (d *postgresDialector) DataTypeOf(field *schema.Field) string {
+	dataType := d.Dialector.DataTypeOf(field)
+	lower := strings.ToLower(dataType)
+	switch {
+	case strings.HasPrefix(lower, "tinyint"):
+		return "smallint"
+	case lower == "datetime" || strings.HasPrefix(lower, "datetime("):
+		return "timestamptz"
+	}
+	return dataType
+}
+
+func (d *postgresDialector) Migrator(db *gorm.DB) gorm.Migrator {
+	m := d.Dialector.Migrator(db).(postgres.Migrator)
+	m.Dialector = d
+	return postgresMigrator{Migrator: m}
+}
+
+type postgresMigrator struct {
+	postgres.Migrator
+}
+
+// CreateIndex ignores the index types of models, which are written for mysql, eg. postgres doesn't support unique hash indexes
+func (m postgresMigrator) CreateIndex(value interface{}, name string) error {
+	return m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		idx := stmt.Schema.LookIndex(name)
+		if idx == nil {
+			return fmt.Errorf("failed to create index with name %v", name)
+		}
+		opts := m.BuildIndexOptions(idx.Fields, stmt)
+		values := []interface{}{clause.Column{Name: idx.Name}, m.CurrentTable(stmt), opts}
+
+		createIndexSQL := "CREATE "
+		if idx.Class != "" {
+			createIndexSQL += idx.Class + " "
+		}
+		createIndexSQL += "INDEX ? ON ??"
+		if idx.Where != "" {
+			createIndexSQL += " WHERE " + idx.Where
+		}
+		return m.DB.Exec(createIndexSQL, values...).Error
+	})
+}
@@ -0,0 +1,104 @@
+// stm: #unit
+package storage
+
+import (
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"github.com/ipfs-force-community/sophon-auth/core"
+)
+
+// TestPostgresStore checks the sql specific to postgres, run `TestStore` with `-db=postgres -dns=<dsn>`
+// against a local postgres for the whole suite.
+func TestPostgresStore(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	dialector := &postgresDialector{Dialector: postgres.New(postgres.Config{Conn: sqlDB}).(*postgres.Dialector)}
+	gormDB, err := gorm.Open(dialector, &gorm.Config{})
+	require.NoError(t, err)
+	pgStore := &postgresStore{mysqlStore: &mysqlStore{db: gormDB.Debug()}}
+
+	t.Run("column types", func(t *testing.T) {
+		s, err := schema.Parse(&User{}, &sync.Map{}, schema.NamingStrategy{})
+		require.NoError(t, err)
+		assert.Equal(t, "smallint", dialector.DataTypeOf(s.LookUpField("State")))
+		assert.Equal(t, "timestamptz", dialector.DataTypeOf(s.LookUpField("CreateTime")))
+
+		s, err = schema.Parse(&AuditLog{}, &sync.Map{}, schema.NamingStrategy{})
+		require.NoError(t, err)
+		assert.Equal(t, "timestamptz", dialector.DataTypeOf(s.LookUpField("Time")))
+		assert.Equal(t, "varchar(64)", dialector.DataTypeOf(s.LookUpField("Hash")))
+	})
+
+	t.Run("quote keywords", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "miners" WHERE "user" = $1 AND "miners"."deleted_at" IS NULL`)).
+			WithArgs("test-user").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user"}))
+		_, err := pgStore.ListMiners("test-user")
+		assert.Nil(t, err)
+
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE state=$1 AND is_deleted=$2 ORDER BY "createTime" LIMIT 10`)).
+			WithArgs(core.UserStateEnabled, core.NotDelete).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+		_, err = pgStore.ListUsers(0, 10, core.UserStateEnabled)
+		assert.Nil(t, err)
+	})
+
+	t.Run("scan text columns", func(t *testing.T) {
+		// pgx returns varchar columns as string
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "user_rate_limits" WHERE name = $1`)).
+			WithArgs("test-user").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "service", "api", "reqLimit", "quota", "token"}).
+				AddRow("limit-01", "test-user", "market", "", `{"Cap":10,"ResetDur":60000000000}`, `{"daily":5}`, "").
+				AddRow("limit-02", "test-user", "", "", nil, nil, nil))
+		limits, err := pgStore.GetRateLimits("test-user", "")
+		require.NoError(t, err)
+		require.Len(t, limits, 2)
+		assert.Equal(t, ReqLimit{Cap: 10, ResetDur: time.Minute}, limits[0].ReqLimit)
+		assert.Equal(t, Quota{Daily: 5}, limits[0].Quota)
+		assert.Equal(t, ReqLimit{}, limits[1].ReqLimit)
+		assert.Equal(t, Quota{}, limits[1].Quota)
+	})
+
+	t.Run("index types", func(t *testing.T) {
+		mock.ExpectExec(regexp.QuoteMeta(`CREATE UNIQUE INDEX "token_token_IDX" ON "token"("token")`)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		assert.Nil(t, gormDB.Migrator().CreateIndex(&KeyPair{}, "token_token_IDX"))
+		mock.ExpectExec(regexp.QuoteMeta(`CREATE UNIQUE INDEX "users_name_IDX" ON "users"("name")`)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		assert.Nil(t, gormDB.Migrator().CreateIndex(&User{}, "users_name_IDX"))
+	})
+
+	t.Run("migrate to v3", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM INFORMATION_SCHEMA.columns WHERE table_schema = CURRENT_SCHEMA() AND table_name = $1 AND column_name = $2")).
+			WithArgs("miners", "id").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		for _, ddl := range []string{
+			`alter table "miners" drop constraint if exists "miners_pkey"`,
+			`alter table "miners" add column "id" bigserial primary key`,
+			`drop index if exists "user_miner_idx"`,
+			`create unique index "miner_idx" on "miners" ("miner")`,
+		} {
+			mock.ExpectExec(regexp.QuoteMeta(ddl)).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "store_versions" ("version","id") VALUES ($1,$2) ON CONFLICT ("id") DO UPDATE SET "version"="excluded"."version" RETURNING "id"`)).
+			WithArgs(3, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectCommit()
+		assert.Nil(t, pgStore.MigrateToV3())
+	})
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+	mock.ExpectClose()
+	assert.Nil(t, sqlDB.Close())
+}
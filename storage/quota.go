@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// QuotaPeriod is the calendar window of a quota, windows are aligned to days or months in UTC
+type QuotaPeriod = string
+
+const (
+	QuotaDaily   QuotaPeriod = "daily"
+	QuotaMonthly QuotaPeriod = "monthly"
+)
+
+// QuotaPeriods are all periods of quotas
+var QuotaPeriods = []QuotaPeriod{QuotaDaily, QuotaMonthly}
+
+const (
+	dailyWindowLayout   = "2006-01-02"
+	monthlyWindowLayout = "2006-01"
+)
+
+// Quota caps the requests in calendar windows besides the cap of `ReqLimit`, 0 means no quota of the period
+type Quota struct {
+	Daily   int64 `json:"daily"`
+	Monthly int64 `json:"monthly"`
+}
+
+// Cap returns the quota of period
+func (q Quota) Cap(period QuotaPeriod) int64 {
+	switch period {
+	case QuotaDaily:
+		return q.Daily
+	case QuotaMonthly:
+		return q.Monthly
+	}
+	return 0
+}
+
+func (q Quota) IsEmpty() bool {
+	return q.Daily <= 0 && q.Monthly <= 0
+}
+
+func (q *Quota) Scan(value interface{}) error {
+	var buf []byte
+	switch v := value.(type) {
+	case []byte:
+		buf = v
+	case string:
+		buf = []byte(v)
+	case nil:
+	default:
+		return xerrors.Errorf("failed to unmarshal quota: %v", value)
+	}
+	if len(buf) == 0 {
+		*q = Quota{}
+		return nil
+	}
+	return json.Unmarshal(buf, q)
+}
+
+func (q Quota) Value() (driver.Value, error) {
+	return json.Marshal(q)
+}
+
+// QuotaWindow returns the window of period containing t, eg. "2026-10-17" for daily and "2026-10" for monthly
+func QuotaWindow(period QuotaPeriod, t time.Time) string {
+	if period == QuotaMonthly {
+		return t.UTC().Format(monthlyWindowLayout)
+	}
+	return t.UTC().Format(dailyWindowLayout)
+}
+
+// ParseQuotaWindow returns the period and the time range [start, end) of window
+func ParseQuotaWindow(window string) (QuotaPeriod, time.Time, time.Time, error) {
+	if start, err := time.Parse(dailyWindowLayout, window); err == nil {
+		return QuotaDaily, start, start.AddDate(0, 0, 1), nil
+	}
+	if start, err := time.Parse(monthlyWindowLayout, window); err == nil {
+		return QuotaMonthly, start, start.AddDate(0, 1, 0), nil
+	}
+	return "", time.Time{}, time.Time{}, fmt.Errorf("invalid quota window %q, expect yyyy-mm-dd or yyyy-mm", window)
+}
+
+// QuotaUsage is the requests of a user taken from the quota of a rate limit in a window
+type QuotaUsage struct {
+	Name    string      `gorm:"column:name;type:varchar(50);primary_key"`
+	LimitID string      `gorm:"column:limit_id;type:varchar(64);primary_key"`
+	Period  QuotaPeriod `gorm:"column:period;type:varchar(16);primary_key"`
+	Window  string      `gorm:"column:quota_window;type:varchar(16);primary_key"`
+	Used    int64       `gorm:"column:used;NOT NULL"`
+}
+
+func (*QuotaUsage) TableName() string {
+	return "quota_usages"
+}
+
+func (u *QuotaUsage) key() []byte {
+	return quotaUsageKey(u.Name, u.Period, u.Window, u.LimitID)
+}
+
+func (u *QuotaUsage) Bytes() ([]byte, error) {
+	return json.Marshal(u)
+}
+
+func (u *QuotaUsage) FromBytes(buf []byte) error {
+	return json.Unmarshal(buf, u)
+}
@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaWindow(t *testing.T) {
+	now := time.Date(2023, 12, 31, 23, 30, 0, 0, time.FixedZone("UTC-1", -3600))
+	assert.Equal(t, "2024-01-01", QuotaWindow(QuotaDaily, now))
+	assert.Equal(t, "2024-01", QuotaWindow(QuotaMonthly, now))
+
+	period, start, end, err := ParseQuotaWindow("2024-02-28")
+	require.NoError(t, err)
+	assert.Equal(t, QuotaDaily, period)
+	assert.Equal(t, time.Date(2024, 2, 28, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), end)
+
+	period, start, end, err = ParseQuotaWindow("2024-12")
+	require.NoError(t, err)
+	assert.Equal(t, QuotaMonthly, period)
+	assert.Equal(t, time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), end)
+
+	for _, window := range []string{"", "2024", "2024-13", "2024-02-30", "24-01-01"} {
+		_, _, _, err = ParseQuotaWindow(window)
+		assert.Error(t, err, window)
+	}
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrRateLimitTierNotFound is returned by `GetRateLimitTier` and `DelRateLimitTier` if the tier doesn't exist
+var ErrRateLimitTierNotFound = xerrors.New("rate limit tier not found")
+
+// RateLimitRule is a rate limit of a tier, which is inherited by all members of the tier
+type RateLimitRule struct {
+	Id       string
+	Service  string
+	API      string
+	ReqLimit ReqLimit
+	Quota    Quota
+}
+
+// Limit returns the rate limit of user `name` inherited from the rule of tier
+func (r *RateLimitRule) Limit(name, tier string) *UserRateLimit {
+	return &UserRateLimit{
+		Id:       r.Id,
+		Name:     name,
+		Service:  r.Service,
+		API:      r.API,
+		ReqLimit: r.ReqLimit,
+		Quota:    r.Quota,
+		Tier:     tier,
+	}
+}
+
+type RateLimitRules []*RateLimitRule
+
+func (rs *RateLimitRules) Scan(value interface{}) error {
+	var buf []byte
+	switch v := value.(type) {
+	case []byte:
+		buf = v
+	case string:
+		buf = []byte(v)
+	case nil:
+	default:
+		return xerrors.Errorf("failed to unmarshal rate limit rules: %v", value)
+	}
+	if len(buf) == 0 {
+		*rs = nil
+		return nil
+	}
+	return json.Unmarshal(buf, rs)
+}
+
+func (rs RateLimitRules) Value() (driver.Value, error) {
+	if rs == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(rs)
+	return string(b), err
+}
+
+// RateLimitTier is a named set of rate limits, users referring to it by `User.RateLimitTier` inherit its rules
+type RateLimitTier struct {
+	Name       string         `gorm:"column:name;type:varchar(50);primary_key"`
+	Rules      RateLimitRules `gorm:"column:rules;type:text"`
+	Comment    string         `gorm:"column:comment;type:varchar(255);"`
+	CreateTime time.Time      `gorm:"column:createTime;type:datetime;NOT NULL"`
+	UpdateTime time.Time      `gorm:"column:updateTime;type:datetime;NOT NULL"`
+}
+
+func (*RateLimitTier) TableName() string {
+	return "rate_limit_tiers"
+}
+
+func (t *RateLimitTier) key() []byte {
+	return rateLimitTierKey(t.Name)
+}
+
+func (t *RateLimitTier) Bytes() ([]byte, error) {
+	return json.Marshal(t)
+}
+
+func (t *RateLimitTier) FromBytes(buf []byte) error {
+	return json.Unmarshal(buf, t)
+}
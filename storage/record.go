@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"fmt"
+
+	"golang.org/x/xerrors"
+)
+
+// RecordKind is a kind of records kept in store, the type of records of each kind is:
+//
+//	RecordUser:         *User
+//	RecordToken:        *KeyPair
+//	RecordMiner:        *Miner
+//	RecordSigner:       *Signer
+//	RecordRateLimit:    *UserRateLimit
+//	RecordSigningKey:   *SigningKey
+//	RecordRole:         *Role
+//	RecordRefreshToken: *RefreshToken
+//	RecordAuditLog:     *AuditLog
+//	RecordQuotaUsage:   *QuotaUsage
+//	RecordTier:         *RateLimitTier
+type RecordKind string
+
+const (
+	RecordUser         RecordKind = "user"
+	RecordToken        RecordKind = "token"
+	RecordMiner        RecordKind = "miner"
+	RecordSigner       RecordKind = "signer"
+	RecordRateLimit    RecordKind = "ratelimit"
+	RecordSigningKey   RecordKind = "signingkey"
+	RecordRole         RecordKind = "role"
+	RecordRefreshToken RecordKind = "refreshtoken"
+	RecordAuditLog     RecordKind = "auditlog"
+	RecordQuotaUsage   RecordKind = "quotausage"
+	RecordTier         RecordKind = "ratelimittier"
+)
+
+// RecordKinds are all kinds of records, users come first because other records refer to them.
+// Rate limit buckets are left out on purpose: they only hold the budget used in the current window,
+// which is reset in a duration at most, so a dumped or copied store starts with full budgets.
+var RecordKinds = []RecordKind{
+	RecordUser,
+	RecordToken,
+	RecordMiner,
+	RecordSigner,
+	RecordRateLimit,
+	RecordSigningKey,
+	RecordRole,
+	RecordRefreshToken,
+	RecordAuditLog,
+	RecordQuotaUsage,
+	RecordTier,
+}
+
+// NewRecord returns a new empty record of kind
+func NewRecord(kind RecordKind) (interface{}, error) {
+	switch kind {
+	case RecordUser:
+		return new(User), nil
+	case RecordToken:
+		return new(KeyPair), nil
+	case RecordMiner:
+		return new(Miner), nil
+	case RecordSigner:
+		return new(Signer), nil
+	case RecordRateLimit:
+		return new(UserRateLimit), nil
+	case RecordSigningKey:
+		return new(SigningKey), nil
+	case RecordRole:
+		return new(Role), nil
+	case RecordRefreshToken:
+		return new(RefreshToken), nil
+	case RecordAuditLog:
+		return new(AuditLog), nil
+	case RecordQuotaUsage:
+		return new(QuotaUsage), nil
+	case RecordTier:
+		return new(RateLimitTier), nil
+	}
+	return nil, fmt.Errorf("unknown record kind %q", kind)
+}
+
+// checkRecord returns an error if record is not the type of kind
+func checkRecord(kind RecordKind, record interface{}) error {
+	var match bool
+	switch record.(type) {
+	case *User:
+		match = kind == RecordUser
+	case *KeyPair:
+		match = kind == RecordToken
+	case *Miner:
+		match = kind == RecordMiner
+	case *Signer:
+		match = kind == RecordSigner
+	case *UserRateLimit:
+		match = kind == RecordRateLimit
+	case *SigningKey:
+		match = kind == RecordSigningKey
+	case *Role:
+		match = kind == RecordRole
+	case *RefreshToken:
+		match = kind == RecordRefreshToken
+	case *AuditLog:
+		match = kind == RecordAuditLog
+	case *QuotaUsage:
+		match = kind == RecordQuotaUsage
+	case *RateLimitTier:
+		match = kind == RecordTier
+	}
+	if !match {
+		return fmt.Errorf("unexpected %T for %s record", record, kind)
+	}
+	return nil
+}
+
+// recordKey identifies a record among records of the same kind
+func recordKey(record interface{}) string {
+	switch r := record.(type) {
+	case *User:
+		return r.Name
+	case *KeyPair:
+		// tokens may be stored by hash in one store but not in another
+		return HashToken(r.Token).String()
+	case *Miner:
+		return r.Miner.Address().String()
+	case *Signer:
+		return r.Signer.Address().String() + ":" + r.User
+	case *UserRateLimit:
+		return r.Id
+	case *SigningKey:
+		return r.Kid
+	case *Role:
+		return r.Name
+	case *RefreshToken:
+		return r.Token
+	case *AuditLog:
+		return r.Id
+	case *QuotaUsage:
+		return string(r.key())
+	case *RateLimitTier:
+		return r.Name
+	}
+	return ""
+}
+
+// copyCheckpointInterval is how many records are copied between two checkpoints
+const copyCheckpointInterval = 1000
+
+// CopyProgress is the count of records of each kind copied so far. Records are walked in a
+// stable order, so an interrupted copy can be resumed by skipping the copied ones, as long as
+// the source store is not modified in between.
+type CopyProgress map[RecordKind]int64
+
+// CopyRecords copies all records from `from` to `to` as they are, records counted in `progress`
+// are skipped. `progress` is updated as records are copied and passed to `checkpoint` regularly,
+// which should persist it to resume later.
+func CopyRecords(from, to Store, progress CopyProgress, checkpoint func(CopyProgress) error) error {
+	for _, kind := range RecordKinds {
+		skip := progress[kind]
+		var walked int64
+		err := from.WalkRecords(kind, func(record interface{}) error {
+			walked++
+			if walked <= skip {
+				return nil
+			}
+			if err := to.RestoreRecord(kind, record); err != nil {
+				return err
+			}
+			progress[kind] = walked
+			if walked%copyCheckpointInterval == 0 {
+				return checkpoint(progress)
+			}
+			return nil
+		})
+		if err != nil {
+			return xerrors.Errorf("copy %s records: %w", kind, err)
+		}
+		progress[kind] = walked
+		if err := checkpoint(progress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CountRecords returns the count of records of each kind in store, soft-deleted ones included
+func CountRecords(store Store) (map[RecordKind]int64, error) {
+	counts := make(map[RecordKind]int64, len(RecordKinds))
+	for _, kind := range RecordKinds {
+		var count int64
+		if err := store.WalkRecords(kind, func(interface{}) error {
+			count++
+			return nil
+		}); err != nil {
+			return nil, xerrors.Errorf("count %s records: %w", kind, err)
+		}
+		counts[kind] = count
+	}
+	return counts, nil
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+	"github.com/ipfs-force-community/sophon-auth/core"
+)
+
+func fillRecords(t *testing.T, store Store) {
+	now := time.Now().Truncate(time.Second)
+	for _, name := range []string{"copy_user_01", "copy_user_02"} {
+		require.NoError(t, store.PutUser(&User{Id: "id-" + name, Name: name, CreateTime: now, UpdateTime: now}))
+	}
+	require.NoError(t, store.DeleteUser("copy_user_02"))
+
+	for idx, name := range []string{"copy-token-01", "copy-token-02"} {
+		require.NoError(t, store.Put(&KeyPair{Name: name, Perm: core.PermRead, Secret: "secret",
+			Token: Token("jwt." + name), CreateTime: now.Add(time.Duration(idx) * time.Second)}))
+	}
+	require.NoError(t, store.Delete("jwt.copy-token-02"))
+
+	for _, miner := range []string{"t01000", "t01001"} {
+		mAddr, err := address.NewFromString(miner)
+		require.NoError(t, err)
+		_, err = store.UpsertMiner(mAddr, "copy_user_01", nil)
+		require.NoError(t, err)
+	}
+	mAddr, _ := address.NewFromString("t01001")
+	_, err := store.DelMiner(mAddr)
+	require.NoError(t, err)
+
+	signer, err := address.NewFromString("t1mpvdqt2acgihevibd4greavlsfn3dfph5sckc2a")
+	require.NoError(t, err)
+	require.NoError(t, store.RegisterSigner(signer, "copy_user_01"))
+
+	_, err = store.PutRateLimit(&UserRateLimit{Id: "limit-01", Name: "copy_user_01", ReqLimit: ReqLimit{Cap: 10, ResetDur: time.Minute}})
+	require.NoError(t, err)
+	require.NoError(t, store.PutSigningKey(&SigningKey{Kid: "kid-01", Alg: "HS256", PrivateKey: "00", CreateTime: now}))
+	require.NoError(t, store.PutRole(&Role{Name: "copy-role", Perm: core.PermRead, CreateTime: now, UpdateTime: now}))
+	require.NoError(t, store.PutRefreshToken(&RefreshToken{Token: "refresh-01", Family: "family-01", Name: "copy_user_01",
+		CreateTime: now}))
+	require.NoError(t, store.PutAuditLog(&AuditLog{Id: "audit-01", Time: now, Action: "user.create", Result: "success"}))
+	require.NoError(t, store.AddQuotaUsages([]*QuotaUsage{{Name: "copy_user_01", LimitID: "limit-01", Period: QuotaMonthly,
+		Window: QuotaWindow(QuotaMonthly, now), Used: 10}}))
+	require.NoError(t, store.PutRateLimitTier(&RateLimitTier{Name: "copy-tier", Rules: RateLimitRules{
+		{Id: "rule-01", Service: "market", ReqLimit: ReqLimit{Cap: 10, ResetDur: time.Minute}}}, CreateTime: now, UpdateTime: now}))
+}
+
+func TestCopyRecords(t *testing.T) {
+	from, err := NewStore(&config.DBConfig{Type: config.Badger}, t.TempDir())
+	require.NoError(t, err)
+	fillRecords(t, from)
+	counts, err := CountRecords(from)
+	require.NoError(t, err)
+	require.Equal(t, map[RecordKind]int64{
+		RecordUser: 2, RecordToken: 2, RecordMiner: 2, RecordSigner: 1, RecordRateLimit: 1,
+		RecordSigningKey: 1, RecordRole: 1, RecordRefreshToken: 1, RecordAuditLog: 1,
+		RecordQuotaUsage: 1, RecordTier: 1,
+	}, counts)
+
+	to, err := NewStore(&config.DBConfig{Type: config.Sqlite}, t.TempDir())
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, closeSQLiteStore(to.(*sqliteStore)))
+	}()
+
+	// resume a copy which was interrupted after copying users
+	progress := CopyProgress{RecordUser: 2}
+	var checkpoints int
+	require.NoError(t, CopyRecords(from, to, progress, func(CopyProgress) error {
+		checkpoints++
+		return nil
+	}))
+	require.Equal(t, len(RecordKinds), checkpoints)
+	require.Equal(t, CopyProgress(counts), progress)
+
+	toCounts, err := CountRecords(to)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), toCounts[RecordUser], "skipped records should not be copied")
+	require.Equal(t, counts[RecordMiner], toCounts[RecordMiner])
+
+	// copy again from scratch, records are overwritten
+	require.NoError(t, CopyRecords(from, to, CopyProgress{}, func(CopyProgress) error { return nil }))
+	toCounts, err = CountRecords(to)
+	require.NoError(t, err)
+	require.Equal(t, counts, toCounts)
+
+	// soft-delete flags and timestamps are kept
+	users := walkRecords(t, to, RecordUser)
+	require.False(t, users[0].(*User).isDeleted())
+	require.True(t, users[1].(*User).isDeleted())
+	tokens, originTokens := walkRecords(t, to, RecordToken), walkRecords(t, from, RecordToken)
+	for idx := range tokens {
+		kp, origin := tokens[idx].(*KeyPair), originTokens[idx].(*KeyPair)
+		require.Equal(t, origin.Token, kp.Token)
+		require.Equal(t, origin.IsDeleted, kp.IsDeleted)
+		require.True(t, origin.CreateTime.Equal(kp.CreateTime))
+	}
+	require.True(t, tokens[1].(*KeyPair).isDeleted())
+	require.NotNil(t, tokens[1].(*KeyPair).DeleteTime)
+	miners, err := to.ListMiners("copy_user_01")
+	require.NoError(t, err)
+	require.Len(t, miners, 1)
+	require.Equal(t, "t01000", miners[0].Miner.Address().String())
+	signers, err := to.ListSigner("copy_user_01")
+	require.NoError(t, err)
+	require.Len(t, signers, 1)
+	limits, err := to.GetRateLimits("copy_user_01", "limit-01")
+	require.NoError(t, err)
+	require.Len(t, limits, 1)
+
+	// and back to badger
+	back, err := NewStore(&config.DBConfig{Type: config.Badger}, t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, CopyRecords(to, back, CopyProgress{}, func(CopyProgress) error { return nil }))
+	backCounts, err := CountRecords(back)
+	require.NoError(t, err)
+	require.Equal(t, counts, backCounts)
+	miners, err = back.ListMiners("copy_user_01")
+	require.NoError(t, err)
+	require.Len(t, miners, 1)
+
+	require.Error(t, to.RestoreRecord(RecordUser, &KeyPair{}))
+}
+
+func walkRecords(t *testing.T, store Store, kind RecordKind) []interface{} {
+	var records []interface{}
+	require.NoError(t, store.WalkRecords(kind, func(record interface{}) error {
+		records = append(records, record)
+		return nil
+	}))
+	return records
+}
@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// Token secrets and private keys of signing keys are encrypted at rest by envelope encryption: each
+// secret is encrypted by its own random data key with aes-256-gcm, and the data key is encrypted by
+// the master key. A sealed secret is
+// `enc:v1:<master key id>:<base64 of sealed data key>:<base64 of sealed secret>`, sealed values
+// are the nonce followed by the ciphertext. Rotating the master key only re-encrypts the data keys.
+const sealedSecretPrefix = "enc:v1:"
+
+var (
+	ErrMasterKeyRequired = xerrors.New("secret is encrypted, master key is required")
+	ErrWrongMasterKey    = xerrors.New("secret is encrypted by another master key")
+)
+
+// IsSealedSecret tells whether secret is encrypted by a `SecretBox`
+func IsSealedSecret(secret string) bool {
+	return strings.HasPrefix(secret, sealedSecretPrefix)
+}
+
+// SecretBox encrypts and decrypts token secrets with a master key
+type SecretBox struct {
+	id   string
+	aead cipher.AEAD
+}
+
+func NewSecretBox(masterKey []byte) (*SecretBox, error) {
+	aead, err := newGCM(masterKey)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid master key: %w", err)
+	}
+	sum := sha256.Sum256(masterKey)
+	return &SecretBox{id: hex.EncodeToString(sum[:8]), aead: aead}, nil
+}
+
+// ID identifies the master key without revealing it
+func (b *SecretBox) ID() string {
+	return b.id
+}
+
+// Seal encrypts secret with a new data key
+func (b *SecretBox) Seal(secret string) (string, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealedKey, err := seal(b.aead, dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealedSecret, err := seal(aead, []byte(secret))
+	if err != nil {
+		return "", err
+	}
+	return sealedSecretPrefix + b.id + ":" + sealedKey + ":" + sealedSecret, nil
+}
+
+// Open decrypts a secret sealed by `Seal`, plain secrets are returned as they are
+func (b *SecretBox) Open(secret string) (string, error) {
+	if !IsSealedSecret(secret) {
+		return secret, nil
+	}
+	if b == nil {
+		return "", ErrMasterKeyRequired
+	}
+	dataKey, sealedSecret, err := b.openDataKey(secret)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plain, err := open(aead, sealedSecret)
+	if err != nil {
+		return "", xerrors.Errorf("decrypt secret: %w", err)
+	}
+	return string(plain), nil
+}
+
+// Rewrap re-encrypts the data key of a secret sealed by `from` with the master key of b,
+// plain secrets are sealed, secrets already sealed by b are returned as they are.
+func (b *SecretBox) Rewrap(from *SecretBox, secret string) (string, error) {
+	if !IsSealedSecret(secret) {
+		return b.Seal(secret)
+	}
+	id, _, _ := parseSealedSecret(secret)
+	if id == b.id {
+		return secret, nil
+	}
+	if from == nil {
+		return "", ErrMasterKeyRequired
+	}
+	dataKey, sealedSecret, err := from.openDataKey(secret)
+	if err != nil {
+		return "", err
+	}
+	sealedKey, err := seal(b.aead, dataKey)
+	if err != nil {
+		return "", err
+	}
+	return sealedSecretPrefix + b.id + ":" + sealedKey + ":" + sealedSecret, nil
+}
+
+func (b *SecretBox) openDataKey(secret string) ([]byte, string, error) {
+	id, sealedKey, sealedSecret := parseSealedSecret(secret)
+	if len(sealedSecret) == 0 {
+		return nil, "", errors.New("malformed encrypted secret")
+	}
+	if id != b.id {
+		return nil, "", fmt.Errorf("master key id %s, got %s: %w", id, b.id, ErrWrongMasterKey)
+	}
+	dataKey, err := open(b.aead, sealedKey)
+	if err != nil {
+		return nil, "", xerrors.Errorf("decrypt data key: %w", err)
+	}
+	return dataKey, sealedSecret, nil
+}
+
+// parseSealedSecret returns empty strings if secret is malformed
+func parseSealedSecret(secret string) (id, sealedKey, sealedSecret string) {
+	parts := strings.Split(strings.TrimPrefix(secret, sealedSecretPrefix), ":")
+	if len(parts) != 3 {
+		return "", "", ""
+	}
+	return parts[0], parts[1], parts[2]
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plain []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plain, nil)), nil
+}
+
+func open(aead cipher.AEAD, sealed string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("encrypted value is too short")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+}
+
+// RekeySecrets re-encrypts the secrets of all tokens, soft-deleted ones included, and the private keys
+// of all signing keys with the master key of `to`, plain ones are encrypted, `from` is the current master
+// key which is nil if there is none. It returns the count of tokens and signing keys updated, running it
+// again after a failure continues the work.
+func RekeySecrets(store Store, from, to *SecretBox) (int64, error) {
+	var kps []*KeyPair
+	if err := store.WalkRecords(RecordToken, func(record interface{}) error {
+		kp := record.(*KeyPair)
+		if len(kp.Secret) == 0 {
+			return nil
+		}
+		secret, err := to.Rewrap(from, kp.Secret)
+		if err != nil {
+			return xerrors.Errorf("token of %s: %w", kp.Name, err)
+		}
+		if secret != kp.Secret {
+			kp.Secret = secret
+			kps = append(kps, kp)
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	var sks []*SigningKey
+	if err := store.WalkRecords(RecordSigningKey, func(record interface{}) error {
+		sk := record.(*SigningKey)
+		privateKey, err := to.Rewrap(from, sk.PrivateKey)
+		if err != nil {
+			return xerrors.Errorf("signing key %s: %w", sk.Kid, err)
+		}
+		if privateKey != sk.PrivateKey {
+			sk.PrivateKey = privateKey
+			sks = append(sks, sk)
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	for idx, kp := range kps {
+		if err := store.UpdateToken(kp); err != nil {
+			return int64(idx), xerrors.Errorf("update token of %s: %w", kp.Name, err)
+		}
+	}
+	for idx, sk := range sks {
+		if err := store.PutSigningKey(sk); err != nil {
+			return int64(len(kps) + idx), xerrors.Errorf("update signing key %s: %w", sk.Kid, err)
+		}
+	}
+	return int64(len(kps) + len(sks)), nil
+}
+
+// EncryptSecrets encrypts the plain secrets of all tokens and signing keys with the master key of box
+func EncryptSecrets(store Store, box *SecretBox) (int64, error) {
+	return RekeySecrets(store, box, box)
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+)
+
+func newTestSecretBox(t *testing.T) *SecretBox {
+	key, err := config.RandSecret()
+	require.NoError(t, err)
+	box, err := NewSecretBox(key)
+	require.NoError(t, err)
+	return box
+}
+
+func TestSecretBox(t *testing.T) {
+	box := newTestSecretBox(t)
+	other := newTestSecretBox(t)
+	secret := hex.EncodeToString(make([]byte, 32))
+
+	sealed, err := box.Seal(secret)
+	require.NoError(t, err)
+	require.True(t, IsSealedSecret(sealed))
+	// it must fit the secret column
+	require.LessOrEqual(t, len(sealed), 255)
+	plain, err := box.Open(sealed)
+	require.NoError(t, err)
+	require.Equal(t, secret, plain)
+
+	plain, err = box.Open(secret)
+	require.NoError(t, err)
+	require.Equal(t, secret, plain)
+
+	_, err = other.Open(sealed)
+	require.ErrorIs(t, err, ErrWrongMasterKey)
+	var nilBox *SecretBox
+	_, err = nilBox.Open(sealed)
+	require.ErrorIs(t, err, ErrMasterKeyRequired)
+
+	rewrapped, err := other.Rewrap(box, sealed)
+	require.NoError(t, err)
+	plain, err = other.Open(rewrapped)
+	require.NoError(t, err)
+	require.Equal(t, secret, plain)
+	_, err = box.Open(rewrapped)
+	require.ErrorIs(t, err, ErrWrongMasterKey)
+}
+
+func TestRekeySecrets(t *testing.T) {
+	for _, cnf := range []*config.DBConfig{{Type: config.Badger}, {Type: config.Sqlite}} {
+		t.Run(cnf.Type, func(t *testing.T) {
+			store, err := NewStore(cnf, t.TempDir())
+			require.NoError(t, err)
+			if sqlite, ok := store.(*sqliteStore); ok {
+				defer func() {
+					require.NoError(t, closeSQLiteStore(sqlite))
+				}()
+			}
+			fillRecords(t, store)
+
+			box := newTestSecretBox(t)
+			count, err := EncryptSecrets(store, box)
+			require.NoError(t, err)
+			// the soft-deleted token and the signing key are encrypted too
+			require.Equal(t, int64(3), count)
+
+			newBox := newTestSecretBox(t)
+			_, err = RekeySecrets(store, nil, newBox)
+			require.ErrorIs(t, err, ErrMasterKeyRequired)
+			count, err = RekeySecrets(store, box, newBox)
+			require.NoError(t, err)
+			require.Equal(t, int64(3), count)
+			count, err = RekeySecrets(store, box, newBox)
+			require.NoError(t, err)
+			require.Equal(t, int64(0), count)
+
+			for _, record := range walkRecords(t, store, RecordToken) {
+				kp := record.(*KeyPair)
+				plain, err := newBox.Open(kp.Secret)
+				require.NoError(t, err)
+				require.Equal(t, "secret", plain)
+			}
+			for _, record := range walkRecords(t, store, RecordSigningKey) {
+				sk := record.(*SigningKey)
+				plain, err := newBox.Open(sk.PrivateKey)
+				require.NoError(t, err)
+				require.Equal(t, "00", plain)
+			}
+		})
+	}
+}
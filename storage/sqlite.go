@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+)
+
+// sqliteDBFile is the database file in the data path if `DSN` is not configured
+const sqliteDBFile = "sophon-auth.db"
+
+// sqliteStore shares the models and queries of mysqlStore, which are portable to sqlite,
+// single-node deployments could query data with sql without running mysql.
+type sqliteStore struct {
+	*mysqlStore
+}
+
+func newSQLiteStore(cnf *config.DBConfig, dataPath string) (Store, error) {
+	dsn := cnf.DSN
+	if len(dsn) == 0 {
+		if err := os.MkdirAll(dataPath, 0o755); err != nil {
+			return nil, err
+		}
+		// wait for the lock rather than failing at once when writing concurrently
+		dsn = filepath.Join(dataPath, sqliteDBFile) + "?_busy_timeout=5000&_journal_mode=WAL"
+	}
+	db, err := gorm.Open(&sqliteDialector{Dialector: sqlite.Open(dsn).(*sqlite.Dialector)})
+	if err != nil {
+		return nil, xerrors.Errorf("[db connection failed] Database name: %s %w", dsn, err)
+	}
+	if cnf.Debug {
+		db = db.Debug()
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(cnf.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cnf.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cnf.MaxLifeTime)
+	sqlDB.SetConnMaxIdleTime(cnf.MaxIdleTime)
+
+	if err = autoMigrate(db.Session(&gorm.Session{})); err != nil {
+		return nil, err
+	}
+	return &sqliteStore{mysqlStore: &mysqlStore{db: db}}, nil
+}
+
+// sqliteDialector creates indexes without the index types of mysql, eg. `USING btree`, which sqlite doesn't support
+type sqliteDialector struct {
+	*sqlite.Dialector
+}
+
+// DataTypeOf maps the mysql `datetime(6)` to `datetime`, the declared type by which the driver parses times
+func (d *sqliteDialector) DataTypeOf(field *schema.Field) string {
+	dataType := d.Dialector.DataTypeOf(field)
+	if strings.HasPrefix(strings.ToLower(dataType), "datetime(") {
+		return "datetime"
+	}
+	return dataType
+}
+
+func (d *sqliteDialector) Migrator(db *gorm.DB) gorm.Migrator {
+	m := d.Dialector.Migrator(db).(sqlite.Migrator)
+	m.Dialector = d
+	return sqliteMigrator{Migrator: m}
+}
+
+type sqliteMigrator struct {
+	sqlite.Migrator
+}
+
+func (m sqliteMigrator) CreateIndex(value interface{}, name string) error {
+	return m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		idx := stmt.Schema.LookIndex(name)
+		if idx == nil {
+			return fmt.Errorf("failed to create index with name %v", name)
+		}
+		opts := m.BuildIndexOptions(idx.Fields, stmt)
+		values := []interface{}{clause.Column{Name: idx.Name}, clause.Table{Name: stmt.Table}, opts}
+
+		createIndexSQL := "CREATE "
+		if idx.Class != "" {
+			createIndexSQL += idx.Class + " "
+		}
+		createIndexSQL += "INDEX ? ON ??"
+		if idx.Where != "" {
+			createIndexSQL += " WHERE " + idx.Where
+		}
+		return m.DB.Exec(createIndexSQL, values...).Error
+	})
+}
@@ -1,12 +1,16 @@
 package storage
 
 import (
+	"crypto/sha256"
 	"database/sql/driver"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/dgraph-io/badger/v3"
 	"gorm.io/gorm"
 
 	"golang.org/x/xerrors"
@@ -18,6 +22,11 @@ import (
 	"github.com/ipfs-force-community/sophon-auth/log"
 )
 
+// IsNotFound tells whether err is returned by a store for a missing or deleted object
+func IsNotFound(err error) bool {
+	return errors.Is(err, badger.ErrKeyNotFound) || errors.Is(err, gorm.ErrRecordNotFound)
+}
+
 func NewStore(cnf *config.DBConfig, dataPath string) (Store, error) {
 	var store Store
 	var err error
@@ -28,6 +37,12 @@ func NewStore(cnf *config.DBConfig, dataPath string) (Store, error) {
 	case config.Badger:
 		log.Warn("badger storage")
 		store, err = newBadgerStore(dataPath)
+	case config.Sqlite:
+		log.Warn("sqlite storage")
+		store, err = newSQLiteStore(cnf, dataPath)
+	case config.Postgres:
+		log.Warn("postgres storage")
+		store, err = newPostgresStore(cnf)
 	default:
 		return nil, fmt.Errorf("the type %s is not currently supported", cnf.Type)
 	}
@@ -38,6 +53,9 @@ func NewStore(cnf *config.DBConfig, dataPath string) (Store, error) {
 	if err = StoreMigrate(store); err != nil {
 		return nil, xerrors.Errorf("migrate store failed:%w", err)
 	}
+	if store, err = withTokenHashing(store, cnf.HashToken); err != nil {
+		return nil, err
+	}
 
 	return store, nil
 }
@@ -52,6 +70,15 @@ type Store interface {
 	Has(token Token) (bool, error)
 	List(skip, limit int64) ([]*KeyPair, error)
 	UpdateToken(kp *KeyPair) error
+	// ListStaleTokens returns at most `limit`(0 means no limit) tokens which were
+	// soft-deleted or expired before `before`
+	ListStaleTokens(before time.Time, limit int64) ([]*KeyPair, error)
+	// PurgeStaleTokens hard-deletes at most `limit` stale tokens, returns the count of deleted tokens
+	PurgeStaleTokens(before time.Time, limit int64) (int64, error)
+	// TokensByPrefix returns at most `limit`(0 means no limit) tokens starting with prefix, soft-deleted ones included
+	TokensByPrefix(prefix Token, limit int64) ([]*KeyPair, error)
+	// RenameToken replaces the token `old` with kp, which has another token
+	RenameToken(old Token, kp *KeyPair) error
 
 	// user
 	HasUser(name string) (bool, error)
@@ -63,11 +90,61 @@ type Store interface {
 	DeleteUser(name string) error
 	RecoverUser(name string) error
 
+	// signing key
+	PutSigningKey(key *SigningKey) error
+	GetSigningKey(kid string) (*SigningKey, error)
+	ListSigningKeys() ([]*SigningKey, error)
+
+	// role
+	PutRole(role *Role) error
+	GetRole(name string) (*Role, error)
+	ListRoles() ([]*Role, error)
+	DelRole(name string) error
+
+	// refresh token
+	PutRefreshToken(rt *RefreshToken) error
+	GetRefreshToken(token string) (*RefreshToken, error)
+	// UseRefreshToken marks token used at `usedAt`, returns `ErrRefreshTokenUsed` if it was used before
+	UseRefreshToken(token string, usedAt time.Time) error
+	// RenameRefreshToken replaces the refresh token `old` with token
+	RenameRefreshToken(old, token string) error
+	// RevokeRefreshTokens revokes all refresh tokens of family
+	RevokeRefreshTokens(family string) error
+
+	// audit log
+	PutAuditLog(entry *AuditLog) error
+	// ListAuditLogs returns audit logs matching filter in chronological order
+	ListAuditLogs(filter *AuditLogFilter) ([]*AuditLog, error)
+	// LastAuditLog returns the latest audit log, `ErrAuditLogNotFound` if there is none
+	LastAuditLog() (*AuditLog, error)
+
 	// rate limit
 	GetRateLimits(name, id string) ([]*UserRateLimit, error)
 	PutRateLimit(limit *UserRateLimit) (string, error)
 	DelRateLimit(name, id string) error
 
+	// rate limit bucket
+	ListRateLimitBuckets() ([]*RateLimitBucket, error)
+	PutRateLimitBuckets(buckets []*RateLimitBucket) error
+	// PurgeRateLimitBuckets deletes buckets reset before `before`, returns the count of deleted buckets
+	PurgeRateLimitBuckets(before time.Time) (int64, error)
+
+	// rate limit tier
+	PutRateLimitTier(tier *RateLimitTier) error
+	GetRateLimitTier(name string) (*RateLimitTier, error)
+	ListRateLimitTiers() ([]*RateLimitTier, error)
+	DelRateLimitTier(name string) error
+
+	// quota usage
+	// AddQuotaUsages adds `Used` of usages to the stored ones
+	AddQuotaUsages(usages []*QuotaUsage) error
+	// TakeQuotaUsages adds `Used` of usages to the stored ones atomically if none exceeds its quota in `quotas` then,
+	// otherwise nothing is added and the first usage exceeding its quota is returned
+	TakeQuotaUsages(usages []*QuotaUsage, quotas []int64) (*QuotaUsage, error)
+	// ListQuotaUsages returns the quota usages of user `name`, filtered by period and window if they are not empty,
+	// window is ignored without period
+	ListQuotaUsages(name string, period QuotaPeriod, window string) ([]*QuotaUsage, error)
+
 	// miner-user(1-1)
 	// first returned bool, 'miner' is created(true) or updated(false)
 	UpsertMiner(mAddr address.Address, userName string, openMining *bool) (bool, error)
@@ -90,6 +167,13 @@ type Store interface {
 	// all users including the specified signer
 	GetUserBySigner(addr address.Address) ([]*User, error)
 
+	// dump and restore
+	// WalkRecords calls fn with every record of kind as it is stored, soft-deleted ones included,
+	// records are walked in a stable order as long as the store is not modified
+	WalkRecords(kind RecordKind, fn func(record interface{}) error) error
+	// RestoreRecord writes a record got from `WalkRecords` as it is, overwriting the existing one
+	RestoreRecord(kind RecordKind, record interface{}) error
+
 	Version() (uint64, error)
 	MigrateToV1() error
 	MigrateToV2() error
@@ -104,6 +188,12 @@ type KeyPair struct {
 	Token      Token     `gorm:"column:token;type:varchar(512);uniqueIndex:token_token_IDX,type:hash;not null"`
 	CreateTime time.Time `gorm:"column:createTime;type:datetime;NOT NULL"`
 	IsDeleted  int       `gorm:"column:is_deleted;index;default:0;NOT NULL"`
+	// ExpireTime is nil if the token never expires
+	ExpireTime *time.Time `gorm:"column:expire_time;type:datetime;index"`
+	// DeleteTime records when the token was soft-deleted
+	DeleteTime *time.Time `gorm:"column:delete_time;type:datetime"`
+	// UnsignedToken is the token without signature, which is kept to show the claims of a token stored by hash
+	UnsignedToken string `gorm:"column:unsigned_token;type:text"`
 }
 
 func (*KeyPair) TableName() string {
@@ -150,6 +240,23 @@ func (kp *KeyPair) isDeleted() bool {
 
 func (kp *KeyPair) setDeleted() {
 	kp.IsDeleted = core.Deleted
+	now := time.Now()
+	kp.DeleteTime = &now
+}
+
+// isStale returns true if token was expired or soft-deleted before `before`,
+// soft-deleted tokens without delete time are judged by their create time.
+func (kp *KeyPair) isStale(before time.Time) bool {
+	if kp.ExpireTime != nil && kp.ExpireTime.Before(before) {
+		return true
+	}
+	if !kp.isDeleted() {
+		return false
+	}
+	if kp.DeleteTime != nil {
+		return kp.DeleteTime.Before(before)
+	}
+	return kp.CreateTime.Before(before)
 }
 
 type User struct {
@@ -160,6 +267,8 @@ type User struct {
 	CreateTime time.Time      `gorm:"column:createTime;type:datetime;NOT NULL"`
 	UpdateTime time.Time      `gorm:"column:updateTime;type:datetime;NOT NULL"`
 	IsDeleted  int            `gorm:"column:is_deleted;index;default:0;NOT NULL"`
+	// RateLimitTier is the tier whose rules the user inherits, empty for none
+	RateLimitTier string `gorm:"column:rate_limit_tier;type:varchar(50)"`
 }
 
 type OrmTimestamp struct {
@@ -220,8 +329,14 @@ func (sa storedAddress) String() string {
 }
 
 func (sa *storedAddress) Scan(value interface{}) error {
-	val, isok := value.([]byte)
-	if !isok {
+	var val []byte
+	switch v := value.(type) {
+	case []byte:
+		val = v
+	case string:
+		// sqlite returns text as string
+		val = []byte(v)
+	default:
 		return xerrors.New("non-string types unsupported")
 	}
 	var str string
@@ -330,6 +445,235 @@ func (s *StoreVersion) Bytes() ([]byte, error) {
 	return json.Marshal(s)
 }
 
+// SigningKey is a server-held asymmetric key used to sign tokens
+type SigningKey struct {
+	Kid string `gorm:"column:kid;type:varchar(64);primary_key"`
+	// Alg is the name of jwt algorithm, eg: Ed25519, ES256
+	Alg string `gorm:"column:alg;type:varchar(32);NOT NULL"`
+	// PrivateKey is hex encoded private key
+	PrivateKey string               `gorm:"column:private_key;type:varchar(512);NOT NULL"`
+	State      core.SigningKeyState `gorm:"column:state;type:tinyint(4);default:0;NOT NULL"`
+	CreateTime time.Time            `gorm:"column:createTime;type:datetime;NOT NULL"`
+	// RetireTime is when a verify-only key stops verifying tokens
+	RetireTime *time.Time `gorm:"column:retire_time;type:datetime"`
+}
+
+func (*SigningKey) TableName() string {
+	return "signing_keys"
+}
+
+func (k *SigningKey) key() []byte {
+	return signingKeyKey(k.Kid)
+}
+
+func (k *SigningKey) Bytes() ([]byte, error) {
+	return json.Marshal(k)
+}
+
+func (k *SigningKey) FromBytes(buf []byte) error {
+	return json.Unmarshal(buf, k)
+}
+
+// ErrRoleNotFound is returned by `GetRole` and `DelRole` if the role doesn't exist
+var ErrRoleNotFound = xerrors.New("role not found")
+
+// Role is a named set of permissions defined by administrators
+type Role struct {
+	Name string `gorm:"column:name;type:varchar(50);primary_key"`
+	// Perm is the legacy permission granted by the role
+	Perm       string     `gorm:"column:perm;type:varchar(50);NOT NULL"`
+	Scopes     StringList `gorm:"column:scopes;type:varchar(1024)"`
+	Comment    string     `gorm:"column:comment;type:varchar(255);"`
+	CreateTime time.Time  `gorm:"column:createTime;type:datetime;NOT NULL"`
+	UpdateTime time.Time  `gorm:"column:updateTime;type:datetime;NOT NULL"`
+}
+
+func (*Role) TableName() string {
+	return "roles"
+}
+
+func (r *Role) key() []byte {
+	return roleKey(r.Name)
+}
+
+func (r *Role) Bytes() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+func (r *Role) FromBytes(buf []byte) error {
+	return json.Unmarshal(buf, r)
+}
+
+var (
+	ErrRefreshTokenNotFound = xerrors.New("refresh token not found")
+	ErrRefreshTokenUsed     = xerrors.New("refresh token has been used")
+)
+
+// RefreshToken is exchanged for a new access token and a new refresh token, which replaces it.
+type RefreshToken struct {
+	Token string `gorm:"column:token;type:varchar(128);primary_key"`
+	// Family is shared by all refresh tokens rotated from the same one
+	Family string     `gorm:"column:family;type:varchar(64);index;NOT NULL"`
+	Name   string     `gorm:"column:name;type:varchar(50);NOT NULL"`
+	Perm   string     `gorm:"column:perm;type:varchar(50);NOT NULL"`
+	Role   string     `gorm:"column:role;type:varchar(50)"`
+	Scopes StringList `gorm:"column:scopes;type:varchar(1024)"`
+	Extra  string     `gorm:"column:extra;type:varchar(255)"`
+	// AccessTTL is the lifetime of the access tokens issued with the refresh token
+	AccessTTL  time.Duration `gorm:"column:access_ttl;type:bigint;NOT NULL"`
+	CreateTime time.Time     `gorm:"column:createTime;type:datetime;NOT NULL"`
+	// ExpireTime is inherited by rotated refresh tokens, nil if the family never expires
+	ExpireTime *time.Time `gorm:"column:expire_time;type:datetime"`
+	// UsedTime is set once the refresh token is exchanged, it must not be used again
+	UsedTime *time.Time `gorm:"column:used_time;type:datetime"`
+	Revoked  bool       `gorm:"column:revoked;default:false;NOT NULL"`
+}
+
+func (*RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+func (rt *RefreshToken) key() []byte {
+	return refreshTokenKey(rt.Token)
+}
+
+func (rt *RefreshToken) Bytes() ([]byte, error) {
+	return json.Marshal(rt)
+}
+
+func (rt *RefreshToken) FromBytes(buf []byte) error {
+	return json.Unmarshal(buf, rt)
+}
+
+// ErrAuditLogNotFound is returned by `LastAuditLog` if there is no audit log
+var ErrAuditLogNotFound = xerrors.New("audit log not found")
+
+// AuditLog records who changed what through the api of sophon-auth
+type AuditLog struct {
+	Id     string    `gorm:"column:id;type:varchar(64);primary_key"`
+	Time   time.Time `gorm:"column:time;type:datetime(6);index;NOT NULL"`
+	Actor  string    `gorm:"column:actor;type:varchar(50);index"`
+	Action string    `gorm:"column:action;type:varchar(50);index;NOT NULL"`
+	Target string    `gorm:"column:target;type:varchar(255)"`
+	IP     string    `gorm:"column:ip;type:varchar(64)"`
+	// Result is "success" or "failure", `Error` tells why it failed
+	Result string `gorm:"column:result;type:varchar(16);NOT NULL"`
+	Error  string `gorm:"column:error;type:varchar(1024)"`
+	// PrevHash is the `Hash` of the previous audit log, chaining audit logs up so that
+	// editing, inserting or deleting any of them breaks the chain
+	PrevHash string `gorm:"column:prev_hash;type:varchar(64)"`
+	Hash     string `gorm:"column:hash;type:varchar(64)"`
+}
+
+// sizes of the varchar columns of audit logs in characters
+const (
+	auditActorSize  = 50
+	auditActionSize = 50
+	auditTargetSize = 255
+	auditIPSize     = 64
+	auditErrorSize  = 1024
+)
+
+// truncateString cuts s to at most size characters, marking the cut with "..."
+func truncateString(s string, size int) string {
+	runes := []rune(s)
+	if len(runes) <= size {
+		return s
+	}
+	return string(runes[:size-3]) + "..."
+}
+
+// Truncate cuts the fields of the audit log to the sizes of their columns, it must be called before
+// `ComputeHash`, otherwise the row is rejected or truncated by database and breaks the chain
+func (l *AuditLog) Truncate() {
+	l.Actor = truncateString(l.Actor, auditActorSize)
+	l.Action = truncateString(l.Action, auditActionSize)
+	l.Target = truncateString(l.Target, auditTargetSize)
+	l.IP = truncateString(l.IP, auditIPSize)
+	l.Error = truncateString(l.Error, auditErrorSize)
+}
+
+// ComputeHash hashes all fields of the audit log except `Hash`, `Time` is hashed in microseconds,
+// which is the precision of mysql.
+func (l *AuditLog) ComputeHash() string {
+	buf, _ := json.Marshal([]interface{}{
+		l.PrevHash, l.Id, l.Time.UnixMicro(), l.Actor, l.Action, l.Target, l.IP, l.Result, l.Error,
+	})
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+func (*AuditLog) TableName() string {
+	return "audit_logs"
+}
+
+func (l *AuditLog) key() []byte {
+	return auditLogKey(l.Time, l.Id)
+}
+
+func (l *AuditLog) Bytes() ([]byte, error) {
+	return json.Marshal(l)
+}
+
+func (l *AuditLog) FromBytes(buf []byte) error {
+	return json.Unmarshal(buf, l)
+}
+
+// AuditLogFilter filters audit logs, zero values match all
+type AuditLogFilter struct {
+	// Start and End bound `Time` in [Start, End)
+	Start, End time.Time
+	Actor      string
+	Action     string
+	Skip       int64
+	Limit      int64
+}
+
+func (f *AuditLogFilter) match(l *AuditLog) bool {
+	if !f.Start.IsZero() && l.Time.Before(f.Start) {
+		return false
+	}
+	if !f.End.IsZero() && !l.Time.Before(f.End) {
+		return false
+	}
+	if len(f.Actor) != 0 && l.Actor != f.Actor {
+		return false
+	}
+	if len(f.Action) != 0 && l.Action != f.Action {
+		return false
+	}
+	return true
+}
+
+// StringList is stored as a json array in mysql
+type StringList []string
+
+func (sl *StringList) Scan(value interface{}) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	case nil:
+	default:
+		return xerrors.Errorf("failed to unmarshal string list: %v", value)
+	}
+	if len(bytes) == 0 {
+		*sl = nil
+		return nil
+	}
+	return json.Unmarshal(bytes, sl)
+}
+
+func (sl StringList) Value() (driver.Value, error) {
+	if sl == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(sl)
+	return string(b), err
+}
+
 // we are perpose to support limit user requests with `Service`/`Service.API` ferther,
 // so we add their declar in `UserRateLimit`
 type UserRateLimit struct {
@@ -338,6 +682,12 @@ type UserRateLimit struct {
 	Service  string   `gorm:"column:service;type:varchar(50);index:user_service_api_IDX"`
 	API      string   `gorm:"column:api;type:varchar(50);index:user_service_api_IDX"`
 	ReqLimit ReqLimit `gorm:"column:reqLimit;type:varchar(256)"`
+	// Quota caps the requests in calendar windows, which is counted besides `ReqLimit`
+	Quota Quota `gorm:"column:quota;type:varchar(256)"`
+	// Token is the fingerprint of the token the limit applies to, empty for all tokens of the user
+	Token string `gorm:"column:token;type:varchar(64)"`
+	// Tier is the tier the limit is inherited from, it's never stored
+	Tier string `gorm:"-"`
 }
 
 func (l *UserRateLimit) LimitKey() string {
@@ -350,8 +700,15 @@ type ReqLimit struct {
 }
 
 func (rl *ReqLimit) Scan(value interface{}) error {
-	bytes, ok := value.([]byte)
-	if !ok {
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		// pgx returns varchar as string
+		bytes = []byte(v)
+	case nil:
+	default:
 		return xerrors.Errorf("failed to unmarshal JSONB value: %v", value)
 	}
 	if len(bytes) == 0 {
@@ -365,6 +722,35 @@ func (rl ReqLimit) Value() (driver.Value, error) {
 	return json.Marshal(rl)
 }
 
+// RateLimitBucket is the budget of a rate limit used in the current window, buckets are saved
+// so that budgets survive restarts. They are transient, so they are not records to dump or copy.
+type RateLimitBucket struct {
+	// Key is the user and the id of the rate limit, see `RateLimitBucketKey`
+	Key     string    `gorm:"column:bucket_key;type:varchar(128);primary_key"`
+	Used    int64     `gorm:"column:used;NOT NULL"`
+	ResetAt time.Time `gorm:"column:reset_at;type:datetime;index;NOT NULL"`
+}
+
+func RateLimitBucketKey(name, limitID string) string {
+	return name + ":" + limitID
+}
+
+func (*RateLimitBucket) TableName() string {
+	return "rate_limit_buckets"
+}
+
+func (b *RateLimitBucket) key() []byte {
+	return rateLimitBucketKey(b.Key)
+}
+
+func (b *RateLimitBucket) Bytes() ([]byte, error) {
+	return json.Marshal(b)
+}
+
+func (b *RateLimitBucket) FromBytes(buf []byte) error {
+	return json.Unmarshal(buf, b)
+}
+
 type mapedRatelimit map[string]*UserRateLimit
 
 // todo: should think about if `mapedRatelimte` is empty?
@@ -416,4 +802,9 @@ var (
 	_ iBadgerObj = (*KeyPair)(nil)
 	_ iBadgerObj = (*mapedRatelimit)(nil)
 	_ iBadgerObj = (*StoreVersion)(nil)
+	_ iBadgerObj = (*SigningKey)(nil)
+	_ iBadgerObj = (*Role)(nil)
+	_ iBadgerObj = (*RefreshToken)(nil)
+	_ iBadgerObj = (*AuditLog)(nil)
+	_ iBadgerObj = (*RateLimitTier)(nil)
 )
@@ -27,7 +27,7 @@ var (
 // badgerstore: go test -v ./storage/ -test.run TestStore --args -db=badger
 // mysqlstore : go test -v ./storage/ -test.run TestStore --args -db=mysql -dns='root:ko2005@tcp(127.0.0.1:3306)/venus_auth?charset=utf8mb4&parseTime=True&loc=Local&timeout=10s'
 func TestMain(m *testing.M) {
-	flag.StringVar(&cfg.Type, "db", "badger", "mysql or badger")
+	flag.StringVar(&cfg.Type, "db", "badger", "mysql, postgres, sqlite or badger")
 	flag.StringVar(&cfg.DSN, "dns", "", "sql connection string or badger data path")
 
 	flag.Parse()
@@ -131,7 +131,9 @@ func testDeleteUser(t *testing.T) {
 	require.Error(t, theStore.DeleteUser(userName))
 
 	_, err = theStore.GetUser(userName)
-	require.Error(t, err)
+	require.True(t, IsNotFound(err))
+	_, err = theStore.GetUser("test_user_not_exist")
+	require.True(t, IsNotFound(err))
 
 	finalMiner := address.Address{}
 	for miner := range miners {
@@ -198,9 +200,9 @@ func testDelMiners(t *testing.T) {
 	for userName, miners := range userMiners {
 		for m := range miners {
 			addr, _ := address.NewFromString(m)
-			_, err := theStore.DelMiner(addr)
-			if userName == "test_user_001" { // already deleted user, expect an error
-				require.Error(t, err)
+			deleted, err := theStore.DelMiner(addr)
+			if userName == "test_user_001" { // already deleted user, expect an error(badger) or nothing deleted(sql)
+				require.True(t, err != nil || !deleted)
 			} else {
 				require.NoError(t, err)
 			}
@@ -355,6 +357,68 @@ func testTokens(t *testing.T) {
 	}
 }
 
+func testStaleTokens(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+	newKp := func(name string, expire *time.Time) *KeyPair {
+		return &KeyPair{
+			Name:       name,
+			Perm:       "read",
+			Secret:     "d6234bf3f14a568a9c8315a6ee4f474e380beb2b65a64e6ba0142df72b454f4e",
+			Token:      Token("stale-token-" + name),
+			CreateTime: past,
+			ExpireTime: expire,
+		}
+	}
+	expired := newKp("expired", &past)
+	deleted := newKp("deleted", nil)
+	notExpired := newKp("not-expired", &future)
+	for _, kp := range []*KeyPair{expired, deleted, notExpired} {
+		require.NoError(t, theStore.Put(kp))
+	}
+	require.NoError(t, theStore.Delete(deleted.Token))
+
+	staleTokens := func(before time.Time) map[Token]struct{} {
+		kps, err := theStore.ListStaleTokens(before, 0)
+		require.NoError(t, err)
+		res := make(map[Token]struct{}, len(kps))
+		for _, kp := range kps {
+			res[kp.Token] = struct{}{}
+		}
+		return res
+	}
+
+	// the token just deleted is kept within retention
+	stale := staleTokens(now)
+	require.Contains(t, stale, expired.Token)
+	require.NotContains(t, stale, deleted.Token)
+	require.NotContains(t, stale, notExpired.Token)
+
+	stale = staleTokens(time.Now().Add(time.Minute))
+	require.Contains(t, stale, expired.Token)
+	require.Contains(t, stale, deleted.Token)
+	require.NotContains(t, stale, notExpired.Token)
+
+	kps, err := theStore.ListStaleTokens(time.Now().Add(time.Minute), 1)
+	require.NoError(t, err)
+	require.Len(t, kps, 1)
+
+	count, err := theStore.PurgeStaleTokens(time.Now().Add(time.Minute), 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+	count, err = theStore.PurgeStaleTokens(time.Now().Add(time.Minute), 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+	require.Len(t, staleTokens(time.Now().Add(time.Minute)), 0)
+
+	// purged tokens can not be recovered any more
+	require.Error(t, theStore.Recover(deleted.Token))
+	has, err := theStore.Has(notExpired.Token)
+	require.NoError(t, err)
+	require.True(t, has)
+}
+
 func testRatelimit(t *testing.T) {
 	for _, l := range originLimits {
 		_, err := theStore.PutRateLimit(l)
@@ -370,6 +434,245 @@ func testRatelimit(t *testing.T) {
 	require.Error(t, theStore.DelRateLimit("", ""))
 }
 
+func testRoles(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	roles := []*Role{
+		{Name: "market-operator", Perm: core.PermWrite, Scopes: StringList{"market:write"}, CreateTime: now, UpdateTime: now},
+		{Name: "wallet-signer", Perm: core.PermSign, Scopes: StringList{"wallet:sign"}, CreateTime: now, UpdateTime: now},
+	}
+	for _, role := range roles {
+		require.NoError(t, theStore.PutRole(role))
+		res, err := theStore.GetRole(role.Name)
+		require.NoError(t, err)
+		require.Equal(t, role.Scopes, res.Scopes)
+		require.Equal(t, role.Perm, res.Perm)
+	}
+	list, err := theStore.ListRoles()
+	require.NoError(t, err)
+	require.Len(t, list, len(roles))
+
+	roles[0].Scopes = StringList{"market:read"}
+	require.NoError(t, theStore.PutRole(roles[0]))
+	res, err := theStore.GetRole(roles[0].Name)
+	require.NoError(t, err)
+	require.Equal(t, roles[0].Scopes, res.Scopes)
+
+	for _, role := range roles {
+		require.NoError(t, theStore.DelRole(role.Name))
+		_, err := theStore.GetRole(role.Name)
+		require.ErrorIs(t, err, ErrRoleNotFound)
+	}
+	require.ErrorIs(t, theStore.DelRole("not-exist"), ErrRoleNotFound)
+}
+
+func testRefreshTokens(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	rts := []*RefreshToken{
+		{Token: "refresh-01", Family: "family-01", Name: "user-01", Perm: core.PermRead, AccessTTL: time.Hour, CreateTime: now},
+		{Token: "refresh-02", Family: "family-01", Name: "user-01", Perm: core.PermRead, AccessTTL: time.Hour, CreateTime: now},
+		{Token: "refresh-03", Family: "family-02", Name: "user-02", Perm: core.PermSign, AccessTTL: time.Hour, CreateTime: now},
+	}
+	for _, rt := range rts {
+		require.NoError(t, theStore.PutRefreshToken(rt))
+	}
+	res, err := theStore.GetRefreshToken("refresh-01")
+	require.NoError(t, err)
+	require.Equal(t, rts[0].AccessTTL, res.AccessTTL)
+	require.Nil(t, res.UsedTime)
+	_, err = theStore.GetRefreshToken("not-exist")
+	require.ErrorIs(t, err, ErrRefreshTokenNotFound)
+
+	require.NoError(t, theStore.UseRefreshToken("refresh-01", now))
+	require.ErrorIs(t, theStore.UseRefreshToken("refresh-01", now), ErrRefreshTokenUsed)
+	require.ErrorIs(t, theStore.UseRefreshToken("not-exist", now), ErrRefreshTokenNotFound)
+	res, err = theStore.GetRefreshToken("refresh-01")
+	require.NoError(t, err)
+	require.True(t, now.Equal(*res.UsedTime))
+
+	require.NoError(t, theStore.RevokeRefreshTokens("family-01"))
+	for _, rt := range rts {
+		res, err := theStore.GetRefreshToken(rt.Token)
+		require.NoError(t, err)
+		require.Equal(t, rt.Family == "family-01", res.Revoked)
+	}
+
+	require.NoError(t, theStore.RenameRefreshToken("refresh-03", "refresh-04"))
+	_, err = theStore.GetRefreshToken("refresh-03")
+	require.ErrorIs(t, err, ErrRefreshTokenNotFound)
+	res, err = theStore.GetRefreshToken("refresh-04")
+	require.NoError(t, err)
+	require.Equal(t, "family-02", res.Family)
+	require.ErrorIs(t, theStore.RenameRefreshToken("not-exist", "refresh-05"), ErrRefreshTokenNotFound)
+}
+
+func testAuditLogs(t *testing.T) {
+	_, err := theStore.LastAuditLog()
+	require.ErrorIs(t, err, ErrAuditLogNotFound)
+
+	base := time.Now().Truncate(time.Second)
+	entries := []*AuditLog{
+		{Id: "audit-01", Time: base, Actor: "admin", Action: "user.create", Target: "user-01", Result: "success"},
+		{Id: "audit-02", Time: base.Add(time.Second), Actor: "admin", Action: "token.generate", Target: "user-01", Result: "success"},
+		{Id: "audit-03", Time: base.Add(2 * time.Second), Actor: "ops", Action: "user.create", Target: "user-02", Result: "failure", Error: "user already exists"},
+	}
+	for _, entry := range entries {
+		require.NoError(t, theStore.PutAuditLog(entry))
+	}
+
+	ids := func(logs []*AuditLog) []string {
+		var res []string
+		for _, l := range logs {
+			res = append(res, l.Id)
+		}
+		return res
+	}
+	logs, err := theStore.ListAuditLogs(&AuditLogFilter{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"audit-01", "audit-02", "audit-03"}, ids(logs))
+
+	last, err := theStore.LastAuditLog()
+	require.NoError(t, err)
+	require.Equal(t, "audit-03", last.Id)
+
+	logs, err = theStore.ListAuditLogs(&AuditLogFilter{Start: base.Add(time.Second), End: base.Add(2 * time.Second)})
+	require.NoError(t, err)
+	require.Equal(t, []string{"audit-02"}, ids(logs))
+
+	logs, err = theStore.ListAuditLogs(&AuditLogFilter{Action: "user.create"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"audit-01", "audit-03"}, ids(logs))
+
+	logs, err = theStore.ListAuditLogs(&AuditLogFilter{Actor: "admin", Skip: 1, Limit: 1})
+	require.NoError(t, err)
+	require.Equal(t, []string{"audit-02"}, ids(logs))
+}
+
+func testRateLimitBuckets(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	buckets := []*RateLimitBucket{
+		{Key: RateLimitBucketKey("bucket_user", "limit-01"), Used: 1, ResetAt: now.Add(-time.Minute)},
+		{Key: RateLimitBucketKey("bucket_user", "limit-02"), Used: 2, ResetAt: now.Add(time.Minute)},
+	}
+	require.NoError(t, theStore.PutRateLimitBuckets(buckets))
+	require.NoError(t, theStore.PutRateLimitBuckets(nil))
+	// buckets are overwritten
+	buckets[1].Used = 3
+	require.NoError(t, theStore.PutRateLimitBuckets(buckets[1:]))
+
+	got, err := theStore.ListRateLimitBuckets()
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	used := make(map[string]int64)
+	for _, b := range got {
+		used[b.Key] = b.Used
+	}
+	require.Equal(t, map[string]int64{buckets[0].Key: 1, buckets[1].Key: 3}, used)
+
+	count, err := theStore.PurgeRateLimitBuckets(now)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+	got, err = theStore.ListRateLimitBuckets()
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, buckets[1].Key, got[0].Key)
+	require.True(t, buckets[1].ResetAt.Equal(got[0].ResetAt))
+}
+
+func testQuotaUsages(t *testing.T) {
+	user := "quota_user"
+	day := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, theStore.AddQuotaUsages([]*QuotaUsage{
+		{Name: user, LimitID: "limit-01", Period: QuotaDaily, Window: QuotaWindow(QuotaDaily, day), Used: 1},
+		{Name: user, LimitID: "limit-01", Period: QuotaMonthly, Window: QuotaWindow(QuotaMonthly, day), Used: 1},
+		{Name: user, LimitID: "limit-01", Period: QuotaDaily, Window: QuotaWindow(QuotaDaily, day.AddDate(0, 0, -1)), Used: 5},
+		{Name: user + ":other", LimitID: "limit-02", Period: QuotaDaily, Window: QuotaWindow(QuotaDaily, day), Used: 7},
+	}))
+	require.NoError(t, theStore.AddQuotaUsages(nil))
+	// usages are accumulated
+	require.NoError(t, theStore.AddQuotaUsages([]*QuotaUsage{
+		{Name: user, LimitID: "limit-01", Period: QuotaDaily, Window: "2026-10-17", Used: 2},
+		{Name: user, LimitID: "limit-01", Period: QuotaMonthly, Window: "2026-10", Used: 2},
+	}))
+
+	usages, err := theStore.ListQuotaUsages(user, QuotaDaily, "2026-10-17")
+	require.NoError(t, err)
+	require.Len(t, usages, 1)
+	require.Equal(t, int64(3), usages[0].Used)
+
+	usages, err = theStore.ListQuotaUsages(user, QuotaDaily, "")
+	require.NoError(t, err)
+	require.Len(t, usages, 2)
+	usages, err = theStore.ListQuotaUsages(user, "", "")
+	require.NoError(t, err)
+	require.Len(t, usages, 3)
+	usages, err = theStore.ListQuotaUsages(user, QuotaMonthly, "2026-10")
+	require.NoError(t, err)
+	require.Len(t, usages, 1)
+	require.Equal(t, int64(3), usages[0].Used)
+
+	// quotas are taken only if all of them are enough
+	take := func(used int64) []*QuotaUsage {
+		return []*QuotaUsage{
+			{Name: user, LimitID: "limit-03", Period: QuotaDaily, Window: "2026-10-17", Used: used},
+			{Name: user, LimitID: "limit-03", Period: QuotaMonthly, Window: "2026-10", Used: used},
+		}
+	}
+	exceeded, err := theStore.TakeQuotaUsages(take(2), []int64{3, 10})
+	require.NoError(t, err)
+	require.Nil(t, exceeded)
+	exceeded, err = theStore.TakeQuotaUsages(take(2), []int64{3, 10})
+	require.NoError(t, err)
+	require.Equal(t, QuotaDaily, exceeded.Period)
+	exceeded, err = theStore.TakeQuotaUsages(take(1), []int64{3, 2})
+	require.NoError(t, err)
+	require.Equal(t, QuotaMonthly, exceeded.Period)
+	exceeded, err = theStore.TakeQuotaUsages(take(1), []int64{3, 10})
+	require.NoError(t, err)
+	require.Nil(t, exceeded)
+	for _, period := range QuotaPeriods {
+		usages, err = theStore.ListQuotaUsages(user, period, "")
+		require.NoError(t, err)
+		for _, u := range usages {
+			if u.LimitID == "limit-03" {
+				require.Equal(t, int64(3), u.Used)
+			}
+		}
+	}
+}
+
+func testRateLimitTiers(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	tiers := []*RateLimitTier{
+		{Name: "gold", Rules: RateLimitRules{
+			{Id: "gold-all", ReqLimit: ReqLimit{Cap: 100, ResetDur: time.Minute}},
+			{Id: "gold-market", Service: "market", API: "Deal*", ReqLimit: ReqLimit{Cap: 10, ResetDur: time.Minute}, Quota: Quota{Daily: 1000}},
+		}, CreateTime: now, UpdateTime: now},
+		{Name: "free", Rules: RateLimitRules{}, CreateTime: now, UpdateTime: now},
+	}
+	for _, tier := range tiers {
+		require.NoError(t, theStore.PutRateLimitTier(tier))
+		res, err := theStore.GetRateLimitTier(tier.Name)
+		require.NoError(t, err)
+		require.Equal(t, tier.Rules, res.Rules)
+	}
+	list, err := theStore.ListRateLimitTiers()
+	require.NoError(t, err)
+	require.Len(t, list, len(tiers))
+
+	tiers[1].Rules = RateLimitRules{{Id: "free-all", ReqLimit: ReqLimit{Cap: 1, ResetDur: time.Minute}}}
+	require.NoError(t, theStore.PutRateLimitTier(tiers[1]))
+	res, err := theStore.GetRateLimitTier(tiers[1].Name)
+	require.NoError(t, err)
+	require.Equal(t, tiers[1].Rules, res.Rules)
+
+	for _, tier := range tiers {
+		require.NoError(t, theStore.DelRateLimitTier(tier.Name))
+		_, err := theStore.GetRateLimitTier(tier.Name)
+		require.ErrorIs(t, err, ErrRateLimitTierNotFound)
+	}
+	require.ErrorIs(t, theStore.DelRateLimitTier("not-exist"), ErrRateLimitTierNotFound)
+}
+
 func TestStore(t *testing.T) {
 	// stm: @VENUSAUTH_BADGER_PUT_001, @VENUSAUTH_BADGER_PUT_USER_001, @VENUSAUTH_BADGER_LIST_USERS_001, @VENUSAUTH_BADGER_VERIFY_USERS_001
 	t.Run("add users", testAddUser)
@@ -394,14 +697,46 @@ func TestStore(t *testing.T) {
 
 	// stm: @VENUSAUTH_BADGER_HAS_001, @VENUSAUTH_BADGER_GET_001, @VENUSAUTH_BADGER_BY_NAME_001, @VENUSAUTH_BADGER_LIST_001
 	t.Run("test token", testTokens)
+	t.Run("test stale tokens", testStaleTokens)
 	// stm: @VENUSAUTH_BADGER_GET_RATE_LIMITS_001, @VENUSAUTH_BADGER_DEL_RATE_LIMITS_001, @VENUSAUTH_BADGER_DEL_RATE_LIMITS_002
 	t.Run("test ratelimit", testRatelimit)
+	t.Run("test roles", testRoles)
+	t.Run("test refresh tokens", testRefreshTokens)
+	t.Run("test audit logs", testAuditLogs)
+	t.Run("test rate limit buckets", testRateLimitBuckets)
+	t.Run("test quota usages", testQuotaUsages)
+	t.Run("test rate limit tiers", testRateLimitTiers)
+}
+
+// TestSQLiteStore runs the suite of `TestStore` against sqlite besides the store chosen by `-db`
+func TestSQLiteStore(t *testing.T) {
+	if cfg.Type == config.Sqlite {
+		t.Skip("sqlite is tested by TestStore")
+	}
+	store, err := NewStore(&config.DBConfig{Type: config.Sqlite}, t.TempDir())
+	require.NoError(t, err)
+	origin := theStore
+	theStore = store
+	defer func() {
+		theStore = origin
+		require.NoError(t, closeSQLiteStore(store.(*sqliteStore)))
+	}()
+
+	TestStore(t)
+}
+
+func closeSQLiteStore(s *sqliteStore) error {
+	sqldb, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqldb.Close()
 }
 
 func setup(cfg *config.DBConfig) error {
 	var err error
 	var dataPath string
-	if cfg.Type == "badger" {
+	if cfg.Type == "badger" || cfg.Type == "sqlite" {
 		if dataPath, err = os.MkdirTemp("", "auth-datastore"); err != nil {
 			return err
 		}
@@ -411,6 +746,22 @@ func setup(cfg *config.DBConfig) error {
 }
 
 func shutdown() error {
+	if sqliteStore, isok := theStore.(*sqliteStore); isok {
+		return closeSQLiteStore(sqliteStore)
+	}
+	if pgStore, isok := theStore.(*postgresStore); isok {
+		// drop tables, so that the suite could run against the same database again
+		if err := pgStore.db.Migrator().DropTable(&KeyPair{}, &User{}, &Miner{}, &Signer{}, &UserRateLimit{}, &StoreVersion{},
+			&SigningKey{}, &Role{}, &RefreshToken{}, &AuditLog{}, &RateLimitBucket{}, &QuotaUsage{},
+			&RateLimitTier{}); err != nil {
+			return err
+		}
+		sqldb, err := pgStore.db.DB()
+		if err != nil {
+			return err
+		}
+		return sqldb.Close()
+	}
 	if mysqlStore, isok := theStore.(*mysqlStore); isok {
 		sqldb, err := mysqlStore.db.DB()
 		if err != nil {
@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/ipfs-force-community/sophon-auth/log"
+)
+
+// Tokens are stored by their hash if `DBConfig.HashToken` is set, so that a leaked store exposes no
+// usable token. A hashed token is `sha256:<hex of the sha256 of token>`, the first 16 hex of the hash
+// is the fingerprint of the token which identifies it in listings. Tokens are looked up by hashing them,
+// the token without signature is kept in `KeyPair.UnsignedToken` to show its claims. Refresh tokens are
+// hashed the same way.
+const HashedTokenPrefix = "sha256:"
+
+const fingerprintLen = 16
+
+var ErrTokensHashed = xerrors.New("tokens are stored by hash, hashToken can't be disabled once enabled")
+
+// HashToken returns the hashed token of token, hashed tokens are returned as they are
+func HashToken(token Token) Token {
+	if IsHashedToken(token) {
+		return token
+	}
+	sum := sha256.Sum256(token.Bytes())
+	return Token(HashedTokenPrefix + hex.EncodeToString(sum[:]))
+}
+
+func IsHashedToken(token Token) bool {
+	return strings.HasPrefix(token.String(), HashedTokenPrefix)
+}
+
+// TokenFingerprint returns the fingerprint of a token, which could be hashed or a fingerprint already
+func TokenFingerprint(token string) string {
+	if IsTokenFingerprint(token) {
+		return token
+	}
+	return strings.TrimPrefix(HashToken(Token(token)).String(), HashedTokenPrefix)[:fingerprintLen]
+}
+
+// IsTokenFingerprint tells whether s is a fingerprint rather than a token
+func IsTokenFingerprint(s string) bool {
+	if len(s) != fingerprintLen {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// unsignedToken strips the signature of token
+func unsignedToken(token Token) string {
+	if idx := strings.LastIndex(token.String(), "."); idx > 0 {
+		return token.String()[:idx]
+	}
+	return ""
+}
+
+// hashedTokenStore stores tokens by hash, token arguments could be either tokens or hashed tokens
+type hashedTokenStore struct {
+	Store
+}
+
+var _ Backuper = (*hashedTokenStore)(nil)
+
+// hashKeyPair returns a copy of kp with hashed token
+func hashKeyPair(kp *KeyPair) *KeyPair {
+	if IsHashedToken(kp.Token) {
+		return kp
+	}
+	hashed := *kp
+	hashed.Token = HashToken(kp.Token)
+	hashed.UnsignedToken = unsignedToken(kp.Token)
+	return &hashed
+}
+
+// hashRefreshToken returns a copy of rt with hashed token
+func hashRefreshToken(rt *RefreshToken) *RefreshToken {
+	if IsHashedToken(Token(rt.Token)) {
+		return rt
+	}
+	hashed := *rt
+	hashed.Token = HashToken(Token(rt.Token)).String()
+	return &hashed
+}
+
+func (s *hashedTokenStore) Get(token Token) (*KeyPair, error) {
+	return s.Store.Get(HashToken(token))
+}
+
+func (s *hashedTokenStore) Put(kp *KeyPair) error {
+	return s.Store.Put(hashKeyPair(kp))
+}
+
+func (s *hashedTokenStore) Delete(token Token) error {
+	return s.Store.Delete(HashToken(token))
+}
+
+func (s *hashedTokenStore) Recover(token Token) error {
+	return s.Store.Recover(HashToken(token))
+}
+
+func (s *hashedTokenStore) Has(token Token) (bool, error) {
+	return s.Store.Has(HashToken(token))
+}
+
+func (s *hashedTokenStore) UpdateToken(kp *KeyPair) error {
+	return s.Store.UpdateToken(hashKeyPair(kp))
+}
+
+// RenameToken looks up `old` as it is, so that tokens not hashed yet could be renamed
+func (s *hashedTokenStore) RenameToken(old Token, kp *KeyPair) error {
+	return s.Store.RenameToken(old, hashKeyPair(kp))
+}
+
+func (s *hashedTokenStore) PutRefreshToken(rt *RefreshToken) error {
+	return s.Store.PutRefreshToken(hashRefreshToken(rt))
+}
+
+// GetRefreshToken always hashes token, unlike access tokens hashed refresh tokens are not signed,
+// so a hash got from the store must not work as a refresh token
+func (s *hashedTokenStore) GetRefreshToken(token string) (*RefreshToken, error) {
+	sum := sha256.Sum256([]byte(token))
+	return s.Store.GetRefreshToken(HashedTokenPrefix + hex.EncodeToString(sum[:]))
+}
+
+func (s *hashedTokenStore) UseRefreshToken(token string, usedAt time.Time) error {
+	return s.Store.UseRefreshToken(HashToken(Token(token)).String(), usedAt)
+}
+
+// RenameRefreshToken looks up `old` as it is, so that refresh tokens not hashed yet could be renamed
+func (s *hashedTokenStore) RenameRefreshToken(old, token string) error {
+	return s.Store.RenameRefreshToken(old, HashToken(Token(token)).String())
+}
+
+func (s *hashedTokenStore) RestoreRecord(kind RecordKind, record interface{}) error {
+	switch r := record.(type) {
+	case *KeyPair:
+		if kind == RecordToken {
+			record = hashKeyPair(r)
+		}
+	case *RefreshToken:
+		if kind == RecordRefreshToken {
+			record = hashRefreshToken(r)
+		}
+	}
+	return s.Store.RestoreRecord(kind, record)
+}
+
+func (s *hashedTokenStore) Backup(w io.Writer, since uint64) (uint64, error) {
+	backuper, ok := s.Store.(Backuper)
+	if !ok {
+		return 0, ErrBackupNotSupported
+	}
+	return backuper.Backup(w, since)
+}
+
+// hashTokens replaces the tokens and refresh tokens which are not hashed yet with their hashes,
+// it returns the count of tokens replaced
+func (s *hashedTokenStore) hashTokens() (int64, error) {
+	var kps []*KeyPair
+	if err := s.Store.WalkRecords(RecordToken, func(record interface{}) error {
+		if kp := record.(*KeyPair); !IsHashedToken(kp.Token) {
+			kps = append(kps, kp)
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	var rts []*RefreshToken
+	if err := s.Store.WalkRecords(RecordRefreshToken, func(record interface{}) error {
+		if rt := record.(*RefreshToken); !IsHashedToken(Token(rt.Token)) {
+			rts = append(rts, rt)
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	for idx, kp := range kps {
+		if err := s.RenameToken(kp.Token, kp); err != nil {
+			return int64(idx), xerrors.Errorf("hash token of %s: %w", kp.Name, err)
+		}
+	}
+	for idx, rt := range rts {
+		if err := s.RenameRefreshToken(rt.Token, rt.Token); err != nil {
+			return int64(len(kps) + idx), xerrors.Errorf("hash refresh token of %s: %w", rt.Name, err)
+		}
+	}
+	return int64(len(kps) + len(rts)), nil
+}
+
+// withTokenHashing wraps store to store tokens by hash if enabled, or makes sure no token is hashed
+func withTokenHashing(store Store, enable bool) (Store, error) {
+	if !enable {
+		hashed, err := store.TokensByPrefix(HashedTokenPrefix, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(hashed) != 0 {
+			return nil, ErrTokensHashed
+		}
+		return store, nil
+	}
+
+	hs := &hashedTokenStore{Store: store}
+	count, err := hs.hashTokens()
+	if err != nil {
+		return nil, xerrors.Errorf("hash tokens after %d tokens hashed: %w", count, err)
+	}
+	if count > 0 {
+		log.Infof("%d tokens are replaced by their hashes", count)
+	}
+	return hs, nil
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/sophon-auth/config"
+)
+
+func TestHashTokens(t *testing.T) {
+	for _, cnf := range []*config.DBConfig{{Type: config.Badger}, {Type: config.Sqlite}} {
+		t.Run(cnf.Type, func(t *testing.T) {
+			store, err := NewStore(cnf, t.TempDir())
+			require.NoError(t, err)
+			if sqlite, ok := store.(*sqliteStore); ok {
+				defer func() {
+					require.NoError(t, closeSQLiteStore(sqlite))
+				}()
+			}
+			fillRecords(t, store)
+			counts, err := CountRecords(store)
+			require.NoError(t, err)
+
+			hashed, err := withTokenHashing(store, true)
+			require.NoError(t, err)
+			newCounts, err := CountRecords(hashed)
+			require.NoError(t, err)
+			require.Equal(t, counts, newCounts)
+			for _, record := range walkRecords(t, hashed, RecordToken) {
+				kp := record.(*KeyPair)
+				require.True(t, IsHashedToken(kp.Token))
+				require.Equal(t, "jwt", kp.UnsignedToken)
+			}
+			for _, record := range walkRecords(t, hashed, RecordRefreshToken) {
+				require.True(t, IsHashedToken(Token(record.(*RefreshToken).Token)))
+			}
+			// tokens are hashed only once
+			count, err := hashed.(*hashedTokenStore).hashTokens()
+			require.NoError(t, err)
+			require.Zero(t, count)
+
+			// tokens are looked up by the token or its hash
+			kp, err := hashed.Get("jwt.copy-token-01")
+			require.NoError(t, err)
+			require.Equal(t, "copy-token-01", kp.Name)
+			require.Equal(t, HashToken("jwt.copy-token-01"), kp.Token)
+			_, err = hashed.Get(kp.Token)
+			require.NoError(t, err)
+			has, err := hashed.Has("jwt.copy-token-02")
+			require.NoError(t, err)
+			require.False(t, has)
+			require.NoError(t, hashed.Recover("jwt.copy-token-02"))
+			require.NoError(t, hashed.Put(&KeyPair{Name: "copy-token-03", Token: "jwt.copy-token-03"}))
+			has, err = hashed.Has("jwt.copy-token-03")
+			require.NoError(t, err)
+			require.True(t, has)
+
+			// refresh tokens are looked up by the token only
+			rt, err := hashed.GetRefreshToken("refresh-01")
+			require.NoError(t, err)
+			require.Equal(t, HashToken("refresh-01").String(), rt.Token)
+			require.NoError(t, hashed.UseRefreshToken("refresh-01", time.Now()))
+			require.NoError(t, hashed.PutRefreshToken(&RefreshToken{Token: "refresh-02", Family: "family-01", Name: "copy_user_01"}))
+			_, err = store.GetRefreshToken("refresh-02")
+			require.ErrorIs(t, err, ErrRefreshTokenNotFound)
+			_, err = hashed.GetRefreshToken("refresh-02")
+			require.NoError(t, err)
+			_, err = hashed.GetRefreshToken(rt.Token)
+			require.ErrorIs(t, err, ErrRefreshTokenNotFound)
+
+			fingerprint := TokenFingerprint("jwt.copy-token-01")
+			require.Equal(t, fingerprint, TokenFingerprint(kp.Token.String()))
+			require.True(t, IsTokenFingerprint(fingerprint))
+			kps, err := hashed.TokensByPrefix(Token(HashedTokenPrefix+fingerprint), 2)
+			require.NoError(t, err)
+			require.Len(t, kps, 1)
+			require.Equal(t, kp.Token, kps[0].Token)
+
+			// hashing can't be disabled
+			_, err = withTokenHashing(store, false)
+			require.ErrorIs(t, err, ErrTokensHashed)
+		})
+	}
+}
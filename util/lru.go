@@ -0,0 +1,121 @@
+package util
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU is a size bounded cache which evicts the least recently used entry when full,
+// every entry also expires after its own ttl. It's safe for concurrent use.
+type LRU[K comparable, V any] struct {
+	lk    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[K]*list.Element
+}
+
+type lruEntry[K comparable, V any] struct {
+	key      K
+	val      V
+	expireAt time.Time
+}
+
+func NewLRU[K comparable, V any](size int) *LRU[K, V] {
+	if size <= 0 {
+		size = 1
+	}
+	return &LRU[K, V]{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[K]*list.Element),
+	}
+}
+
+// Get returns the value of key, false if not found or expired
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	var zero V
+	elem, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	entry := elem.Value.(*lruEntry[K, V])
+	if !time.Now().Before(entry.expireAt) {
+		c.removeElement(elem)
+		return zero, false
+	}
+	c.ll.MoveToFront(elem)
+	return entry.val, true
+}
+
+// Add adds or replaces the value of key, which expires after ttl
+func (c *LRU[K, V]) Add(key K, val V, ttl time.Duration) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	expireAt := time.Now().Add(ttl)
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*lruEntry[K, V])
+		entry.val, entry.expireAt = val, expireAt
+		c.ll.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry[K, V]{key: key, val: val, expireAt: expireAt})
+	for c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// Remove removes key, returns false if key not found
+func (c *LRU[K, V]) Remove(key K) bool {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	elem, ok := c.items[key]
+	if ok {
+		c.removeElement(elem)
+	}
+	return ok
+}
+
+// RemoveIf removes all the entries matching `fn`, returns the count of removed entries
+func (c *LRU[K, V]) RemoveIf(fn func(key K, val V) bool) int {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	var count int
+	for elem := c.ll.Front(); elem != nil; {
+		next := elem.Next()
+		entry := elem.Value.(*lruEntry[K, V])
+		if fn(entry.key, entry.val) {
+			c.removeElement(elem)
+			count++
+		}
+		elem = next
+	}
+	return count
+}
+
+// Purge removes all the entries
+func (c *LRU[K, V]) Purge() {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	c.ll.Init()
+	c.items = make(map[K]*list.Element)
+}
+
+// Len returns the count of entries, including the expired ones not evicted yet
+func (c *LRU[K, V]) Len() int {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return c.ll.Len()
+}
+
+func (c *LRU[K, V]) removeElement(elem *list.Element) {
+	c.ll.Remove(elem)
+	delete(c.items, elem.Value.(*lruEntry[K, V]).key)
+}
@@ -0,0 +1,50 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU(t *testing.T) {
+	c := NewLRU[string, int](2)
+
+	c.Add("a", 1, time.Minute)
+	c.Add("b", 2, time.Minute)
+	// `a` becomes the most recently used
+	val, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, val)
+
+	// `b` is evicted
+	c.Add("c", 3, time.Minute)
+	assert.Equal(t, 2, c.Len())
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+
+	// replace
+	c.Add("a", 10, time.Minute)
+	val, ok = c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 10, val)
+
+	// expired
+	c.Add("d", 4, time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	_, ok = c.Get("d")
+	assert.False(t, ok)
+	assert.Equal(t, 1, c.Len())
+
+	assert.True(t, c.Remove("a"))
+	assert.False(t, c.Remove("a"))
+
+	c.Add("e", 5, time.Minute)
+	c.Add("f", 6, time.Minute)
+	assert.Equal(t, 1, c.RemoveIf(func(key string, val int) bool { return val > 5 }))
+	_, ok = c.Get("e")
+	assert.True(t, ok)
+
+	c.Purge()
+	assert.Equal(t, 0, c.Len())
+}